@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/heissanjay/oscode/internal/app"
 	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
 	"github.com/heissanjay/oscode/internal/setup"
 	"github.com/spf13/cobra"
 )
@@ -29,20 +32,25 @@ Supports multiple LLM providers including Anthropic (Claude) and OpenAI.`,
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringP("provider", "P", "", "LLM provider (anthropic, openai)")
-	rootCmd.PersistentFlags().StringP("model", "m", "", "Model to use")
+	rootCmd.PersistentFlags().StringP("provider", "P", "", "LLM provider (anthropic, openai, gemini, ollama or a configured name)")
+	rootCmd.PersistentFlags().StringP("model", "m", "", "Model to use (name, alias or provider/model)")
+	rootCmd.PersistentFlags().String("thinking", "", "Extended thinking (off, low, medium, high or a token budget)")
 	rootCmd.PersistentFlags().BoolP("print", "p", false, "Print mode (non-interactive)")
 	rootCmd.PersistentFlags().BoolP("continue", "c", false, "Continue last conversation")
 	rootCmd.PersistentFlags().StringP("resume", "r", "", "Resume session by ID or name")
 	rootCmd.PersistentFlags().Bool("verbose", false, "Show verbose output")
 	rootCmd.PersistentFlags().String("system-prompt", "", "Custom system prompt")
 	rootCmd.PersistentFlags().String("output-format", "text", "Output format (text, json, stream-json)")
+	rootCmd.PersistentFlags().String("json-schema", "", "Print mode: return the result as JSON matching this schema (inline JSON or a file path)")
+	rootCmd.PersistentFlags().StringArray("image", nil, "Print mode: attach an image to the prompt (repeatable)")
 	rootCmd.PersistentFlags().Int("max-turns", 0, "Maximum agentic turns (0 = unlimited)")
-	rootCmd.PersistentFlags().String("permission-mode", "", "Permission mode (auto, ask, plan)")
+	rootCmd.PersistentFlags().String("permission-mode", "", "Permission mode (auto, acceptEdits, ask, plan)")
 	rootCmd.PersistentFlags().StringSlice("tools", nil, "Enabled tools")
 	rootCmd.PersistentFlags().StringSlice("allowed-tools", nil, "Auto-approved tools")
 	rootCmd.PersistentFlags().StringSlice("disallowed-tools", nil, "Disabled tools")
 	rootCmd.PersistentFlags().Bool("dangerously-skip-permissions", false, "Skip all permission prompts")
+	rootCmd.PersistentFlags().String("record", "", "Record provider exchanges to a fixture file")
+	rootCmd.PersistentFlags().String("replay", "", "Play provider exchanges back from a fixture file instead of calling APIs")
 
 	// Add subcommands
 	rootCmd.AddCommand(configCmd())
@@ -62,15 +70,21 @@ func runApp(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Check if first run / needs setup
-	if setup.NeedsSetup(cfg) {
+	// A provider without API keys, such as a local Ollama, needs no setup
+	if provider, _ := cmd.Flags().GetString("provider"); provider != "" {
+		cfg.DefaultProvider = provider
+	}
+
+	// Check if first run / needs setup. Replays need no API keys.
+	replay, _ := cmd.Flags().GetString("replay")
+	if replay == "" && setup.NeedsSetup(cfg) {
 		result, err := setup.Run(cfg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Setup error: %v\n", err)
 		}
 		if result.Skipped {
 			fmt.Println("Setup skipped. Run 'oscode config setup' to configure later.")
-			fmt.Println("You can also set environment variables: ANTHROPIC_API_KEY or OPENAI_API_KEY")
+			fmt.Println("You can also set environment variables: ANTHROPIC_API_KEY, OPENAI_API_KEY or GEMINI_API_KEY")
 		} else {
 			// Reload config after setup
 			cfg, _ = config.Load()
@@ -80,10 +94,19 @@ func runApp(cmd *cobra.Command, args []string) error {
 	// Apply command line overrides
 	if provider, _ := cmd.Flags().GetString("provider"); provider != "" {
 		cfg.DefaultProvider = provider
+		// The configured model may belong to another provider, so use
+		// the provider's default
+		cfg.DefaultModel = config.GetDefaultModel(provider)
 	}
 	if model, _ := cmd.Flags().GetString("model"); model != "" {
 		cfg.DefaultModel = model
 	}
+	if thinking, _ := cmd.Flags().GetString("thinking"); thinking != "" {
+		if _, _, err := llm.ParseThinking(thinking); err != nil {
+			return err
+		}
+		cfg.Thinking = thinking
+	}
 	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
 		cfg.Verbose = true
 	}
@@ -101,6 +124,26 @@ func runApp(cmd *cobra.Command, args []string) error {
 	continueSession, _ := cmd.Flags().GetBool("continue")
 	resumeSession, _ := cmd.Flags().GetString("resume")
 	skipPermissions, _ := cmd.Flags().GetBool("dangerously-skip-permissions")
+	record, _ := cmd.Flags().GetString("record")
+	if record != "" && replay != "" {
+		return fmt.Errorf("--record and --replay can't be used together")
+	}
+
+	var jsonSchema *llm.ResponseSchema
+	if value, _ := cmd.Flags().GetString("json-schema"); value != "" {
+		if !printMode {
+			return fmt.Errorf("--json-schema requires print mode (-p)")
+		}
+		jsonSchema, err = llm.LoadResponseSchema(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	images, _ := cmd.Flags().GetStringArray("image")
+	if len(images) > 0 && !printMode {
+		return fmt.Errorf("--image requires print mode (-p)")
+	}
 
 	// Get initial prompt if provided
 	var initialPrompt string
@@ -117,11 +160,17 @@ func runApp(cmd *cobra.Command, args []string) error {
 		ContinueSession: continueSession,
 		ResumeSession:   resumeSession,
 		SkipPermissions: skipPermissions,
+		JSONSchema:      jsonSchema,
+		Record:          record,
+		Replay:          replay,
+		Images:          images,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create application: %w", err)
 	}
 
+	defer application.Close()
+
 	return application.Run()
 }
 
@@ -186,17 +235,127 @@ func mcpCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List configured MCP servers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
-			if err != nil {
-				return err
+			cwd, _ := os.Getwd()
+
+			found := false
+			seen := make(map[string]bool)
+			for _, scope := range config.AllScopes {
+				servers, err := config.LoadMCPServers(scope, cwd)
+				if err != nil {
+					return err
+				}
+
+				names := make([]string, 0, len(servers))
+				for name := range servers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					server := servers[name]
+					note := ""
+					if seen[name] {
+						note = " (overridden)"
+					}
+					seen[name] = true
+					found = true
+					fmt.Printf("  %s: %s (%s, %s)%s\n", name, mcpTarget(server), server.Transport, scope, note)
+				}
 			}
-			if len(cfg.MCP.Servers) == 0 {
+
+			if !found {
 				fmt.Println("No MCP servers configured")
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(mcpAddCmd())
+	cmd.AddCommand(mcpServeCmd())
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove an MCP server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, _ := os.Getwd()
+			name := args[0]
+
+			scopeFlag, _ := cmd.Flags().GetString("scope")
+			if scopeFlag != "" {
+				scope, err := config.ParseScope(scopeFlag)
+				if err != nil {
+					return err
+				}
+				if err := config.RemoveMCPServer(scope, cwd, name); err != nil {
+					return err
+				}
+				fmt.Printf("Removed MCP server %s from %s config\n", name, scope)
+				return nil
+			}
+
+			// Without a scope the server must be configured in exactly one
+			var scopes []config.Scope
+			for _, scope := range config.AllScopes {
+				servers, err := config.LoadMCPServers(scope, cwd)
+				if err != nil {
+					return err
+				}
+				if _, ok := servers[name]; ok {
+					scopes = append(scopes, scope)
+				}
+			}
+
+			switch len(scopes) {
+			case 0:
+				return fmt.Errorf("no MCP server named %q", name)
+			case 1:
+				if err := config.RemoveMCPServer(scopes[0], cwd, name); err != nil {
+					return err
+				}
+				fmt.Printf("Removed MCP server %s from %s config\n", name, scopes[0])
 				return nil
+			default:
+				return fmt.Errorf("MCP server %q exists in several scopes (%v); choose one with --scope", name, scopes)
+			}
+		},
+	}
+	removeCmd.Flags().StringP("scope", "s", "", "Scope to remove from (local, project, user)")
+	cmd.AddCommand(removeCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get <name>",
+		Short: "Show details for an MCP server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, _ := os.Getwd()
+			server, scope, ok := config.FindMCPServer(cwd, args[0])
+			if !ok {
+				return fmt.Errorf("no MCP server named %q", args[0])
+			}
+
+			fmt.Printf("%s:\n", args[0])
+			fmt.Printf("  Scope: %s (%s)\n", scope, config.MCPScopePath(scope, cwd))
+			fmt.Printf("  Type: %s\n", server.Transport)
+			if server.URL != "" {
+				fmt.Printf("  URL: %s\n", server.URL)
 			}
-			for name, server := range cfg.MCP.Servers {
-				fmt.Printf("  %s (%s)\n", name, server.Transport)
+			if server.Command != "" {
+				fmt.Printf("  Command: %s\n", server.Command)
 			}
+			if len(server.Args) > 0 {
+				fmt.Printf("  Args: %s\n", strings.Join(server.Args, " "))
+			}
+			for _, key := range sortedKeys(server.Env) {
+				fmt.Printf("  Env: %s=%s\n", key, maskValue(server.Env[key]))
+			}
+			for _, key := range sortedKeys(server.Headers) {
+				fmt.Printf("  Header: %s: %s\n", key, maskValue(server.Headers[key]))
+			}
+			if server.OAuth != nil && server.OAuth.ClientID != "" {
+				fmt.Printf("  OAuth client: %s\n", server.OAuth.ClientID)
+			}
+			fmt.Printf("\nTo remove: oscode mcp remove %s --scope %s\n", args[0], scope)
 			return nil
 		},
 	})
@@ -204,6 +363,156 @@ func mcpCmd() *cobra.Command {
 	return cmd
 }
 
+func mcpServeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve OSCode's tools over MCP on stdio",
+		Long: `Run OSCode as an MCP server on stdin and stdout, exposing its built-in
+tools (Read, Edit, Bash, Grep, Glob, ...) to other agents and editors.
+
+Permission rules from settings apply to every call. Calls that would ask for
+approval in the CLI are refused; approve them with --allowed-tools,
+--permission-mode or --dangerously-skip-permissions:
+
+  oscode mcp serve --tools Read,Grep,Glob
+  oscode mcp serve --disallowed-tools Bash --permission-mode acceptEdits`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if mode, _ := cmd.Flags().GetString("permission-mode"); mode != "" {
+				cfg.PermissionMode = mode
+			}
+
+			enabled, _ := cmd.Flags().GetStringSlice("tools")
+			disallowed, _ := cmd.Flags().GetStringSlice("disallowed-tools")
+			allowed, _ := cmd.Flags().GetStringSlice("allowed-tools")
+			skipPermissions, _ := cmd.Flags().GetBool("dangerously-skip-permissions")
+
+			return app.ServeMCP(cfg, app.ServeOptions{
+				Version:         Version,
+				Tools:           enabled,
+				DisallowedTools: disallowed,
+				AllowedTools:    allowed,
+				SkipPermissions: skipPermissions,
+			})
+		},
+	}
+}
+
+func mcpAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add <name> <command-or-url> [args...]",
+		Short: "Add an MCP server",
+		Long: `Add an MCP server to the local, project or user configuration.
+
+Local servers run a command over stdio. Put -- before the command when its
+arguments start with a dash:
+
+  oscode mcp add github -e GITHUB_TOKEN=... -- github-mcp-server stdio
+  oscode mcp add --transport http linear https://mcp.linear.app/mcp
+  oscode mcp add --scope user --transport sse legacy https://example.com/sse`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, _ := os.Getwd()
+
+			scopeFlag, _ := cmd.Flags().GetString("scope")
+			scope, err := config.ParseScope(scopeFlag)
+			if err != nil {
+				return err
+			}
+
+			transport, _ := cmd.Flags().GetString("transport")
+			server := config.MCPServerConfig{Transport: transport}
+
+			switch transport {
+			case "stdio":
+				server.Command = args[1]
+				server.Args = args[2:]
+			case "http", "sse":
+				if !strings.HasPrefix(args[1], "http://") && !strings.HasPrefix(args[1], "https://") {
+					return fmt.Errorf("%s servers need a URL, got %q", transport, args[1])
+				}
+				if len(args) > 2 {
+					return fmt.Errorf("%s servers don't take arguments", transport)
+				}
+				server.URL = args[1]
+			default:
+				return fmt.Errorf("invalid transport %q (use stdio, http or sse)", transport)
+			}
+
+			envs, _ := cmd.Flags().GetStringArray("env")
+			for _, env := range envs {
+				key, value, ok := strings.Cut(env, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid --env %q, expected KEY=value", env)
+				}
+				if server.Env == nil {
+					server.Env = make(map[string]string)
+				}
+				server.Env[key] = value
+			}
+
+			headers, _ := cmd.Flags().GetStringArray("header")
+			for _, header := range headers {
+				key, value, ok := strings.Cut(header, ":")
+				if !ok || strings.TrimSpace(key) == "" {
+					return fmt.Errorf("invalid --header %q, expected \"Name: value\"", header)
+				}
+				if server.Headers == nil {
+					server.Headers = make(map[string]string)
+				}
+				server.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+
+			if clientID, _ := cmd.Flags().GetString("client-id"); clientID != "" {
+				server.OAuth = &config.MCPOAuthConfig{ClientID: clientID}
+			}
+
+			if err := config.AddMCPServer(scope, cwd, args[0], server); err != nil {
+				return err
+			}
+			fmt.Printf("Added %s MCP server %s to %s config (%s)\n", transport, args[0], scope, config.MCPScopePath(scope, cwd))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("scope", "s", string(config.ScopeLocal), "Where to save the server (local, project, user)")
+	cmd.Flags().StringP("transport", "t", "stdio", "Transport (stdio, http, sse)")
+	cmd.Flags().StringArrayP("env", "e", nil, "Environment variable for stdio servers (KEY=value)")
+	cmd.Flags().StringArrayP("header", "H", nil, "HTTP header for remote servers (\"Name: value\")")
+	cmd.Flags().String("client-id", "", "OAuth client ID for remote servers")
+	return cmd
+}
+
+// mcpTarget describes what a server config connects to
+func mcpTarget(server config.MCPServerConfig) string {
+	if server.URL != "" {
+		return server.URL
+	}
+	return strings.TrimSpace(server.Command + " " + strings.Join(server.Args, " "))
+}
+
+// maskValue hides an env or header value, which often holds a credential.
+// References to environment variables, as in ${API_KEY}, stay readable.
+func maskValue(value string) string {
+	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+		return value
+	}
+	return "****"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func updateCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "update",
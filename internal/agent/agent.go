@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"time"
+
 	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/permissions"
 	"github.com/heissanjay/oscode/internal/tools"
 )
 
@@ -17,24 +20,37 @@ const (
 	TypeGeneral Type = "general-purpose"
 )
 
+// Model names with special meaning in agent configs
+const (
+	ModelInherit = "inherit" // The parent's model
+	ModelFast    = "fast"    // The provider's fast, inexpensive model
+)
+
 // Config defines configuration for an agent type
 type Config struct {
-	Type         Type
-	Model        string // Model to use (empty = inherit from parent)
-	MaxTokens    int
-	AllowedTools []string // Tool names to include (nil = all)
-	ReadOnly     bool     // Whether agent can only read, not write
-	SystemPrompt string   // Custom system prompt for this agent type
+	Type           Type
+	Description    string // When to use this agent, shown to the model
+	Model          string // Model, alias or provider/model (empty or "inherit" = parent's, "fast" = provider's fast model)
+	Provider       string // Provider to pin the agent to (empty = the model's, or the parent's)
+	MaxTokens      int
+	AllowedTools   []string         // Tool names to include (nil = all)
+	ReadOnly       bool             // Whether agent can only read, not write
+	PermissionMode permissions.Mode // Permission mode for the agent's tool calls (empty = parent's)
+	SystemPrompt   string           // Custom system prompt for this agent type
+	Source         string           // Built-in, user or project
+	Path           string           // Definition file, for user and project agents
 }
 
 // DefaultConfigs returns the default configurations for each agent type
 var DefaultConfigs = map[Type]Config{
 	TypeExplore: {
 		Type:         TypeExplore,
-		Model:        "claude-haiku-3-5-20241022", // Fast model for exploration
+		Description:  "Fast, read-only agent for finding files, searching code and answering questions about the codebase",
+		Model:        ModelFast,
 		MaxTokens:    4096,
 		AllowedTools: []string{"Read", "Glob", "Grep", "CodeSearch", "LSP"},
 		ReadOnly:     true,
+		Source:       SourceBuiltin,
 		SystemPrompt: `You are a fast exploration agent. Your job is to quickly find and analyze code.
 
 Use these tools efficiently:
@@ -49,10 +65,12 @@ Focus on answering the question directly.`,
 	},
 	TypePlan: {
 		Type:         TypePlan,
-		Model:        "claude-sonnet-4-20250514",
+		Description:  "Read-only software architect that designs implementation plans",
+		Model:        ModelInherit,
 		MaxTokens:    8192,
 		AllowedTools: []string{"Read", "Glob", "Grep", "CodeSearch", "LSP", "TodoWrite"},
 		ReadOnly:     true,
+		Source:       SourceBuiltin,
 		SystemPrompt: `You are a software architect agent. Your job is to design implementation plans.
 
 Analyze the codebase and create detailed implementation plans including:
@@ -66,10 +84,12 @@ Be specific about file paths and code locations.`,
 	},
 	TypeGeneral: {
 		Type:         TypeGeneral,
-		Model:        "", // Inherit from parent
+		Description:  "General-purpose agent with all tools for complex, multi-step tasks",
+		Model:        ModelInherit,
 		MaxTokens:    16384,
 		AllowedTools: nil, // All tools
 		ReadOnly:     false,
+		Source:       SourceBuiltin,
 		SystemPrompt: "", // Use parent's system prompt
 	},
 }
@@ -79,29 +99,28 @@ type Agent struct {
 	ID            string
 	Type          Type
 	Config        Config
+	Description   string // Short description of the task
 	Provider      llm.Provider
-	ToolRegistry  *tools.Registry
+	ToolRegistry  *tools.Registry // The tools this agent may use
 	Conversation  *llm.Conversation
 	SystemPrompt  string
 	WorkDir       string
 	ParentContext string // Context passed from parent agent
+	SessionID     string // Parent session the transcript is saved under
+	CreatedAt     time.Time
 }
 
 // NewAgent creates a new agent instance
-func NewAgent(id string, agentType Type, provider llm.Provider, registry *tools.Registry, workDir string) *Agent {
-	config := DefaultConfigs[agentType]
-	if config.Type == "" {
-		config = DefaultConfigs[TypeGeneral]
-	}
-
+func NewAgent(id string, config Config, provider llm.Provider, registry *tools.Registry, workDir string) *Agent {
 	return &Agent{
 		ID:           id,
-		Type:         agentType,
+		Type:         config.Type,
 		Config:       config,
 		Provider:     provider,
 		ToolRegistry: registry,
 		Conversation: llm.NewConversation(),
 		WorkDir:      workDir,
+		CreatedAt:    time.Now(),
 	}
 }
 
@@ -125,14 +144,6 @@ func (a *Agent) GetFilteredTools() []llm.Tool {
 	return filtered
 }
 
-// GetModel returns the model to use for this agent
-func (a *Agent) GetModel(defaultModel string) string {
-	if a.Config.Model != "" {
-		return a.Config.Model
-	}
-	return defaultModel
-}
-
 // GetSystemPrompt returns the system prompt for this agent
 func (a *Agent) GetSystemPrompt(defaultPrompt string) string {
 	if a.Config.SystemPrompt != "" {
@@ -146,22 +157,10 @@ func (a *Agent) GetSystemPrompt(defaultPrompt string) string {
 	return defaultPrompt
 }
 
-// CanExecuteTool checks if this agent can execute the given tool
+// CanExecuteTool checks if this agent's tool list includes the given tool.
+// Read-only agents are held to that by their permission context, which
+// still lets them run read-only Bash commands.
 func (a *Agent) CanExecuteTool(toolName string) bool {
-	if a.Config.ReadOnly {
-		// Read-only agents can't execute write tools
-		writeTools := map[string]bool{
-			"Write":        true,
-			"Edit":         true,
-			"Bash":         true,
-			"NotebookEdit": true,
-			"KillShell":    true,
-		}
-		if writeTools[toolName] {
-			return false
-		}
-	}
-
 	if a.Config.AllowedTools == nil {
 		return true
 	}
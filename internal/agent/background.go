@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a background agent
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// BackgroundStatus is a snapshot of a background agent
+type BackgroundStatus struct {
+	ID          string
+	Type        Type
+	Description string
+	State       State
+	ToolCalls   int    // Tool calls made so far
+	LastTool    string // Most recent tool called
+	Result      string // Final response, once completed
+	Error       string // Why the agent failed
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// Done reports whether the agent has stopped
+func (s BackgroundStatus) Done() bool {
+	return s.State != StateRunning
+}
+
+// Elapsed returns how long the agent ran, or has been running
+func (s BackgroundStatus) Elapsed() time.Duration {
+	if s.EndTime.IsZero() {
+		return time.Since(s.StartTime)
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// BackgroundHandler is called whenever a background agent makes progress
+// or stops
+type BackgroundHandler func(status BackgroundStatus)
+
+// backgroundRun tracks an agent running in its own goroutine
+type backgroundRun struct {
+	status BackgroundStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+func (r *backgroundRun) snapshot() BackgroundStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// SetBackgroundHandler sets the callback for background agent updates
+func (e *Executor) SetBackgroundHandler(handler BackgroundHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onBackground = handler
+}
+
+// startBackground runs an agent detached from the caller's context. It can
+// be stopped with Cancel and its result retrieved with Wait.
+func (e *Executor) startBackground(agent *Agent, description, prompt string) *TaskResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &backgroundRun{
+		status: BackgroundStatus{
+			ID:          agent.ID,
+			Type:        agent.Type,
+			Description: description,
+			State:       StateRunning,
+			StartTime:   time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	e.background[agent.ID] = run
+	e.mu.Unlock()
+	e.reportBackground(run)
+
+	go func() {
+		defer cancel()
+		result, err := e.runAgent(ctx, agent, prompt)
+
+		run.mu.Lock()
+		run.status.EndTime = time.Now()
+		switch {
+		case ctx.Err() == context.Canceled:
+			run.status.State = StateCancelled
+			run.status.Error = "cancelled"
+		case err != nil:
+			run.status.State = StateFailed
+			run.status.Error = err.Error()
+		case result.Status == "error":
+			run.status.State = StateFailed
+			run.status.Error = result.Result
+		default:
+			run.status.State = StateCompleted
+			run.status.Result = result.Result
+		}
+		run.mu.Unlock()
+
+		close(run.done)
+		e.reportBackground(run)
+	}()
+
+	return &TaskResult{
+		AgentID: agent.ID,
+		Status:  string(StateRunning),
+		Result:  fmt.Sprintf("Agent %s started in background. Use AgentOutput with agent_id %q to check on it or get its result.", agent.ID, agent.ID),
+	}
+}
+
+// recordToolCall counts a tool call toward a background agent's progress
+func (e *Executor) recordToolCall(agentID, tool string) {
+	e.mu.RLock()
+	run, ok := e.background[agentID]
+	e.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	run.mu.Lock()
+	run.status.ToolCalls++
+	run.status.LastTool = tool
+	run.mu.Unlock()
+	e.reportBackground(run)
+}
+
+func (e *Executor) reportBackground(run *backgroundRun) {
+	e.mu.RLock()
+	handler := e.onBackground
+	e.mu.RUnlock()
+	if handler != nil {
+		handler(run.snapshot())
+	}
+}
+
+// BackgroundAgents returns all background agents, oldest first
+func (e *Executor) BackgroundAgents() []BackgroundStatus {
+	e.mu.RLock()
+	runs := make([]*backgroundRun, 0, len(e.background))
+	for _, run := range e.background {
+		runs = append(runs, run)
+	}
+	e.mu.RUnlock()
+
+	statuses := make([]BackgroundStatus, 0, len(runs))
+	for _, run := range runs {
+		statuses = append(statuses, run.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StartTime.Before(statuses[j].StartTime)
+	})
+	return statuses
+}
+
+// BackgroundStatus returns a background agent's current status
+func (e *Executor) BackgroundStatus(agentID string) (BackgroundStatus, bool) {
+	e.mu.RLock()
+	run, ok := e.background[agentID]
+	e.mu.RUnlock()
+	if !ok {
+		return BackgroundStatus{}, false
+	}
+	return run.snapshot(), true
+}
+
+// Wait blocks until a background agent stops, the timeout passes or ctx is
+// done, and returns its status at that point
+func (e *Executor) Wait(ctx context.Context, agentID string, timeout time.Duration) (BackgroundStatus, error) {
+	e.mu.RLock()
+	run, ok := e.background[agentID]
+	e.mu.RUnlock()
+	if !ok {
+		return BackgroundStatus{}, fmt.Errorf("no background agent with ID %s", agentID)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-run.done:
+	case <-timer.C:
+	case <-ctx.Done():
+		return run.snapshot(), ctx.Err()
+	}
+	return run.snapshot(), nil
+}
+
+// Cancel stops a running background agent
+func (e *Executor) Cancel(agentID string) error {
+	e.mu.RLock()
+	run, ok := e.background[agentID]
+	e.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no background agent with ID %s", agentID)
+	}
+	if run.snapshot().Done() {
+		return fmt.Errorf("agent %s is not running", agentID)
+	}
+
+	run.cancel()
+	<-run.done
+	return nil
+}
+
+// isRunningInBackground reports whether an agent is busy in the background
+func (e *Executor) isRunningInBackground(agentID string) bool {
+	status, ok := e.BackgroundStatus(agentID)
+	return ok && !status.Done()
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/permissions"
+	"gopkg.in/yaml.v3"
+)
+
+// Where an agent definition comes from
+const (
+	SourceBuiltin = "built-in"
+	SourceUser    = "user"
+	SourceProject = "project"
+)
+
+// agentNamePattern restricts agent names to what fits in a file name and
+// the Task tool's enum
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// frontmatter is the YAML header of an agent definition file
+type frontmatter struct {
+	Name           string      `yaml:"name"`
+	Description    string      `yaml:"description"`
+	Tools          interface{} `yaml:"tools"` // Comma-separated string or list
+	Model          string      `yaml:"model"`
+	Provider       string      `yaml:"provider"`
+	PermissionMode string      `yaml:"permissionMode"`
+}
+
+// LoadConfigs returns the built-in agents merged with those defined in the
+// user and project agents directories. Project agents override user agents,
+// which override built-ins of the same name. Files that fail to parse are
+// skipped and reported in the returned errors.
+func LoadConfigs(projectDir string) (map[Type]Config, []error) {
+	configs := make(map[Type]Config, len(DefaultConfigs))
+	for t, cfg := range DefaultConfigs {
+		configs[t] = cfg
+	}
+
+	var errs []error
+	dirs := []struct {
+		path   string
+		source string
+	}{
+		{config.GetUserAgentsDir(), SourceUser},
+		{config.GetProjectAgentsDir(projectDir), SourceProject},
+	}
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir.path, "*.md"))
+		sort.Strings(paths)
+		for _, path := range paths {
+			cfg, err := ParseConfigFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			cfg.Source = dir.source
+			configs[cfg.Type] = cfg
+		}
+	}
+
+	return configs, errs
+}
+
+// ParseConfigFile reads an agent definition: YAML frontmatter with name,
+// description, tools, model, provider and permissionMode, followed by the
+// system prompt
+func ParseConfigFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	header, body, err := splitFrontmatter(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var fm frontmatter
+	if err := yaml.Unmarshal(header, &fm); err != nil {
+		return Config{}, fmt.Errorf("%s: invalid frontmatter: %w", path, err)
+	}
+
+	name := fm.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".md")
+	}
+	if !agentNamePattern.MatchString(name) {
+		return Config{}, fmt.Errorf("%s: invalid agent name %q (use letters, digits, - and _)", path, name)
+	}
+	if fm.Description == "" {
+		return Config{}, fmt.Errorf("%s: description is required", path)
+	}
+
+	cfg := Config{
+		Type:         Type(name),
+		Description:  fm.Description,
+		Model:        fm.Model,
+		Provider:     fm.Provider,
+		MaxTokens:    DefaultConfigs[TypeGeneral].MaxTokens,
+		SystemPrompt: strings.TrimSpace(string(body)),
+		Path:         path,
+	}
+
+	cfg.AllowedTools, err = parseToolList(fm.Tools)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if fm.PermissionMode != "" {
+		mode, ok := permissions.ParseMode(fm.PermissionMode)
+		if !ok {
+			return Config{}, fmt.Errorf("%s: invalid permissionMode %q (use auto, acceptEdits, ask or plan)", path, fm.PermissionMode)
+		}
+		cfg.PermissionMode = mode
+		cfg.ReadOnly = mode == permissions.ModePlan
+	}
+
+	return cfg, nil
+}
+
+// CreateConfigFile writes a template agent definition to dir and returns
+// its path. It fails if the agent already exists there.
+func CreateConfigFile(dir, name string) (string, error) {
+	if !agentNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid agent name %q (use letters, digits, - and _)", name)
+	}
+
+	path := filepath.Join(dir, name+".md")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("agent %s already exists at %s", name, path)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	template := fmt.Sprintf(`---
+name: %s
+description: Describe when the main agent should use this agent
+tools: Read, Glob, Grep
+model: inherit
+---
+You are a specialized agent. Describe its role, what it should look for and
+how it should report back.
+`, name)
+
+	if err := os.WriteFile(path, []byte(template), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// splitFrontmatter separates a "---" delimited YAML header from the body
+func splitFrontmatter(data []byte) ([]byte, []byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, nil, fmt.Errorf("missing frontmatter (the file must start with ---)")
+	}
+
+	rest := text[len("---\n"):]
+	end := strings.Index(rest, "\n---")
+	if end == -1 {
+		return nil, nil, fmt.Errorf("unterminated frontmatter")
+	}
+
+	body := rest[end+len("\n---"):]
+	if i := strings.Index(body, "\n"); i != -1 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	return []byte(rest[:end]), []byte(body), nil
+}
+
+// parseToolList accepts tools as "Read, Grep" or a YAML list. No tools
+// means all tools.
+func parseToolList(value interface{}) ([]string, error) {
+	var names []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid tools entry %v", item)
+			}
+			names = append(names, s)
+		}
+	default:
+		return nil, fmt.Errorf("tools must be a comma-separated string or a list")
+	}
+
+	var tools []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			tools = append(tools, name)
+		}
+	}
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	return tools, nil
+}
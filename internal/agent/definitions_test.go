@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/permissions"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    Config
+		wantErr string
+	}{
+		{
+			name:    "tools as a string",
+			file:    "reviewer.md",
+			content: "---\ndescription: Reviews diffs\ntools: Read, Grep ,Glob\nmodel: haiku\n---\nYou review code.\n",
+			want: Config{
+				Type:         "reviewer",
+				Description:  "Reviews diffs",
+				Model:        "haiku",
+				AllowedTools: []string{"Read", "Grep", "Glob"},
+				SystemPrompt: "You review code.",
+			},
+		},
+		{
+			name:    "tools as a list, CRLF and a BOM",
+			file:    "other.md",
+			content: "\ufeff---\r\nname: tester\r\ndescription: Runs tests\r\ntools:\r\n  - Bash\r\n  - Read\r\npermissionMode: plan\r\n---\r\nRun the tests.\r\n",
+			want: Config{
+				Type:           "tester",
+				Description:    "Runs tests",
+				AllowedTools:   []string{"Bash", "Read"},
+				PermissionMode: permissions.ModePlan,
+				ReadOnly:       true,
+				SystemPrompt:   "Run the tests.",
+			},
+		},
+		{
+			name:    "no tools means all",
+			file:    "helper.md",
+			content: "---\ndescription: Helps\n---\n",
+			want:    Config{Type: "helper", Description: "Helps"},
+		},
+		{
+			name:    "missing description",
+			file:    "vague.md",
+			content: "---\ntools: Read\n---\nDo things.\n",
+			wantErr: "description is required",
+		},
+		{
+			name:    "invalid permission mode",
+			file:    "rogue.md",
+			content: "---\ndescription: Rogue\npermissionMode: yolo\n---\n",
+			wantErr: `invalid permissionMode "yolo"`,
+		},
+		{
+			name:    "invalid tools",
+			file:    "odd.md",
+			content: "---\ndescription: Odd\ntools: {read: true}\n---\n",
+			wantErr: "tools must be",
+		},
+		{
+			name:    "invalid name",
+			file:    "bad.md",
+			content: "---\nname: ../escape\ndescription: Bad\n---\n",
+			wantErr: "invalid agent name",
+		},
+		{
+			name:    "missing frontmatter",
+			file:    "plain.md",
+			content: "Just a prompt.\n",
+			wantErr: "missing frontmatter",
+		},
+		{
+			name:    "unterminated frontmatter",
+			file:    "open.md",
+			content: "---\ndescription: Open\n",
+			wantErr: "unterminated frontmatter",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParseConfigFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.MaxTokens = DefaultConfigs[TypeGeneral].MaxTokens
+			tt.want.Path = path
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("config = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	header, body, err := splitFrontmatter([]byte("---\nname: a\n---\nline one\n---\nline two\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(header) != "name: a" {
+		t.Errorf("header = %q", header)
+	}
+	// Only the first closing marker ends the frontmatter
+	if string(body) != "line one\n---\nline two\n" {
+		t.Errorf("body = %q", body)
+	}
+
+	if _, body, err := splitFrontmatter([]byte("---\nname: a\n---")); err != nil || len(body) != 0 {
+		t.Errorf("frontmatter alone = %q, %v, want an empty body", body, err)
+	}
+}
+
+func TestParseToolList(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    []string
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{"", nil, false},
+		{" , ", nil, false},
+		{"Read", []string{"Read"}, false},
+		{"Read,Grep, mcp:search", []string{"Read", "Grep", "mcp:search"}, false},
+		{[]interface{}{"Read", " Bash "}, []string{"Read", "Bash"}, false},
+		{[]interface{}{}, nil, false},
+		{[]interface{}{"Read", 3}, nil, true},
+		{42, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseToolList(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseToolList(%#v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseToolList(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -3,15 +3,25 @@ package agent
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/hooks"
 	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/permissions"
+	"github.com/heissanjay/oscode/internal/session"
 	"github.com/heissanjay/oscode/internal/tools"
 )
 
+// foregroundTimeout bounds an agent the caller waits on. Background agents
+// run until they finish or are cancelled.
+const foregroundTimeout = 5 * time.Minute
+
 // TaskInput matches the tools.TaskInput structure
 type TaskInput struct {
 	Description  string `json:"description"`
@@ -31,27 +41,113 @@ type TaskResult struct {
 
 // Executor manages agent execution
 type Executor struct {
-	providers    map[string]llm.Provider
-	toolRegistry *tools.Registry
-	workDir      string
-	defaultModel string
+	providers       *llm.ProviderRegistry
+	toolRegistry    *tools.Registry
+	workDir         string
+	defaultProvider string
+	defaultModel    string
+	hooks           *hooks.Executor
+	permissions     *permissions.Manager
+	sessions        *session.Manager
+
+	// Agent types by name, built-in and loaded from definition files
+	configs map[Type]Config
 
 	// Active agents for resumption
 	activeAgents map[string]*Agent
-	mu           sync.RWMutex
+
+	// Agents started with run_in_background
+	background   map[string]*backgroundRun
+	onBackground BackgroundHandler
+
+	onUsage UsageHandler
+
+	mu sync.RWMutex
+}
+
+// UsageHandler is called with the token usage of each request an agent
+// makes, so it can be counted towards the session
+type UsageHandler func(provider llm.Provider, model string, usage llm.Usage)
+
+// SetUsageHandler sets the callback for agents' token usage
+func (e *Executor) SetUsageHandler(handler UsageHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onUsage = handler
 }
 
-// NewExecutor creates a new agent executor
-func NewExecutor(providers map[string]llm.Provider, registry *tools.Registry, workDir, defaultModel string) *Executor {
+// NewExecutor creates a new agent executor with the built-in agent types.
+// Call Reload to add agents defined in the user and project directories.
+func NewExecutor(providers *llm.ProviderRegistry, registry *tools.Registry, workDir, defaultProvider, defaultModel string) *Executor {
+	configs := make(map[Type]Config, len(DefaultConfigs))
+	for t, cfg := range DefaultConfigs {
+		configs[t] = cfg
+	}
+
 	return &Executor{
-		providers:    providers,
-		toolRegistry: registry,
-		workDir:      workDir,
-		defaultModel: defaultModel,
-		activeAgents: make(map[string]*Agent),
+		providers:       providers,
+		toolRegistry:    registry,
+		workDir:         workDir,
+		defaultProvider: defaultProvider,
+		defaultModel:    defaultModel,
+		configs:         configs,
+		activeAgents:    make(map[string]*Agent),
+		background:      make(map[string]*backgroundRun),
 	}
 }
 
+// Reload re-reads agent definition files. Definitions that fail to load
+// are skipped and returned as errors.
+func (e *Executor) Reload() []error {
+	configs, errs := LoadConfigs(e.workDir)
+
+	e.mu.Lock()
+	e.configs = configs
+	e.mu.Unlock()
+
+	return errs
+}
+
+// Configs returns the available agent types sorted by name
+func (e *Executor) Configs() []Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	configs := make([]Config, 0, len(e.configs))
+	for _, cfg := range e.configs {
+		configs = append(configs, cfg)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Type < configs[j].Type
+	})
+	return configs
+}
+
+// Config returns an agent type by name
+func (e *Executor) Config(agentType Type) (Config, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	cfg, ok := e.configs[agentType]
+	return cfg, ok
+}
+
+// SetHooks sets the hook executor used for SubagentStop hooks
+func (e *Executor) SetHooks(executor *hooks.Executor) {
+	e.hooks = executor
+}
+
+// SetPermissions sets the manager that agents' permission contexts are
+// derived from
+func (e *Executor) SetPermissions(manager *permissions.Manager) {
+	e.permissions = manager
+}
+
+// SetSessions sets the session manager that agent transcripts are saved
+// with, as sidechains of the current session
+func (e *Executor) SetSessions(manager *session.Manager) {
+	e.sessions = manager
+}
+
 // Execute runs an agent task
 func (e *Executor) Execute(ctx context.Context, input TaskInput) (*TaskResult, error) {
 	// Handle resume
@@ -65,16 +161,33 @@ func (e *Executor) Execute(ctx context.Context, input TaskInput) (*TaskResult, e
 		agentType = TypeGeneral
 	}
 
-	agentID := uuid.New().String()[:8]
+	cfg, ok := e.Config(agentType)
+	if !ok {
+		names := make([]string, 0)
+		for _, cfg := range e.Configs() {
+			names = append(names, string(cfg.Type))
+		}
+		return nil, fmt.Errorf("unknown agent type %q (available: %s)", agentType, strings.Join(names, ", "))
+	}
+	if input.Model != "" {
+		cfg.Model = input.Model
+	}
 
 	// Get provider for the agent
-	provider := e.getProvider(agentType, input.Model)
-	if provider == nil {
-		return nil, fmt.Errorf("no provider available for agent")
+	provider, providerName, model, err := e.route(cfg)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Provider, cfg.Model = providerName, model
 
-	agent := NewAgent(agentID, agentType, provider, e.toolRegistry, e.workDir)
+	agentID := uuid.New().String()[:8]
+
+	agent := NewAgent(agentID, cfg, provider, e.scopedRegistry(agentID, cfg), e.workDir)
+	agent.Description = input.Description
 	agent.ParentContext = input.Prompt
+	if e.sessions != nil && e.sessions.Current() != nil {
+		agent.SessionID = e.sessions.Current().ID
+	}
 
 	// Store for potential resume
 	e.mu.Lock()
@@ -83,58 +196,124 @@ func (e *Executor) Execute(ctx context.Context, input TaskInput) (*TaskResult, e
 
 	// Handle background execution
 	if input.Background {
-		go e.runAgent(context.Background(), agent, input.Prompt)
-		return &TaskResult{
-			AgentID: agentID,
-			Status:  "running",
-			Result:  fmt.Sprintf("Agent %s started in background", agentID),
-		}, nil
+		return e.startBackground(agent, input.Description, input.Prompt), nil
 	}
 
 	// Run synchronously
+	ctx, cancel := context.WithTimeout(ctx, foregroundTimeout)
+	defer cancel()
 	return e.runAgent(ctx, agent, input.Prompt)
 }
 
-func (e *Executor) getProvider(agentType Type, requestedModel string) llm.Provider {
-	// Determine which provider to use based on model
-	model := requestedModel
-	if model == "" {
-		config := DefaultConfigs[agentType]
-		model = config.Model
+// route picks the provider and full model name for an agent. A
+// "provider/model" reference names both; otherwise a pinned provider wins,
+// then the provider the catalog lists for the model, then the parent's.
+func (e *Executor) route(cfg Config) (llm.Provider, string, string, error) {
+	e.mu.RLock()
+	defaultProvider, defaultModel := e.defaultProvider, e.defaultModel
+	e.mu.RUnlock()
+
+	provider := cfg.Provider
+	if provider == "" {
+		provider = defaultProvider
+	}
+
+	// The parent's model only makes sense on the parent's provider
+	fallback := defaultModel
+	if provider != defaultProvider {
+		fallback = config.GetDefaultModel(provider)
+	}
+
+	model := cfg.Model
+	switch model {
+	case "", ModelInherit:
+		model = fallback
+	case ModelFast:
+		model = config.GetFastModel(provider, fallback)
 	}
 	if model == "" {
-		model = e.defaultModel
+		return nil, "", "", fmt.Errorf("%s agent: provider %s has no default model. Set model in the agent definition", cfg.Type, provider)
+	}
+
+	ref := model
+	if _, _, explicit := e.providers.SplitRef(model); !explicit && cfg.Provider != "" {
+		ref = cfg.Provider + "/" + model
+	}
+
+	providerName, model, err := e.providers.Resolve(ref, defaultProvider)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s agent: %w", cfg.Type, err)
+	}
+	p, err := e.providers.Get(providerName)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s agent: %w", cfg.Type, err)
 	}
+	return p, providerName, model, nil
+}
+
+// SetDefaultModel sets the parent's provider and model, which agents
+// inherit
+func (e *Executor) SetDefaultModel(provider, model string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.defaultProvider = provider
+	e.defaultModel = model
+}
+
+// parentOnlyTools stay with the main conversation: agents can't start or
+// manage other agents, or move the session in and out of plan mode
+var parentOnlyTools = map[string]bool{
+	"Task": true, "AgentOutput": true, "KillAgent": true,
+	"EnterPlanMode": true, "ExitPlanMode": true,
+}
 
-	// Route to appropriate provider based on model name
-	if strings.HasPrefix(model, "claude") {
-		if p, ok := e.providers["anthropic"]; ok {
-			return p
+// scopedRegistry returns the tools an agent may use, checked against its
+// own permission context
+func (e *Executor) scopedRegistry(agentID string, cfg Config) *tools.Registry {
+	names := cfg.AllowedTools
+	if names == nil {
+		for _, tool := range e.toolRegistry.List() {
+			names = append(names, tool.Name())
 		}
 	}
-	if strings.HasPrefix(model, "gpt") || strings.HasPrefix(model, "o1") {
-		if p, ok := e.providers["openai"]; ok {
-			return p
+	allowed := []string{}
+	for _, name := range names {
+		if !parentOnlyTools[name] {
+			allowed = append(allowed, name)
 		}
 	}
 
-	// Return any available provider
-	for _, p := range e.providers {
-		return p
+	if e.permissions == nil {
+		return e.toolRegistry.Scoped(allowed, nil)
 	}
-	return nil
+	label := fmt.Sprintf("%s (%s)", cfg.Type, agentID)
+	return e.toolRegistry.Scoped(allowed, e.permissions.ForAgent(label, cfg.PermissionMode, cfg.ReadOnly))
 }
 
-func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*TaskResult, error) {
-	// Add timeout for agent execution
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (result *TaskResult, err error) {
+	// Warnings are noted once at the end of the result, where the parent
+	// model and the user see them
+	var warnings []string
+	defer func() {
+		if result == nil {
+			return
+		}
+		for _, warning := range warnings {
+			result.Result += fmt.Sprintf("\n\n(Warning: %s)", warning)
+		}
+	}()
+	defer func() {
+		if saveErr := e.saveTranscript(agent); saveErr != nil && result != nil {
+			result.Result += fmt.Sprintf("\n\n(Transcript not saved, agent %s cannot be resumed: %v)", agent.ID, saveErr)
+		}
+	}()
 
-	// Add initial user message
-	agent.Conversation.AddUserMessage(prompt)
+	// Add initial user message (resumed agents already have theirs)
+	if prompt != "" {
+		agent.Conversation.AddUserMessage(prompt)
+	}
 
-	// Get model
-	model := agent.GetModel(e.defaultModel)
+	model := agent.Config.Model
 
 	// Get system prompt
 	systemPrompt := agent.GetSystemPrompt("")
@@ -142,6 +321,7 @@ func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*
 	// Process message loop (max iterations to prevent infinite loops)
 	const maxIterations = 50
 	var response strings.Builder
+	stopHookActive := false
 
 	for i := 0; i < maxIterations; i++ {
 		// Build request
@@ -152,6 +332,24 @@ func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*
 			SystemPrompt: systemPrompt,
 			MaxTokens:    agent.Config.MaxTokens,
 		}
+		// The last turn must answer, since there's no turn after it to
+		// send tool results to
+		if i == maxIterations-1 {
+			req.ToolChoice = &llm.ToolChoice{Mode: llm.ToolChoiceNone}
+		}
+		checkWarnings, err := llm.CheckRequest(agent.Provider, req)
+		if err != nil {
+			return &TaskResult{
+				AgentID: agent.ID,
+				Status:  "error",
+				Result:  err.Error(),
+			}, nil
+		}
+		for _, warning := range checkWarnings {
+			if !slices.Contains(warnings, warning) {
+				warnings = append(warnings, warning)
+			}
+		}
 
 		// Stream response
 		events, err := agent.Provider.Stream(ctx, req)
@@ -163,27 +361,29 @@ func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*
 			}, nil
 		}
 
-		var textResponse strings.Builder
-		var pendingToolUses []*llm.ToolUse
+		message := llm.NewMessageBuilder()
 
 		for event := range events {
+			message.Add(event)
+
 			switch event.Type {
 			case llm.EventTypeText:
-				textResponse.WriteString(event.Delta)
 				response.WriteString(event.Delta)
 
-			case llm.EventTypeToolUse:
-				pendingToolUses = append(pendingToolUses, event.ToolUse)
-
 			case llm.EventTypeDone:
-				// Add assistant message
-				if textResponse.Len() > 0 {
-					agent.Conversation.AddAssistantMessage(textResponse.String())
+				if event.Response != nil {
+					e.mu.RLock()
+					onUsage := e.onUsage
+					e.mu.RUnlock()
+					if onUsage != nil {
+						onUsage(agent.Provider, model, event.Response.Usage)
+					}
 				}
 
 				// Handle tool uses
-				if len(pendingToolUses) > 0 {
-					err := e.executeToolUses(ctx, agent, pendingToolUses)
+				if toolUses := message.ToolUses(); len(toolUses) > 0 {
+					agent.Conversation.AddMessage(message.Message())
+					err := e.executeToolUses(ctx, agent, toolUses)
 					if err != nil {
 						return &TaskResult{
 							AgentID: agent.ID,
@@ -195,6 +395,17 @@ func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*
 					continue
 				}
 
+				if msg := message.Message(); len(msg.Content) > 0 {
+					agent.Conversation.AddMessage(msg)
+				}
+
+				// SubagentStop hooks may keep the agent working
+				if instruction := e.runStopHooks(ctx, agent, response.String(), stopHookActive); instruction != "" {
+					agent.Conversation.AddUserMessage(instruction)
+					stopHookActive = true
+					continue
+				}
+
 				// No more tool uses, agent is done
 				return &TaskResult{
 					AgentID: agent.ID,
@@ -219,14 +430,28 @@ func (e *Executor) runAgent(ctx context.Context, agent *Agent, prompt string) (*
 	}, nil
 }
 
-func (e *Executor) executeToolUses(ctx context.Context, agent *Agent, toolUses []*llm.ToolUse) error {
-	// Add assistant message with tool uses
-	msg := llm.Message{Role: llm.RoleAssistant}
-	for _, tu := range toolUses {
-		msg.AddToolUse(tu)
+// runStopHooks runs SubagentStop hooks and returns the instruction to
+// continue with, if a hook blocked the stop
+func (e *Executor) runStopHooks(ctx context.Context, agent *Agent, result string, stopHookActive bool) string {
+	if e.hooks == nil {
+		return ""
+	}
+
+	hookResult, err := e.hooks.Execute(ctx, hooks.Context{
+		Event:          hooks.EventSubagentStop,
+		ToolName:       string(agent.Type),
+		Result:         result,
+		StopHookActive: stopHookActive,
+		Transcript:     agent.Conversation.Messages,
+	})
+	if err != nil || hookResult.Continue {
+		return ""
 	}
-	agent.Conversation.AddMessage(msg)
 
+	return hookResult.Instruction
+}
+
+func (e *Executor) executeToolUses(ctx context.Context, agent *Agent, toolUses []*llm.ToolUse) error {
 	// Execute each tool
 	resultMsg := llm.Message{Role: llm.RoleUser}
 
@@ -243,7 +468,8 @@ func (e *Executor) executeToolUses(ctx context.Context, agent *Agent, toolUses [
 		}
 
 		// Execute tool
-		result, err := e.toolRegistry.ExecuteToolUse(ctx, tu)
+		e.recordToolCall(agent.ID, tu.Name)
+		result, err := agent.ToolRegistry.ExecuteToolUse(ctx, tu)
 		if err != nil {
 			result = &llm.ToolResult{
 				ToolUseID: tu.ID,
@@ -251,6 +477,9 @@ func (e *Executor) executeToolUses(ctx context.Context, agent *Agent, toolUses [
 				IsError:   true,
 			}
 		}
+		if !llm.SupportsVision(agent.Provider, agent.Config.Model) {
+			result = result.WithoutImages()
+		}
 		resultMsg.AddToolResult(result)
 	}
 
@@ -263,6 +492,13 @@ func (e *Executor) resumeAgent(ctx context.Context, agentID, prompt string) (*Ta
 	agent, ok := e.activeAgents[agentID]
 	e.mu.RUnlock()
 
+	// Agents from before a restart are restored from their transcript
+	if !ok {
+		if restored, err := e.restoreAgent(agentID); err == nil {
+			agent, ok = restored, true
+		}
+	}
+
 	if !ok {
 		return &TaskResult{
 			AgentID: agentID,
@@ -271,14 +507,91 @@ func (e *Executor) resumeAgent(ctx context.Context, agentID, prompt string) (*Ta
 		}, nil
 	}
 
+	if e.isRunningInBackground(agentID) {
+		return &TaskResult{
+			AgentID: agentID,
+			Status:  "error",
+			Result:  fmt.Sprintf("Agent %s is still running in the background. Wait for it with AgentOutput first.", agentID),
+		}, nil
+	}
+
 	// Add follow-up prompt
 	if prompt != "" {
 		agent.Conversation.AddUserMessage(prompt)
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, foregroundTimeout)
+	defer cancel()
 	return e.runAgent(ctx, agent, "")
 }
 
+// saveTranscript saves an agent's conversation as a sidechain of its
+// parent session
+func (e *Executor) saveTranscript(agent *Agent) error {
+	if e.sessions == nil || agent.SessionID == "" {
+		return nil
+	}
+
+	return e.sessions.SaveSidechain(&session.Sidechain{
+		AgentID:     agent.ID,
+		SessionID:   agent.SessionID,
+		AgentType:   string(agent.Type),
+		Description: agent.Description,
+		Model:       agent.Config.Provider + "/" + agent.Config.Model,
+		Messages:    agent.Conversation.Messages,
+		CreatedAt:   agent.CreatedAt,
+		UpdatedAt:   time.Now(),
+	})
+}
+
+// Transcripts returns the saved agent transcripts of the current session,
+// oldest first
+func (e *Executor) Transcripts() ([]*session.Sidechain, error) {
+	if e.sessions == nil || e.sessions.Current() == nil {
+		return nil, nil
+	}
+	return e.sessions.ListSidechains(e.sessions.Current().ID)
+}
+
+// restoreAgent rebuilds an agent from a sidechain of the current session
+func (e *Executor) restoreAgent(agentID string) (*Agent, error) {
+	if e.sessions == nil || e.sessions.Current() == nil {
+		return nil, fmt.Errorf("no session to restore agent %s from", agentID)
+	}
+
+	sc, err := e.sessions.LoadSidechain(e.sessions.Current().ID, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, ok := e.Config(Type(sc.AgentType))
+	if !ok {
+		return nil, fmt.Errorf("agent type %s no longer exists", sc.AgentType)
+	}
+	cfg.Model = sc.Model
+
+	provider, providerName, model, err := e.route(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Provider, cfg.Model = providerName, model
+
+	agent := NewAgent(sc.AgentID, cfg, provider, e.scopedRegistry(sc.AgentID, cfg), e.workDir)
+	agent.Description = sc.Description
+	agent.SessionID = sc.SessionID
+	agent.CreatedAt = sc.CreatedAt
+	agent.Conversation.Messages = sc.Messages
+	if len(sc.Messages) > 0 {
+		agent.ParentContext = sc.Messages[0].GetText()
+	}
+
+	e.mu.Lock()
+	e.activeAgents[agent.ID] = agent
+	e.mu.Unlock()
+
+	return agent, nil
+}
+
 // GetAgent returns an active agent by ID
 func (e *Executor) GetAgent(agentID string) (*Agent, bool) {
 	e.mu.RLock()
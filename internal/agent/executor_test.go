@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/session"
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// requestLog records the requests sent to a provider
+type requestLog struct {
+	llm.Provider
+	mu       sync.Mutex
+	requests []*llm.ChatRequest
+}
+
+func (l *requestLog) Stream(ctx context.Context, req *llm.ChatRequest) (<-chan llm.StreamEvent, error) {
+	l.mu.Lock()
+	l.requests = append(l.requests, req)
+	l.mu.Unlock()
+	return l.Provider.Stream(ctx, req)
+}
+
+// newReplayExecutor returns an executor for a project directory whose
+// agents play back the scripted exchanges
+func newReplayExecutor(t *testing.T, workDir string, exchanges ...llm.Exchange) (*Executor, *requestLog, *llm.ReplayProvider) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	replay := llm.NewReplayProvider(&llm.Fixture{Exchanges: exchanges})
+	log := &requestLog{Provider: replay}
+
+	providers := llm.NewProviderRegistry()
+	providers.Register("replay", func() (llm.Provider, error) {
+		return log, nil
+	})
+
+	registry := tools.NewRegistry()
+	registry.Register(tools.NewReadTool(workDir))
+	registry.Register(tools.NewGlobTool(workDir))
+
+	return NewExecutor(providers, registry, workDir, "replay", "replay-model"), log, replay
+}
+
+func TestExecuteRunsToolCalls(t *testing.T) {
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	executor, log, replay := newReplayExecutor(t, workDir,
+		llm.NewToolUseExchange("Looking for Go files.", llm.ToolUse{
+			ID:    "call_1",
+			Name:  "Glob",
+			Input: map[string]interface{}{"pattern": "*.go"},
+		}),
+		llm.NewTextExchange("There is one Go file, main.go."),
+	)
+
+	result, err := executor.Execute(context.Background(), TaskInput{
+		Description:  "Find Go files",
+		Prompt:       "Which Go files are there?",
+		SubagentType: string(TypeGeneral),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "completed" {
+		t.Fatalf("status = %s: %s", result.Status, result.Result)
+	}
+	if !strings.Contains(result.Result, "There is one Go file, main.go.") {
+		t.Errorf("result = %q", result.Result)
+	}
+	if replay.Remaining() != 0 {
+		t.Errorf("%d exchanges not played", replay.Remaining())
+	}
+
+	// The second request carries the agent's text, its tool call and the
+	// tool's output
+	if len(log.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(log.requests))
+	}
+	messages := log.requests[1].Messages
+	if len(messages) != 3 {
+		t.Fatalf("second request has %d messages, want 3", len(messages))
+	}
+	if messages[1].GetText() != "Looking for Go files." || len(messages[1].GetToolUses()) != 1 {
+		t.Errorf("assistant message = %+v", messages[1])
+	}
+	toolResult := messages[2].Content[0].ToolResult
+	if toolResult == nil || toolResult.IsError || !strings.Contains(toolResult.Content, "main.go") {
+		t.Errorf("tool result = %+v", toolResult)
+	}
+}
+
+func TestExecuteForbidsToolsOnLastIteration(t *testing.T) {
+	workDir := t.TempDir()
+
+	// An agent that never stops calling tools
+	var exchanges []llm.Exchange
+	for i := 0; i < 50; i++ {
+		exchanges = append(exchanges, llm.NewToolUseExchange("", llm.ToolUse{
+			ID:    fmt.Sprintf("call_%d", i),
+			Name:  "Glob",
+			Input: map[string]interface{}{"pattern": "*"},
+		}))
+	}
+	executor, log, _ := newReplayExecutor(t, workDir, exchanges...)
+
+	result, err := executor.Execute(context.Background(), TaskInput{
+		Prompt:       "Keep looking",
+		SubagentType: string(TypeGeneral),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Result, "maximum iterations") {
+		t.Errorf("result = %q, want the iteration limit noted", result.Result)
+	}
+
+	for i, req := range log.requests {
+		last := i == len(log.requests)-1
+		none := req.ToolChoice != nil && req.ToolChoice.Mode == llm.ToolChoiceNone
+		if none != last {
+			t.Errorf("request %d tool choice = %+v", i, req.ToolChoice)
+		}
+	}
+}
+
+func TestScopedRegistryKeepsParentOnlyTools(t *testing.T) {
+	executor, _, _ := newReplayExecutor(t, t.TempDir())
+	executor.toolRegistry.Register(tools.NewTaskTool(nil, nil))
+	executor.toolRegistry.Register(tools.NewAgentOutputTool(nil))
+	executor.toolRegistry.Register(tools.NewKillAgentTool(nil))
+	executor.toolRegistry.Register(tools.NewEnterPlanModeTool(nil))
+	executor.toolRegistry.Register(tools.NewExitPlanModeTool(nil))
+
+	for _, allowed := range [][]string{nil, {"Read", "Task", "ExitPlanMode"}} {
+		cfg := Config{Type: "helper", AllowedTools: allowed}
+		var names []string
+		for _, tool := range executor.scopedRegistry("agent-1", cfg).List() {
+			names = append(names, tool.Name())
+		}
+		sort.Strings(names)
+
+		want := []string{"Glob", "Read"}
+		if allowed != nil {
+			want = []string{"Read"}
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("tools for %q = %q, want %q", allowed, names, want)
+		}
+	}
+}
+
+func TestExecuteSavesTranscript(t *testing.T) {
+	executor, _, _ := newReplayExecutor(t, t.TempDir(), llm.NewTextExchange("Done."))
+	sessions := session.NewManager()
+	sessions.Create(t.TempDir(), "replay", "replay-model")
+	executor.SetSessions(sessions)
+
+	result, err := executor.Execute(context.Background(), TaskInput{
+		Description:  "Say done",
+		Prompt:       "Say done",
+		SubagentType: string(TypeGeneral),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcripts, err := executor.Transcripts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcripts) != 1 || transcripts[0].AgentID != result.AgentID || transcripts[0].Description != "Say done" {
+		t.Errorf("transcripts = %+v", transcripts)
+	}
+}
+
+func TestExecuteReportsUnsavedTranscript(t *testing.T) {
+	executor, _, _ := newReplayExecutor(t, t.TempDir(), llm.NewTextExchange("Done."))
+	sessions := session.NewManager()
+	sessions.Create(t.TempDir(), "replay", "replay-model")
+	executor.SetSessions(sessions)
+
+	// A file where the sessions directory should be makes saving fail
+	if err := os.MkdirAll(filepath.Dir(config.GetSessionsDir()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.GetSessionsDir(), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executor.Execute(context.Background(), TaskInput{
+		Prompt:       "Say done",
+		SubagentType: string(TypeGeneral),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Result, "Transcript not saved") {
+		t.Errorf("result = %q, want a note about the unsaved transcript", result.Result)
+	}
+}
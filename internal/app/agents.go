@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/agent"
+	"github.com/heissanjay/oscode/internal/tools"
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+// handleBackgroundAgent refreshes the agents panel and, when an agent
+// stops, tells the user and queues a note for the main conversation
+func (a *App) handleBackgroundAgent(status agent.BackgroundStatus) {
+	if a.program != nil {
+		var running []ui.BackgroundAgentInfo
+		for _, s := range a.agentExecutor.BackgroundAgents() {
+			if s.Done() {
+				continue
+			}
+			running = append(running, ui.BackgroundAgentInfo{
+				ID:          s.ID,
+				Type:        string(s.Type),
+				Description: s.Description,
+				ToolCalls:   s.ToolCalls,
+				LastTool:    s.LastTool,
+				StartTime:   s.StartTime,
+			})
+		}
+		a.program.Send(ui.BackgroundAgentsMsg{Agents: running})
+	}
+
+	if !status.Done() {
+		return
+	}
+
+	summary := fmt.Sprintf("Background agent %s (%s: %s) %s after %s", status.ID, status.Type, status.Description, status.State, status.Elapsed().Round(time.Second))
+	if status.State == agent.StateFailed {
+		summary += ": " + status.Error
+	}
+
+	a.agentNotesMu.Lock()
+	a.agentNotes[status.ID] = summary
+	a.agentNotesMu.Unlock()
+
+	if a.program != nil {
+		a.program.Send(ui.SystemMsg{Content: summary})
+	}
+	a.notify(summary)
+}
+
+// agentStatus backs the AgentOutput tool
+func (a *App) agentStatus(ctx context.Context, agentID string, wait bool, timeout time.Duration) (*tools.AgentStatus, error) {
+	status, ok := a.agentExecutor.BackgroundStatus(agentID)
+	if !ok {
+		return nil, fmt.Errorf("no background agent with ID %s", agentID)
+	}
+	if wait && !status.Done() {
+		var err error
+		if status, err = a.agentExecutor.Wait(ctx, agentID, timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	// The model has seen the outcome, so it needs no reminder
+	if status.Done() {
+		a.agentNotesMu.Lock()
+		delete(a.agentNotes, agentID)
+		a.agentNotesMu.Unlock()
+	}
+
+	return &tools.AgentStatus{
+		AgentID:     status.ID,
+		AgentType:   string(status.Type),
+		Description: status.Description,
+		State:       string(status.State),
+		ToolCalls:   status.ToolCalls,
+		Result:      status.Result,
+		Error:       status.Error,
+		Elapsed:     status.Elapsed(),
+	}, nil
+}
+
+// takeAgentNotes returns notes about background agents that stopped since
+// the model last checked on them, for the next prompt
+func (a *App) takeAgentNotes() string {
+	a.agentNotesMu.Lock()
+	defer a.agentNotesMu.Unlock()
+	if len(a.agentNotes) == 0 {
+		return ""
+	}
+
+	ids := make([]string, 0, len(a.agentNotes))
+	for id := range a.agentNotes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	sb.WriteString("<background-agents>\n")
+	for _, id := range ids {
+		sb.WriteString(a.agentNotes[id] + ". Use AgentOutput with agent_id \"" + id + "\" for its result.\n")
+		delete(a.agentNotes, id)
+	}
+	sb.WriteString("</background-agents>")
+	return sb.String()
+}
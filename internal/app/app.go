@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/heissanjay/oscode/internal/agent"
@@ -19,6 +23,7 @@ import (
 	"github.com/heissanjay/oscode/internal/session"
 	"github.com/heissanjay/oscode/internal/tools"
 	"github.com/heissanjay/oscode/internal/ui"
+	"github.com/heissanjay/oscode/internal/utils"
 )
 
 // Options contains application startup options
@@ -30,6 +35,10 @@ type Options struct {
 	ContinueSession bool
 	ResumeSession   string
 	SkipPermissions bool
+	JSONSchema      *llm.ResponseSchema // Print mode result format
+	Record          string              // Fixture file to record provider exchanges to
+	Replay          string              // Fixture file to play provider exchanges back from
+	Images          []string            // Print mode images to attach to the prompt
 }
 
 // App is the main application
@@ -37,9 +46,11 @@ type App struct {
 	config         *config.Config
 	options        Options
 	provider       llm.Provider
+	providers      *llm.ProviderRegistry
 	toolRegistry   *tools.Registry
 	sessionManager *session.Manager
 	permManager    *permissions.Manager
+	prePlanMode    permissions.Mode // Mode to return to after an approved plan
 	hookExecutor   *hooks.Executor
 	agentExecutor  *agent.Executor
 	mcpClient      *mcp.Client
@@ -51,12 +62,45 @@ type App struct {
 	systemPrompt   string
 	conversation   *llm.Conversation
 	currentSession *session.Session
-	inPlanMode     bool
 
 	// Permission handling
-	permissionChan     chan bool
-	permissionResponse chan ui.PermissionResponse
-	sessionAllowed     map[string]bool // Tools allowed for this session
+	permissionChan       chan bool
+	permissionResponse   chan ui.PermissionResponse
+	planApprovalResponse chan ui.PlanApprovalResponse
+	sessionAllowed       map[string]bool // Tools allowed for this session
+	promptMu             sync.Mutex      // Held while a permission prompt is shown
+	promptAgent          string          // Sub-agent that raised the current prompt
+
+	// Hook state
+	sessionContext string // Context added by SessionStart hooks
+	stopHookActive bool   // Whether a Stop hook is keeping the agent going
+	endSessionOnce sync.Once
+
+	// Background agents that stopped since the model last checked on them
+	agentNotes   map[string]string
+	agentNotesMu sync.Mutex
+
+	// Guards the session's usage totals, which sub-agents also add to
+	usageMu sync.Mutex
+
+	// Prompts submitted in the project, across sessions
+	history *session.History
+
+	// Project files offered for @mention completion
+	project        projectIndex
+	projectMu      sync.Mutex // Guards project
+	projectBuildMu sync.Mutex // Held while the index is rebuilt
+
+	// Guards the conversation's messages, which hooks read while a turn runs
+	conversationMu sync.Mutex
+
+	// Warnings already shown, so each is shown once per session
+	warned sync.Map
+
+	// Fixtures for offline runs: recorded exchanges stand in for every
+	// provider, or real exchanges are saved
+	replay   *llm.ReplayProvider
+	recorder *llm.Recorder
 
 	// Context for cancellation
 	ctx    context.Context
@@ -82,23 +126,39 @@ func New(cfg *config.Config, opts Options) (*App, error) {
 		sessionManager:     session.NewManager(),
 		permissionResponse: make(chan ui.PermissionResponse, 1),
 		sessionAllowed:     make(map[string]bool),
+		agentNotes:         make(map[string]string),
+
+		planApprovalResponse: make(chan ui.PlanApprovalResponse, 1),
+	}
+
+	if opts.Replay != "" {
+		fixture, err := llm.LoadFixture(opts.Replay)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		app.replay = llm.NewReplayProvider(fixture)
+	}
+	if opts.Record != "" {
+		app.recorder = llm.NewRecorder(opts.Record)
 	}
 
 	// Initialize provider
+	app.initProviders()
 	if err := app.initProvider(); err != nil {
 		cancel()
 		return nil, err
 	}
 
 	// Initialize hooks executor
-	app.hookExecutor = hooks.NewExecutor(cfg.Hooks, workDir)
-
-	// Initialize MCP client and connect to configured servers
-	app.initMCP()
+	app.initHooks()
 
 	// Initialize tools
 	app.initTools()
 
+	// Initialize MCP client and connect to configured servers
+	app.initMCP()
+
 	// Initialize permissions
 	app.initPermissions()
 
@@ -124,52 +184,9 @@ func New(cfg *config.Config, opts Options) (*App, error) {
 	return app, nil
 }
 
-func (a *App) initProvider() error {
-	providerName := a.config.DefaultProvider
-
-	apiKey := a.config.GetAPIKey(providerName)
-	if apiKey == "" {
-		return fmt.Errorf("no API key configured for %s. Set %s_API_KEY environment variable",
-			providerName, strings.ToUpper(providerName))
-	}
-
-	baseURL := a.config.GetBaseURL(providerName)
-
-	switch providerName {
-	case "anthropic":
-		a.provider = llm.NewAnthropicProvider(apiKey, baseURL)
-	case "openai":
-		a.provider = llm.NewOpenAIProvider(apiKey, baseURL)
-	default:
-		return fmt.Errorf("unknown provider: %s", providerName)
-	}
-
-	return nil
-}
-
 func (a *App) initTools() {
 	a.toolRegistry = tools.NewRegistry()
-
-	// Register file tools
-	readTool := tools.NewReadTool(a.workDir)
-	writeTool := tools.NewWriteTool(a.workDir)
-	editTool := tools.NewEditTool(a.workDir)
-
-	a.toolRegistry.Register(readTool)
-	a.toolRegistry.Register(writeTool)
-	a.toolRegistry.Register(editTool)
-
-	// Register bash tool
-	bashTool := tools.NewBashTool(a.workDir)
-	a.toolRegistry.Register(bashTool)
-	a.toolRegistry.Register(tools.NewBashOutputTool(bashTool))
-	a.toolRegistry.Register(tools.NewKillShellTool(bashTool))
-
-	// Register search tools
-	a.toolRegistry.Register(tools.NewGlobTool(a.workDir))
-	a.toolRegistry.Register(tools.NewGrepTool(a.workDir))
-	a.toolRegistry.Register(tools.NewCodeSearchTool(a.workDir))
-	a.toolRegistry.Register(tools.NewLSPTool(a.workDir))
+	registerBuiltinTools(a.toolRegistry, a.workDir)
 
 	// Register agent tools
 	todoTool := tools.NewTodoWriteTool(func(todos []tools.TodoItem) {
@@ -177,19 +194,21 @@ func (a *App) initTools() {
 	})
 	a.toolRegistry.Register(todoTool)
 
-	// Register notebook tool
-	a.toolRegistry.Register(tools.NewNotebookEditTool(a.workDir))
-
 	// Register plan mode tools
 	planModeCallback := func(entering bool) {
-		// TODO: Implement plan mode state tracking
+		if entering {
+			a.setPermissionMode(permissions.ModePlan)
+		}
 	}
 	a.toolRegistry.Register(tools.NewEnterPlanModeTool(planModeCallback))
-	a.toolRegistry.Register(tools.NewExitPlanModeTool(planModeCallback))
+	a.toolRegistry.Register(tools.NewExitPlanModeTool(a.requestPlanApproval))
 
 	// Register ask user question tool (callback will be wired up via UI)
 	a.toolRegistry.Register(tools.NewAskUserQuestionTool(nil))
 
+	// Run PreToolUse and PostToolUse hooks around every tool call
+	a.toolRegistry.SetHooks(a.hookExecutor)
+
 	// Set tool callbacks for UI updates
 	a.toolRegistry.SetCallbacks(
 		func(name, desc string) {
@@ -205,6 +224,30 @@ func (a *App) initTools() {
 	)
 }
 
+// registerBuiltinTools registers the tools that work without a UI or an
+// LLM: file, shell, search and notebook tools
+func registerBuiltinTools(registry *tools.Registry, workDir string) {
+	// Register file tools
+	registry.Register(tools.NewReadTool(workDir))
+	registry.Register(tools.NewWriteTool(workDir))
+	registry.Register(tools.NewEditTool(workDir))
+
+	// Register bash tool
+	bashTool := tools.NewBashTool(workDir)
+	registry.Register(bashTool)
+	registry.Register(tools.NewBashOutputTool(bashTool))
+	registry.Register(tools.NewKillShellTool(bashTool))
+
+	// Register search tools
+	registry.Register(tools.NewGlobTool(workDir))
+	registry.Register(tools.NewGrepTool(workDir))
+	registry.Register(tools.NewCodeSearchTool(workDir))
+	registry.Register(tools.NewLSPTool(workDir))
+
+	// Register notebook tool
+	registry.Register(tools.NewNotebookEditTool(workDir))
+}
+
 func (a *App) initPermissions() {
 	a.permManager = permissions.NewManager(a.config)
 
@@ -213,12 +256,22 @@ func (a *App) initPermissions() {
 	}
 
 	// Set permission callback for UI prompts
-	a.permManager.SetCallback(func(tool string, input map[string]interface{}, description string) (bool, error) {
+	a.permManager.SetCallback(func(ctx context.Context, tool string, input map[string]interface{}, description, agentName string) (bool, error) {
+		// Background agents may ask while the main conversation does, so
+		// prompts are shown one at a time
+		a.promptMu.Lock()
+		defer a.promptMu.Unlock()
+
 		// Check if this tool was already allowed for session
 		if a.sessionAllowed[tool] {
 			return true, nil
 		}
 
+		// PermissionRequest hooks can answer on the user's behalf
+		if decided, allowed, err := a.runPermissionHooks(tool, input); decided {
+			return allowed, err
+		}
+
 		// If no UI program, auto-allow (print mode)
 		if a.program == nil {
 			return true, nil
@@ -228,6 +281,7 @@ func (a *App) initPermissions() {
 		req := &ui.PermissionRequest{
 			Tool:        tool,
 			Description: description,
+			Agent:       agentName,
 		}
 
 		// Extract file info for file operations
@@ -257,51 +311,168 @@ func (a *App) initPermissions() {
 		}
 
 		// Send permission request to UI
+		a.promptAgent = agentName
+		if agentName != "" {
+			a.notify(fmt.Sprintf("OSCode's %s agent needs your permission to use %s", agentName, tool))
+		} else {
+			a.notify(fmt.Sprintf("OSCode needs your permission to use %s", tool))
+		}
+		drain(a.permissionResponse)
 		a.program.Send(ui.PermissionRequestMsg{Request: req})
 
-		// Wait for response (blocking)
-		resp := <-a.permissionResponse
+		// Wait for the response, unless the call is cancelled first, as
+		// when a background agent is killed
+		var resp ui.PermissionResponse
+		select {
+		case resp = <-a.permissionResponse:
+		case <-ctx.Done():
+			return false, fmt.Errorf("permission request cancelled: %w", ctx.Err())
+		}
 
 		// Track "don't ask again" preference
 		if resp.DontAskAgain && resp.Allowed {
 			a.sessionAllowed[tool] = true
 		}
 
+		// Feedback on an agent's request goes back to that agent
+		if agentName != "" && !resp.Allowed && resp.Feedback != "" {
+			return false, fmt.Errorf("Permission denied by user: %s", resp.Feedback)
+		}
+
 		return resp.Allowed, nil
 	})
 
+	// MCP tools annotated as read-only skip the prompt
+	a.permManager.SetReadOnlyCheck(func(name string) bool {
+		tool, ok := a.toolRegistry.Get(name)
+		if !ok {
+			return false
+		}
+		bridge, ok := tool.(*mcp.ToolBridge)
+		return ok && bridge.ReadOnly()
+	})
+
 	a.toolRegistry.SetPermissionChecker(a.permManager)
 }
 
+// setPermissionMode switches the permission mode and updates the UI
+func (a *App) setPermissionMode(mode permissions.Mode) {
+	a.switchPermissionMode(mode)
+	if a.program != nil {
+		a.program.Send(ui.PermissionModeMsg{Mode: string(mode)})
+	}
+}
+
+// switchPermissionMode switches the permission mode, remembering the mode
+// plan mode was entered from so approving a plan can return to it
+func (a *App) switchPermissionMode(mode permissions.Mode) {
+	if current := a.permManager.GetMode(); mode == permissions.ModePlan && current != permissions.ModePlan {
+		a.prePlanMode = current
+	}
+	a.permManager.SetMode(mode)
+}
+
+// requestPlanApproval presents a plan from ExitPlanMode and waits for the
+// user's decision. Approval leaves plan mode in the chosen edit mode.
+func (a *App) requestPlanApproval(ctx context.Context, plan string) (tools.PlanApproval, error) {
+	if a.permManager.GetMode() != permissions.ModePlan {
+		return tools.PlanApproval{}, fmt.Errorf("not in plan mode")
+	}
+
+	// Without a UI nobody can approve, so the plan is the final answer
+	if a.program == nil {
+		return tools.PlanApproval{
+			Decision: tools.PlanKeepPlanning,
+			Feedback: "Running non-interactively. Present the plan as your final response instead of implementing it.",
+		}, nil
+	}
+
+	a.notify("OSCode is waiting for plan approval")
+	drain(a.planApprovalResponse)
+	a.program.Send(ui.PlanApprovalRequestMsg{Request: &ui.PlanApprovalRequest{Plan: plan}})
+
+	var resp ui.PlanApprovalResponse
+	select {
+	case resp = <-a.planApprovalResponse:
+	case <-ctx.Done():
+		return tools.PlanApproval{}, ctx.Err()
+	}
+
+	switch resp.Choice {
+	case ui.PlanChoiceAcceptEdits:
+		a.setPermissionMode(permissions.ModeAcceptEdits)
+		return tools.PlanApproval{Decision: tools.PlanApprovedAcceptEdits}, nil
+	case ui.PlanChoiceAskEdits:
+		// Back to the mode before planning, so only edits prompt
+		mode := a.prePlanMode
+		if mode == "" || mode == permissions.ModePlan || mode == permissions.ModeAcceptEdits {
+			mode = permissions.ModeAuto
+		}
+		a.setPermissionMode(mode)
+		return tools.PlanApproval{Decision: tools.PlanApprovedAskEdits}, nil
+	default:
+		return tools.PlanApproval{Decision: tools.PlanKeepPlanning, Feedback: resp.Feedback}, nil
+	}
+}
+
 func (a *App) initMCP() {
 	a.mcpClient = mcp.NewClient()
 
-	// Connect to configured MCP servers
-	for name, serverCfg := range a.config.MCP.Servers {
-		if err := a.mcpClient.Connect(name, serverCfg); err != nil {
-			// Log warning but continue - MCP servers are optional
-			fmt.Fprintf(os.Stderr, "Warning: failed to connect to MCP server %s: %v\n", name, err)
-			continue
+	// Let servers see the project and sample from our model
+	a.mcpClient.SetRoots([]mcp.Root{{URI: "file://" + a.workDir, Name: filepath.Base(a.workDir)}})
+	a.mcpClient.SetSamplingHandler(mcp.NewProviderSamplingHandler(a.provider, a.config.GetModel()))
+	a.mcpClient.SetToolsChangedHandler(a.refreshMCPTools)
+	a.mcpClient.SetPromptsChangedHandler(a.registerMCPPrompts)
+	a.mcpClient.SetStatusHandler(a.handleMCPStatus)
+	a.mcpClient.SetAuthorizeHandler(a.handleMCPAuthorize)
+
+	// Let the model browse server resources
+	a.toolRegistry.Register(mcp.NewListResourcesTool(a.mcpClient))
+	a.toolRegistry.Register(mcp.NewReadResourceTool(a.mcpClient))
+
+	// Connect in the background; tools and prompts are registered as each
+	// server comes up
+	a.mcpClient.Start(a.config.MCP.Servers)
+}
+
+// refreshMCPTools re-registers a server's tools after it reports a change
+// or its connection changes
+func (a *App) refreshMCPTools(serverName string) {
+	prefix := serverName + ":"
+	for _, name := range a.toolRegistry.ListNames() {
+		if strings.HasPrefix(name, prefix) {
+			a.toolRegistry.Unregister(name)
 		}
 	}
 
-	// Register MCP tools with the registry
-	for _, tool := range a.mcpClient.AllTools() {
+	server, ok := a.mcpClient.GetServer(serverName)
+	if !ok {
+		return
+	}
+
+	for _, tool := range server.BridgeTools() {
 		a.toolRegistry.Register(tool)
 	}
 }
 
 func (a *App) initAgentExecutor() {
-	// Create provider map for agent executor
-	providers := make(map[string]llm.Provider)
-	providers[a.config.DefaultProvider] = a.provider
-
 	a.agentExecutor = agent.NewExecutor(
-		providers,
+		a.providers,
 		a.toolRegistry,
 		a.workDir,
+		a.config.DefaultProvider,
 		a.config.GetModel(),
 	)
+	a.agentExecutor.SetHooks(a.hookExecutor)
+	a.agentExecutor.SetPermissions(a.permManager)
+	a.agentExecutor.SetSessions(a.sessionManager)
+	a.agentExecutor.SetBackgroundHandler(a.handleBackgroundAgent)
+	a.agentExecutor.SetUsageHandler(a.recordUsage)
+
+	// Load agents defined in the user and project agents directories
+	for _, err := range a.agentExecutor.Reload() {
+		fmt.Fprintf(os.Stderr, "Warning: skipping agent definition: %v\n", err)
+	}
 
 	// Wire up the Task tool with the agent executor
 	taskExecutor := func(ctx context.Context, input tools.TaskInput) (*tools.TaskResult, error) {
@@ -311,6 +482,7 @@ func (a *App) initAgentExecutor() {
 			SubagentType: input.SubagentType,
 			Model:        input.Model,
 			Background:   input.Background,
+			Resume:       input.Resume,
 		}
 
 		result, err := a.agentExecutor.Execute(ctx, agentInput)
@@ -325,8 +497,18 @@ func (a *App) initAgentExecutor() {
 		}, nil
 	}
 
+	agentTypes := func() []tools.TaskAgentType {
+		var types []tools.TaskAgentType
+		for _, cfg := range a.agentExecutor.Configs() {
+			types = append(types, tools.TaskAgentType{Name: string(cfg.Type), Description: cfg.Description})
+		}
+		return types
+	}
+
 	// Register the Task tool with the executor callback
-	a.toolRegistry.Register(tools.NewTaskTool(taskExecutor))
+	a.toolRegistry.Register(tools.NewTaskTool(taskExecutor, agentTypes))
+	a.toolRegistry.Register(tools.NewAgentOutputTool(a.agentStatus))
+	a.toolRegistry.Register(tools.NewKillAgentTool(a.agentExecutor.Cancel))
 }
 
 func (a *App) buildSystemPrompt() {
@@ -399,7 +581,7 @@ func (a *App) resumeLatestSession() error {
 	}
 
 	a.currentSession = sess
-	a.conversation.Messages = sess.Messages
+	a.setMessages(sess.Messages)
 	a.sessionManager.SetCurrent(sess)
 	return nil
 }
@@ -415,7 +597,7 @@ func (a *App) resumeSession(id string) error {
 	}
 
 	a.currentSession = sess
-	a.conversation.Messages = sess.Messages
+	a.setMessages(sess.Messages)
 	a.sessionManager.SetCurrent(sess)
 	return nil
 }
@@ -432,34 +614,89 @@ func (a *App) Run() error {
 }
 
 func (a *App) runPrintMode() error {
-	if a.options.InitialPrompt == "" {
+	if a.options.InitialPrompt == "" && len(a.options.Images) == 0 {
 		return fmt.Errorf("no prompt provided for print mode")
 	}
 
+	a.startSession()
+	defer a.endSession()
+
+	// MCP tools must be available before the first request
+	a.waitForMCP()
+
 	// Process the prompt
-	response, err := a.processMessage(a.options.InitialPrompt)
+	response, err := a.processMessage(a.options.InitialPrompt, a.options.Images...)
 	if err != nil {
 		return err
 	}
 
+	var structured json.RawMessage
+	if a.options.JSONSchema != nil {
+		structured, err = a.structuredResult()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Output based on format
 	switch a.options.OutputFormat {
 	case "json":
 		output := map[string]interface{}{
 			"result": response,
 		}
+		if structured != nil {
+			output["structured_output"] = structured
+		}
 		if a.currentSession != nil {
 			output["session_id"] = a.currentSession.ID
 		}
+		usage, cost := a.sessionUsage()
+		output["usage"] = map[string]int{
+			"input_tokens":                usage.InputTokens,
+			"output_tokens":               usage.OutputTokens,
+			"cache_creation_input_tokens": usage.CacheCreationInputTokens,
+			"cache_read_input_tokens":     usage.CacheReadInputTokens,
+		}
+		output["total_cost_usd"] = cost
 		data, _ := json.MarshalIndent(output, "", "  ")
 		fmt.Println(string(data))
 	default:
-		fmt.Println(response)
+		if structured != nil {
+			fmt.Println(string(structured))
+		} else {
+			fmt.Println(response)
+		}
 	}
 
 	return nil
 }
 
+// structuredResult asks the model for the result of the finished task as
+// JSON matching the print mode schema
+func (a *App) structuredResult() (json.RawMessage, error) {
+	messages := a.messages()
+	messages = append(messages, llm.NewUserMessage("Give the result of this task as JSON matching the response schema."))
+
+	req := &llm.ChatRequest{
+		Model:          a.config.GetModel(),
+		Messages:       messages,
+		SystemPrompt:   a.currentSystemPrompt(),
+		MaxTokens:      8192,
+		ResponseSchema: a.options.JSONSchema,
+	}
+	warnings, err := llm.CheckRequest(a.provider, req)
+	if err != nil {
+		return nil, err
+	}
+	a.warnOnce(warnings...)
+
+	data, resp, err := llm.ChatJSON(a.ctx, a.provider, req)
+	if resp != nil {
+		a.recordUsage(a.provider, req.Model, resp.Usage)
+	}
+	return data, err
+}
+
 func (a *App) runInteractive() error {
 	// Create or use existing session
 	if a.currentSession == nil {
@@ -475,6 +712,24 @@ func (a *App) runInteractive() error {
 	a.uiModel.SetProviderInfo(a.config.DefaultProvider, a.config.GetModel())
 	a.uiModel.SetSessionID(a.currentSession.ID)
 	a.uiModel.SetVerbose(a.config.Verbose)
+	a.uiModel.SetPermissionMode(string(a.permManager.GetMode()))
+
+	a.startSession()
+
+	// Images pasted in sessions that quit before sending them
+	go utils.RemoveStaleClipboardImages(24 * time.Hour)
+
+	// Index the project for @mention completion before it's first needed
+	go a.loadProjectIndex()
+
+	// Up, down and Ctrl+R reach the prompts of earlier sessions too
+	history, err := session.LoadHistory(a.workDir, a.config.UI.HistoryRedactPatterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: prompt history unavailable: %v\n", err)
+	} else {
+		a.history = history
+		a.uiModel.SetHistory(history.Prompts(), a.saveHistory)
+	}
 
 	// Set up handlers
 	a.uiModel.SetHandlers(
@@ -489,6 +744,15 @@ func (a *App) runInteractive() error {
 		a.handleProviderChange,
 	)
 
+	// Complete MCP prompt commands, and file and resource mentions
+	a.uiModel.SetSuggestionSources(a.mcpCommandItems, a.mentionItems, a.refreshMentions)
+
+	// Set up plan approval and permission mode handlers
+	a.uiModel.SetPlanHandlers(
+		a.handlePlanApproval,
+		a.handleModeCycle,
+	)
+
 	// Create program with proper options for fluid UI
 	a.program = tea.NewProgram(
 		a.uiModel,
@@ -505,7 +769,7 @@ func (a *App) runInteractive() error {
 	}
 
 	// Run the program
-	_, err := a.program.Run()
+	_, err = a.program.Run()
 	return err
 }
 
@@ -516,80 +780,64 @@ func (a *App) handleSubmit(input string) tea.Cmd {
 			ctx := a.createCommandContext()
 			err := commands.Execute(ctx, input)
 			if err != nil {
-				return ui.ErrorMsg{Error: err}
+				return ui.StreamErrorMsg{Error: err}
 			}
-			return ui.StreamDoneMsg{}
+			return a.streamDone()
 		}
 
 		// Process as chat message
-		response, err := a.processMessage(input)
-		if err != nil {
+		if _, err := a.processMessage(input); err != nil {
 			return ui.StreamErrorMsg{Error: err}
 		}
 
-		return ui.StreamDoneMsg{
-			InputTokens:  0,                 // Would come from response
-			OutputTokens: len(response) / 4, // Rough estimate
-		}
+		return a.streamDone()
 	}
 }
 
-func (a *App) handlePermission(resp ui.PermissionResponse) {
-	// Send response through channel to unblock the permission callback
-	// Use blocking send since the permission callback is waiting
-	a.permissionResponse <- resp
-
-	// If user provided feedback on rejection, add it to conversation
-	if !resp.Allowed && resp.Feedback != "" {
-		a.conversation.AddUserMessage("I rejected that change. " + resp.Feedback)
+// saveHistory adds a submitted prompt to the project's history
+func (a *App) saveHistory(prompt string) {
+	if err := a.history.Add(prompt, a.currentSession.ID); err != nil {
+		// Called from the UI's update loop, which Send would block
+		go a.program.Send(ui.ErrorMsg{Error: fmt.Errorf("failed to save prompt history: %w", err)})
 	}
 }
 
-func (a *App) handleModelChange(model string) {
-	a.config.DefaultModel = model
-	providerChanged := false
-
-	// Re-initialize provider if needed (model might be from different provider)
-	if strings.HasPrefix(model, "claude") {
-		if a.config.DefaultProvider != "anthropic" {
-			a.config.DefaultProvider = "anthropic"
-			providerChanged = true
-		}
-	} else if strings.HasPrefix(model, "gpt") || strings.HasPrefix(model, "o1") {
-		if a.config.DefaultProvider != "openai" {
-			a.config.DefaultProvider = "openai"
-			providerChanged = true
-		}
+func (a *App) handlePermission(resp ui.PermissionResponse) {
+	// Unblock the permission callback. Nobody is waiting if the request
+	// was cancelled, and the UI must not block on it.
+	select {
+	case a.permissionResponse <- resp:
+	default:
 	}
 
-	if providerChanged {
-		a.initProvider()
+	// If user provided feedback on rejection, add it to conversation.
+	// Sub-agents get theirs with the denial instead.
+	if !resp.Allowed && resp.Feedback != "" && a.promptAgent == "" {
+		a.addMessages(llm.NewUserMessage("I rejected that change. " + resp.Feedback))
 	}
+}
 
-	// Update UI
-	if a.program != nil {
-		a.uiModel.SetProviderInfo(a.config.DefaultProvider, model)
+// drain discards a response to an abandoned request, so it can't answer
+// the next one
+func drain[T any](responses chan T) {
+	select {
+	case <-responses:
+	default:
 	}
 }
 
-func (a *App) handleProviderChange(provider string) {
-	a.config.DefaultProvider = provider
-
-	// Set default model for the provider
-	switch provider {
-	case "anthropic":
-		a.config.DefaultModel = "claude-sonnet-4-20250514"
-	case "openai":
-		a.config.DefaultModel = "gpt-4o"
+func (a *App) handlePlanApproval(resp ui.PlanApprovalResponse) {
+	// Unblock the ExitPlanMode tool waiting for a decision, if it still is
+	select {
+	case a.planApprovalResponse <- resp:
+	default:
 	}
+}
 
-	// Re-initialize provider
-	a.initProvider()
-
-	// Update UI with new model
-	if a.program != nil {
-		a.uiModel.SetProviderInfo(provider, a.config.DefaultModel)
-	}
+func (a *App) handleModeCycle() string {
+	mode := permissions.NextMode(a.permManager.GetMode())
+	a.switchPermissionMode(mode)
+	return string(mode)
 }
 
 func (a *App) handleQuit() {
@@ -597,6 +845,7 @@ func (a *App) handleQuit() {
 	if a.currentSession != nil {
 		a.sessionManager.Save()
 	}
+	a.endSession()
 	a.cancel()
 }
 
@@ -606,6 +855,10 @@ func (a *App) createCommandContext() *commands.Context {
 		Config:       a.config,
 		Provider:     a.provider,
 		ToolRegistry: a.toolRegistry,
+		Hooks:        a.hookExecutor,
+		MCP:          a.mcpClient,
+		Agents:       a.agentExecutor,
+		Providers:    a.providers,
 		Print: func(s string) {
 			if a.program != nil {
 				a.program.Send(ui.StreamTextMsg{Content: s})
@@ -624,15 +877,15 @@ func (a *App) createCommandContext() *commands.Context {
 			if a.program != nil {
 				a.program.Send(ui.ClearMsg{})
 			}
-			a.conversation.Clear()
-		},
-		SetModel: func(model string) {
-			a.config.DefaultModel = model
-		},
-		SetProvider: func(provider string) {
-			a.config.DefaultProvider = provider
-			a.initProvider()
+			a.setMessages(nil)
 		},
+		SetModel:          a.switchModel,
+		SetProvider:       a.switchProvider,
+		SetPermissionMode: a.setPermissionMode,
+		Compact:           a.compactConversation,
+		ShowMenu:          a.showMenu(),
+		OpenEditor:        a.openEditor,
+		Usage:             a.sessionUsage,
 		Exit: func() {
 			a.handleQuit()
 			if a.program != nil {
@@ -649,18 +902,142 @@ func (a *App) createCommandContext() *commands.Context {
 	}
 }
 
-func (a *App) processMessage(input string) (string, error) {
+// openEditor opens a file in $VISUAL or $EDITOR, handing the terminal over
+// to the editor until it exits
+func (a *App) openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), path)
+
+	if a.program != nil {
+		if err := a.program.ReleaseTerminal(); err != nil {
+			return err
+		}
+		defer a.program.RestoreTerminal()
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	return nil
+}
+
+// showMenu returns a callback that shows a command menu, or nil without a UI
+func (a *App) showMenu() func(string, []commands.MenuItem) {
+	if a.program == nil {
+		return nil
+	}
+	return func(title string, items []commands.MenuItem) {
+		menu := make([]ui.SelectionItem, len(items))
+		for i, item := range items {
+			menu[i] = ui.SelectionItem{ID: item.Command, Label: item.Label, Description: item.Description}
+		}
+		a.program.Send(ui.CommandMenuMsg{Title: title, Items: menu})
+	}
+}
+
+func (a *App) processMessage(input string, images ...string) (string, error) {
+	prompt := input
+
+	// UserPromptSubmit hooks can block the prompt or add context to it
+	result, err := a.hookExecutor.Execute(a.ctx, hooks.Context{
+		Event:  hooks.EventUserPromptSubmit,
+		Prompt: input,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !result.Continue {
+		if result.Message != "" {
+			return "", fmt.Errorf("prompt blocked by hook: %s", result.Message)
+		}
+		return "", fmt.Errorf("prompt blocked by hook")
+	}
+	if result.AdditionalContext != "" {
+		input += "\n\n" + result.AdditionalContext
+	}
+	if notes := a.takeAgentNotes(); notes != "" {
+		input += "\n\n" + notes
+	}
+
+	// Attach resources referenced with @server:uri
+	input, err = a.expandMCPMentions(input)
+	if err != nil {
+		return "", err
+	}
+
+	// Attach files and directories referenced with @path, and images
+	// passed in or referenced that way
+	input, err = a.expandFileMentions(input, prompt)
+	if err != nil {
+		return "", err
+	}
+	images = append(images, a.imageMentions(prompt)...)
+
+	a.stopHookActive = false
+	if len(images) == 0 {
+		return a.runTurn(input)
+	}
+	msg, err := a.newUserMessage(input, images)
+	if err != nil {
+		return "", err
+	}
+	a.addMessages(msg)
+	return a.runTurn("")
+}
+
+// warnOnce shows warnings that haven't been shown yet this session
+func (a *App) warnOnce(warnings ...string) {
+	for _, warning := range warnings {
+		if _, seen := a.warned.LoadOrStore(warning, true); seen {
+			continue
+		}
+		if a.program != nil {
+			a.program.Send(ui.WarningMsg{Content: warning})
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+	}
+}
+
+// runTurn sends the conversation to the model, executing tool calls until
+// the model stops. An empty input continues after tool results.
+func (a *App) runTurn(input string) (string, error) {
 	// Add user message
-	a.conversation.AddUserMessage(input)
+	if input != "" {
+		a.addMessages(llm.NewUserMessage(input))
+	}
+
+	budget, effort, err := llm.ParseThinking(a.config.Thinking)
+	if err != nil {
+		return "", err
+	}
 
-	// Build chat request
+	// Build chat request. Thinking counts toward max tokens, so the
+	// budget comes on top of room for the answer.
 	req := &llm.ChatRequest{
-		Model:        a.config.GetModel(),
-		Messages:     a.conversation.Messages,
-		Tools:        a.toolRegistry.ToLLMTools(),
-		SystemPrompt: a.systemPrompt,
-		MaxTokens:    8192,
+		Model:           a.config.GetModel(),
+		Messages:        a.messages(),
+		Tools:           a.toolRegistry.ToLLMTools(),
+		SystemPrompt:    a.currentSystemPrompt(),
+		MaxTokens:       8192 + budget,
+		ThinkingBudget:  budget,
+		ReasoningEffort: effort,
 	}
+	warnings, err := llm.CheckRequest(a.provider, req)
+	if err != nil {
+		return "", err
+	}
+	a.warnOnce(warnings...)
 
 	// Stream the response
 	events, err := a.provider.Stream(a.ctx, req)
@@ -668,38 +1045,45 @@ func (a *App) processMessage(input string) (string, error) {
 		return "", err
 	}
 
-	var response strings.Builder
-	var pendingToolUses []*llm.ToolUse
+	// The assistant message keeps its text, thinking and tool uses in
+	// order, so the model sees what it said alongside its tool calls
+	message := llm.NewMessageBuilder()
 
 	for event := range events {
+		message.Add(event)
+
 		switch event.Type {
 		case llm.EventTypeText:
-			response.WriteString(event.Delta)
 			if a.program != nil {
 				a.program.Send(ui.StreamTextMsg{Content: event.Delta})
 			}
 
-		case llm.EventTypeToolUse:
-			pendingToolUses = append(pendingToolUses, event.ToolUse)
+		case llm.EventTypeThinking:
+			if event.Delta != "" && a.program != nil {
+				a.program.Send(ui.StreamThinkingMsg{Content: event.Delta})
+			}
+
+		case llm.EventTypeRetry:
+			if a.program != nil {
+				a.program.Send(ui.RetryMsg{Status: event.Retry.String()})
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", event.Retry)
+			}
 
 		case llm.EventTypeDone:
+			if event.Response != nil {
+				a.recordUsage(a.provider, req.Model, event.Response.Usage)
+			}
+
 			// Handle tool uses
-			if len(pendingToolUses) > 0 {
-				err := a.executeToolUses(pendingToolUses)
+			if len(message.ToolUses()) > 0 {
+				err := a.executeToolUses(message.Message())
 				if err != nil {
 					return "", err
 				}
 
 				// Continue conversation after tool execution
-				return a.processMessage("")
-			}
-
-			// Update session
-			if event.Response != nil && a.currentSession != nil {
-				a.currentSession.UpdateTokens(
-					event.Response.Usage.InputTokens,
-					event.Response.Usage.OutputTokens,
-				)
+				return a.runTurn("")
 			}
 
 		case llm.EventTypeError:
@@ -708,27 +1092,111 @@ func (a *App) processMessage(input string) (string, error) {
 	}
 
 	// Add assistant response to conversation
-	responseText := response.String()
-	if responseText != "" {
-		a.conversation.AddAssistantMessage(responseText)
+	responseText := message.Text()
+	if msg := message.Message(); len(msg.Content) > 0 {
+		a.addMessages(msg)
+	}
+
+	// Stop hooks may keep the agent working
+	if instruction := a.runStopHooks(responseText); instruction != "" {
+		a.stopHookActive = true
+		return a.runTurn(instruction)
 	}
 
 	// Save session
 	if a.currentSession != nil {
-		a.currentSession.Messages = a.conversation.Messages
+		a.currentSession.Messages = a.messages()
 		a.sessionManager.Save()
 	}
 
 	return responseText, nil
 }
 
-func (a *App) executeToolUses(toolUses []*llm.ToolUse) error {
-	// Add assistant message with tool uses
-	msg := llm.Message{Role: llm.RoleAssistant}
-	for _, tu := range toolUses {
-		msg.AddToolUse(tu)
+// compactConversation replaces the conversation with a model-written summary
+// to free up context. PreCompact hooks may block it or add instructions.
+func (a *App) compactConversation(instructions string) error {
+	if len(a.messages()) == 0 {
+		return fmt.Errorf("nothing to compact")
+	}
+
+	result, err := a.hookExecutor.Execute(a.ctx, hooks.Context{
+		Event:   hooks.EventPreCompact,
+		Message: "manual",
+		Prompt:  instructions,
+	})
+	if err != nil {
+		return err
+	}
+	if !result.Continue {
+		return fmt.Errorf("compaction blocked by hook: %s", result.Message)
+	}
+	if result.AdditionalContext != "" {
+		instructions = strings.TrimSpace(instructions + "\n" + result.AdditionalContext)
+	}
+
+	prompt := `Summarize this conversation so it can be continued with the summary alone. Include the user's goals, decisions made, files read or changed, and any work still in progress. Be concise but keep every detail needed to continue.`
+	if instructions != "" {
+		prompt += "\n\nAdditional instructions:\n" + instructions
+	}
+
+	messages := a.messages()
+	messages = append(messages, llm.NewUserMessage(prompt))
+
+	resp, err := a.provider.Chat(a.ctx, &llm.ChatRequest{
+		Model:        a.config.GetModel(),
+		Messages:     messages,
+		SystemPrompt: a.systemPrompt,
+		MaxTokens:    4096,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+
+	var summary strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == llm.ContentTypeText {
+			summary.WriteString(block.Text)
+		}
+	}
+	if summary.Len() == 0 {
+		return fmt.Errorf("model returned an empty summary")
+	}
+
+	a.setMessages([]llm.Message{
+		llm.NewUserMessage("This session continues from an earlier conversation. Summary of it so far:\n\n" + summary.String()),
+	})
+
+	if a.currentSession != nil {
+		a.currentSession.Messages = a.messages()
+		a.sessionManager.Save()
+	}
+
+	return nil
+}
+
+// currentSystemPrompt returns the system prompt with any mode-specific
+// instructions appended
+func (a *App) currentSystemPrompt() string {
+	prompt := a.systemPrompt
+	if a.sessionContext != "" {
+		prompt += "\n\n# Session Context\n" + a.sessionContext
+	}
+
+	if a.permManager.GetMode() != permissions.ModePlan {
+		return prompt
 	}
-	a.conversation.AddMessage(msg)
+
+	return prompt + `
+
+# Plan Mode
+Plan mode is active. The user does not want any changes made yet. You MUST NOT edit files, run mutating commands, or call tools that change state; such calls will be rejected. Explore the codebase with read-only tools, design an implementation plan, and then call ExitPlanMode with the plan to request approval.`
+}
+
+// executeToolUses adds the assistant message to the conversation, runs its
+// tool calls and adds their results
+func (a *App) executeToolUses(msg llm.Message) error {
+	a.addMessages(msg)
+	toolUses := msg.GetToolUses()
 
 	// Execute each tool and collect results
 	resultMsg := llm.Message{Role: llm.RoleUser}
@@ -742,15 +1210,41 @@ func (a *App) executeToolUses(toolUses []*llm.ToolUse) error {
 				IsError:   true,
 			}
 		}
+		if !llm.SupportsVision(a.provider, a.config.GetModel()) {
+			result = result.WithoutImages()
+		}
 		resultMsg.AddToolResult(result)
 	}
 
-	a.conversation.AddMessage(resultMsg)
+	a.addMessages(resultMsg)
 	return nil
 }
 
+// addMessages appends messages to the conversation. Hooks read the
+// conversation from other goroutines, so it's changed under conversationMu.
+func (a *App) addMessages(msgs ...llm.Message) {
+	a.conversationMu.Lock()
+	defer a.conversationMu.Unlock()
+	a.conversation.Messages = append(a.conversation.Messages, msgs...)
+}
+
+// setMessages replaces the conversation's messages
+func (a *App) setMessages(msgs []llm.Message) {
+	a.conversationMu.Lock()
+	defer a.conversationMu.Unlock()
+	a.conversation.Messages = append([]llm.Message{}, msgs...)
+}
+
+// messages returns a snapshot of the conversation's messages
+func (a *App) messages() []llm.Message {
+	a.conversationMu.Lock()
+	defer a.conversationMu.Unlock()
+	return append([]llm.Message{}, a.conversation.Messages...)
+}
+
 // Close cleans up the application
 func (a *App) Close() {
+	a.endSession()
 	a.cancel()
 	if a.currentSession != nil {
 		a.sessionManager.Save()
@@ -0,0 +1,654 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/heissanjay/oscode/internal/commands"
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/hooks"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/mcp"
+	"github.com/heissanjay/oscode/internal/permissions"
+	"github.com/heissanjay/oscode/internal/tools"
+	"github.com/heissanjay/oscode/internal/ui"
+	"github.com/heissanjay/oscode/internal/utils"
+)
+
+// newProject sets up an empty project directory as the working directory,
+// with a home directory of its own, and returns its path
+func newProject(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("OSCODE_CONFIG_DIR", filepath.Join(home, ".config", "oscode"))
+
+	workDir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+
+	// Temp dirs may be behind a symlink, and the app uses the real path
+	if workDir, err = os.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+	return workDir
+}
+
+// newReplayApp creates an app in the working directory whose providers
+// play back the scripted exchanges
+func newReplayApp(t *testing.T, exchanges ...llm.Exchange) *App {
+	t.Helper()
+
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+	fixture := &llm.Fixture{Exchanges: exchanges}
+	if err := fixture.Save(fixturePath); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		DefaultProvider: "anthropic",
+		DefaultModel:    "claude-sonnet-4-20250514",
+		Providers: map[string]config.ProviderConfig{
+			"anthropic": {},
+		},
+	}
+	app, err := New(cfg, Options{PrintMode: true, SkipPermissions: true, Replay: fixturePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Close)
+	return app
+}
+
+func TestProcessMessageRunsToolCalls(t *testing.T) {
+	target := filepath.Join(newProject(t), "hello.txt")
+	app := newReplayApp(t,
+		llm.NewToolUseExchange("I'll create the file.", llm.ToolUse{
+			ID:    "call_1",
+			Name:  "Write",
+			Input: map[string]interface{}{"file_path": target, "content": "hello\n"},
+		}),
+		llm.NewTextExchange("Created hello.txt."),
+	)
+
+	response, err := app.processMessage("Create hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Created hello.txt." {
+		t.Errorf("response = %q", response)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("file not written: %v", err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("file content = %q", data)
+	}
+
+	// user, assistant text and tool call, tool result, final answer
+	messages := app.conversation.Messages
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(messages))
+	}
+	toolTurn := messages[1]
+	if toolTurn.GetText() != "I'll create the file." || len(toolTurn.GetToolUses()) != 1 {
+		t.Errorf("tool turn = %+v, want its text and tool call", toolTurn)
+	}
+	result := messages[2].Content[0].ToolResult
+	if result == nil || result.ToolUseID != "call_1" || result.IsError {
+		t.Errorf("tool result = %+v", result)
+	}
+	if app.replay.Remaining() != 0 {
+		t.Errorf("%d exchanges not played", app.replay.Remaining())
+	}
+}
+
+func TestPlanModeOverridesApprovingHooks(t *testing.T) {
+	target := filepath.Join(newProject(t), "hello.txt")
+	app := newReplayApp(t,
+		llm.NewToolUseExchange("I'll create the file.", llm.ToolUse{
+			ID:    "call_1",
+			Name:  "Write",
+			Input: map[string]interface{}{"file_path": target, "content": "hello\n"},
+		}),
+		llm.NewTextExchange("I'll present a plan instead."),
+	)
+	app.switchPermissionMode(permissions.ModePlan)
+	app.hookExecutor = hooks.NewExecutor(config.HookConfig{
+		PreToolUse: []config.HookDefinition{{Matcher: "*", Hooks: []config.HookAction{
+			{Type: "command", Command: `echo '{"decision": "approve"}'`},
+		}}},
+	}, app.workDir)
+	app.toolRegistry.SetHooks(app.hookExecutor)
+
+	if _, err := app.processMessage("Create hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("file written in plan mode: %v", err)
+	}
+	result := app.conversation.Messages[2].Content[0].ToolResult
+	if result == nil || !result.IsError || !strings.Contains(result.Content, "not allowed in plan mode") {
+		t.Errorf("tool result = %+v, want the plan mode denial", result)
+	}
+}
+
+func TestProcessMessageKeepsThinkingOnlyReplies(t *testing.T) {
+	newProject(t)
+	thinking := llm.ContentBlock{Type: llm.ContentTypeThinking, Thinking: "Nothing to add.", Signature: "sig"}
+	app := newReplayApp(t, llm.Exchange{Events: []llm.FixtureEvent{
+		{Type: llm.EventTypeThinking, Block: &thinking},
+		{Type: llm.EventTypeDone, Response: &llm.ChatResponse{StopReason: "end_turn", Content: []llm.ContentBlock{thinking}}},
+	}})
+
+	if _, err := app.processMessage("Anything to add?"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signed thinking goes back with the next request
+	messages := app.conversation.Messages
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want the prompt and the reply", len(messages))
+	}
+	reply := messages[1]
+	if reply.Role != llm.RoleAssistant || len(reply.Content) != 1 || reply.Content[0] != thinking {
+		t.Errorf("reply = %+v, want the thinking block", reply)
+	}
+}
+
+func TestProcessMessageRunsSubAgent(t *testing.T) {
+	workDir := newProject(t)
+	if err := os.WriteFile(filepath.Join(workDir, "VERSION"), []byte("1.2.3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newReplayApp(t,
+		// The main conversation hands the question to an Explore agent,
+		// which reads a file and reports back
+		llm.NewToolUseExchange("", llm.ToolUse{
+			ID:   "call_task",
+			Name: "Task",
+			Input: map[string]interface{}{
+				"description":   "Find the version",
+				"prompt":        "What version is in VERSION?",
+				"subagent_type": "Explore",
+			},
+		}),
+		llm.NewToolUseExchange("", llm.ToolUse{
+			ID:    "call_read",
+			Name:  "Read",
+			Input: map[string]interface{}{"file_path": filepath.Join(workDir, "VERSION")},
+		}),
+		llm.NewTextExchange("The version is 1.2.3."),
+		llm.NewTextExchange("OSCode is at version 1.2.3."),
+	)
+
+	response, err := app.processMessage("What version is this?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "OSCode is at version 1.2.3." {
+		t.Errorf("response = %q", response)
+	}
+
+	// The agent's answer comes back as the Task tool's result
+	result := app.conversation.Messages[2].Content[0].ToolResult
+	if result == nil || result.ToolUseID != "call_task" || !strings.Contains(result.Content, "The version is 1.2.3.") {
+		t.Errorf("task result = %+v", result)
+	}
+	if app.replay.Remaining() != 0 {
+		t.Errorf("%d exchanges not played", app.replay.Remaining())
+	}
+}
+
+func TestProcessMessageFailsWhenFixtureRunsOut(t *testing.T) {
+	newProject(t)
+	app := newReplayApp(t, llm.NewToolUseExchange("", llm.ToolUse{
+		ID:    "call_1",
+		Name:  "Glob",
+		Input: map[string]interface{}{"pattern": "*.go"},
+	}))
+
+	if _, err := app.processMessage("List Go files"); err == nil || !strings.Contains(err.Error(), "recorded exchanges") {
+		t.Errorf("err = %v, want the fixture to run out", err)
+	}
+}
+
+func TestProcessMessageAttachesImages(t *testing.T) {
+	workDir := newProject(t)
+	png := []byte("\x89PNG\r\n\x1a\n")
+	for _, name := range []string{"before.png", "after shot.png"} {
+		if err := os.WriteFile(filepath.Join(workDir, name), png, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := newReplayApp(t, llm.NewTextExchange("The button moved."))
+	prompt := `What changed between @before.png and @"after shot.png"?`
+	if _, err := app.processMessage(prompt, filepath.Join(workDir, "before.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each image is attached once, ahead of the text
+	content := app.conversation.Messages[0].Content
+	if len(content) != 3 {
+		t.Fatalf("got %d content blocks, want 2 images and the text", len(content))
+	}
+	for _, block := range content[:2] {
+		if block.Image == nil || block.Image.MediaType != "image/png" {
+			t.Errorf("block = %+v, want a PNG image", block)
+		}
+	}
+	if content[2].Text != prompt {
+		t.Errorf("text = %q", content[2].Text)
+	}
+}
+
+func TestProcessMessageLeavesMissingImageMentions(t *testing.T) {
+	workDir := newProject(t)
+	app := newReplayApp(t, llm.NewTextExchange("There's no such file."))
+
+	prompt := "What's in @missing.png?"
+	if _, err := app.processMessage(prompt); err != nil {
+		t.Fatal(err)
+	}
+	content := app.conversation.Messages[0].Content
+	if len(content) != 1 || content[0].Text != prompt {
+		t.Errorf("content = %+v, want just the prompt", content)
+	}
+
+	// An image passed in explicitly must exist
+	if _, err := app.processMessage("And this?", filepath.Join(workDir, "missing.png")); err == nil || !strings.Contains(err.Error(), "can't attach image") {
+		t.Errorf("err = %v, want the missing image reported", err)
+	}
+}
+
+func TestProcessMessageDeletesClipboardImages(t *testing.T) {
+	workDir := newProject(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	if err := os.MkdirAll(utils.ClipboardImageDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pasted := filepath.Join(utils.ClipboardImageDir(), "clipboard-1.png")
+	kept := filepath.Join(workDir, "screenshot.png")
+	for _, path := range []string{pasted, kept} {
+		if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := newReplayApp(t, llm.NewTextExchange("Two screenshots."))
+	if _, err := app.processMessage("Compare @" + pasted + " and @screenshot.png"); err != nil {
+		t.Fatal(err)
+	}
+	if images := len(app.conversation.Messages[0].Content) - 1; images != 2 {
+		t.Errorf("attached %d images, want 2", images)
+	}
+	if _, err := os.Stat(pasted); !os.IsNotExist(err) {
+		t.Errorf("pasted image not deleted: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("project image deleted: %v", err)
+	}
+}
+
+func TestProcessMessageInlinesMentionedFiles(t *testing.T) {
+	workDir := newProject(t)
+	if err := os.MkdirAll(filepath.Join(workDir, "cmd", "tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.go":          "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		"cmd/tool/tool.go": "package tool\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := newReplayApp(t, llm.NewTextExchange("It prints hi."))
+	if _, err := app.processMessage("What does @main.go#L5-6 do, and what's in @cmd? Ask @alice."); err != nil {
+		t.Fatal(err)
+	}
+
+	text := app.conversation.Messages[0].GetText()
+	for _, want := range []string{
+		"<file path=\"main.go\" lines=\"5-6\">\n     5\tfunc main() {\n     6\t\tfmt.Println(\"hi\")\n</file>",
+		"<directory path=\"cmd/\">\ntool/\n  tool.go\n</directory>",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "package main") || strings.Contains(text, "alice\"") {
+		t.Errorf("prompt has more than the mentioned lines:\n%s", text)
+	}
+}
+
+func TestPermissionsCommandSetsMode(t *testing.T) {
+	newProject(t)
+	app := newReplayApp(t)
+	ctx := app.createCommandContext()
+
+	if err := commands.Execute(ctx, "/permissions acceptEdits"); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Execute(ctx, "/permissions plan"); err != nil {
+		t.Fatal(err)
+	}
+	if mode := app.permManager.GetMode(); mode != permissions.ModePlan {
+		t.Errorf("mode = %s, want plan", mode)
+	}
+	if app.prePlanMode != permissions.ModeAcceptEdits {
+		t.Errorf("mode before planning = %s, want acceptEdits", app.prePlanMode)
+	}
+
+	if err := commands.Execute(ctx, "/permissions yolo"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if mode := app.permManager.GetMode(); mode != permissions.ModePlan {
+		t.Errorf("mode after an unknown mode = %s, want plan", mode)
+	}
+}
+
+func TestRunMCPPromptKeepsContentBlocks(t *testing.T) {
+	newProject(t)
+	app := newReplayApp(t, llm.NewTextExchange("Looks good."))
+
+	// A server whose prompt has an image and an embedded resource
+	a, b := net.Pipe()
+	fake := mcp.NewConn(mcp.NewStreamTransport(b, b))
+	t.Cleanup(func() { fake.Close() })
+	fake.HandleRequest("initialize", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &mcp.InitializeResult{ProtocolVersion: mcp.ProtocolVersion, Capabilities: mcp.ServerCapabilities{Prompts: &mcp.ListChangedCapability{}}}, nil
+	})
+	fake.HandleRequest("tools/list", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+	})
+	fake.HandleRequest("prompts/list", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &mcp.ListPromptsResult{Prompts: []mcp.Prompt{{Name: "review"}}}, nil
+	})
+	fake.HandleRequest("prompts/get", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &mcp.GetPromptResult{Messages: []mcp.PromptMessage{
+			{Role: "user", Content: mcp.PromptContent{Type: "text", Text: "Review this screenshot"}},
+			{Role: "user", Content: mcp.PromptContent{Type: "image", MimeType: "image/png", Data: "iVBORw0KGgo="}},
+			{Role: "user", Content: mcp.PromptContent{Type: "resource", Resource: &mcp.ResourceContents{URI: "file:///style.md", Text: "Use tabs."}}},
+		}}, nil
+	})
+	if err := app.mcpClient.ConnectTransport("docs", config.MCPServerConfig{}, mcp.NewStreamTransport(a, a)); err != nil {
+		t.Fatal(err)
+	}
+	server, _ := app.mcpClient.GetServer("docs")
+
+	app.addMessages(llm.NewUserMessage("Earlier question"), llm.NewAssistantMessage("Earlier answer"))
+	if err := app.runMCPPrompt(server, "review", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := app.messages()
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want the earlier turn, the prompt and the answer", len(messages))
+	}
+	content := messages[2].Content
+	if len(content) != 3 {
+		t.Fatalf("prompt has %d content blocks, want text, image and resource", len(content))
+	}
+	if content[0].Text != "Review this screenshot" {
+		t.Errorf("first block = %+v", content[0])
+	}
+	if content[1].Image == nil || content[1].Image.MediaType != "image/png" {
+		t.Errorf("second block = %+v, want the image", content[1])
+	}
+	if !strings.Contains(content[2].Text, "Use tabs.") {
+		t.Errorf("third block = %+v, want the resource", content[2])
+	}
+	if messages[3].GetText() != "Looks good." {
+		t.Errorf("answer = %q", messages[3].GetText())
+	}
+}
+
+// newOllamaServer fakes an Ollama server whose model writes a file and
+// then answers, counting the chat requests it gets
+func newOllamaServer(t *testing.T, target string) (string, *int) {
+	t.Helper()
+	chats := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			fmt.Fprint(w, `{"capabilities": ["completion", "tools"]}`)
+		case "/api/chat":
+			chats++
+			if chats == 1 {
+				call := map[string]interface{}{"function": map[string]interface{}{
+					"name":      "Write",
+					"arguments": map[string]interface{}{"file_path": target, "content": "hello\n"},
+				}}
+				fmt.Fprintln(w, mustJSON(t, map[string]interface{}{"model": "qwen3", "message": map[string]interface{}{"role": "assistant", "content": "", "tool_calls": []interface{}{call}}, "done": false}))
+			} else {
+				fmt.Fprintln(w, `{"model": "qwen3", "message": {"role": "assistant", "content": "Created hello.txt."}, "done": false}`)
+			}
+			fmt.Fprintln(w, `{"model": "qwen3", "message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "stop"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &chats
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRecordThenReplayByHash(t *testing.T) {
+	target := filepath.Join(newProject(t), "hello.txt")
+	serverURL, chats := newOllamaServer(t, target)
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+
+	newApp := func(opts Options) *App {
+		cfg := &config.Config{
+			DefaultProvider: "ollama",
+			DefaultModel:    "qwen3",
+			Providers: map[string]config.ProviderConfig{
+				"ollama": {BaseURL: serverURL},
+			},
+		}
+		opts.PrintMode = true
+		opts.SkipPermissions = true
+		app, err := New(cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(app.Close)
+		return app
+	}
+
+	recording := newApp(Options{Record: fixturePath})
+	response, err := recording.processMessage("Create hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Created hello.txt." || *chats != 2 {
+		t.Fatalf("response = %q after %d requests", response, *chats)
+	}
+
+	// Play the recording back by request hash, with the exchanges out of
+	// order to show they're found by content
+	fixture, err := llm.LoadFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixture.Exchanges) != 2 {
+		t.Fatalf("recorded %d exchanges, want 2", len(fixture.Exchanges))
+	}
+	fixture.Match = llm.MatchHash
+	fixture.Exchanges[0], fixture.Exchanges[1] = fixture.Exchanges[1], fixture.Exchanges[0]
+	if err := fixture.Save(fixturePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+
+	replaying := newApp(Options{Replay: fixturePath})
+	response, err = replaying.processMessage("Create hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Created hello.txt." {
+		t.Errorf("replayed response = %q", response)
+	}
+	if *chats != 2 {
+		t.Errorf("replay reached the server: %d requests", *chats)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "hello\n" {
+		t.Errorf("replayed tool call didn't write the file: %q, %v", data, err)
+	}
+	if replaying.replay.Remaining() != 0 {
+		t.Errorf("%d exchanges not played", replaying.replay.Remaining())
+	}
+}
+
+// newSilentProgram returns a UI program that drops every message, so tests
+// can answer prompts through the app's handlers
+func newSilentProgram() *tea.Program {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return tea.NewProgram(nil, tea.WithContext(ctx), tea.WithInput(nil), tea.WithOutput(io.Discard))
+}
+
+func TestPermissionPromptGivesUpWhenCancelled(t *testing.T) {
+	newProject(t)
+	app := newReplayApp(t)
+	app.permManager.SetSkipPermissions(false)
+	app.program = newSilentProgram()
+	input := map[string]interface{}{"file_path": "notes.txt", "content": "hi"}
+
+	// Killing a background agent cancels its context while it waits
+	ctx, cancel := context.WithCancel(context.Background())
+	agent := app.permManager.ForAgent("general-purpose (agent-1)", "", false)
+	done := make(chan error, 1)
+	go func() {
+		allowed, err := agent.RequestPermission(ctx, "Write", input)
+		if allowed {
+			err = fmt.Errorf("allowed")
+		}
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want a denial for the cancelled request", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("permission request still waiting after cancel")
+	}
+
+	// Late answers to the abandoned prompt neither block the UI nor answer
+	// the next prompt
+	app.handlePermission(ui.PermissionResponse{Allowed: true})
+	app.handlePermission(ui.PermissionResponse{Allowed: true})
+
+	result := make(chan bool, 1)
+	go func() {
+		allowed, _ := app.permManager.RequestPermission(context.Background(), "Write", input)
+		result <- allowed
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case allowed := <-result:
+			if allowed {
+				t.Error("a stale answer allowed the next request")
+			}
+			return
+		case <-deadline:
+			t.Fatal("permission request not answered")
+		case <-time.After(10 * time.Millisecond):
+			app.handlePermission(ui.PermissionResponse{Allowed: false})
+		}
+	}
+}
+
+func TestPlanApprovalIgnoresStaleAnswers(t *testing.T) {
+	newProject(t)
+	app := newReplayApp(t)
+	app.program = newSilentProgram()
+	app.switchPermissionMode(permissions.ModePlan)
+
+	// The tool call is cancelled before the user answers
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := app.requestPlanApproval(ctx, "1. Do it"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want the cancellation", err)
+	}
+
+	// Late answers neither block the UI nor approve the next plan
+	done := make(chan struct{})
+	go func() {
+		app.handlePlanApproval(ui.PlanApprovalResponse{Choice: ui.PlanChoiceAcceptEdits})
+		app.handlePlanApproval(ui.PlanApprovalResponse{Choice: ui.PlanChoiceAcceptEdits})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("answering an abandoned plan approval blocked")
+	}
+
+	type approval struct {
+		tools.PlanApproval
+		err error
+	}
+	result := make(chan approval, 1)
+	go func() {
+		got, err := app.requestPlanApproval(context.Background(), "2. Do it properly")
+		result <- approval{got, err}
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-result:
+			if got.err != nil || got.Decision != tools.PlanKeepPlanning || got.Feedback != "smaller steps" {
+				t.Errorf("approval = %+v, %v, want the user's answer to keep planning", got.PlanApproval, got.err)
+			}
+			if mode := app.permManager.GetMode(); mode != permissions.ModePlan {
+				t.Errorf("mode = %s, want still planning", mode)
+			}
+			return
+		case <-deadline:
+			t.Fatal("plan approval not answered")
+		case <-time.After(10 * time.Millisecond):
+			app.handlePlanApproval(ui.PlanApprovalResponse{Choice: ui.PlanChoiceKeepPlanning, Feedback: "smaller steps"})
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/hooks"
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+func (a *App) initHooks() {
+	a.hookExecutor = hooks.NewExecutor(a.config.Hooks, a.workDir)
+	a.hookExecutor.SetProvider(a.provider, config.GetFastModel(a.config.DefaultProvider, a.config.GetModel()))
+
+	// Non-blocking hook failures are shown to the user
+	a.hookExecutor.SetErrorHandler(func(message string) {
+		if a.program != nil {
+			a.program.Send(ui.SystemMsg{Content: "Hook error: " + message})
+		} else if a.config.Verbose {
+			fmt.Printf("Hook error: %s\n", message)
+		}
+	})
+	a.hookExecutor.SetOutputHandler(func(output string) {
+		if a.program != nil {
+			a.program.Send(ui.SystemMsg{Content: "Hook output: " + output})
+		} else if a.config.Verbose {
+			fmt.Printf("Hook output: %s\n", output)
+		}
+	})
+}
+
+// startSession runs SessionStart hooks. Context they return is added to the
+// system prompt for the rest of the session.
+func (a *App) startSession() {
+	sessionID := ""
+	if a.currentSession != nil {
+		sessionID = a.currentSession.ID
+	}
+	a.hookExecutor.SetSession(sessionID, a.messages)
+
+	result, err := a.hookExecutor.Execute(a.ctx, hooks.Context{Event: hooks.EventSessionStart})
+	if err == nil && result.AdditionalContext != "" {
+		a.sessionContext = result.AdditionalContext
+	}
+}
+
+// endSession runs SessionEnd hooks once, however the app exits
+func (a *App) endSession() {
+	a.endSessionOnce.Do(func() {
+		// The app context may already be cancelled
+		a.hookExecutor.Execute(context.Background(), hooks.Context{Event: hooks.EventSessionEnd})
+	})
+}
+
+// notify runs Notification hooks without blocking the caller
+func (a *App) notify(message string) {
+	if !a.hookExecutor.HasHooks(hooks.EventNotification) {
+		return
+	}
+	go a.hookExecutor.Execute(a.ctx, hooks.Context{
+		Event:   hooks.EventNotification,
+		Message: message,
+	})
+}
+
+// runPermissionHooks runs PermissionRequest hooks before the user is asked.
+// It reports whether a hook decided, and if so whether the tool is allowed.
+func (a *App) runPermissionHooks(tool string, input map[string]interface{}) (decided, allowed bool, err error) {
+	result, err := a.hookExecutor.Execute(a.ctx, hooks.Context{
+		Event:    hooks.EventPermissionRequest,
+		ToolName: tool,
+		Input:    input,
+	})
+	if err != nil {
+		return false, false, nil
+	}
+
+	switch {
+	case !result.Continue:
+		if result.Message != "" {
+			return true, false, fmt.Errorf("blocked by PermissionRequest hook: %s", result.Message)
+		}
+		return true, false, fmt.Errorf("blocked by PermissionRequest hook")
+	case result.Decision == hooks.DecisionApprove:
+		return true, true, nil
+	default:
+		return false, false, nil
+	}
+}
+
+// runStopHooks runs Stop hooks when the agent finishes a turn and returns
+// the instruction to keep going with, if a hook blocked the stop
+func (a *App) runStopHooks(response string) string {
+	result, err := a.hookExecutor.Execute(a.ctx, hooks.Context{
+		Event:          hooks.EventStop,
+		Result:         response,
+		StopHookActive: a.stopHookActive,
+	})
+	if err != nil || result.Continue {
+		return ""
+	}
+	return result.Instruction
+}
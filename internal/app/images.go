@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/utils"
+)
+
+// maxImageSize is the largest image the providers accept
+const maxImageSize = 5 << 20
+
+// imageMentions returns the images referenced with @path in a prompt.
+// Mentions of other files, and of images that don't exist, are left alone
+// like other mentions that name no file.
+func (a *App) imageMentions(input string) []string {
+	var images []string
+	for _, path := range pathMentions(input) {
+		if !llm.IsImageFile(path) {
+			continue
+		}
+		resolved := a.resolvePath(path)
+		if info, err := os.Stat(resolved); err != nil || info.IsDir() {
+			continue
+		}
+		images = append(images, resolved)
+	}
+	return images
+}
+
+// resolvePath makes a path from a prompt or flag absolute, relative to the
+// working directory
+func (a *App) resolvePath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.workDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// newUserMessage builds a user message with images ahead of the prompt's
+// text. Images need a model that accepts them. Images pasted from the
+// clipboard are deleted once read, since the message holds their data.
+func (a *App) newUserMessage(input string, images []string) (llm.Message, error) {
+	defer func() {
+		for _, path := range images {
+			utils.RemoveClipboardImage(a.resolvePath(path))
+		}
+	}()
+
+	msg := llm.Message{Role: llm.RoleUser}
+	if len(images) > 0 && !llm.SupportsVision(a.provider, a.config.GetModel()) {
+		return msg, fmt.Errorf("model %s doesn't accept images. Switch to another model with /model", a.config.GetModel())
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range images {
+		path = a.resolvePath(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return msg, fmt.Errorf("can't attach image: %w", err)
+		}
+		if info.Size() > maxImageSize {
+			return msg, fmt.Errorf("can't attach %s: images must be under %dMB", filepath.Base(path), maxImageSize>>20)
+		}
+		if err := msg.AddImage(path); err != nil {
+			return msg, fmt.Errorf("can't attach %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	if input != "" {
+		msg.AddText(input)
+	}
+	return msg, nil
+}
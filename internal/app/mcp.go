@@ -0,0 +1,318 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/commands"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/mcp"
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+// mcpMentionPattern matches @server:uri resource mentions
+var mcpMentionPattern = regexp.MustCompile(`(^|\s)@([A-Za-z0-9_.-]+):(\S+)`)
+
+// mcpStartupTimeout bounds how long print mode waits for MCP servers
+const mcpStartupTimeout = 30 * time.Second
+
+// mcpCommandPrefix starts the names of commands backed by MCP prompts
+const mcpCommandPrefix = "mcp__"
+
+// mcpCommandName returns the slash command name for a server prompt
+func mcpCommandName(server, prompt string) string {
+	clean := strings.NewReplacer(" ", "_", "/", "_")
+	return mcpCommandPrefix + clean.Replace(server) + "__" + clean.Replace(prompt)
+}
+
+// handleMCPStatus keeps tools and commands in step with a server's
+// connection and tells the user when it drops
+func (a *App) handleMCPStatus(serverName string) {
+	a.refreshMCPTools(serverName)
+	a.registerMCPPrompts(serverName)
+
+	status, ok := a.mcpClient.Status(serverName)
+	if !ok || a.program == nil {
+		return
+	}
+
+	switch status.State {
+	case mcp.StateFailed:
+		a.program.Send(ui.SystemMsg{Content: fmt.Sprintf("MCP server %s failed: %s (see /mcp)", serverName, status.Error)})
+	case mcp.StateRestarting:
+		a.program.Send(ui.SystemMsg{Content: fmt.Sprintf("MCP server %s stopped, restarting...", serverName)})
+	}
+}
+
+// handleMCPAuthorize shows the URL a remote server needs the user to log in
+// at. Stderr would be hidden under the UI.
+func (a *App) handleMCPAuthorize(serverName, authURL string) {
+	message := fmt.Sprintf("MCP server %s needs authorization. Opening your browser; if it doesn't open, visit:\n%s", serverName, authURL)
+	a.notify(fmt.Sprintf("MCP server %s needs authorization", serverName))
+	if a.program != nil {
+		a.program.Send(ui.SystemMsg{Content: message})
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+}
+
+// waitForMCP blocks until configured servers have connected or failed, and
+// reports failures on stderr
+func (a *App) waitForMCP() {
+	a.mcpClient.Wait(mcpStartupTimeout)
+
+	for _, status := range a.mcpClient.Statuses() {
+		switch status.State {
+		case mcp.StateFailed:
+			fmt.Fprintf(os.Stderr, "Warning: failed to connect to MCP server %s: %s\n", status.Name, status.Error)
+		case mcp.StateConnecting:
+			fmt.Fprintf(os.Stderr, "Warning: MCP server %s is still connecting\n", status.Name)
+		}
+	}
+}
+
+// registerMCPPrompts exposes a server's prompts as /mcp__server__prompt
+// commands, replacing any registered earlier
+func (a *App) registerMCPPrompts(serverName string) {
+	prefix := mcpCommandName(serverName, "")
+	for _, cmd := range commands.DefaultRegistry.List() {
+		if strings.HasPrefix(cmd.Name, prefix) {
+			commands.DefaultRegistry.Unregister(cmd.Name)
+		}
+	}
+
+	server, ok := a.mcpClient.GetServer(serverName)
+	if !ok {
+		return
+	}
+
+	for _, prompt := range server.ListPrompts() {
+		commands.Register(a.mcpPromptCommand(server, prompt))
+	}
+}
+
+func (a *App) mcpPromptCommand(server *mcp.Server, prompt mcp.Prompt) *commands.Command {
+	name := mcpCommandName(server.Name, prompt.Name)
+
+	usage := "/" + name
+	for _, arg := range prompt.Arguments {
+		if arg.Required {
+			usage += " <" + arg.Name + ">"
+		} else {
+			usage += " [" + arg.Name + "]"
+		}
+	}
+
+	description := prompt.Description
+	if description == "" {
+		description = prompt.Title
+	}
+	if description == "" {
+		description = fmt.Sprintf("Prompt from MCP server %s", server.Name)
+	}
+
+	return &commands.Command{
+		Name:        name,
+		Description: description + " (MCP)",
+		Usage:       usage,
+		Handler: func(ctx *commands.Context, args string) error {
+			values, err := parsePromptArgs(prompt, args)
+			if err != nil {
+				return fmt.Errorf("%v\n%s", err, promptArgHelp(usage, prompt))
+			}
+			return a.runMCPPrompt(server, prompt.Name, values)
+		},
+	}
+}
+
+// parsePromptArgs maps command arguments onto a prompt's arguments. Values
+// are given as name=value pairs or positionally, with the last argument
+// taking the rest of the line.
+func parsePromptArgs(prompt mcp.Prompt, args string) (map[string]string, error) {
+	values := make(map[string]string)
+	fields := strings.Fields(args)
+
+	known := make(map[string]bool)
+	for _, arg := range prompt.Arguments {
+		known[arg.Name] = true
+	}
+
+	var positional []string
+	for _, field := range fields {
+		if key, value, ok := strings.Cut(field, "="); ok && known[key] {
+			values[key] = value
+			continue
+		}
+		positional = append(positional, field)
+	}
+
+	var unfilled []string
+	for _, arg := range prompt.Arguments {
+		if _, ok := values[arg.Name]; !ok {
+			unfilled = append(unfilled, arg.Name)
+		}
+	}
+	for i, name := range unfilled {
+		if i >= len(positional) {
+			break
+		}
+		if i == len(unfilled)-1 {
+			values[name] = strings.Join(positional[i:], " ")
+			break
+		}
+		values[name] = positional[i]
+	}
+
+	var missing []string
+	for _, arg := range prompt.Arguments {
+		if arg.Required && values[arg.Name] == "" {
+			missing = append(missing, arg.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required argument: %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// promptArgHelp describes a prompt's arguments for the user
+func promptArgHelp(usage string, prompt mcp.Prompt) string {
+	var sb strings.Builder
+	sb.WriteString("Usage: " + usage)
+	for _, arg := range prompt.Arguments {
+		sb.WriteString("\n  " + arg.Name)
+		if arg.Required {
+			sb.WriteString(" (required)")
+		}
+		if arg.Description != "" {
+			sb.WriteString(": " + arg.Description)
+		}
+	}
+	return sb.String()
+}
+
+// runMCPPrompt renders a server prompt, adds its messages to the
+// conversation with their images and embedded resources, and runs a turn
+// when the prompt ends with the user
+func (a *App) runMCPPrompt(server *mcp.Server, name string, args map[string]string) error {
+	result, err := server.GetPrompt(a.ctx, name, args)
+	if err != nil {
+		return err
+	}
+
+	messages := mcp.PromptMessages(result)
+	if len(messages) == 0 {
+		return fmt.Errorf("prompt %s returned no messages", name)
+	}
+	if hasImages(messages) && !llm.SupportsVision(a.provider, a.config.GetModel()) {
+		return fmt.Errorf("prompt %s includes images, which model %s doesn't accept. Switch to another model with /model", name, a.config.GetModel())
+	}
+
+	a.appendMessages(messages)
+	if messages[len(messages)-1].Role != llm.RoleUser {
+		return nil
+	}
+
+	a.stopHookActive = false
+	_, err = a.runTurn("")
+	return err
+}
+
+// appendMessages adds messages to the conversation, merging the first into
+// the last message there when they're from the same role
+func (a *App) appendMessages(messages []llm.Message) {
+	a.conversationMu.Lock()
+	defer a.conversationMu.Unlock()
+
+	existing := a.conversation.Messages
+	if n := len(existing); n > 0 && len(messages) > 0 && existing[n-1].Role == messages[0].Role {
+		merged := existing[n-1]
+		merged.Content = append(append([]llm.ContentBlock{}, merged.Content...), messages[0].Content...)
+		existing = append(existing[:n-1:n-1], merged)
+		messages = messages[1:]
+	}
+	a.conversation.Messages = append(existing, messages...)
+}
+
+// hasImages reports whether any of the messages carry an image
+func hasImages(messages []llm.Message) bool {
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			if block.Type == llm.ContentTypeImage {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandMCPMentions attaches the contents of @server:uri mentions to the
+// prompt. Mentions of unknown servers are left alone.
+func (a *App) expandMCPMentions(input string) (string, error) {
+	if a.mcpClient == nil {
+		return input, nil
+	}
+
+	var attachments []string
+	seen := make(map[string]bool)
+	for _, match := range mcpMentionPattern.FindAllStringSubmatch(input, -1) {
+		serverName := match[2]
+		uri := strings.TrimRight(match[3], ".,;!?)")
+
+		server, ok := a.mcpClient.GetServer(serverName)
+		if !ok || seen[serverName+":"+uri] {
+			continue
+		}
+		seen[serverName+":"+uri] = true
+
+		result, err := server.ReadResource(a.ctx, uri)
+		if err != nil {
+			return "", err
+		}
+		attachments = append(attachments, fmt.Sprintf("<resource server=%q uri=%q>\n%s\n</resource>",
+			serverName, uri, mcp.FormatResourceContents(result.Contents)))
+	}
+
+	if len(attachments) == 0 {
+		return input, nil
+	}
+	return input + "\n\n" + strings.Join(attachments, "\n\n"), nil
+}
+
+// mcpCommandItems lists prompt commands for slash command completion
+func (a *App) mcpCommandItems() []ui.SelectionItem {
+	var items []ui.SelectionItem
+	for _, cmd := range commands.DefaultRegistry.List() {
+		if strings.HasPrefix(cmd.Name, mcpCommandPrefix) {
+			items = append(items, ui.SelectionItem{
+				ID:          cmd.Name,
+				Label:       "/" + cmd.Name,
+				Description: cmd.Description,
+			})
+		}
+	}
+	return items
+}
+
+// mcpMentionItems lists server resources for @mention completion
+func (a *App) mcpMentionItems() []ui.SelectionItem {
+	if a.mcpClient == nil {
+		return nil
+	}
+
+	var items []ui.SelectionItem
+	for _, server := range a.mcpClient.Servers() {
+		for _, r := range server.ListResources() {
+			id := server.Name + ":" + r.URI
+			items = append(items, ui.SelectionItem{
+				ID:          id,
+				Label:       "@" + id,
+				Description: r.Name,
+			})
+		}
+	}
+	return items
+}
@@ -0,0 +1,361 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/ui"
+	"github.com/heissanjay/oscode/internal/utils"
+)
+
+// pathMentionPattern matches @path mentions. Paths with spaces are quoted.
+var pathMentionPattern = regexp.MustCompile(`(^|\s)@("[^"]+"|\S+)`)
+
+// lineRangePattern matches a #L10-40 line range at the end of a mention
+var lineRangePattern = regexp.MustCompile(`^(.+)#L(\d+)(?:-L?(\d+))?$`)
+
+const (
+	maxMentionBytes  = 100 * 1024 // File content inlined per mention
+	maxTreeEntries   = 200        // Entries listed per directory mention
+	maxTreeDepth     = 3
+	maxWalkFiles     = 10000 // Files listed outside a git repository
+	projectFilesTTL  = 10 * time.Second
+	binarySniffBytes = 8000
+)
+
+// skippedDirs are left out of directory walks
+var skippedDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "__pycache__": true,
+	"dist": true, "build": true, "target": true,
+}
+
+// projectIndex caches the project's files for mention completion
+type projectIndex struct {
+	files  []string
+	items  []ui.SelectionItem
+	listed time.Time
+}
+
+// pathMentions returns the paths mentioned with @path in a prompt, without
+// quotes or trailing punctuation
+func pathMentions(input string) []string {
+	var paths []string
+	for _, match := range pathMentionPattern.FindAllStringSubmatch(input, -1) {
+		path := match[2]
+		if strings.HasPrefix(path, `"`) {
+			path = strings.Trim(path, `"`)
+		} else {
+			path = strings.TrimRight(path, ".,;!?)")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// expandFileMentions attaches the contents of files and the layout of
+// directories mentioned with @path in prompt to the input. A file mention
+// can name lines, as in @main.go#L10-40. Mentions of paths that don't exist
+// are left alone.
+func (a *App) expandFileMentions(input, prompt string) (string, error) {
+	var attachments []string
+	seen := make(map[string]bool)
+	for _, mention := range pathMentions(prompt) {
+		path, start, end := mention, 0, 0
+		if match := lineRangePattern.FindStringSubmatch(mention); match != nil {
+			path = match[1]
+			start, _ = strconv.Atoi(match[2])
+			end = start
+			if match[3] != "" {
+				end, _ = strconv.Atoi(match[3])
+			}
+			if start < 1 || end < start {
+				return "", fmt.Errorf("invalid line range in @%s", mention)
+			}
+		}
+		if llm.IsImageFile(path) || seen[mention] {
+			continue
+		}
+
+		resolved := a.resolvePath(path)
+		info, err := os.Stat(resolved)
+		if err != nil {
+			continue
+		}
+		seen[mention] = true
+
+		name := a.displayPath(resolved)
+		if info.IsDir() {
+			attachments = append(attachments, fmt.Sprintf("<directory path=%q>\n%s\n</directory>",
+				name+"/", a.directoryTree(resolved)))
+			continue
+		}
+
+		content, lines, err := readMentionedFile(resolved, start, end)
+		if err != nil {
+			return "", fmt.Errorf("can't attach @%s: %w", mention, err)
+		}
+		if lines != "" {
+			attachments = append(attachments, fmt.Sprintf("<file path=%q lines=%q>\n%s\n</file>", name, lines, content))
+		} else {
+			attachments = append(attachments, fmt.Sprintf("<file path=%q>\n%s\n</file>", name, content))
+		}
+	}
+
+	if len(attachments) == 0 {
+		return input, nil
+	}
+	return input + "\n\n" + strings.Join(attachments, "\n\n"), nil
+}
+
+// readMentionedFile returns a file's lines from start to end, numbered like
+// the Read tool's output, and the range it covers. A zero start reads the
+// whole file. Content beyond maxMentionBytes is cut off.
+func readMentionedFile(path string, start, end int) (content, lines string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if head, _ := reader.Peek(binarySniffBytes); bytes.IndexByte(head, 0) >= 0 {
+		return "(binary file, not inlined)", "", nil
+	}
+
+	var b strings.Builder
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum, last := 0, 0
+	truncated := false
+	for scanner.Scan() {
+		lineNum++
+		if lineNum < start || (end > 0 && lineNum > end) {
+			continue
+		}
+		line := fmt.Sprintf("%6d\t%s\n", lineNum, scanner.Text())
+		if b.Len()+len(line) > maxMentionBytes {
+			truncated = true
+			break
+		}
+		b.WriteString(line)
+		last = lineNum
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	if start > 0 && last == 0 && !truncated {
+		return "", "", fmt.Errorf("the file has %d lines", lineNum)
+	}
+	content = strings.TrimSuffix(b.String(), "\n")
+	if content == "" {
+		content = "(empty file)"
+	}
+	if truncated {
+		content += fmt.Sprintf("\n... (truncated after line %d; use Read for the rest)", last)
+	}
+	if start > 0 {
+		lines = fmt.Sprintf("%d-%d", start, last)
+	}
+	return content, lines, nil
+}
+
+// directoryTree lists a directory's files as an indented tree, a few levels
+// deep
+func (a *App) directoryTree(dir string) string {
+	var files []string
+	if rel, err := filepath.Rel(a.workDir, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		// Inside the project, list what completion offers
+		prefix := filepath.ToSlash(rel) + "/"
+		for _, file := range a.projectFiles() {
+			if rel == "." {
+				files = append(files, file)
+			} else if strings.HasPrefix(file, prefix) {
+				files = append(files, strings.TrimPrefix(file, prefix))
+			}
+		}
+	}
+	if len(files) == 0 {
+		// Outside the project, or ignored by git
+		files = walkFiles(dir)
+	}
+	if len(files) == 0 {
+		return "(empty directory)"
+	}
+	return fileTree(files)
+}
+
+// fileTree renders sorted slash-separated paths as an indented tree
+func fileTree(files []string) string {
+	var b strings.Builder
+	listed := make(map[string]bool)
+	entries, omitted := 0, 0
+	for _, file := range files {
+		parts := strings.Split(file, "/")
+		for depth := range parts {
+			if depth >= maxTreeDepth {
+				break
+			}
+			entry := strings.Join(parts[:depth+1], "/")
+			if listed[entry] {
+				continue
+			}
+			listed[entry] = true
+			if entries == maxTreeEntries {
+				omitted++
+				continue
+			}
+
+			name := parts[depth]
+			if depth < len(parts)-1 {
+				name += "/"
+			}
+			b.WriteString(strings.Repeat("  ", depth) + name + "\n")
+			entries++
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "... %d more entries\n", omitted)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// displayPath shows a path relative to the working directory when it's
+// inside it
+func (a *App) displayPath(path string) string {
+	if rel, err := filepath.Rel(a.workDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// projectFiles lists the project's files relative to the working
+// directory: those tracked by git, or a walk outside a repository
+func (a *App) projectFiles() []string {
+	return a.loadProjectIndex().files
+}
+
+// mentionItems lists everything that can be @mentioned. It runs on the
+// UI's update loop, so files come from the last index built by
+// refreshMentions.
+func (a *App) mentionItems() []ui.SelectionItem {
+	a.projectMu.Lock()
+	files := a.project.items
+	a.projectMu.Unlock()
+	return append(append([]ui.SelectionItem{}, files...), a.mcpMentionItems()...)
+}
+
+// refreshMentions rebuilds the project index when it's stale. The UI runs
+// it as a command while a mention is typed, and refilters on the message
+// it returns.
+func (a *App) refreshMentions() tea.Msg {
+	a.projectMu.Lock()
+	before := a.project.listed
+	a.projectMu.Unlock()
+
+	if a.loadProjectIndex().listed.Equal(before) {
+		return nil
+	}
+	return ui.MentionsUpdatedMsg{}
+}
+
+// loadProjectIndex returns the project index, rebuilding it if it's older
+// than projectFilesTTL. The index is cached, as completion asks for it
+// while a mention is typed.
+func (a *App) loadProjectIndex() projectIndex {
+	a.projectBuildMu.Lock()
+	defer a.projectBuildMu.Unlock()
+
+	// Completion reads the cache while the index is built, so projectMu
+	// is only held to swap it
+	a.projectMu.Lock()
+	index := a.project
+	a.projectMu.Unlock()
+	if !index.listed.IsZero() && time.Since(index.listed) < projectFilesTTL {
+		return index
+	}
+
+	index = buildProjectIndex(a.workDir)
+	a.projectMu.Lock()
+	a.project = index
+	a.projectMu.Unlock()
+	return index
+}
+
+// buildProjectIndex lists a project's files, and its files and directories
+// for @mention completion, shallowest first
+func buildProjectIndex(workDir string) projectIndex {
+	files, err := utils.GetTrackedFiles(workDir)
+	if err != nil {
+		files = walkFiles(workDir)
+	}
+	sort.Strings(files)
+
+	// Directories come from the files in them
+	var paths []string
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		paths = append(paths, file)
+		for dir := filepath.ToSlash(filepath.Dir(file)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			if dirs[dir] {
+				break
+			}
+			dirs[dir] = true
+			paths = append(paths, dir+"/")
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		di := strings.Count(strings.TrimSuffix(paths[i], "/"), "/")
+		dj := strings.Count(strings.TrimSuffix(paths[j], "/"), "/")
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	items := make([]ui.SelectionItem, len(paths))
+	for i, path := range paths {
+		items[i] = ui.SelectionItem{ID: path, Label: "@" + path}
+	}
+
+	return projectIndex{files: files, items: items, listed: time.Now()}
+}
+
+// walkFiles lists the files under root, relative to it, skipping hidden and
+// dependency directories
+func walkFiles(root string) []string {
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip errors
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || skippedDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(files) == maxWalkFiles {
+			return filepath.SkipAll
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+func TestLineRangePattern(t *testing.T) {
+	tests := []struct {
+		mention          string
+		path, start, end string
+		ok               bool
+	}{
+		{"main.go#L10-40", "main.go", "10", "40", true},
+		{"main.go#L10-L40", "main.go", "10", "40", true},
+		{"main.go#L7", "main.go", "7", "", true},
+		{"notes#1.md#L3", "notes#1.md", "3", "", true},
+		{"main.go", "", "", "", false},
+		{"main.go#10", "", "", "", false},
+		{"main.go#L", "", "", "", false},
+		{"#L5", "", "", "", false},
+	}
+	for _, tt := range tests {
+		match := lineRangePattern.FindStringSubmatch(tt.mention)
+		if (match != nil) != tt.ok {
+			t.Errorf("%q: matched = %v, want %v", tt.mention, match != nil, tt.ok)
+			continue
+		}
+		if match != nil && (match[1] != tt.path || match[2] != tt.start || match[3] != tt.end) {
+			t.Errorf("%q: got path %q lines %q-%q, want %q %q-%q", tt.mention, match[1], match[2], match[3], tt.path, tt.start, tt.end)
+		}
+	}
+}
+
+func TestFileTree(t *testing.T) {
+	// Directories are listed once, and only maxTreeDepth levels deep
+	files := []string{"cmd/oscode/main.go", "cmd/oscode/sub/deep.go", "go.mod", "internal/app/app.go"}
+	want := strings.Join([]string{
+		"cmd/",
+		"  oscode/",
+		"    main.go",
+		"    sub/",
+		"go.mod",
+		"internal/",
+		"  app/",
+		"    app.go",
+	}, "\n")
+	if got := fileTree(files); got != want {
+		t.Errorf("tree:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Entries past maxTreeEntries are counted
+	files = nil
+	for i := 0; i < maxTreeEntries+5; i++ {
+		files = append(files, fmt.Sprintf("file%03d.go", i))
+	}
+	lines := strings.Split(fileTree(files), "\n")
+	if len(lines) != maxTreeEntries+1 || lines[len(lines)-1] != "... 5 more entries" {
+		t.Errorf("got %d lines ending %q", len(lines), lines[len(lines)-1])
+	}
+}
+
+func TestRefreshMentionsBuildsIndex(t *testing.T) {
+	workDir := newProject(t)
+	if err := os.WriteFile(filepath.Join(workDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := newReplayApp(t)
+
+	// Completion doesn't wait for the index to be built
+	if items := app.mentionItems(); len(items) != 0 {
+		t.Errorf("items before indexing = %+v", items)
+	}
+
+	if msg := app.refreshMentions(); msg != (ui.MentionsUpdatedMsg{}) {
+		t.Errorf("refresh returned %#v, want MentionsUpdatedMsg", msg)
+	}
+	items := app.mentionItems()
+	if len(items) != 1 || items[0].ID != "main.go" {
+		t.Errorf("items = %+v", items)
+	}
+
+	// A fresh index isn't rebuilt
+	if msg := app.refreshMentions(); msg != nil {
+		t.Errorf("second refresh returned %#v, want nil", msg)
+	}
+}
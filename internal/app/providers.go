@@ -0,0 +1,145 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+// initProviders registers every configured provider. Each is created on
+// first use, so only the providers actually used need an API key.
+func (a *App) initProviders() {
+	a.providers = llm.NewProviderRegistry()
+	for name, providerConfig := range a.config.Providers {
+		name, providerConfig := name, providerConfig
+		a.providers.Register(name, func() (llm.Provider, error) {
+			if a.replay != nil {
+				return a.replay.Named(name), nil
+			}
+
+			provider, err := newProvider(name, providerConfig)
+			if err != nil {
+				return nil, err
+			}
+			fallback := ""
+			if providerConfig.FallbackModel != "" {
+				fallback = config.ResolveModel(name, providerConfig.FallbackModel)
+			}
+			provider = llm.NewRetryProvider(provider, llm.NewRetryPolicy(a.config.Retry, fallback))
+
+			// Recorded outside the retries, so fixtures hold only outcomes
+			if a.recorder != nil {
+				provider = a.recorder.Wrap(provider)
+			}
+			return provider, nil
+		})
+	}
+}
+
+// newProvider creates the client for a configured provider
+func newProvider(name string, providerConfig config.ProviderConfig) (llm.Provider, error) {
+	providerType := providerConfig.ProviderType(name)
+
+	if providerConfig.APIKey == "" && providerConfig.NeedsAPIKey(name) {
+		return nil, fmt.Errorf("no API key configured for %s. Set %s_API_KEY environment variable",
+			name, strings.ToUpper(name))
+	}
+
+	switch providerType {
+	case config.ProviderAnthropic:
+		return llm.NewAnthropicCompatibleProvider(name, providerConfig.APIKey, providerConfig.BaseURL, providerConfig), nil
+	case config.ProviderOpenAI:
+		return llm.NewOpenAICompatibleProvider(name, providerConfig.APIKey, providerConfig.BaseURL, providerConfig), nil
+	case config.ProviderOpenAICompatible:
+		if providerConfig.BaseURL == "" {
+			return nil, fmt.Errorf("no baseURL configured for %s", name)
+		}
+		return llm.NewOpenAICompatibleProvider(name, providerConfig.APIKey, providerConfig.BaseURL, providerConfig), nil
+	case config.ProviderOllama:
+		return llm.NewOllamaProvider(name, providerConfig.BaseURL, providerConfig), nil
+	case config.ProviderGemini:
+		return llm.NewGeminiProvider(name, providerConfig.APIKey, providerConfig.BaseURL, providerConfig), nil
+	}
+	return nil, fmt.Errorf("unknown provider type %q for %s (expected anthropic, openai, openai-compatible, ollama or gemini)", providerType, name)
+}
+
+// initProvider routes the configured model to its provider and makes that
+// the main conversation's provider
+func (a *App) initProvider() error {
+	model := a.config.DefaultModel
+	if model == "" {
+		var err error
+		if model, err = a.providers.DefaultModel(a.config.DefaultProvider); err != nil {
+			return err
+		}
+	}
+
+	providerName, model, err := a.providers.Resolve(model, a.config.DefaultProvider)
+	if err != nil {
+		return err
+	}
+
+	provider, err := a.providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+
+	a.provider = provider
+	a.config.DefaultProvider = providerName
+	a.config.DefaultModel = model
+
+	if a.hookExecutor != nil {
+		a.hookExecutor.SetProvider(a.provider, config.GetFastModel(providerName, model))
+	}
+	if a.agentExecutor != nil {
+		a.agentExecutor.SetDefaultModel(providerName, model)
+	}
+	return nil
+}
+
+// switchModel switches the main conversation to a model, given as a name,
+// alias or provider/model. The previous model stays if the new one can't
+// be used.
+func (a *App) switchModel(ref string) error {
+	previousProvider, previousModel := a.config.DefaultProvider, a.config.DefaultModel
+
+	a.config.DefaultModel = ref
+	if err := a.initProvider(); err != nil {
+		a.config.DefaultProvider, a.config.DefaultModel = previousProvider, previousModel
+		return err
+	}
+
+	if a.program != nil {
+		a.uiModel.SetProviderInfo(a.config.DefaultProvider, a.config.DefaultModel)
+	}
+	return nil
+}
+
+// switchProvider switches the main conversation to a provider's default
+// model
+func (a *App) switchProvider(name string) error {
+	if !a.providers.Has(name) {
+		return fmt.Errorf("unknown provider: %s (configured: %s)", name, strings.Join(a.providers.Names(), ", "))
+	}
+
+	model, err := a.providers.DefaultModel(name)
+	if err != nil {
+		return err
+	}
+	return a.switchModel(name + "/" + model)
+}
+
+func (a *App) handleModelChange(model string) {
+	if err := a.switchModel(model); err != nil && a.program != nil {
+		a.program.Send(ui.ErrorMsg{Error: err})
+	}
+}
+
+func (a *App) handleProviderChange(provider string) {
+	if err := a.switchProvider(provider); err != nil && a.program != nil {
+		a.program.Send(ui.ErrorMsg{Error: err})
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/hooks"
+	"github.com/heissanjay/oscode/internal/mcp"
+	"github.com/heissanjay/oscode/internal/permissions"
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// ServeOptions contains options for serving tools over MCP
+type ServeOptions struct {
+	Version         string
+	Tools           []string // Tools to expose (empty = all)
+	DisallowedTools []string // Tools to hide
+	AllowedTools    []string // Tools or rules like Bash(git:*) approved without asking
+	SkipPermissions bool
+}
+
+// ServeMCP exposes the built-in tools as an MCP server on stdin and stdout.
+// Permission rules and hooks apply to every call. There is nobody to ask
+// for approval, so calls that would prompt in the CLI are refused.
+func ServeMCP(cfg *config.Config, opts ServeOptions) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	registry := tools.NewRegistry()
+	registerBuiltinTools(registry, workDir)
+	if err := selectTools(registry, opts.Tools, opts.DisallowedTools); err != nil {
+		return err
+	}
+
+	// Stdout carries the protocol, so hook problems go to stderr
+	hookExecutor := hooks.NewExecutor(cfg.Hooks, workDir)
+	hookExecutor.SetErrorHandler(func(message string) {
+		fmt.Fprintf(os.Stderr, "Hook error: %s\n", message)
+	})
+	registry.SetHooks(hookExecutor)
+
+	// Allowed tools stand in for the user's answer to a prompt, so they
+	// override ask rules but not deny rules or plan mode
+	approved := make([]*permissions.Rule, 0, len(opts.AllowedTools))
+	for _, rule := range opts.AllowedTools {
+		approved = append(approved, permissions.ParseRule(rule, permissions.ActionAllow))
+	}
+
+	permManager := permissions.NewManager(cfg)
+	permManager.SetSkipPermissions(opts.SkipPermissions)
+	permManager.SetCallback(func(ctx context.Context, tool string, input map[string]interface{}, description, agent string) (bool, error) {
+		for _, rule := range approved {
+			if rule.Match(tool, input) {
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("%s needs approval, which can't be asked for over MCP. Allow it with --allowed-tools, a permissions.allow rule or --permission-mode", description)
+	})
+	registry.SetPermissionChecker(permManager)
+
+	server := mcp.NewToolServer(registry, mcp.Implementation{Name: "oscode", Version: opts.Version})
+	return server.Serve(mcp.NewStreamTransport(os.Stdin, os.Stdout))
+}
+
+// selectTools narrows the registry to the enabled tools, minus the
+// disallowed ones
+func selectTools(registry *tools.Registry, enabled, disallowed []string) error {
+	available := registry.ListNames()
+	sort.Strings(available)
+	for _, name := range append(append([]string{}, enabled...), disallowed...) {
+		if _, ok := registry.Get(name); !ok {
+			return fmt.Errorf("unknown tool %q (available: %s)", name, strings.Join(available, ", "))
+		}
+	}
+
+	if len(enabled) > 0 {
+		keep := make(map[string]bool)
+		for _, name := range enabled {
+			keep[name] = true
+		}
+		for _, name := range registry.ListNames() {
+			if !keep[name] {
+				registry.Unregister(name)
+			}
+		}
+	}
+
+	for _, name := range disallowed {
+		registry.Unregister(name)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/ui"
+)
+
+// recordUsage adds a request's tokens and cost to the session
+func (a *App) recordUsage(provider llm.Provider, model string, usage llm.Usage) {
+	var cost float64
+	if info, ok := llm.LookupModel(provider, model); ok {
+		cost = usage.Cost(info)
+	}
+
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	if a.currentSession != nil {
+		a.currentSession.AddUsage(usage, cost)
+	}
+}
+
+// sessionUsage returns the session's token usage and cost so far
+func (a *App) sessionUsage() (llm.Usage, float64) {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	if a.currentSession == nil {
+		return llm.Usage{}, 0
+	}
+	return a.currentSession.Usage(), a.currentSession.TotalCost
+}
+
+// streamDone ends a response, updating the status bar's session totals
+func (a *App) streamDone() ui.StreamDoneMsg {
+	usage, cost := a.sessionUsage()
+	return ui.StreamDoneMsg{
+		InputTokens:  usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens,
+		OutputTokens: usage.OutputTokens,
+		Cost:         cost,
+	}
+}
@@ -4,7 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/heissanjay/oscode/internal/agent"
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/hooks"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/mcp"
+	"github.com/heissanjay/oscode/internal/permissions"
 )
 
 // RegisterBuiltinCommands registers all built-in commands
@@ -49,6 +57,14 @@ func RegisterBuiltinCommands() {
 		Handler:     handleProvider,
 	})
 
+	Register(&Command{
+		Name:        "thinking",
+		Aliases:     []string{"think"},
+		Description: "Set how much the model thinks before answering",
+		Usage:       "/thinking [off|low|medium|high|<tokens>]",
+		Handler:     handleThinking,
+	})
+
 	Register(&Command{
 		Name:        "cost",
 		Description: "Show token usage and estimated cost",
@@ -59,7 +75,7 @@ func RegisterBuiltinCommands() {
 	Register(&Command{
 		Name:        "compact",
 		Description: "Summarize conversation to save tokens",
-		Usage:       "/compact",
+		Usage:       "/compact [instructions]",
 		Handler:     handleCompact,
 	})
 
@@ -108,6 +124,27 @@ func RegisterBuiltinCommands() {
 		Handler:     handlePermissions,
 	})
 
+	Register(&Command{
+		Name:        "hooks",
+		Description: "List configured hooks",
+		Usage:       "/hooks",
+		Handler:     handleHooks,
+	})
+
+	Register(&Command{
+		Name:        "mcp",
+		Description: "Show MCP server status, reconnect or disable servers",
+		Usage:       "/mcp [server | reconnect <server> | disable <server>]",
+		Handler:     handleMCP,
+	})
+
+	Register(&Command{
+		Name:        "agents",
+		Description: "List, create and edit sub-agents",
+		Usage:       "/agents [agent | create <name> [project|user] | edit <agent> | transcripts]",
+		Handler:     handleAgents,
+	})
+
 	Register(&Command{
 		Name:        "config",
 		Description: "Open configuration settings",
@@ -189,44 +226,153 @@ func handleClear(ctx *Context, args string) error {
 }
 
 func handleModel(ctx *Context, args string) error {
+	cfg, _ := ctx.Config.(*config.Config)
 	if args == "" {
-		// Show available models
-		ctx.Print("Available models:\n")
-		ctx.Print("  Anthropic: claude-3-5-sonnet-20241022, claude-3-opus-20240229, claude-3-haiku-20240307\n")
-		ctx.Print("  OpenAI: gpt-4o, gpt-4o-mini, o1-preview, o1-mini\n")
-		ctx.Print("\nUsage: /model <model_name>\n")
+		// Show the model catalog
+		var sb strings.Builder
+		if cfg != nil {
+			sb.WriteString(fmt.Sprintf("Current model: %s/%s\n\n", cfg.DefaultProvider, cfg.DefaultModel))
+		}
+		sb.WriteString("Available models:\n")
+		providers, _ := ctx.Providers.(*llm.ProviderRegistry)
+		for _, provider := range configuredProviders(cfg) {
+			if models := config.ModelsFor(provider); len(models) > 0 {
+				sb.WriteString(fmt.Sprintf("  %s:\n", provider))
+				for _, info := range models {
+					sb.WriteString(fmt.Sprintf("    %s (%s)\n", info.ID, info.Describe()))
+				}
+				continue
+			}
+
+			// Other providers list their own. Only the current provider and
+			// keyless ones are asked, as the rest may not be set up.
+			if providers == nil || (provider != cfg.DefaultProvider && cfg.Providers[provider].NeedsAPIKey(provider)) {
+				continue
+			}
+			p, err := providers.Get(provider)
+			if err != nil {
+				continue
+			}
+			if models := p.Models(); len(models) > 0 {
+				sb.WriteString(fmt.Sprintf("  %s:\n", provider))
+				for _, model := range models {
+					sb.WriteString(fmt.Sprintf("    %s\n", model))
+				}
+			}
+		}
+		sb.WriteString("\nUsage: /model <model|alias|provider/model>\n")
+		ctx.Print(sb.String())
 		return nil
 	}
 
-	ctx.SetModel(args)
-	ctx.Print(fmt.Sprintf("✓ Model set to: %s\n", args))
+	if err := ctx.SetModel(args); err != nil {
+		return err
+	}
+	if cfg != nil {
+		ctx.Print(fmt.Sprintf("✓ Model set to: %s/%s\n", cfg.DefaultProvider, cfg.DefaultModel))
+	} else {
+		ctx.Print(fmt.Sprintf("✓ Model set to: %s\n", args))
+	}
+	return nil
+}
+
+func handleThinking(ctx *Context, args string) error {
+	cfg, ok := ctx.Config.(*config.Config)
+	if !ok || cfg == nil {
+		return fmt.Errorf("config is not available")
+	}
+
+	if args != "" {
+		if _, _, err := llm.ParseThinking(args); err != nil {
+			return err
+		}
+		cfg.Thinking = strings.ToLower(strings.TrimSpace(args))
+	}
+
+	budget, effort, _ := llm.ParseThinking(cfg.Thinking)
+	setting := "off"
+	if budget > 0 {
+		setting = fmt.Sprintf("%s (%d token budget)", effort, budget)
+	}
+	if args != "" {
+		ctx.Print(fmt.Sprintf("✓ Thinking set to: %s\n", setting))
+	} else {
+		ctx.Print(fmt.Sprintf("Thinking: %s\n", setting))
+	}
+
+	if provider, ok := ctx.Provider.(llm.Provider); ok && budget > 0 {
+		if info, ok := llm.LookupModel(provider, cfg.GetModel()); ok && !info.Reasoning {
+			ctx.Print(fmt.Sprintf("Note: %s doesn't support thinking, so it's ignored until you switch models.\n", cfg.GetModel()))
+		}
+	}
+	if args == "" {
+		ctx.Print("\nUsage: /thinking [off|low|medium|high|<tokens>]\n")
+	}
 	return nil
 }
 
 func handleProvider(ctx *Context, args string) error {
+	cfg, _ := ctx.Config.(*config.Config)
 	if args == "" {
-		ctx.Print("Available providers: anthropic, openai\n")
+		ctx.Print(fmt.Sprintf("Available providers: %s\n", strings.Join(configuredProviders(cfg), ", ")))
 		ctx.Print("Usage: /provider <provider_name>\n")
 		return nil
 	}
 
-	ctx.SetProvider(args)
-	ctx.Print(fmt.Sprintf("✓ Provider set to: %s\n", args))
+	if err := ctx.SetProvider(args); err != nil {
+		return err
+	}
+	if cfg != nil {
+		ctx.Print(fmt.Sprintf("✓ Provider set to: %s (model %s)\n", cfg.DefaultProvider, cfg.DefaultModel))
+	} else {
+		ctx.Print(fmt.Sprintf("✓ Provider set to: %s\n", args))
+	}
 	return nil
 }
 
+// configuredProviders returns the names of the providers in settings
+func configuredProviders(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func handleCost(ctx *Context, args string) error {
-	ctx.Print("Token usage: 2.4k input / 1.1k output\nEstimated cost: $0.05\n")
+	if ctx.Usage == nil {
+		return fmt.Errorf("usage is not available")
+	}
+	usage, cost := ctx.Usage()
+
+	var sb strings.Builder
+	sb.WriteString("Session usage:\n")
+	sb.WriteString(fmt.Sprintf("  Input:        %d tokens\n", usage.InputTokens))
+	sb.WriteString(fmt.Sprintf("  Cache write:  %d tokens\n", usage.CacheCreationInputTokens))
+	sb.WriteString(fmt.Sprintf("  Cache read:   %d tokens\n", usage.CacheReadInputTokens))
+	sb.WriteString(fmt.Sprintf("  Output:       %d tokens\n", usage.OutputTokens))
+	if input := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens; input > 0 {
+		sb.WriteString(fmt.Sprintf("  Cache hits:   %.0f%% of input\n", float64(usage.CacheReadInputTokens)*100/float64(input)))
+	}
+	sb.WriteString(fmt.Sprintf("Estimated cost: $%.4f\n", cost))
+	ctx.Print(sb.String())
 	return nil
 }
 
 func handleCompact(ctx *Context, args string) error {
-	// In a real implementation, this would trigger an LLM summarization
-	// For now, we simulate it
+	if ctx.Compact == nil {
+		return fmt.Errorf("compaction is not available")
+	}
+
 	ctx.Print("✻ Compacting conversation history...\n")
-	// clear history but keep system prompt logic would go here
-	// ctx.Clear() // Too aggressive for this mock, but fits the "UX" requirement of the command existing
-	ctx.Print("✓ Conversation compacted. Token usage reduced by 40%.\n")
+	if err := ctx.Compact(strings.TrimSpace(args)); err != nil {
+		return err
+	}
+	ctx.Print("✓ Conversation compacted.\n")
 	return nil
 }
 
@@ -273,17 +419,374 @@ func handleVerbose(ctx *Context, args string) error {
 func handlePermissions(ctx *Context, args string) error {
 	if args == "" {
 		ctx.Print("Permission modes:\n")
-		ctx.Print("  auto - Auto-accept allowed tools\n")
-		ctx.Print("  ask  - Ask for all tool executions\n")
-		ctx.Print("  plan - Read-only mode (no write operations)\n")
+		ctx.Print("  auto        - Auto-accept allowed tools\n")
+		ctx.Print("  acceptEdits - Auto-accept file edits as well\n")
+		ctx.Print("  ask         - Ask for all tool executions\n")
+		ctx.Print("  plan        - Read-only mode (no write operations)\n")
 		ctx.Print("\nUsage: /permissions <mode>\n")
 		return nil
 	}
 
-	ctx.Print(fmt.Sprintf("✓ Permission mode set to: %s\n", args))
+	mode, ok := permissions.ParseMode(strings.TrimSpace(args))
+	if !ok {
+		return fmt.Errorf("unknown permission mode %q. Use auto, acceptEdits, ask or plan", args)
+	}
+	if ctx.SetPermissionMode == nil {
+		return fmt.Errorf("permission modes can't be changed here")
+	}
+	ctx.SetPermissionMode(mode)
+	ctx.Print(fmt.Sprintf("✓ Permission mode set to: %s\n", mode))
+	return nil
+}
+
+func handleHooks(ctx *Context, args string) error {
+	executor, ok := ctx.Hooks.(*hooks.Executor)
+	if !ok || executor == nil {
+		return fmt.Errorf("hooks are not available")
+	}
+
+	var sb strings.Builder
+	count := 0
+	for _, event := range hooks.AllEvents {
+		defs := executor.Definitions(event)
+		if len(defs) == 0 {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("%s:\n", event))
+		for _, def := range defs {
+			matcher := def.Matcher
+			if matcher == "" {
+				matcher = "*"
+			}
+			for _, action := range def.Hooks {
+				detail := action.Command
+				if action.Type == "prompt" {
+					detail = action.Prompt
+				}
+				if len(detail) > 60 {
+					detail = detail[:57] + "..."
+				}
+
+				sb.WriteString(fmt.Sprintf("  [%s] %s: %s", matcher, action.Type, detail))
+				if action.Timeout > 0 {
+					sb.WriteString(fmt.Sprintf(" (timeout %ds)", action.Timeout))
+				}
+				sb.WriteString("\n")
+				count++
+			}
+		}
+	}
+
+	if count == 0 {
+		ctx.Print("No hooks configured.\n")
+		ctx.Print("Add hooks to the \"hooks\" section of .oscode/settings.json\n")
+		return nil
+	}
+
+	ctx.Print(fmt.Sprintf("Configured hooks (%d):\n\n%s", count, sb.String()))
+	return nil
+}
+
+func handleMCP(ctx *Context, args string) error {
+	client, ok := ctx.MCP.(*mcp.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("MCP is not available")
+	}
+
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		return showMCPServers(ctx, client)
+	case len(fields) == 1:
+		return showMCPServer(ctx, client, fields[0])
+	}
+
+	action, name := fields[0], fields[1]
+	switch action {
+	case "reconnect", "enable":
+		ctx.Print(fmt.Sprintf("✻ Reconnecting to %s...\n", name))
+		if err := client.Reconnect(name); err != nil {
+			return err
+		}
+		status, _ := client.Status(name)
+		ctx.Print(fmt.Sprintf("✓ %s connected (%d tools)\n", name, status.Tools))
+	case "disable":
+		if err := client.Disable(name); err != nil {
+			return err
+		}
+		ctx.Print(fmt.Sprintf("✓ %s disabled for this session\n", name))
+	default:
+		return fmt.Errorf("unknown action: %s. Usage: /mcp [server | reconnect <server> | disable <server>]", action)
+	}
+	return nil
+}
+
+// showMCPServers lists configured servers, as a menu when the UI has one
+func showMCPServers(ctx *Context, client *mcp.Client) error {
+	statuses := client.Statuses()
+	if len(statuses) == 0 {
+		ctx.Print("No MCP servers configured.\n")
+		ctx.Print("Add one with: oscode mcp add <name> <command> [args...]\n")
+		return nil
+	}
+
+	if ctx.ShowMenu != nil {
+		items := make([]MenuItem, 0, len(statuses))
+		for _, status := range statuses {
+			items = append(items, MenuItem{
+				Command:     "/mcp " + status.Name,
+				Label:       fmt.Sprintf("%s %s", mcpStateIcon(status.State), status.Name),
+				Description: mcpStatusSummary(status),
+			})
+		}
+		ctx.ShowMenu("MCP Servers", items)
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("MCP servers:\n\n")
+	for _, status := range statuses {
+		sb.WriteString(fmt.Sprintf("  %s %s - %s\n", mcpStateIcon(status.State), status.Name, mcpStatusSummary(status)))
+	}
+	ctx.Print(sb.String())
+	return nil
+}
+
+// showMCPServer shows one server's details and the actions available for it
+func showMCPServer(ctx *Context, client *mcp.Client, name string) error {
+	status, ok := client.Status(name)
+	if !ok {
+		return fmt.Errorf("MCP server not found: %s", name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (%s): %s\n", status.Name, status.Transport, status.State))
+	if status.State == mcp.StateConnected {
+		sb.WriteString(fmt.Sprintf("  %d tools, %d resources, %d prompts\n", status.Tools, status.Resources, status.Prompts))
+	}
+	if status.Restarts > 0 {
+		sb.WriteString(fmt.Sprintf("  Restarts: %d\n", status.Restarts))
+	}
+	if status.Error != "" {
+		sb.WriteString(fmt.Sprintf("  Error: %s\n", status.Error))
+	}
+	for _, warning := range status.Warnings {
+		sb.WriteString(fmt.Sprintf("  Warning: %s\n", warning))
+	}
+	ctx.Print(sb.String())
+
+	if ctx.ShowMenu != nil {
+		items := []MenuItem{
+			{Command: "/mcp reconnect " + name, Label: "Reconnect", Description: "Restart the connection"},
+		}
+		if status.State == mcp.StateDisabled {
+			items[0] = MenuItem{Command: "/mcp enable " + name, Label: "Enable", Description: "Connect for this session"}
+		} else {
+			items = append(items, MenuItem{Command: "/mcp disable " + name, Label: "Disable", Description: "Disconnect for this session"})
+		}
+		ctx.ShowMenu(name, items)
+	}
+	return nil
+}
+
+func handleAgents(ctx *Context, args string) error {
+	executor, ok := ctx.Agents.(*agent.Executor)
+	if !ok || executor == nil {
+		return fmt.Errorf("agents are not available")
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return showAgents(ctx, executor)
+	}
+
+	switch fields[0] {
+	case "create":
+		if len(fields) < 2 {
+			return fmt.Errorf("agent name required. Usage: /agents create <name> [project|user]")
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir := config.GetProjectAgentsDir(cwd)
+		if len(fields) > 2 {
+			switch fields[2] {
+			case "user":
+				dir = config.GetUserAgentsDir()
+			case "project":
+			default:
+				return fmt.Errorf("unknown location: %s (use project or user)", fields[2])
+			}
+		}
+
+		path, err := agent.CreateConfigFile(dir, fields[1])
+		if err != nil {
+			return err
+		}
+		ctx.Print(fmt.Sprintf("✓ Created %s\n", path))
+		return editAgent(ctx, executor, path)
+
+	case "edit":
+		if len(fields) < 2 {
+			return fmt.Errorf("agent name required. Usage: /agents edit <agent>")
+		}
+		cfg, ok := executor.Config(agent.Type(fields[1]))
+		if !ok {
+			return fmt.Errorf("agent not found: %s", fields[1])
+		}
+		if cfg.Path == "" {
+			return fmt.Errorf("%s is built in. Run /agents create %s to override it", cfg.Type, cfg.Type)
+		}
+		return editAgent(ctx, executor, cfg.Path)
+
+	case "transcripts":
+		return showTranscripts(ctx, executor)
+	}
+
+	if len(fields) == 1 {
+		return showAgent(ctx, executor, fields[0])
+	}
+	return fmt.Errorf("unknown action: %s. Usage: /agents [agent | create <name> [project|user] | edit <agent> | transcripts]", fields[0])
+}
+
+// showAgents lists agent types, as a menu when the UI has one. Definition
+// files are re-read first so edits made outside OSCode show up.
+func showAgents(ctx *Context, executor *agent.Executor) error {
+	for _, err := range executor.Reload() {
+		ctx.PrintError(err.Error())
+	}
+	configs := executor.Configs()
+
+	if ctx.ShowMenu != nil {
+		items := make([]MenuItem, 0, len(configs))
+		for _, cfg := range configs {
+			items = append(items, MenuItem{
+				Command:     "/agents " + string(cfg.Type),
+				Label:       fmt.Sprintf("%s (%s)", cfg.Type, cfg.Source),
+				Description: cfg.Description,
+			})
+		}
+		ctx.ShowMenu("Agents", items)
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Agents:\n\n")
+	for _, cfg := range configs {
+		sb.WriteString(fmt.Sprintf("  %s (%s) - %s\n", cfg.Type, cfg.Source, cfg.Description))
+	}
+	sb.WriteString("\nCreate one with: /agents create <name> [project|user]\n")
+	ctx.Print(sb.String())
 	return nil
 }
 
+// showAgent shows one agent's definition and the actions available for it
+func showAgent(ctx *Context, executor *agent.Executor, name string) error {
+	cfg, ok := executor.Config(agent.Type(name))
+	if !ok {
+		return fmt.Errorf("agent not found: %s", name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (%s)\n", cfg.Type, cfg.Source))
+	sb.WriteString(fmt.Sprintf("  %s\n", cfg.Description))
+	if cfg.Path != "" {
+		sb.WriteString(fmt.Sprintf("  File: %s\n", cfg.Path))
+	}
+	tools := "all"
+	if cfg.AllowedTools != nil {
+		tools = strings.Join(cfg.AllowedTools, ", ")
+	}
+	sb.WriteString(fmt.Sprintf("  Tools: %s\n", tools))
+	model := cfg.Model
+	if model == "" {
+		model = agent.ModelInherit
+	}
+	sb.WriteString(fmt.Sprintf("  Model: %s\n", model))
+	if cfg.Provider != "" {
+		sb.WriteString(fmt.Sprintf("  Provider: %s\n", cfg.Provider))
+	}
+	if cfg.PermissionMode != "" {
+		sb.WriteString(fmt.Sprintf("  Permission mode: %s\n", cfg.PermissionMode))
+	}
+	ctx.Print(sb.String())
+
+	if ctx.ShowMenu != nil {
+		item := MenuItem{Command: "/agents edit " + name, Label: "Edit", Description: "Open the definition in your editor"}
+		if cfg.Path == "" {
+			item = MenuItem{Command: "/agents create " + name, Label: "Override", Description: "Create a project agent with this name"}
+		}
+		ctx.ShowMenu(name, []MenuItem{item})
+	}
+	return nil
+}
+
+// showTranscripts lists the agent transcripts saved in the current session
+func showTranscripts(ctx *Context, executor *agent.Executor) error {
+	transcripts, err := executor.Transcripts()
+	if err != nil {
+		return err
+	}
+	if len(transcripts) == 0 {
+		ctx.Print("No agent transcripts in this session\n")
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Agent transcripts:\n\n")
+	for _, sc := range transcripts {
+		sb.WriteString(fmt.Sprintf("  %s  %s - %s (%d messages, %s)\n",
+			sc.AgentID, sc.AgentType, sc.Description, len(sc.Messages), sc.UpdatedAt.Format("2006-01-02 15:04")))
+	}
+	sb.WriteString("\nAsk to resume one by its ID to continue it with the Task tool.\n")
+	ctx.Print(sb.String())
+	return nil
+}
+
+// editAgent opens a definition in the user's editor and reloads agents
+func editAgent(ctx *Context, executor *agent.Executor, path string) error {
+	if ctx.OpenEditor == nil {
+		ctx.Print(fmt.Sprintf("Edit %s, then run /agents to reload.\n", path))
+		return nil
+	}
+	if err := ctx.OpenEditor(path); err != nil {
+		return err
+	}
+
+	for _, err := range executor.Reload() {
+		ctx.PrintError(err.Error())
+	}
+	ctx.Print("✓ Agents reloaded\n")
+	return nil
+}
+
+func mcpStateIcon(state mcp.ServerState) string {
+	switch state {
+	case mcp.StateConnected:
+		return "✓"
+	case mcp.StateFailed:
+		return "✗"
+	case mcp.StateDisabled:
+		return "○"
+	default:
+		return "…"
+	}
+}
+
+func mcpStatusSummary(status mcp.ServerStatus) string {
+	switch status.State {
+	case mcp.StateConnected:
+		return fmt.Sprintf("%d tools", status.Tools)
+	case mcp.StateFailed:
+		return "failed: " + status.Error
+	case mcp.StateRestarting:
+		return fmt.Sprintf("restarting (attempt %d)", status.Restarts)
+	}
+	return string(status.State)
+}
+
 func handleConfig(ctx *Context, args string) error {
 	ctx.Print("Configuration editor coming soon.\n")
 	ctx.Print("Configuration file location can be found with: oscode config path\n")
@@ -5,6 +5,9 @@ import (
 	"sort"
 	"strings"
 	"sync"
+
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/permissions"
 )
 
 // Command represents a slash command
@@ -17,6 +20,13 @@ type Command struct {
 	Hidden      bool // Don't show in /help
 }
 
+// MenuItem is an entry in an interactive menu. Choosing it runs Command.
+type MenuItem struct {
+	Command     string
+	Label       string
+	Description string
+}
+
 // CommandHandler handles a command execution
 type CommandHandler func(ctx *Context, args string) error
 
@@ -27,13 +37,22 @@ type Context struct {
 	Config     interface{} // *config.Config
 	Provider   interface{} // llm.Provider
 	ToolRegistry interface{} // *tools.Registry
+	Hooks        interface{} // *hooks.Executor
+	MCP          interface{} // *mcp.Client
+	Agents       interface{} // *agent.Executor
+	Providers    interface{} // *llm.ProviderRegistry
 
 	// UI callbacks
-	Print       func(string)
-	PrintError  func(string)
-	Clear       func()
-	SetModel    func(string)
-	SetProvider func(string)
+	Print             func(string)
+	PrintError        func(string)
+	Clear             func()
+	SetModel          func(string) error
+	SetProvider       func(string) error
+	SetPermissionMode func(permissions.Mode)
+	Compact           func(instructions string) error
+	ShowMenu          func(title string, items []MenuItem)
+	OpenEditor        func(path string) error
+	Usage             func() (llm.Usage, float64) // Session token usage and cost in USD
 
 	// Session controls
 	Exit       func()
@@ -67,6 +86,21 @@ func (r *Registry) Register(cmd *Command) {
 	}
 }
 
+// Unregister removes a command and its aliases from the registry
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd, ok := r.commands[name]
+	if !ok {
+		return
+	}
+	for _, alias := range cmd.Aliases {
+		delete(r.aliases, alias)
+	}
+	delete(r.commands, name)
+}
+
 // Get returns a command by name or alias
 func (r *Registry) Get(name string) (*Command, bool) {
 	r.mu.RLock()
@@ -25,8 +25,14 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to load user config: %w", err)
 	}
 
-	// Load project settings (.oscode/settings.json)
 	cwd, _ := os.Getwd()
+
+	// Load project MCP servers (.mcp.json)
+	if err := loadMCPFile(GetMCPConfigPath(cwd), cfg); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load project MCP config: %w", err)
+	}
+
+	// Load project settings (.oscode/settings.json)
 	projectConfig := GetProjectSettingsPath(cwd)
 	if err := loadConfigFile(projectConfig, cfg); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to load project config: %w", err)
@@ -74,6 +80,9 @@ func resolveEnvVars(cfg *Config) {
 	for name, provider := range cfg.Providers {
 		provider.APIKey = expandEnvVar(provider.APIKey)
 		provider.BaseURL = expandEnvVar(provider.BaseURL)
+		for key, val := range provider.Headers {
+			provider.Headers[key] = expandEnvVar(val)
+		}
 		cfg.Providers[name] = provider
 	}
 
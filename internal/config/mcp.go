@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Scope is where an MCP server is configured
+type Scope string
+
+const (
+	ScopeLocal   Scope = "local"   // .oscode/settings.local.json, private to this project
+	ScopeProject Scope = "project" // .mcp.json, shared with the team
+	ScopeUser    Scope = "user"    // ~/.oscode/settings.json, all projects
+)
+
+// AllScopes lists scopes from highest to lowest precedence
+var AllScopes = []Scope{ScopeLocal, ScopeProject, ScopeUser}
+
+// ParseScope validates a scope name
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeLocal, ScopeProject, ScopeUser:
+		return Scope(s), nil
+	}
+	return "", fmt.Errorf("invalid scope %q (use local, project or user)", s)
+}
+
+// MCPScopePath returns the file that holds MCP servers for a scope
+func MCPScopePath(scope Scope, projectDir string) string {
+	switch scope {
+	case ScopeUser:
+		return GetConfigPath()
+	case ScopeProject:
+		return GetMCPConfigPath(projectDir)
+	default:
+		return GetProjectLocalSettingsPath(projectDir)
+	}
+}
+
+// LoadMCPServers returns the MCP servers configured in one scope
+func LoadMCPServers(scope Scope, projectDir string) (map[string]MCPServerConfig, error) {
+	doc, err := readJSONDocument(MCPScopePath(scope, projectDir))
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make(map[string]MCPServerConfig)
+	raw, ok := mcpServersNode(doc, scope)
+	if !ok {
+		return servers, nil
+	}
+
+	data, _ := json.Marshal(raw)
+	if err := json.Unmarshal(data, &servers); err != nil {
+		return nil, fmt.Errorf("invalid MCP servers in %s: %w", MCPScopePath(scope, projectDir), err)
+	}
+	return servers, nil
+}
+
+// FindMCPServer looks up a server by name across scopes, in precedence order
+func FindMCPServer(projectDir, name string) (MCPServerConfig, Scope, bool) {
+	for _, scope := range AllScopes {
+		servers, err := LoadMCPServers(scope, projectDir)
+		if err != nil {
+			continue
+		}
+		if server, ok := servers[name]; ok {
+			return server, scope, true
+		}
+	}
+	return MCPServerConfig{}, "", false
+}
+
+// AddMCPServer writes a server to a scope's config file, replacing any
+// server with the same name. Other settings in the file are preserved.
+func AddMCPServer(scope Scope, projectDir, name string, server MCPServerConfig) error {
+	path := MCPScopePath(scope, projectDir)
+	doc, err := readJSONDocument(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(server)
+	if err != nil {
+		return err
+	}
+	var entry map[string]interface{}
+	json.Unmarshal(data, &entry)
+
+	servers := ensureMCPServers(doc, scope)
+	servers[name] = entry
+
+	return writeJSONDocument(path, doc)
+}
+
+// RemoveMCPServer deletes a server from a scope's config file
+func RemoveMCPServer(scope Scope, projectDir, name string) error {
+	path := MCPScopePath(scope, projectDir)
+	doc, err := readJSONDocument(path)
+	if err != nil {
+		return err
+	}
+
+	servers := ensureMCPServers(doc, scope)
+	if _, ok := servers[name]; !ok {
+		return fmt.Errorf("no MCP server named %q in %s scope", name, scope)
+	}
+	delete(servers, name)
+
+	return writeJSONDocument(path, doc)
+}
+
+// mcpServersNode returns the raw servers object of a config document.
+// Settings files nest it under "mcp"; .mcp.json has it at the top level.
+func mcpServersNode(doc map[string]interface{}, scope Scope) (interface{}, bool) {
+	parent := doc
+	if scope != ScopeProject {
+		mcp, ok := doc["mcp"].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		parent = mcp
+	}
+	servers, ok := parent["mcpServers"]
+	return servers, ok
+}
+
+// ensureMCPServers returns the servers object of a config document,
+// creating it if needed
+func ensureMCPServers(doc map[string]interface{}, scope Scope) map[string]interface{} {
+	parent := doc
+	if scope != ScopeProject {
+		mcp, ok := doc["mcp"].(map[string]interface{})
+		if !ok {
+			mcp = make(map[string]interface{})
+			doc["mcp"] = mcp
+		}
+		parent = mcp
+	}
+
+	servers, ok := parent["mcpServers"].(map[string]interface{})
+	if !ok {
+		servers = make(map[string]interface{})
+		parent["mcpServers"] = servers
+	}
+	return servers
+}
+
+// loadMCPFile merges servers from a .mcp.json file into the config
+func loadMCPFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Servers map[string]MCPServerConfig `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+
+	if cfg.MCP.Servers == nil {
+		cfg.MCP.Servers = make(map[string]MCPServerConfig)
+	}
+	for name, server := range file.Servers {
+		cfg.MCP.Servers[name] = server
+	}
+	return nil
+}
+
+func readJSONDocument(path string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return doc, nil
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+func writeJSONDocument(path string, doc map[string]interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
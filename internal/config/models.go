@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModelInfo describes a model's capabilities
+type ModelInfo struct {
+	ID              string
+	Provider        string
+	ContextWindow   int // Input tokens
+	MaxOutputTokens int
+	Tools           bool // Supports tool use
+	Vision          bool // Accepts images
+	Reasoning       bool // Can think before answering
+
+	// Prices in USD per million tokens. Cache prices of zero mean the
+	// input price.
+	InputPrice      float64
+	OutputPrice     float64
+	CacheWritePrice float64
+	CacheReadPrice  float64
+}
+
+// ModelCatalog lists the models OSCode knows the capabilities of. Other
+// model names are passed through and assumed to support everything.
+var ModelCatalog = []ModelInfo{
+	{ID: "claude-opus-4-20250514", Provider: "anthropic", ContextWindow: 200000, MaxOutputTokens: 32000, Tools: true, Vision: true, Reasoning: true, InputPrice: 15, OutputPrice: 75, CacheWritePrice: 18.75, CacheReadPrice: 1.5},
+	{ID: "claude-sonnet-4-20250514", Provider: "anthropic", ContextWindow: 200000, MaxOutputTokens: 64000, Tools: true, Vision: true, Reasoning: true, InputPrice: 3, OutputPrice: 15, CacheWritePrice: 3.75, CacheReadPrice: 0.3},
+	{ID: "claude-3-5-haiku-20241022", Provider: "anthropic", ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Vision: true, InputPrice: 0.8, OutputPrice: 4, CacheWritePrice: 1, CacheReadPrice: 0.08},
+	{ID: "claude-3-5-sonnet-20241022", Provider: "anthropic", ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Vision: true, InputPrice: 3, OutputPrice: 15, CacheWritePrice: 3.75, CacheReadPrice: 0.3},
+	{ID: "claude-3-opus-20240229", Provider: "anthropic", ContextWindow: 200000, MaxOutputTokens: 4096, Tools: true, Vision: true, InputPrice: 15, OutputPrice: 75, CacheWritePrice: 18.75, CacheReadPrice: 1.5},
+
+	{ID: "gpt-4o", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, InputPrice: 2.5, OutputPrice: 10, CacheReadPrice: 1.25},
+	{ID: "gpt-4o-mini", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, InputPrice: 0.15, OutputPrice: 0.6, CacheReadPrice: 0.075},
+	{ID: "gpt-4-turbo-preview", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true, Vision: false, InputPrice: 10, OutputPrice: 30},
+	{ID: "gpt-4-turbo", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true, Vision: true, InputPrice: 10, OutputPrice: 30},
+	{ID: "gpt-4", Provider: "openai", ContextWindow: 8192, MaxOutputTokens: 8192, Tools: true, Vision: false, InputPrice: 30, OutputPrice: 60},
+	{ID: "gpt-3.5-turbo", Provider: "openai", ContextWindow: 16385, MaxOutputTokens: 4096, Tools: true, Vision: false, InputPrice: 0.5, OutputPrice: 1.5},
+	{ID: "o1-preview", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 32768, Tools: false, Vision: false, InputPrice: 15, OutputPrice: 60, CacheReadPrice: 7.5},
+	{ID: "o1-mini", Provider: "openai", ContextWindow: 128000, MaxOutputTokens: 65536, Tools: false, Vision: false, InputPrice: 3, OutputPrice: 12, CacheReadPrice: 1.5},
+	{ID: "o3", Provider: "openai", ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: true, Reasoning: true, InputPrice: 2, OutputPrice: 8, CacheReadPrice: 0.5},
+	{ID: "o3-mini", Provider: "openai", ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: false, Reasoning: true, InputPrice: 1.1, OutputPrice: 4.4, CacheReadPrice: 0.55},
+	{ID: "o4-mini", Provider: "openai", ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: true, Reasoning: true, InputPrice: 1.1, OutputPrice: 4.4, CacheReadPrice: 0.275},
+
+	{ID: "gemini-2.5-pro", Provider: "gemini", ContextWindow: 1048576, MaxOutputTokens: 65536, Tools: true, Vision: true, Reasoning: true, InputPrice: 1.25, OutputPrice: 10, CacheReadPrice: 0.31},
+	{ID: "gemini-2.5-flash", Provider: "gemini", ContextWindow: 1048576, MaxOutputTokens: 65536, Tools: true, Vision: true, Reasoning: true, InputPrice: 0.3, OutputPrice: 2.5, CacheReadPrice: 0.075},
+	{ID: "gemini-2.0-flash", Provider: "gemini", ContextWindow: 1048576, MaxOutputTokens: 8192, Tools: true, Vision: true, InputPrice: 0.1, OutputPrice: 0.4, CacheReadPrice: 0.025},
+}
+
+// DefaultModels maps providers to the alias of the model used when
+// switching to them
+var DefaultModels = map[string]string{
+	"anthropic": "sonnet",
+	"openai":    "gpt4o",
+	"gemini":    "gemini-pro",
+}
+
+// GetDefaultModel returns the model to use for a provider when none is
+// given, or "" if it has no default
+func GetDefaultModel(provider string) string {
+	if alias, ok := DefaultModels[provider]; ok {
+		return ResolveModel(provider, alias)
+	}
+	return ""
+}
+
+// LookupModel returns the catalog entry for a model name or alias
+func LookupModel(provider, model string) (ModelInfo, bool) {
+	id := ResolveModel(provider, model)
+	for _, info := range ModelCatalog {
+		if info.ID == id && (provider == "" || info.Provider == provider) {
+			return info, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// FindModelProvider returns the provider that serves a catalog model or
+// alias, checking the preferred provider's aliases first
+func FindModelProvider(model, preferred string) (string, bool) {
+	if preferred != "" {
+		if _, ok := LookupModel(preferred, model); ok {
+			return preferred, true
+		}
+	}
+	if info, ok := LookupModel("", model); ok {
+		return info.Provider, true
+	}
+
+	providers := make([]string, 0, len(ModelAliases))
+	for provider := range ModelAliases {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		if _, ok := ModelAliases[provider][model]; ok {
+			return provider, true
+		}
+	}
+	return "", false
+}
+
+// ModelsFor returns the catalog models of a provider
+func ModelsFor(provider string) []ModelInfo {
+	var models []ModelInfo
+	for _, info := range ModelCatalog {
+		if info.Provider == provider {
+			models = append(models, info)
+		}
+	}
+	return models
+}
+
+// ModelIDs returns the names of a provider's catalog models
+func ModelIDs(provider string) []string {
+	var ids []string
+	for _, info := range ModelsFor(provider) {
+		ids = append(ids, info.ID)
+	}
+	return ids
+}
+
+// Describe summarizes a model's capabilities, e.g. "200k context, tools, vision"
+func (m ModelInfo) Describe() string {
+	parts := []string{fmt.Sprintf("%dk context", m.ContextWindow/1000)}
+	if m.Tools {
+		parts = append(parts, "tools")
+	}
+	if m.Vision {
+		parts = append(parts, "vision")
+	}
+	if m.Reasoning {
+		parts = append(parts, "thinking")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestAliasesResolveToCatalogModels(t *testing.T) {
+	for provider, aliases := range ModelAliases {
+		for alias, id := range aliases {
+			info, ok := LookupModel(provider, alias)
+			if !ok {
+				t.Errorf("%s alias %q resolves to %q, which isn't in the catalog", provider, alias, id)
+				continue
+			}
+			if info.ID != id {
+				t.Errorf("%s alias %q found %q, want %q", provider, alias, info.ID, id)
+			}
+		}
+	}
+
+	// Sub-agents and hooks use these without checking
+	for name, models := range map[string]map[string]string{"FastModels": FastModels, "DefaultModels": DefaultModels} {
+		for provider, alias := range models {
+			if _, ok := LookupModel(provider, alias); !ok {
+				t.Errorf("%s[%q] = %q, which isn't in the catalog", name, provider, alias)
+			}
+		}
+	}
+}
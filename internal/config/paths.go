@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 const (
@@ -12,9 +15,12 @@ const (
 	MemoryFile    = "OSCODE.md"
 	LocalMemory   = "OSCODE.local.md"
 	SessionsDir   = "sessions"
+	HistoryDir    = "history"
 	CommandsDir   = "commands"
 	RulesDir      = "rules"
+	AgentsDir     = "agents"
 	MCPConfigFile = ".mcp.json"
+	MCPAuthFile   = "mcp-auth.json"
 )
 
 // GetConfigDir returns the user's config directory for OSCode
@@ -60,6 +66,28 @@ func GetSessionsDir() string {
 	return filepath.Join(GetUserConfigDir(), SessionsDir)
 }
 
+// GetProjectHistoryPath returns the prompt history file for a project,
+// kept with the user's config rather than in the project. The file is
+// named for the project's directory and a hash of its full path, so
+// projects with the same name don't share a history.
+func GetProjectHistoryPath(projectDir string) string {
+	clean := filepath.Clean(projectDir)
+	sum := sha256.Sum256([]byte(clean))
+	name := strings.NewReplacer("/", "", "\\", "", ":", "").Replace(filepath.Base(clean))
+	if name == "" || name == "." {
+		name = "root"
+	}
+	key := name + "-" + hex.EncodeToString(sum[:8])
+	return filepath.Join(GetUserConfigDir(), HistoryDir, key+".jsonl")
+}
+
+// GetLegacyProjectHistoryPath returns where a project's prompt history was
+// kept before GetProjectHistoryPath named files by hash
+func GetLegacyProjectHistoryPath(projectDir string) string {
+	key := strings.NewReplacer("/", "-", "\\", "-", ":", "").Replace(filepath.Clean(projectDir))
+	return filepath.Join(GetUserConfigDir(), HistoryDir, key+".jsonl")
+}
+
 // GetUserMemoryPath returns the path to the user's OSCODE.md
 func GetUserMemoryPath() string {
 	return filepath.Join(GetUserConfigDir(), MemoryFile)
@@ -75,6 +103,11 @@ func GetUserRulesDir() string {
 	return filepath.Join(GetUserConfigDir(), RulesDir)
 }
 
+// GetUserAgentsDir returns the path to user's sub-agent definitions
+func GetUserAgentsDir() string {
+	return filepath.Join(GetUserConfigDir(), AgentsDir)
+}
+
 // GetProjectConfigDir returns the .oscode directory in the current project
 func GetProjectConfigDir(projectDir string) string {
 	return filepath.Join(projectDir, "."+AppName)
@@ -115,11 +148,21 @@ func GetProjectRulesDir(projectDir string) string {
 	return filepath.Join(GetProjectConfigDir(projectDir), RulesDir)
 }
 
+// GetProjectAgentsDir returns the project's sub-agent definitions directory
+func GetProjectAgentsDir(projectDir string) string {
+	return filepath.Join(GetProjectConfigDir(projectDir), AgentsDir)
+}
+
 // GetMCPConfigPath returns the project's MCP config file path
 func GetMCPConfigPath(projectDir string) string {
 	return filepath.Join(projectDir, MCPConfigFile)
 }
 
+// GetMCPAuthPath returns the path where MCP OAuth tokens are stored
+func GetMCPAuthPath() string {
+	return filepath.Join(GetUserConfigDir(), MCPAuthFile)
+}
+
 // EnsureConfigDirs creates necessary config directories
 func EnsureConfigDirs() error {
 	dirs := []string{
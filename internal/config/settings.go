@@ -6,6 +6,9 @@ type Config struct {
 	DefaultProvider string `json:"defaultProvider" mapstructure:"defaultProvider"`
 	DefaultModel    string `json:"defaultModel" mapstructure:"defaultModel"`
 
+	// Extended thinking: off, low, medium, high or a token budget
+	Thinking string `json:"thinking,omitempty" mapstructure:"thinking"`
+
 	// Provider configurations
 	Providers map[string]ProviderConfig `json:"providers" mapstructure:"providers"`
 
@@ -24,6 +27,9 @@ type Config struct {
 	// Session settings
 	CleanupPeriodDays int `json:"cleanupPeriodDays" mapstructure:"cleanupPeriodDays"`
 
+	// Retries of failed provider requests
+	Retry RetryConfig `json:"retry" mapstructure:"retry"`
+
 	// Runtime flags (not persisted)
 	Verbose        bool   `json:"-" mapstructure:"-"`
 	SystemPrompt   string `json:"-" mapstructure:"-"`
@@ -32,14 +38,73 @@ type Config struct {
 
 // ProviderConfig contains settings for an LLM provider
 type ProviderConfig struct {
+	Type    string `json:"type,omitempty" mapstructure:"type"` // API the provider speaks (empty = the provider's name)
 	APIKey  string `json:"apiKey" mapstructure:"apiKey"`
 	BaseURL string `json:"baseURL" mapstructure:"baseURL"`
 	OrgID   string `json:"orgId" mapstructure:"orgId"`
 
+	// Extra HTTP headers sent with every request, e.g. for gateways
+	Headers map[string]string `json:"headers,omitempty" mapstructure:"headers"`
+
+	// Models served, listed by /model for servers that can't list them
+	Models []string `json:"models,omitempty" mapstructure:"models"`
+
+	// Model to switch to when requests keep failing (see RetryConfig)
+	FallbackModel string `json:"fallbackModel,omitempty" mapstructure:"fallbackModel"`
+
+	// Workarounds for OpenAI-compatible servers
+	Quirks ProviderQuirks `json:"quirks,omitempty" mapstructure:"quirks"`
+
 	// Provider-specific options
 	Options map[string]interface{} `json:"options" mapstructure:"options"`
 }
 
+// Provider types
+const (
+	ProviderAnthropic        = "anthropic"
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderOllama           = "ollama"
+	ProviderGemini           = "gemini"
+)
+
+// ProviderQuirks works around OpenAI-compatible servers that differ from
+// the OpenAI API
+type ProviderQuirks struct {
+	NoTools       bool `json:"noTools,omitempty" mapstructure:"noTools"`             // Server doesn't support tool calls
+	NoVision      bool `json:"noVision,omitempty" mapstructure:"noVision"`           // Server doesn't accept images
+	NoStreamTools bool `json:"noStreamTools,omitempty" mapstructure:"noStreamTools"` // Tool calls only work without streaming
+	SystemAsUser  bool `json:"systemAsUser,omitempty" mapstructure:"systemAsUser"`   // No system role; the system prompt is sent as a user message
+	TextContent   bool `json:"textContent,omitempty" mapstructure:"textContent"`     // Message content must be a string, not a list of parts
+}
+
+// ProviderType returns the API a provider speaks. Providers without a type
+// are named after theirs.
+func (p ProviderConfig) ProviderType(name string) string {
+	if p.Type != "" {
+		return p.Type
+	}
+	return name
+}
+
+// NeedsAPIKey reports whether a provider can't be used without an API key
+func (p ProviderConfig) NeedsAPIKey(name string) bool {
+	switch p.ProviderType(name) {
+	case ProviderOllama, ProviderOpenAICompatible:
+		return false
+	}
+	return true
+}
+
+// RetryConfig controls how rate limits, overloads, server errors and
+// dropped connections are retried
+type RetryConfig struct {
+	MaxRetries    int     `json:"maxRetries" mapstructure:"maxRetries"`       // Retries per request (0 = none)
+	InitialDelay  float64 `json:"initialDelay" mapstructure:"initialDelay"`   // Seconds before the first retry, doubled for each one after
+	MaxDelay      float64 `json:"maxDelay" mapstructure:"maxDelay"`           // Longest wait between retries, in seconds
+	FallbackAfter int     `json:"fallbackAfter" mapstructure:"fallbackAfter"` // Failed attempts before switching to the provider's fallbackModel
+}
+
 // PermissionConfig defines permission rules
 type PermissionConfig struct {
 	// Rules that auto-allow tools
@@ -68,6 +133,8 @@ type HookConfig struct {
 	SessionEnd        []HookDefinition `json:"SessionEnd" mapstructure:"SessionEnd"`
 	Notification      []HookDefinition `json:"Notification" mapstructure:"Notification"`
 	Stop              []HookDefinition `json:"Stop" mapstructure:"Stop"`
+	PreCompact        []HookDefinition `json:"PreCompact" mapstructure:"PreCompact"`
+	SubagentStop      []HookDefinition `json:"SubagentStop" mapstructure:"SubagentStop"`
 }
 
 // HookDefinition defines a single hook
@@ -81,6 +148,12 @@ type HookAction struct {
 	Type    string `json:"type" mapstructure:"type"` // "command" or "prompt"
 	Command string `json:"command" mapstructure:"command"`
 	Prompt  string `json:"prompt" mapstructure:"prompt"`
+
+	Timeout int `json:"timeout,omitempty" mapstructure:"timeout"` // Timeout in seconds (0 = default)
+
+	// Prompt hook options
+	Model      string `json:"model,omitempty" mapstructure:"model"`           // Model that evaluates the prompt (empty = provider's fast model)
+	FailClosed bool   `json:"failClosed,omitempty" mapstructure:"failClosed"` // Block the operation if evaluation fails
 }
 
 // MCPConfig contains MCP server configurations
@@ -91,11 +164,23 @@ type MCPConfig struct {
 // MCPServerConfig defines an MCP server
 type MCPServerConfig struct {
 	Transport string            `json:"type" mapstructure:"type"` // "http", "sse", "stdio"
-	URL       string            `json:"url" mapstructure:"url"`
-	Command   string            `json:"command" mapstructure:"command"`
-	Args      []string          `json:"args" mapstructure:"args"`
-	Env       map[string]string `json:"env" mapstructure:"env"`
-	Headers   map[string]string `json:"headers" mapstructure:"headers"`
+	URL       string            `json:"url,omitempty" mapstructure:"url"`
+	Command   string            `json:"command,omitempty" mapstructure:"command"`
+	Args      []string          `json:"args,omitempty" mapstructure:"args"`
+	Env       map[string]string `json:"env,omitempty" mapstructure:"env"`
+	Headers   map[string]string `json:"headers,omitempty" mapstructure:"headers"`
+
+	// OAuth settings for remote servers that require authorization
+	OAuth *MCPOAuthConfig `json:"oauth,omitempty" mapstructure:"oauth"`
+}
+
+// MCPOAuthConfig configures the OAuth flow for a remote MCP server. All
+// fields are optional; clients are registered dynamically when possible.
+type MCPOAuthConfig struct {
+	ClientID     string   `json:"clientId,omitempty" mapstructure:"clientId"`
+	ClientSecret string   `json:"clientSecret,omitempty" mapstructure:"clientSecret"`
+	Scopes       []string `json:"scopes,omitempty" mapstructure:"scopes"`
+	CallbackPort int      `json:"callbackPort,omitempty" mapstructure:"callbackPort"` // 0 = any free port
 }
 
 // UIConfig contains UI settings
@@ -105,6 +190,9 @@ type UIConfig struct {
 	ShowCost       bool   `json:"showCost" mapstructure:"showCost"`
 	VimMode        bool   `json:"vimMode" mapstructure:"vimMode"`
 	OutputStyle    string `json:"outputStyle" mapstructure:"outputStyle"`
+
+	// Extra patterns for secrets to keep out of prompt history
+	HistoryRedactPatterns []string `json:"historyRedactPatterns,omitempty" mapstructure:"historyRedactPatterns"`
 }
 
 // DefaultConfig returns the default configuration
@@ -121,6 +209,12 @@ func DefaultConfig() *Config {
 				APIKey:  "${OPENAI_API_KEY}",
 				BaseURL: "",
 			},
+			"gemini": {
+				APIKey: "${GEMINI_API_KEY}",
+			},
+			"ollama": {
+				BaseURL: "${OLLAMA_HOST:-http://localhost:11434}",
+			},
 		},
 		Permissions: PermissionConfig{
 			Allow:       []string{"Read", "Glob", "Grep", "Task", "Write", "Edit", "WebFetch", "WebSearch"},
@@ -140,6 +234,12 @@ func DefaultConfig() *Config {
 			OutputStyle:    "normal",
 		},
 		CleanupPeriodDays: 30,
+		Retry: RetryConfig{
+			MaxRetries:    5,
+			InitialDelay:  1,
+			MaxDelay:      30,
+			FallbackAfter: 2,
+		},
 	}
 }
 
@@ -148,7 +248,7 @@ var ModelAliases = map[string]map[string]string{
 	"anthropic": {
 		"opus":   "claude-opus-4-20250514",
 		"sonnet": "claude-sonnet-4-20250514",
-		"haiku":  "claude-haiku-3-5-20241022",
+		"haiku":  "claude-3-5-haiku-20241022",
 	},
 	"openai": {
 		"gpt4":    "gpt-4-turbo-preview",
@@ -157,6 +257,26 @@ var ModelAliases = map[string]map[string]string{
 		"o1":      "o1-preview",
 		"o1-mini": "o1-mini",
 	},
+	"gemini": {
+		"gemini-pro":   "gemini-2.5-pro",
+		"gemini-flash": "gemini-2.5-flash",
+	},
+}
+
+// FastModels maps providers to the alias of their fast, inexpensive model
+var FastModels = map[string]string{
+	"anthropic": "haiku",
+	"openai":    "gpt4o-mini",
+	"gemini":    "gemini-flash",
+}
+
+// GetFastModel returns the fast model for a provider, falling back to the
+// given default when the provider has none
+func GetFastModel(provider, fallback string) string {
+	if alias, ok := FastModels[provider]; ok {
+		return ResolveModel(provider, alias)
+	}
+	return fallback
 }
 
 // ResolveModel resolves a model alias to its full name
@@ -10,9 +10,11 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
 )
 
 // Event represents a hook event type
@@ -27,8 +29,27 @@ const (
 	EventSessionEnd        Event = "SessionEnd"
 	EventNotification      Event = "Notification"
 	EventStop              Event = "Stop"
+	EventPreCompact        Event = "PreCompact"
+	EventSubagentStop      Event = "SubagentStop"
 )
 
+// AllEvents lists every hook event in lifecycle order
+var AllEvents = []Event{
+	EventSessionStart,
+	EventUserPromptSubmit,
+	EventPreToolUse,
+	EventPermissionRequest,
+	EventPostToolUse,
+	EventNotification,
+	EventSubagentStop,
+	EventStop,
+	EventPreCompact,
+	EventSessionEnd,
+}
+
+// defaultCommandTimeout bounds how long a command hook may run
+const defaultCommandTimeout = 30 * time.Second
+
 // Context holds context for hook execution
 type Context struct {
 	Event     Event
@@ -40,13 +61,27 @@ type Context struct {
 	WorkDir   string
 	Prompt    string
 	Message   string
+
+	// StopHookActive is set when the agent is already continuing because
+	// of a Stop hook, so hooks can avoid looping forever
+	StopHookActive bool
+
+	// Transcript is the conversation so far, used by prompt hooks
+	Transcript []llm.Message
 }
 
 // Result represents the result of hook execution
 type Result struct {
 	Continue bool                   // Whether to continue with the operation
-	Message  string                 // Optional message from the hook
+	Message  string                 // Optional message from the hook (the reason when blocking)
 	Modified map[string]interface{} // Modified input (for pre hooks)
+
+	Decision          Decision // Explicit approve/block/ask verdict, if any
+	AdditionalContext string   // Context to append to the conversation
+	Output            string   // Hook stdout to show the user
+	SuppressOutput    bool     // Keep the hook's stdout out of the transcript
+	Instruction       string   // Stop hooks: keep going with this instruction
+	Errors            []string // Non-blocking hook failures to show the user
 }
 
 // Executor handles hook execution
@@ -54,6 +89,20 @@ type Executor struct {
 	config  config.HookConfig
 	workDir string
 	env     []string
+
+	// LLM used to evaluate prompt hooks
+	provider llm.Provider
+	model    string
+
+	// Session details filled into every hook context
+	sessionID  string
+	transcript func() []llm.Message
+
+	// onError reports non-blocking hook failures
+	onError func(message string)
+
+	// onOutput shows hook stdout to the user
+	onOutput func(output string)
 }
 
 // NewExecutor creates a new hook executor
@@ -65,45 +114,150 @@ func NewExecutor(cfg config.HookConfig, workDir string) *Executor {
 	}
 }
 
-// Execute runs hooks for the given event
+// Execute runs hooks for the given event. Matching hooks are independent and
+// run in parallel; their results are merged in declaration order. A hook
+// that fails doesn't fail the event: it is reported and skipped.
 func (e *Executor) Execute(ctx context.Context, hookCtx Context) (*Result, error) {
-	hooks := e.getHooksForEvent(hookCtx.Event)
-	if len(hooks) == 0 {
+	var actions []config.HookAction
+	for _, hookDef := range e.getHooksForEvent(hookCtx.Event) {
+		// Check if hook matches the context
+		if e.matchesContext(hookDef.Matcher, hookCtx) {
+			actions = append(actions, hookDef.Hooks...)
+		}
+	}
+
+	if len(actions) == 0 {
 		return &Result{Continue: true}, nil
 	}
 
-	result := &Result{Continue: true}
+	e.fillContext(&hookCtx)
 
-	for _, hookDef := range hooks {
-		// Check if hook matches the context
-		if !e.matchesContext(hookDef.Matcher, hookCtx) {
-			continue
-		}
+	results := make([]*Result, len(actions))
+	errs := make([]error, len(actions))
 
-		// Execute each hook action
-		for _, action := range hookDef.Hooks {
-			actionResult, err := e.executeAction(ctx, action, hookCtx)
-			if err != nil {
-				return nil, fmt.Errorf("hook execution failed: %w", err)
-			}
+	var wg sync.WaitGroup
+	for i, action := range actions {
+		wg.Add(1)
+		go func(i int, action config.HookAction) {
+			defer wg.Done()
+			results[i], errs[i] = e.executeAction(ctx, action, hookCtx)
+		}(i, action)
+	}
+	wg.Wait()
 
-			// If any hook says don't continue, stop
-			if !actionResult.Continue {
-				result.Continue = false
-				result.Message = actionResult.Message
-				return result, nil
+	result := &Result{Continue: true}
+	for i, action := range actions {
+		// A hook that can't run is reported and skipped, like one that fails
+		if errs[i] != nil {
+			results[i] = &Result{
+				Continue: true,
+				Errors:   []string{fmt.Sprintf("hook %s failed: %v", actionLabel(action), errs[i])},
 			}
+		}
 
-			// Merge modified input if present
-			if actionResult.Modified != nil {
-				result.Modified = actionResult.Modified
-			}
+		// The first hook that blocks decides the reason
+		if result.Continue {
+			result.merge(results[i])
+		} else {
+			result.Errors = append(result.Errors, results[i].Errors...)
+		}
+	}
+
+	if !result.Continue && (hookCtx.Event == EventStop || hookCtx.Event == EventSubagentStop) {
+		// Blocking a stop means the agent keeps working
+		result.Instruction = result.Message
+	}
+
+	if e.onError != nil {
+		for _, msg := range result.Errors {
+			e.onError(msg)
 		}
 	}
+	if e.onOutput != nil && result.Output != "" {
+		e.onOutput(result.Output)
+	}
 
 	return result, nil
 }
 
+// fillContext adds session details the caller didn't provide
+func (e *Executor) fillContext(hookCtx *Context) {
+	if hookCtx.SessionID == "" {
+		hookCtx.SessionID = e.sessionID
+	}
+	if hookCtx.WorkDir == "" {
+		hookCtx.WorkDir = e.workDir
+	}
+	if hookCtx.Transcript == nil && e.transcript != nil {
+		hookCtx.Transcript = e.transcript()
+	}
+}
+
+// merge folds a single hook's result into the aggregate
+func (r *Result) merge(other *Result) {
+	if !other.Continue {
+		r.Continue = false
+		r.Decision = DecisionBlock
+		r.Message = other.Message
+	} else if other.Decision == DecisionAsk || (other.Decision == DecisionApprove && r.Decision == DecisionNone) {
+		// Ask wins over approve
+		r.Decision = other.Decision
+		r.Message = other.Message
+	}
+
+	// Merge modified input if present
+	if other.Modified != nil {
+		r.Modified = other.Modified
+	}
+
+	if other.AdditionalContext != "" {
+		if r.AdditionalContext != "" {
+			r.AdditionalContext += "\n"
+		}
+		r.AdditionalContext += other.AdditionalContext
+	}
+
+	// Hooks that suppress their output keep it out of the aggregate
+	if other.SuppressOutput {
+		r.SuppressOutput = true
+	} else if other.Output != "" {
+		if r.Output != "" {
+			r.Output += "\n"
+		}
+		r.Output += other.Output
+	}
+
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
+// SetProvider sets the LLM used to evaluate prompt hooks. The model is used
+// for hooks that don't name their own.
+func (e *Executor) SetProvider(provider llm.Provider, model string) {
+	e.provider = provider
+	e.model = model
+}
+
+// SetSession sets the session ID and transcript source passed to hooks
+func (e *Executor) SetSession(sessionID string, transcript func() []llm.Message) {
+	e.sessionID = sessionID
+	e.transcript = transcript
+}
+
+// SetErrorHandler sets the callback for non-blocking hook failures
+func (e *Executor) SetErrorHandler(onError func(message string)) {
+	e.onError = onError
+}
+
+// SetOutputHandler sets the callback that shows hook stdout to the user
+func (e *Executor) SetOutputHandler(onOutput func(output string)) {
+	e.onOutput = onOutput
+}
+
+// Definitions returns the hooks configured for an event
+func (e *Executor) Definitions(event Event) []config.HookDefinition {
+	return e.getHooksForEvent(event)
+}
+
 func (e *Executor) getHooksForEvent(event Event) []config.HookDefinition {
 	switch event {
 	case EventPreToolUse:
@@ -122,6 +276,10 @@ func (e *Executor) getHooksForEvent(event Event) []config.HookDefinition {
 		return e.config.Notification
 	case EventStop:
 		return e.config.Stop
+	case EventPreCompact:
+		return e.config.PreCompact
+	case EventSubagentStop:
+		return e.config.SubagentStop
 	default:
 		return nil
 	}
@@ -170,23 +328,35 @@ func matchPattern(pattern, value string) (bool, error) {
 	return re.MatchString(value), nil
 }
 
+// actionLabel names a hook action in error messages
+func actionLabel(action config.HookAction) string {
+	if action.Type == "command" {
+		return fmt.Sprintf("%q", action.Command)
+	}
+	return fmt.Sprintf("%q", action.Type)
+}
+
 func (e *Executor) executeAction(ctx context.Context, action config.HookAction, hookCtx Context) (*Result, error) {
 	switch action.Type {
 	case "command":
-		return e.executeCommand(ctx, action.Command, hookCtx)
+		return e.executeCommand(ctx, action, hookCtx)
 	case "prompt":
-		return e.executePrompt(action.Prompt, hookCtx)
+		return e.executePrompt(ctx, action, hookCtx)
 	default:
 		return nil, fmt.Errorf("unknown hook action type: %s", action.Type)
 	}
 }
 
-func (e *Executor) executeCommand(ctx context.Context, command string, hookCtx Context) (*Result, error) {
+func (e *Executor) executeCommand(ctx context.Context, action config.HookAction, hookCtx Context) (*Result, error) {
 	// Expand variables in command
-	command = e.expandVariables(command, hookCtx)
+	command := e.expandVariables(action.Command, hookCtx)
 
 	// Create command with timeout
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	timeout := defaultCommandTimeout
+	if action.Timeout > 0 {
+		timeout = time.Duration(action.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	var cmd *exec.Cmd
@@ -199,50 +369,51 @@ func (e *Executor) executeCommand(ctx context.Context, command string, hookCtx C
 	cmd.Dir = e.workDir
 	cmd.Env = e.buildEnv(hookCtx)
 
+	// Hook context is also available as JSON on stdin
+	inputJSON, _ := json.Marshal(newInput(hookCtx))
+	cmd.Stdin = bytes.NewReader(inputJSON)
+
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
-
-	result := &Result{
-		Continue: true,
-		Message:  strings.TrimSpace(stdout.String()),
-	}
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
 
-	// Non-zero exit code means don't continue
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.ExitCode() != 0 {
-				result.Continue = false
-				result.Message = strings.TrimSpace(stderr.String())
-				if result.Message == "" {
-					result.Message = stdout.String()
-				}
+		// Exit code 2 blocks and feeds stderr to the model
+		if exitErr.ExitCode() == BlockExitCode {
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = strings.TrimSpace(stdout.String())
 			}
-		} else {
-			return nil, err
+			return &Result{Continue: false, Decision: DecisionBlock, Message: message}, nil
 		}
-	}
 
-	// Try to parse output as JSON for modified input
-	var modified map[string]interface{}
-	if err := json.Unmarshal(stdout.Bytes(), &modified); err == nil {
-		result.Modified = modified
+		// Any other failure is reported but doesn't block
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return &Result{
+			Continue: true,
+			Errors:   []string{fmt.Sprintf("hook %q failed: %s", command, message)},
+		}, nil
 	}
 
-	return result, nil
-}
-
-func (e *Executor) executePrompt(prompt string, hookCtx Context) (*Result, error) {
-	// Expand variables in prompt
-	prompt = e.expandVariables(prompt, hookCtx)
+	text := strings.TrimSpace(stdout.String())
+	if output, ok := parseOutput(stdout.Bytes()); ok {
+		result := output.toResult()
+		result.Output = text
+		return result, nil
+	}
 
-	// For now, just return the prompt as a message
-	// In a full implementation, this would inject into the conversation
 	return &Result{
 		Continue: true,
-		Message:  prompt,
+		Message:  text,
+		Output:   text,
 	}, nil
 }
 
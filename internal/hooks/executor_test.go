@@ -0,0 +1,219 @@
+package hooks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// commandHook is a command hook action running script with bash
+func commandHook(script string) config.HookAction {
+	return config.HookAction{Type: "command", Command: script}
+}
+
+// newTestExecutor returns an executor with actions configured for
+// PreToolUse on every tool
+func newTestExecutor(t *testing.T, actions ...config.HookAction) *Executor {
+	t.Helper()
+	cfg := config.HookConfig{
+		PreToolUse: []config.HookDefinition{{Matcher: "*", Hooks: actions}},
+	}
+	return NewExecutor(cfg, t.TempDir())
+}
+
+// preToolUse runs the executor's PreToolUse hooks for a Bash call
+func preToolUse(t *testing.T, executor *Executor) *Result {
+	t.Helper()
+	result, err := executor.Execute(context.Background(), Context{
+		Event:    EventPreToolUse,
+		ToolName: "Bash",
+		Input:    map[string]interface{}{"command": "ls"},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	return result
+}
+
+func TestExecuteSuppressOutput(t *testing.T) {
+	executor := newTestExecutor(t,
+		commandHook(`echo "formatted 3 files"`),
+		commandHook(`echo '{"suppressOutput": true, "additionalContext": "lint clean"}'`),
+		commandHook(`echo '{"additionalContext": "tests pass"}'`),
+	)
+	var shown []string
+	executor.SetOutputHandler(func(output string) {
+		shown = append(shown, output)
+	})
+
+	result := preToolUse(t, executor)
+
+	if !result.SuppressOutput {
+		t.Error("SuppressOutput = false, want true")
+	}
+	want := "formatted 3 files\n" + `{"additionalContext": "tests pass"}`
+	if result.Output != want {
+		t.Errorf("Output = %q, want %q", result.Output, want)
+	}
+	if len(shown) != 1 || shown[0] != want {
+		t.Errorf("shown output = %q, want [%q]", shown, want)
+	}
+	if result.AdditionalContext != "lint clean\ntests pass" {
+		t.Errorf("AdditionalContext = %q, suppressing output shouldn't drop context", result.AdditionalContext)
+	}
+}
+
+func TestExecuteCommandHook(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   Result
+	}{
+		{
+			name:   "exit 2 blocks with stderr",
+			script: `echo "not on main" >&2; echo ignored; exit 2`,
+			want:   Result{Continue: false, Decision: DecisionBlock, Message: "not on main"},
+		},
+		{
+			name:   "exit 2 without stderr uses stdout",
+			script: `echo "no tests"; exit 2`,
+			want:   Result{Continue: false, Decision: DecisionBlock, Message: "no tests"},
+		},
+		{
+			name:   "other exit codes don't block",
+			script: `echo "oops" >&2; exit 1`,
+			want:   Result{Continue: true, Errors: []string{`hook "echo \"oops\" >&2; exit 1" failed: oops`}},
+		},
+		{
+			name:   "plain stdout",
+			script: `echo done`,
+			want:   Result{Continue: true, Output: "done"},
+		},
+		{
+			name:   "json approve",
+			script: `echo '{"decision": "approve", "reason": "safe", "additionalContext": "ctx"}'`,
+			want: Result{
+				Continue: true, Decision: DecisionApprove, Message: "safe", AdditionalContext: "ctx",
+				Output: `{"decision": "approve", "reason": "safe", "additionalContext": "ctx"}`,
+			},
+		},
+		{
+			name:   "json block",
+			script: `echo '{"decision": "block", "reason": "use the staging db"}'`,
+			want: Result{
+				Continue: false, Decision: DecisionBlock, Message: "use the staging db",
+				Output: `{"decision": "block", "reason": "use the staging db"}`,
+			},
+		},
+		{
+			name:   "json deny is block",
+			script: `echo '{"decision": "deny"}'`,
+			want:   Result{Continue: false, Decision: DecisionBlock, Output: `{"decision": "deny"}`},
+		},
+		{
+			name:   "json allow is approve",
+			script: `echo '{"decision": "Allow"}'`,
+			want:   Result{Continue: true, Decision: DecisionApprove, Output: `{"decision": "Allow"}`},
+		},
+		{
+			name:   "json ask",
+			script: `echo '{"decision": "ask", "reason": "touches prod"}'`,
+			want: Result{
+				Continue: true, Decision: DecisionAsk, Message: "touches prod",
+				Output: `{"decision": "ask", "reason": "touches prod"}`,
+			},
+		},
+		{
+			name:   "json updated input",
+			script: `echo '{"updatedInput": {"command": "ls -la"}}'`,
+			want: Result{
+				Continue: true, Modified: map[string]interface{}{"command": "ls -la"},
+				Output: `{"updatedInput": {"command": "ls -la"}}`,
+			},
+		},
+		{
+			name:   "unknown decision is plain text",
+			script: `echo '{"decision": "maybe"}'`,
+			want:   Result{Continue: true, Output: `{"decision": "maybe"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := preToolUse(t, newTestExecutor(t, commandHook(tt.script)))
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("result = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteMergesParallelHooks(t *testing.T) {
+	approve := commandHook(`echo '{"decision": "approve", "reason": "approved"}'`)
+	ask := commandHook(`echo '{"decision": "ask", "reason": "asked"}'`)
+	block := commandHook(`echo blocked >&2; exit 2`)
+
+	tests := []struct {
+		name         string
+		actions      []config.HookAction
+		wantContinue bool
+		wantDecision Decision
+		wantMessage  string
+	}{
+		{"approve alone", []config.HookAction{approve}, true, DecisionApprove, "approved"},
+		{"ask beats approve", []config.HookAction{approve, ask}, true, DecisionAsk, "asked"},
+		{"ask beats later approve", []config.HookAction{ask, approve}, true, DecisionAsk, "asked"},
+		{"block beats ask and approve", []config.HookAction{approve, ask, block}, false, DecisionBlock, "blocked"},
+		{"block beats later hooks", []config.HookAction{block, ask, approve}, false, DecisionBlock, "blocked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := preToolUse(t, newTestExecutor(t, tt.actions...))
+			if got.Continue != tt.wantContinue || got.Decision != tt.wantDecision || got.Message != tt.wantMessage {
+				t.Errorf("result = (%v, %q, %q), want (%v, %q, %q)",
+					got.Continue, got.Decision, got.Message, tt.wantContinue, tt.wantDecision, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestExecuteKeepsDeclarationOrder(t *testing.T) {
+	// The first hook finishes last
+	executor := newTestExecutor(t,
+		commandHook(`sleep 0.3; echo '{"additionalContext": "first"}'`),
+		commandHook(`sleep 0.1; echo '{"additionalContext": "second"}'`),
+		commandHook(`echo '{"additionalContext": "third"}'`),
+	)
+
+	result := preToolUse(t, executor)
+
+	if result.AdditionalContext != "first\nsecond\nthird" {
+		t.Errorf("AdditionalContext = %q, want hooks in declaration order", result.AdditionalContext)
+	}
+}
+
+func TestExecuteSkipsFailedHooks(t *testing.T) {
+	executor := newTestExecutor(t,
+		config.HookAction{Type: "webhook"},
+		commandHook(`echo '{"decision": "approve", "additionalContext": "checked"}'`),
+	)
+	var reported []string
+	executor.SetErrorHandler(func(message string) {
+		reported = append(reported, message)
+	})
+
+	result, err := executor.Execute(context.Background(), Context{Event: EventPreToolUse, ToolName: "Bash"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v, want the failed hook skipped", err)
+	}
+	if !result.Continue || result.Decision != DecisionApprove || result.AdditionalContext != "checked" {
+		t.Errorf("result = %+v, want the other hook's decision", result)
+	}
+	want := []string{`hook "webhook" failed: unknown hook action type: webhook`}
+	if !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported = %q, want %q", reported, want)
+	}
+}
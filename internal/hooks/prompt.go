@@ -0,0 +1,223 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
+)
+
+const (
+	// defaultPromptTimeout bounds how long a prompt hook may take
+	defaultPromptTimeout = 30 * time.Second
+
+	// transcriptTailMessages is how many recent messages a prompt hook sees
+	transcriptTailMessages = 10
+
+	// maxHookFieldLength truncates large inputs, results and messages
+	maxHookFieldLength = 2000
+)
+
+const promptHookSystemPrompt = `You are a policy evaluator for a coding agent. You are given a policy and the details of an event the agent is about to perform or has just performed. Decide whether the event complies with the policy.
+
+Respond with ONLY a JSON object, no prose and no code fences:
+{"decision": "allow" | "deny" | "modify", "reason": "<one sentence>", "updated_input": {<full replacement tool input, only for "modify">}}
+
+- "allow": the event complies with the policy.
+- "deny": the event violates the policy. The reason is shown to the agent, so explain what to do instead.
+- "modify": the event can comply if the tool input is changed. Provide the complete updated input.`
+
+// promptDecision is the structured response expected from the evaluator
+type promptDecision struct {
+	Decision     string                 `json:"decision"`
+	Reason       string                 `json:"reason"`
+	UpdatedInput map[string]interface{} `json:"updated_input"`
+}
+
+// promptDecisionSchema constrains the evaluator's response to a decision
+var promptDecisionSchema = &llm.ResponseSchema{
+	Name:        "policy_decision",
+	Description: "Report whether the event complies with the policy.",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"decision":      map[string]interface{}{"type": "string", "enum": []string{"allow", "deny", "modify"}},
+			"reason":        map[string]interface{}{"type": "string"},
+			"updated_input": map[string]interface{}{"type": "object"},
+		},
+		"required": []string{"decision", "reason"},
+	},
+}
+
+// executePrompt asks an LLM to evaluate the hook's policy against the event
+func (e *Executor) executePrompt(ctx context.Context, action config.HookAction, hookCtx Context) (*Result, error) {
+	timeout := defaultPromptTimeout
+	if action.Timeout > 0 {
+		timeout = time.Duration(action.Timeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	decision, err := e.evaluatePrompt(ctx, action, hookCtx)
+	if err != nil {
+		if action.FailClosed {
+			return &Result{
+				Continue: false,
+				Decision: DecisionBlock,
+				Message:  fmt.Sprintf("Blocked: prompt hook could not be evaluated: %v", err),
+			}, nil
+		}
+		return &Result{
+			Continue: true,
+			Errors:   []string{fmt.Sprintf("prompt hook could not be evaluated: %v", err)},
+		}, nil
+	}
+
+	switch decision.Decision {
+	case "deny":
+		return &Result{Continue: false, Decision: DecisionBlock, Message: decision.Reason}, nil
+	case "modify":
+		return &Result{Continue: true, Message: decision.Reason, Modified: decision.UpdatedInput}, nil
+	default:
+		return &Result{Continue: true, Message: decision.Reason}, nil
+	}
+}
+
+func (e *Executor) evaluatePrompt(ctx context.Context, action config.HookAction, hookCtx Context) (*promptDecision, error) {
+	if e.provider == nil {
+		return nil, fmt.Errorf("no LLM provider configured for prompt hooks")
+	}
+
+	model := e.model
+	if action.Model != "" {
+		model = config.ResolveModel(e.provider.Name(), action.Model)
+	}
+
+	req := &llm.ChatRequest{
+		Model:          model,
+		SystemPrompt:   promptHookSystemPrompt,
+		Messages:       []llm.Message{llm.NewUserMessage(buildPromptHookMessage(e.expandVariables(action.Prompt, hookCtx), hookCtx))},
+		MaxTokens:      1024,
+		ResponseSchema: promptDecisionSchema,
+	}
+
+	data, _, err := llm.ChatJSON(ctx, e.provider, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePromptDecision(string(data))
+}
+
+// parsePromptDecision extracts the JSON decision from the evaluator's reply
+func parsePromptDecision(text string) (*promptDecision, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in evaluator response")
+	}
+
+	var decision promptDecision
+	if err := json.Unmarshal([]byte(text[start:end+1]), &decision); err != nil {
+		return nil, fmt.Errorf("invalid evaluator response: %w", err)
+	}
+
+	switch decision.Decision {
+	case "allow", "deny":
+	case "modify":
+		if decision.UpdatedInput == nil {
+			return nil, fmt.Errorf("modify decision without updated_input")
+		}
+	default:
+		return nil, fmt.Errorf("unknown decision %q", decision.Decision)
+	}
+
+	return &decision, nil
+}
+
+// buildPromptHookMessage renders the policy and event context for the evaluator
+func buildPromptHookMessage(policy string, ctx Context) string {
+	var sb strings.Builder
+
+	sb.WriteString("## Policy\n")
+	sb.WriteString(policy)
+	sb.WriteString("\n\n## Event\n")
+	sb.WriteString(string(ctx.Event))
+	sb.WriteString("\n")
+
+	if ctx.ToolName != "" {
+		sb.WriteString("\n## Tool\n")
+		sb.WriteString(ctx.ToolName)
+		sb.WriteString("\n")
+	}
+
+	if ctx.Input != nil {
+		inputJSON, _ := json.MarshalIndent(ctx.Input, "", "  ")
+		sb.WriteString("\n## Tool input\n")
+		sb.WriteString(truncateField(string(inputJSON)))
+		sb.WriteString("\n")
+	}
+
+	if ctx.Result != "" {
+		sb.WriteString("\n## Tool result\n")
+		if ctx.IsError {
+			sb.WriteString("(error) ")
+		}
+		sb.WriteString(truncateField(ctx.Result))
+		sb.WriteString("\n")
+	}
+
+	if ctx.Prompt != "" {
+		sb.WriteString("\n## User prompt\n")
+		sb.WriteString(truncateField(ctx.Prompt))
+		sb.WriteString("\n")
+	}
+
+	if tail := formatTranscriptTail(ctx.Transcript); tail != "" {
+		sb.WriteString("\n## Recent conversation\n")
+		sb.WriteString(tail)
+	}
+
+	return sb.String()
+}
+
+// formatTranscriptTail renders the last few messages as plain text
+func formatTranscriptTail(messages []llm.Message) string {
+	if len(messages) > transcriptTailMessages {
+		messages = messages[len(messages)-transcriptTailMessages:]
+	}
+
+	var sb strings.Builder
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			switch block.Type {
+			case llm.ContentTypeText:
+				if block.Text != "" {
+					sb.WriteString(fmt.Sprintf("[%s] %s\n", msg.Role, truncateField(block.Text)))
+				}
+			case llm.ContentTypeToolUse:
+				if block.ToolUse != nil {
+					inputJSON, _ := json.Marshal(block.ToolUse.Input)
+					sb.WriteString(fmt.Sprintf("[%s called %s] %s\n", msg.Role, block.ToolUse.Name, truncateField(string(inputJSON))))
+				}
+			case llm.ContentTypeToolResult:
+				if block.ToolResult != nil {
+					sb.WriteString(fmt.Sprintf("[tool result] %s\n", truncateField(block.ToolResult.Content)))
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+func truncateField(s string) string {
+	if len(s) <= maxHookFieldLength {
+		return s
+	}
+	return s[:maxHookFieldLength] + "... (truncated)"
+}
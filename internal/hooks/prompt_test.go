@@ -0,0 +1,166 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+	"github.com/heissanjay/oscode/internal/llm"
+)
+
+// stubProvider answers every chat request with the same reply or error,
+// recording the requests
+type stubProvider struct {
+	llm.Provider
+	reply    string
+	err      error
+	requests []*llm.ChatRequest
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	p.requests = append(p.requests, req)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &llm.ChatResponse{
+		Model:   req.Model,
+		Content: []llm.ContentBlock{{Type: llm.ContentTypeText, Text: p.reply}},
+	}, nil
+}
+
+// runPromptHook evaluates a prompt hook for a Bash call with the provider
+func runPromptHook(t *testing.T, provider *stubProvider, action config.HookAction) *Result {
+	t.Helper()
+	action.Type = "prompt"
+	if action.Prompt == "" {
+		action.Prompt = "Block anything that deletes files."
+	}
+	executor := newTestExecutor(t, action)
+	executor.SetProvider(provider, "fast-model")
+	return preToolUse(t, executor)
+}
+
+func TestPromptHookDecisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  Result
+	}{
+		{
+			name:  "allow",
+			reply: `{"decision": "allow", "reason": "read only"}`,
+			want:  Result{Continue: true},
+		},
+		{
+			name:  "deny",
+			reply: `{"decision": "deny", "reason": "deletes files, move them instead"}`,
+			want:  Result{Continue: false, Decision: DecisionBlock, Message: "deletes files, move them instead"},
+		},
+		{
+			name:  "modify",
+			reply: `{"decision": "modify", "reason": "dry run", "updated_input": {"command": "ls -n"}}`,
+			want:  Result{Continue: true, Modified: map[string]interface{}{"command": "ls -n"}},
+		},
+		{
+			name:  "code fence",
+			reply: "```json\n{\"decision\": \"deny\", \"reason\": \"no\"}\n```",
+			want:  Result{Continue: false, Decision: DecisionBlock, Message: "no"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubProvider{reply: tt.reply}
+			got := runPromptHook(t, provider, config.HookAction{})
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("result = %+v, want %+v", *got, tt.want)
+			}
+
+			req := provider.requests[0]
+			if req.Model != "fast-model" {
+				t.Errorf("model = %q, want the executor's fast model", req.Model)
+			}
+			if req.ResponseSchema != promptDecisionSchema {
+				t.Error("request doesn't ask for the decision schema")
+			}
+			message := req.Messages[0].GetText()
+			for _, want := range []string{"Block anything that deletes files.", "Bash", `"command": "ls"`} {
+				if !strings.Contains(message, want) {
+					t.Errorf("evaluator message doesn't contain %q:\n%s", want, message)
+				}
+			}
+		})
+	}
+}
+
+func TestPromptHookFailClosed(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *stubProvider
+	}{
+		{"provider error", &stubProvider{err: errors.New("overloaded")}},
+		{"malformed json", &stubProvider{reply: `{"decision": "allow"`}},
+		{"unknown decision", &stubProvider{reply: `{"decision": "maybe", "reason": "unsure"}`}},
+		{"modify without input", &stubProvider{reply: `{"decision": "modify", "reason": "change it"}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			closed := runPromptHook(t, &stubProvider{reply: tt.provider.reply, err: tt.provider.err}, config.HookAction{FailClosed: true})
+			if closed.Continue || closed.Decision != DecisionBlock {
+				t.Errorf("fail closed: result = %+v, want blocked", closed)
+			}
+			if !strings.Contains(closed.Message, "could not be evaluated") {
+				t.Errorf("fail closed: message = %q, want the evaluation error", closed.Message)
+			}
+
+			open := runPromptHook(t, tt.provider, config.HookAction{})
+			if !open.Continue || open.Decision != DecisionNone {
+				t.Errorf("fail open: result = %+v, want the operation to continue", open)
+			}
+			if len(open.Errors) != 1 || !strings.Contains(open.Errors[0], "could not be evaluated") {
+				t.Errorf("fail open: errors = %q, want the evaluation error reported", open.Errors)
+			}
+		})
+	}
+}
+
+func TestPromptHookWithoutProvider(t *testing.T) {
+	executor := newTestExecutor(t, config.HookAction{Type: "prompt", Prompt: "Anything", FailClosed: true})
+	result := preToolUse(t, executor)
+	if result.Continue || !strings.Contains(result.Message, "no LLM provider") {
+		t.Errorf("result = %+v, want blocked for lack of a provider", result)
+	}
+}
+
+func TestParsePromptDecision(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{`{"decision": "allow", "reason": "ok"}`, "allow", false},
+		{`Here you go: {"decision": "deny", "reason": "no"} done`, "deny", false},
+		{`{"decision": "modify", "updated_input": {"a": 1}}`, "modify", false},
+		{`{"decision": "modify"}`, "", true},
+		{`{"decision": "approve"}`, "", true},
+		{`{"decision": `, "", true},
+		{`no json here`, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePromptDecision(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePromptDecision(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.Decision != tt.want {
+			t.Errorf("parsePromptDecision(%q) = %q, want %q", tt.text, got.Decision, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Decision is a hook's verdict on the operation it was run for
+type Decision string
+
+const (
+	// DecisionNone leaves the operation to the normal permission flow
+	DecisionNone Decision = ""
+	// DecisionApprove allows the operation without asking the user
+	DecisionApprove Decision = "approve"
+	// DecisionBlock stops the operation and feeds the reason to the model
+	DecisionBlock Decision = "block"
+	// DecisionAsk forces a permission prompt even if rules would allow it
+	DecisionAsk Decision = "ask"
+)
+
+// BlockExitCode is the exit code a command hook uses to block the operation.
+// Its stderr is fed to the model as the reason.
+const BlockExitCode = 2
+
+// Output is the JSON a command hook may print on stdout (with exit code 0):
+//
+//	{
+//	  "decision": "approve" | "block" | "ask",
+//	  "reason": "shown to the model when blocking",
+//	  "additionalContext": "appended to the conversation",
+//	  "suppressOutput": true,
+//	  "updatedInput": { ... replacement tool input ... }
+//	}
+//
+// For Stop hooks, "block" keeps the agent going and the reason becomes its
+// next instruction. All fields are optional.
+type Output struct {
+	Decision          Decision               `json:"decision,omitempty"`
+	Reason            string                 `json:"reason,omitempty"`
+	AdditionalContext string                 `json:"additionalContext,omitempty"`
+	SuppressOutput    bool                   `json:"suppressOutput"`
+	UpdatedInput      map[string]interface{} `json:"updatedInput,omitempty"`
+}
+
+// Input is the JSON passed to command hooks on stdin
+type Input struct {
+	Event        Event                  `json:"hook_event_name"`
+	SessionID    string                 `json:"session_id,omitempty"`
+	WorkDir      string                 `json:"cwd,omitempty"`
+	ToolName     string                 `json:"tool_name,omitempty"`
+	ToolInput    map[string]interface{} `json:"tool_input,omitempty"`
+	ToolResponse string                 `json:"tool_response,omitempty"`
+	IsError      bool                   `json:"is_error,omitempty"`
+	Prompt       string                 `json:"prompt,omitempty"`
+	Message      string                 `json:"message,omitempty"`
+
+	StopHookActive bool `json:"stop_hook_active,omitempty"`
+}
+
+// newInput builds the stdin payload for a hook context
+func newInput(ctx Context) Input {
+	return Input{
+		Event:        ctx.Event,
+		SessionID:    ctx.SessionID,
+		WorkDir:      ctx.WorkDir,
+		ToolName:     ctx.ToolName,
+		ToolInput:    ctx.Input,
+		ToolResponse: ctx.Result,
+		IsError:      ctx.IsError,
+		Prompt:       ctx.Prompt,
+		Message:      ctx.Message,
+
+		StopHookActive: ctx.StopHookActive,
+	}
+}
+
+// parseOutput interprets a successful hook's stdout. Output that isn't a JSON
+// object is treated as plain text.
+func parseOutput(stdout []byte) (*Output, bool) {
+	trimmed := bytes.TrimSpace(stdout)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+
+	var out Output
+	if err := json.Unmarshal(trimmed, &out); err != nil {
+		return nil, false
+	}
+
+	out.Decision = Decision(strings.ToLower(string(out.Decision)))
+	switch out.Decision {
+	case DecisionNone, DecisionApprove, DecisionBlock, DecisionAsk:
+	case "allow":
+		out.Decision = DecisionApprove
+	case "deny":
+		out.Decision = DecisionBlock
+	default:
+		return nil, false
+	}
+
+	return &out, true
+}
+
+// toResult converts a hook's JSON output into a Result
+func (o *Output) toResult() *Result {
+	return &Result{
+		Continue:          o.Decision != DecisionBlock,
+		Decision:          o.Decision,
+		Message:           o.Reason,
+		AdditionalContext: o.AdditionalContext,
+		SuppressOutput:    o.SuppressOutput,
+		Modified:          o.UpdatedInput,
+	}
+}
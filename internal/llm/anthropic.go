@@ -7,44 +7,57 @@ import (
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/heissanjay/oscode/internal/config"
 )
 
 // AnthropicProvider implements the Provider interface for Anthropic's Claude
+// and gateways with an Anthropic-compatible API
 type AnthropicProvider struct {
 	client *anthropic.Client
 	apiKey string
+	name   string
+	models []string
 }
 
 // NewAnthropicProvider creates a new Anthropic provider
 func NewAnthropicProvider(apiKey string, baseURL string) *AnthropicProvider {
+	return NewAnthropicCompatibleProvider("anthropic", apiKey, baseURL, config.ProviderConfig{})
+}
+
+// NewAnthropicCompatibleProvider creates a provider for an
+// Anthropic-compatible gateway configured under name. providerConfig
+// supplies its headers and model list.
+func NewAnthropicCompatibleProvider(name, apiKey, baseURL string, providerConfig config.ProviderConfig) *AnthropicProvider {
 	opts := []option.RequestOption{
 		option.WithAPIKey(apiKey),
+		option.WithMaxRetries(0), // RetryProvider retries, and reports it
 	}
 	if baseURL != "" {
 		opts = append(opts, option.WithBaseURL(baseURL))
 	}
+	for key, val := range providerConfig.Headers {
+		opts = append(opts, option.WithHeader(key, val))
+	}
 
 	client := anthropic.NewClient(opts...)
 
 	return &AnthropicProvider{
 		client: client,
 		apiKey: apiKey,
+		name:   name,
+		models: providerConfig.Models,
 	}
 }
 
 func (p *AnthropicProvider) Name() string {
-	return "anthropic"
+	return p.name
 }
 
 func (p *AnthropicProvider) Models() []string {
-	return []string{
-		"claude-opus-4-20250514",
-		"claude-sonnet-4-20250514",
-		"claude-haiku-3-5-20241022",
-		"claude-3-5-sonnet-20241022",
-		"claude-3-5-haiku-20241022",
-		"claude-3-opus-20240229",
+	if len(p.models) > 0 {
+		return p.models
 	}
+	return config.ModelIDs(p.name)
 }
 
 func (p *AnthropicProvider) SupportsTools() bool {
@@ -60,10 +73,25 @@ func (p *AnthropicProvider) SupportsStreaming() bool {
 }
 
 func (p *AnthropicProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
-	// Convert messages
+	resp, err := p.client.Messages.New(ctx, p.buildParams(req))
+	if err != nil {
+		return nil, fmt.Errorf("anthropic API error: %w", err)
+	}
+
+	response := p.convertResponse(resp)
+	if req.ResponseSchema != nil {
+		schemaResponse(response, req.ResponseSchema)
+	}
+	return response, nil
+}
+
+// buildParams converts a chat request, marking cache breakpoints on the
+// tools, the system prompt and the end of the conversation so that each
+// turn reads the previous turn's prefix from the prompt cache
+func (p *AnthropicProvider) buildParams(req *ChatRequest) anthropic.MessageNewParams {
 	messages := p.convertMessages(req.Messages)
+	cacheConversation(messages)
 
-	// Build request params
 	params := anthropic.MessageNewParams{
 		Model:     anthropic.F(anthropic.Model(req.Model)),
 		Messages:  anthropic.F(messages),
@@ -71,60 +99,162 @@ func (p *AnthropicProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRe
 	}
 
 	if req.SystemPrompt != "" {
-		params.System = anthropic.F([]anthropic.TextBlockParam{
-			anthropic.NewTextBlock(req.SystemPrompt),
-		})
+		system := anthropic.NewTextBlock(req.SystemPrompt)
+		system.CacheControl = anthropic.F(ephemeralCache)
+		params.System = anthropic.F([]anthropic.TextBlockParam{system})
 	}
 
-	if req.Temperature > 0 {
-		params.Temperature = anthropic.F(req.Temperature)
+	// Thinking requires the default temperature and top_p. It can't be
+	// used with a forced tool call, which is how a response schema works.
+	if req.ThinkingBudget > 0 && req.ResponseSchema == nil && !req.ToolChoice.forced() {
+		params.Thinking = anthropic.F[anthropic.ThinkingConfigParamUnion](anthropic.ThinkingConfigEnabledParam{
+			Type:         anthropic.F(anthropic.ThinkingConfigEnabledTypeEnabled),
+			BudgetTokens: anthropic.F(int64(req.ThinkingBudget)),
+		})
+	} else {
+		if req.Temperature > 0 {
+			params.Temperature = anthropic.F(req.Temperature)
+		}
+
+		if req.TopP > 0 {
+			params.TopP = anthropic.F(req.TopP)
+		}
 	}
 
-	if req.TopP > 0 {
-		params.TopP = anthropic.F(req.TopP)
+	if len(req.StopSequences) > 0 {
+		params.StopSequences = anthropic.F(req.StopSequences)
 	}
 
 	if len(req.Tools) > 0 {
 		tools := p.convertTools(req.Tools)
+		last := tools[len(tools)-1].(anthropic.ToolParam)
+		last.CacheControl = anthropic.F(ephemeralCache)
+		tools[len(tools)-1] = last
 		params.Tools = anthropic.F(tools)
+		if choice, ok := anthropicToolChoice(req); ok {
+			params.ToolChoice = anthropic.F(choice)
+		}
 	}
 
-	// Make request
-	resp, err := p.client.Messages.New(ctx, params)
-	if err != nil {
-		return nil, fmt.Errorf("anthropic API error: %w", err)
+	if schema := req.ResponseSchema; schema != nil {
+		description := schema.Description
+		if description == "" {
+			description = "Respond with the result."
+		}
+		tools := append(params.Tools.Value, anthropic.ToolParam{
+			Name:        anthropic.F(schema.SchemaName()),
+			Description: anthropic.F(description),
+			InputSchema: anthropic.F[interface{}](schema.objectSchema()),
+		})
+		params.Tools = anthropic.F(tools)
+		forced := *req
+		forced.ToolChoice = ForceTool(schema.SchemaName())
+		choice, _ := anthropicToolChoice(&forced)
+		params.ToolChoice = anthropic.F(choice)
 	}
 
-	return p.convertResponse(resp), nil
+	return params
 }
 
-func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
-	events := make(chan StreamEvent, 100)
-
-	// Convert messages
-	messages := p.convertMessages(req.Messages)
-
-	// Build request params
-	params := anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.Model(req.Model)),
-		Messages:  anthropic.F(messages),
-		MaxTokens: anthropic.F(int64(req.MaxTokens)),
+// anthropicToolChoice converts a request's tool choice, reporting false
+// when the API's default applies
+func anthropicToolChoice(req *ChatRequest) (anthropic.ToolChoiceUnionParam, bool) {
+	choice := req.ToolChoice
+	if choice == nil {
+		if !req.DisableParallelToolUse {
+			return nil, false
+		}
+		choice = &ToolChoice{Mode: ToolChoiceAuto}
 	}
 
-	if req.SystemPrompt != "" {
-		params.System = anthropic.F([]anthropic.TextBlockParam{
-			anthropic.NewTextBlock(req.SystemPrompt),
-		})
+	switch choice.Mode {
+	case ToolChoiceAny:
+		return anthropic.ToolChoiceAnyParam{
+			Type:                   anthropic.F(anthropic.ToolChoiceAnyTypeAny),
+			DisableParallelToolUse: anthropic.F(req.DisableParallelToolUse),
+		}, true
+	case ToolChoiceNone:
+		return anthropic.ToolChoiceNoneParam{
+			Type: anthropic.F(anthropic.ToolChoiceNoneTypeNone),
+		}, true
+	case ToolChoiceTool:
+		return anthropic.ToolChoiceToolParam{
+			Type:                   anthropic.F(anthropic.ToolChoiceToolTypeTool),
+			Name:                   anthropic.F(choice.Name),
+			DisableParallelToolUse: anthropic.F(req.DisableParallelToolUse),
+		}, true
+	default:
+		return anthropic.ToolChoiceAutoParam{
+			Type:                   anthropic.F(anthropic.ToolChoiceAutoTypeAuto),
+			DisableParallelToolUse: anthropic.F(req.DisableParallelToolUse),
+		}, true
 	}
+}
 
-	if req.Temperature > 0 {
-		params.Temperature = anthropic.F(req.Temperature)
+// schemaResponse turns the forced call to a response schema's tool into
+// the text of the response
+func schemaResponse(resp *ChatResponse, schema *ResponseSchema) {
+	for i, block := range resp.Content {
+		if block.Type == ContentTypeToolUse && block.ToolUse != nil && block.ToolUse.Name == schema.SchemaName() {
+			resp.Content[i] = ContentBlock{Type: ContentTypeText, Text: schema.responseJSON(block.ToolUse.Input)}
+		}
 	}
+	toolUses := resp.ToolUse[:0]
+	for _, toolUse := range resp.ToolUse {
+		if toolUse.Name != schema.SchemaName() {
+			toolUses = append(toolUses, toolUse)
+		}
+	}
+	resp.ToolUse = toolUses
+	if len(toolUses) == 0 && resp.StopReason == string(anthropic.MessageStopReasonToolUse) {
+		resp.StopReason = string(anthropic.MessageStopReasonEndTurn)
+	}
+}
 
-	if len(req.Tools) > 0 {
-		tools := p.convertTools(req.Tools)
-		params.Tools = anthropic.F(tools)
+// conversationBreakpoints is how many of the last user messages get a
+// cache breakpoint. The API allows four, and the tools and system prompt
+// use two.
+const conversationBreakpoints = 2
+
+// cacheConversation marks the last block of the last user messages as cache
+// breakpoints. The final one writes this turn's prefix; the one before it
+// matches what the previous turn wrote.
+func cacheConversation(messages []anthropic.MessageParam) {
+	marked := 0
+	for i := len(messages) - 1; i >= 0 && marked < conversationBreakpoints; i-- {
+		if messages[i].Role.Value != anthropic.MessageParamRoleUser {
+			continue
+		}
+		blocks := messages[i].Content.Value
+		if len(blocks) == 0 {
+			continue
+		}
+
+		switch block := blocks[len(blocks)-1].(type) {
+		case anthropic.TextBlockParam:
+			block.CacheControl = anthropic.F(ephemeralCache)
+			blocks[len(blocks)-1] = block
+		case anthropic.ImageBlockParam:
+			block.CacheControl = anthropic.F(ephemeralCache)
+			blocks[len(blocks)-1] = block
+		case anthropic.ToolResultBlockParam:
+			block.CacheControl = anthropic.F(ephemeralCache)
+			blocks[len(blocks)-1] = block
+		default:
+			continue
+		}
+		marked++
 	}
+}
+
+// ephemeralCache is the cache_control of a breakpoint
+var ephemeralCache = anthropic.CacheControlEphemeralParam{
+	Type: anthropic.F(anthropic.CacheControlEphemeralTypeEphemeral),
+}
+
+func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	events := make(chan StreamEvent, 100)
+	params := p.buildParams(req)
 
 	go func() {
 		defer close(events)
@@ -135,9 +265,11 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 		var currentToolUse *ToolUse
 		var toolInputJSON string
 		var response *ChatResponse
+		var message anthropic.Message // Accumulates usage across events
 
 		for stream.Next() {
 			event := stream.Current()
+			message.Accumulate(event)
 
 			switch evt := event.AsUnion().(type) {
 			case anthropic.ContentBlockStartEvent:
@@ -156,6 +288,11 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 						Type:  EventTypeText,
 						Delta: delta.Text,
 					}
+				case anthropic.ThinkingDelta:
+					events <- StreamEvent{
+						Type:  EventTypeThinking,
+						Delta: delta.Thinking,
+					}
 				case anthropic.InputJSONDelta:
 					toolInputJSON += delta.PartialJSON
 				}
@@ -167,26 +304,39 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 					if err := json.Unmarshal([]byte(toolInputJSON), &input); err == nil {
 						currentToolUse.Input = input
 					}
+					if schema := req.ResponseSchema; schema != nil && currentToolUse.Name == schema.SchemaName() {
+						events <- StreamEvent{
+							Type:  EventTypeText,
+							Delta: schema.responseJSON(input),
+						}
+						currentToolUse = nil
+						toolInputJSON = ""
+						continue
+					}
 					events <- StreamEvent{
 						Type:    EventTypeToolUse,
 						ToolUse: currentToolUse,
 					}
 					currentToolUse = nil
 					toolInputJSON = ""
+				} else if len(message.Content) > 0 {
+					// The accumulated block has the signature needed to
+					// send the thinking back with tool results
+					if block := thinkingBlock(message.Content[len(message.Content)-1]); block != nil {
+						events <- StreamEvent{
+							Type:  EventTypeThinking,
+							Block: block,
+						}
+					}
 				}
 
 			case anthropic.MessageStopEvent:
 				// Build final response
-				msg := stream.Current().Message
 				response = &ChatResponse{
-					ID:         msg.ID,
-					Model:      string(msg.Model),
-					StopReason: string(msg.StopReason),
-					Usage: Usage{
-						InputTokens:  int(msg.Usage.InputTokens),
-						OutputTokens: int(msg.Usage.OutputTokens),
-						TotalTokens:  int(msg.Usage.InputTokens + msg.Usage.OutputTokens),
-					},
+					ID:         message.ID,
+					Model:      string(message.Model),
+					StopReason: string(message.StopReason),
+					Usage:      anthropicUsage(message.Usage),
 				}
 			}
 		}
@@ -220,6 +370,22 @@ func (p *AnthropicProvider) convertMessages(messages []Message) []anthropic.Mess
 			case ContentTypeText:
 				blocks = append(blocks, anthropic.NewTextBlock(content.Text))
 
+			case ContentTypeThinking:
+				// Only Claude's own, signed thinking can be sent back
+				if content.Signature != "" {
+					blocks = append(blocks, anthropic.ThinkingBlockParam{
+						Type:      anthropic.F(anthropic.ThinkingBlockParamTypeThinking),
+						Thinking:  anthropic.F(content.Thinking),
+						Signature: anthropic.F(content.Signature),
+					})
+				}
+
+			case ContentTypeRedactedThinking:
+				blocks = append(blocks, anthropic.RedactedThinkingBlockParam{
+					Type: anthropic.F(anthropic.RedactedThinkingBlockParamTypeRedactedThinking),
+					Data: anthropic.F(content.Data),
+				})
+
 			case ContentTypeImage:
 				if content.Image != nil && content.Image.Type == "base64" {
 					blocks = append(blocks, anthropic.NewImageBlockBase64(
@@ -230,27 +396,35 @@ func (p *AnthropicProvider) convertMessages(messages []Message) []anthropic.Mess
 
 			case ContentTypeToolResult:
 				if content.ToolResult != nil {
-					blocks = append(blocks, anthropic.NewToolResultBlock(
+					block := anthropic.NewToolResultBlock(
 						content.ToolResult.ToolUseID,
 						content.ToolResult.Content,
 						content.ToolResult.IsError,
-					))
+					)
+					if len(content.ToolResult.Images) > 0 {
+						parts := block.Content.Value
+						for _, image := range content.ToolResult.Images {
+							if image.Type == "base64" {
+								parts = append(parts, anthropic.NewImageBlockBase64(image.MediaType, image.Data))
+							}
+						}
+						block.Content = anthropic.F(parts)
+					}
+					blocks = append(blocks, block)
 				}
-			}
-		}
 
-		// Handle tool use blocks in assistant messages
-		for _, content := range msg.Content {
-			if content.Type == ContentTypeToolUse && content.ToolUse != nil {
-				inputJSON, _ := json.Marshal(content.ToolUse.Input)
-				var inputAny interface{}
-				json.Unmarshal(inputJSON, &inputAny)
-
-				blocks = append(blocks, anthropic.NewToolUseBlockParam(
-					content.ToolUse.ID,
-					content.ToolUse.Name,
-					inputAny,
-				))
+			case ContentTypeToolUse:
+				if content.ToolUse != nil {
+					input := content.ToolUse.Input
+					if input == nil {
+						input = map[string]interface{}{}
+					}
+					blocks = append(blocks, anthropic.NewToolUseBlockParam(
+						content.ToolUse.ID,
+						content.ToolUse.Name,
+						input,
+					))
+				}
 			}
 		}
 
@@ -303,14 +477,15 @@ func (p *AnthropicProvider) convertResponse(resp *anthropic.Message) *ChatRespon
 		ID:         resp.ID,
 		Model:      string(resp.Model),
 		StopReason: string(resp.StopReason),
-		Usage: Usage{
-			InputTokens:  int(resp.Usage.InputTokens),
-			OutputTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:  int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
-		},
+		Usage:      anthropicUsage(resp.Usage),
 	}
 
 	for _, block := range resp.Content {
+		if thinking := thinkingBlock(block); thinking != nil {
+			response.Content = append(response.Content, *thinking)
+			continue
+		}
+
 		switch block.Type {
 		case anthropic.ContentBlockTypeText:
 			response.Content = append(response.Content, ContentBlock{
@@ -337,3 +512,32 @@ func (p *AnthropicProvider) convertResponse(resp *anthropic.Message) *ChatRespon
 
 	return response
 }
+
+// thinkingBlock converts a thinking or redacted thinking block, returning
+// nil for other blocks
+func thinkingBlock(block anthropic.ContentBlock) *ContentBlock {
+	switch block.Type {
+	case anthropic.ContentBlockTypeThinking:
+		return &ContentBlock{
+			Type:      ContentTypeThinking,
+			Thinking:  block.Thinking,
+			Signature: block.Signature,
+		}
+	case anthropic.ContentBlockTypeRedactedThinking:
+		return &ContentBlock{
+			Type: ContentTypeRedactedThinking,
+			Data: block.Data,
+		}
+	}
+	return nil
+}
+
+func anthropicUsage(usage anthropic.Usage) Usage {
+	return Usage{
+		InputTokens:              int(usage.InputTokens),
+		OutputTokens:             int(usage.OutputTokens),
+		TotalTokens:              int(usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens + usage.OutputTokens),
+		CacheCreationInputTokens: int(usage.CacheCreationInputTokens),
+		CacheReadInputTokens:     int(usage.CacheReadInputTokens),
+	}
+}
@@ -0,0 +1,55 @@
+package llm_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// Tool definitions come before the first cache breakpoint, so a request
+// built twice from the same registry must be byte-identical
+func TestBuildParamsIsStable(t *testing.T) {
+	workDir := t.TempDir()
+	bash := tools.NewBashTool(workDir)
+	registry := tools.NewRegistry()
+	for _, tool := range []tools.Tool{
+		tools.NewReadTool(workDir),
+		tools.NewWriteTool(workDir),
+		tools.NewEditTool(workDir),
+		tools.NewGlobTool(workDir),
+		tools.NewGrepTool(workDir),
+		tools.NewNotebookEditTool(workDir),
+		bash,
+		tools.NewBashOutputTool(bash),
+		tools.NewKillShellTool(bash),
+		tools.NewWebFetchTool(),
+		tools.NewWebSearchTool(),
+	} {
+		registry.Register(tool)
+	}
+
+	build := func() []byte {
+		params := llm.BuildAnthropicParams(&llm.ChatRequest{
+			Model:        "claude-sonnet-4-20250514",
+			Messages:     []llm.Message{llm.NewUserMessage("hi")},
+			Tools:        registry.ToLLMTools(),
+			SystemPrompt: "You are a coding assistant.",
+			MaxTokens:    1024,
+		})
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := build()
+	for i := 0; i < 20; i++ {
+		if next := build(); !bytes.Equal(first, next) {
+			t.Fatalf("request changed between builds:\n%s\n%s", first, next)
+		}
+	}
+}
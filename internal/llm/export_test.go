@@ -0,0 +1,9 @@
+package llm
+
+import "github.com/anthropics/anthropic-sdk-go"
+
+// BuildAnthropicParams builds an Anthropic request, for tests outside the
+// package
+func BuildAnthropicParams(req *ChatRequest) anthropic.MessageNewParams {
+	return NewAnthropicProvider("test-key", "").buildParams(req)
+}
@@ -0,0 +1,483 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// DefaultGeminiURL is the Gemini API endpoint
+const DefaultGeminiURL = "https://generativelanguage.googleapis.com"
+
+// GeminiProvider implements the Provider interface for Google's Gemini API
+type GeminiProvider struct {
+	client  *http.Client
+	apiKey  string
+	baseURL string
+	name    string
+	models  []string
+}
+
+// NewGeminiProvider creates a new Gemini provider
+func NewGeminiProvider(name, apiKey, baseURL string, providerConfig config.ProviderConfig) *GeminiProvider {
+	if baseURL == "" {
+		baseURL = DefaultGeminiURL
+	}
+	return &GeminiProvider{
+		client:  newHTTPClient(providerConfig.Headers),
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		name:    name,
+		models:  providerConfig.Models,
+	}
+}
+
+func (p *GeminiProvider) Name() string {
+	return p.name
+}
+
+func (p *GeminiProvider) Models() []string {
+	if len(p.models) > 0 {
+		return p.models
+	}
+	return config.ModelIDs(p.name)
+}
+
+func (p *GeminiProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *GeminiProvider) SupportsVision() bool {
+	return true
+}
+
+func (p *GeminiProvider) SupportsStreaming() bool {
+	return true
+}
+
+// geminiPart is a part of a Gemini message
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFile             `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFile struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiResponse is a complete response or a streamed chunk of one
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	Error        *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	httpResp, err := p.send(ctx, req, "generateContent")
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp geminiResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid gemini response: %w", err)
+	}
+
+	result := &ChatResponse{Model: resp.ModelVersion, Usage: geminiUsage(&resp)}
+	for _, part := range geminiParts(&resp) {
+		switch {
+		case part.FunctionCall != nil:
+			toolUse := geminiToolUse(part.FunctionCall)
+			result.ToolUse = append(result.ToolUse, *toolUse)
+			result.Content = append(result.Content, ContentBlock{Type: ContentTypeToolUse, ToolUse: toolUse})
+		case part.Thought:
+			result.Content = append(result.Content, ContentBlock{Type: ContentTypeThinking, Thinking: part.Text})
+		case part.Text != "":
+			result.Content = append(result.Content, ContentBlock{Type: ContentTypeText, Text: part.Text})
+		}
+	}
+	result.StopReason = geminiStopReason(&resp, len(result.ToolUse) > 0)
+	return result, nil
+}
+
+func (p *GeminiProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	httpResp, err := p.send(ctx, req, "streamGenerateContent")
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent, 100)
+
+	go func() {
+		defer close(events)
+		defer httpResp.Body.Close()
+
+		var last geminiResponse
+		var thinking thinkingBuffer
+		sawToolUse := false
+
+		scanner := newLineScanner(httpResp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("invalid gemini response: %w", err)}
+				return
+			}
+			if chunk.Error != nil {
+				events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("gemini API error: %s", chunk.Error.Message)}
+				return
+			}
+
+			for _, part := range geminiParts(&chunk) {
+				switch {
+				case part.FunctionCall != nil:
+					thinking.flush(events)
+					sawToolUse = true
+					events <- StreamEvent{Type: EventTypeToolUse, ToolUse: geminiToolUse(part.FunctionCall)}
+				case part.Thought:
+					thinking.WriteString(part.Text)
+					events <- StreamEvent{Type: EventTypeThinking, Delta: part.Text}
+				case part.Text != "":
+					thinking.flush(events)
+					events <- StreamEvent{Type: EventTypeText, Delta: part.Text}
+				}
+			}
+			last = chunk
+		}
+		if err := scanner.Err(); err != nil {
+			events <- StreamEvent{Type: EventTypeError, Error: err}
+			return
+		}
+
+		thinking.flush(events)
+
+		events <- StreamEvent{
+			Type: EventTypeDone,
+			Response: &ChatResponse{
+				Model:      last.ModelVersion,
+				StopReason: geminiStopReason(&last, sawToolUse),
+				Usage:      geminiUsage(&last),
+			},
+		}
+	}()
+
+	return events, nil
+}
+
+// send posts a request to a model method, returning the response once its
+// status is OK
+func (p *GeminiProvider) send(ctx context.Context, req *ChatRequest, method string) (*http.Response, error) {
+	body, err := json.Marshal(p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1beta/models/%s:%s", p.baseURL, url.PathEscape(req.Model), method)
+	if method == "streamGenerateContent" {
+		endpoint += "?alt=sse"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API error: %w", err)
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("gemini API error: %w", err)
+	}
+	return resp, nil
+}
+
+// geminiMaxThinkingBudget is the largest budget every thinking Gemini model
+// accepts
+const geminiMaxThinkingBudget = 24576
+
+// buildRequest converts a chat request to Gemini's format
+func (p *GeminiProvider) buildRequest(req *ChatRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"contents": p.convertMessages(req.Messages),
+	}
+
+	if req.SystemPrompt != "" {
+		body["systemInstruction"] = geminiContent{Parts: []geminiPart{{Text: req.SystemPrompt}}}
+	}
+
+	generation := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		generation["maxOutputTokens"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		generation["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		generation["topP"] = req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		generation["stopSequences"] = req.StopSequences
+	}
+	if req.ThinkingBudget > 0 {
+		generation["thinkingConfig"] = map[string]interface{}{
+			"thinkingBudget":  min(req.ThinkingBudget, geminiMaxThinkingBudget),
+			"includeThoughts": true,
+		}
+	}
+	if req.ResponseSchema != nil {
+		generation["responseMimeType"] = "application/json"
+		generation["responseJsonSchema"] = req.ResponseSchema.Schema
+	}
+	if len(generation) > 0 {
+		body["generationConfig"] = generation
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]map[string]interface{}, len(req.Tools))
+		for i, tool := range req.Tools {
+			declaration := map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+			}
+			// Gemini rejects objects without properties
+			if params := geminiSchema(tool.InputSchema); params["properties"] != nil {
+				declaration["parameters"] = params
+			}
+			declarations[i] = declaration
+		}
+		body["tools"] = []map[string]interface{}{{"functionDeclarations": declarations}}
+
+		if choice := req.ToolChoice; choice != nil {
+			calling := map[string]interface{}{"mode": strings.ToUpper(string(choice.Mode))}
+			if choice.Mode == ToolChoiceTool {
+				calling["mode"] = "ANY"
+				calling["allowedFunctionNames"] = []string{choice.Name}
+			}
+			body["toolConfig"] = map[string]interface{}{"functionCallingConfig": calling}
+		}
+	}
+
+	return body
+}
+
+func (p *GeminiProvider) convertMessages(messages []Message) []geminiContent {
+	result := make([]geminiContent, 0, len(messages))
+
+	// Function responses name their function rather than the call
+	toolNames := make(map[string]string)
+
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+
+		var parts []geminiPart
+		for _, content := range msg.Content {
+			switch content.Type {
+			case ContentTypeText:
+				if content.Text != "" {
+					parts = append(parts, geminiPart{Text: content.Text})
+				}
+
+			case ContentTypeImage:
+				if content.Image != nil {
+					parts = append(parts, geminiImage(content.Image))
+				}
+
+			case ContentTypeToolUse:
+				if content.ToolUse != nil {
+					toolNames[content.ToolUse.ID] = content.ToolUse.Name
+					args := content.ToolUse.Input
+					if args == nil {
+						args = make(map[string]interface{})
+					}
+					parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+						Name: content.ToolUse.Name,
+						Args: args,
+					}})
+				}
+
+			case ContentTypeToolResult:
+				if content.ToolResult != nil {
+					response := map[string]interface{}{"content": content.ToolResult.Content}
+					if content.ToolResult.IsError {
+						response = map[string]interface{}{"error": content.ToolResult.Content}
+					}
+					parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+						Name:     toolNames[content.ToolResult.ToolUseID],
+						Response: response,
+					}})
+					for i := range content.ToolResult.Images {
+						parts = append(parts, geminiImage(&content.ToolResult.Images[i]))
+					}
+				}
+			}
+		}
+
+		if len(parts) > 0 {
+			result = append(result, geminiContent{Role: role, Parts: parts})
+		}
+	}
+
+	return result
+}
+
+func geminiImage(image *ImageBlock) geminiPart {
+	if image.Type == "base64" {
+		return geminiPart{InlineData: &geminiBlob{MimeType: image.MediaType, Data: image.Data}}
+	}
+	return geminiPart{FileData: &geminiFile{MimeType: image.MediaType, FileURI: image.URL}}
+}
+
+// geminiSchemaKeys are the JSON Schema keywords Gemini accepts
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "description": true, "nullable": true, "enum": true,
+	"properties": true, "required": true, "items": true, "anyOf": true,
+	"minItems": true, "maxItems": true, "minimum": true, "maximum": true,
+}
+
+// geminiSchema strips a JSON schema down to the subset Gemini accepts
+func geminiSchema(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, val := range schema {
+		if !geminiSchemaKeys[key] {
+			continue
+		}
+
+		switch key {
+		case "type":
+			// ["string", "null"] becomes a nullable string
+			if types, ok := val.([]interface{}); ok {
+				for _, t := range types {
+					if t == "null" {
+						result["nullable"] = true
+					} else if _, set := result["type"]; !set {
+						result["type"] = t
+					}
+				}
+				continue
+			}
+		case "properties":
+			props, ok := val.(map[string]interface{})
+			if !ok || len(props) == 0 {
+				continue
+			}
+			converted := make(map[string]interface{}, len(props))
+			for name, prop := range props {
+				if propSchema, ok := prop.(map[string]interface{}); ok {
+					converted[name] = geminiSchema(propSchema)
+				}
+			}
+			val = converted
+		case "items":
+			if items, ok := val.(map[string]interface{}); ok {
+				val = geminiSchema(items)
+			}
+		case "anyOf":
+			if options, ok := val.([]interface{}); ok {
+				converted := make([]interface{}, 0, len(options))
+				for _, option := range options {
+					if optionSchema, ok := option.(map[string]interface{}); ok {
+						converted = append(converted, geminiSchema(optionSchema))
+					}
+				}
+				val = converted
+			}
+		}
+		result[key] = val
+	}
+	return result
+}
+
+func geminiParts(resp *geminiResponse) []geminiPart {
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	return resp.Candidates[0].Content.Parts
+}
+
+func geminiToolUse(call *geminiFunctionCall) *ToolUse {
+	id := call.ID
+	if id == "" {
+		id = newToolCallID()
+	}
+	input := call.Args
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	return &ToolUse{ID: id, Name: call.Name, Input: input}
+}
+
+func geminiStopReason(resp *geminiResponse, toolUse bool) string {
+	if toolUse {
+		return "tool_use"
+	}
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	return strings.ToLower(resp.Candidates[0].FinishReason)
+}
+
+func geminiUsage(resp *geminiResponse) Usage {
+	return Usage{
+		InputTokens:          resp.UsageMetadata.PromptTokenCount - resp.UsageMetadata.CachedContentTokenCount,
+		OutputTokens:         resp.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:          resp.UsageMetadata.TotalTokenCount,
+		CacheReadInputTokens: resp.UsageMetadata.CachedContentTokenCount,
+	}
+}
@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// headerTransport adds configured headers to every request
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, val := range t.headers {
+		req.Header.Set(key, val)
+	}
+	return t.base.RoundTrip(req)
+}
+
+type bodyFieldsKey struct{}
+
+// withBodyFields returns a context whose requests get fields added to their
+// JSON body, for parameters client libraries don't have yet
+func withBodyFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	return context.WithValue(ctx, bodyFieldsKey{}, fields)
+}
+
+// bodyTransport adds the fields set with withBodyFields to request bodies
+type bodyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fields, _ := req.Context().Value(bodyFieldsKey{}).(map[string]interface{})
+	if len(fields) == 0 || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err == nil {
+		for key, val := range fields {
+			if raw, err := json.Marshal(val); err == nil {
+				body[key] = raw
+			}
+		}
+		if merged, err := json.Marshal(body); err == nil {
+			data = merged
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient returns a client that sends headers and any context body
+// fields with every request. Streams can run for minutes, so there's no
+// overall timeout.
+func newHTTPClient(headers map[string]string) *http.Client {
+	var transport http.RoundTripper = &bodyTransport{base: http.DefaultTransport}
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, base: transport}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// listTimeout bounds model list and capability lookups, which shouldn't
+// hold up the UI when a server is down
+const listTimeout = 5 * time.Second
+
+// StatusError is a non-2xx response from an API
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration // How long the server asked clients to wait, if it did
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Body)
+}
+
+// checkStatus turns a non-2xx response into a StatusError with the body
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: retryAfter(resp.Header),
+	}
+}
+
+// retryAfter reads how long a response asks clients to wait before
+// retrying, from retry-after-ms or retry-after in seconds or as a date
+func retryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// newLineScanner returns a scanner for line-delimited streams, whose lines
+// can hold large tool call arguments
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return scanner
+}
+
+var toolCallCounter atomic.Int64
+
+// newToolCallID returns an ID for a tool call from an API that doesn't
+// give them
+func newToolCallID() string {
+	return fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), toolCallCounter.Add(1))
+}
@@ -26,12 +26,14 @@ type Message struct {
 
 // ContentBlock represents a block of content in a message
 type ContentBlock struct {
-	Type      ContentType `json:"type"`
-	Text      string      `json:"text,omitempty"`
-	Image     *ImageBlock `json:"image,omitempty"`
-	ToolUse   *ToolUse    `json:"tool_use,omitempty"`
+	Type       ContentType `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	Image      *ImageBlock `json:"image,omitempty"`
+	ToolUse    *ToolUse    `json:"tool_use,omitempty"`
 	ToolResult *ToolResult `json:"tool_result,omitempty"`
-	Thinking  string      `json:"thinking,omitempty"`
+	Thinking   string      `json:"thinking,omitempty"`
+	Signature  string      `json:"signature,omitempty"` // Verifies thinking when it's sent back
+	Data       string      `json:"data,omitempty"`      // Encrypted redacted thinking
 }
 
 // ContentType defines the type of content block
@@ -43,6 +45,8 @@ const (
 	ContentTypeToolUse    ContentType = "tool_use"
 	ContentTypeToolResult ContentType = "tool_result"
 	ContentTypeThinking   ContentType = "thinking"
+
+	ContentTypeRedactedThinking ContentType = "redacted_thinking"
 )
 
 // ImageBlock represents an image in a message
@@ -209,11 +213,88 @@ func (m *Message) HasToolUse() bool {
 	return false
 }
 
+// MessageBuilder assembles an assistant message from stream events,
+// keeping its thinking, text and tool use blocks in the order they arrived
+type MessageBuilder struct {
+	blocks []ContentBlock
+}
+
+// NewMessageBuilder creates an empty message builder
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// Add records the content of a stream event. Consecutive text deltas are
+// joined into one block.
+func (b *MessageBuilder) Add(event StreamEvent) {
+	switch event.Type {
+	case EventTypeText:
+		if event.Delta == "" {
+			return
+		}
+		if n := len(b.blocks); n > 0 && b.blocks[n-1].Type == ContentTypeText {
+			b.blocks[n-1].Text += event.Delta
+			return
+		}
+		b.blocks = append(b.blocks, ContentBlock{Type: ContentTypeText, Text: event.Delta})
+
+	case EventTypeThinking:
+		if event.Block != nil {
+			b.blocks = append(b.blocks, *event.Block)
+		}
+
+	case EventTypeToolUse:
+		if event.ToolUse != nil {
+			b.blocks = append(b.blocks, ContentBlock{Type: ContentTypeToolUse, ToolUse: event.ToolUse})
+		}
+	}
+}
+
+// Message returns the assistant message built so far. Whitespace-only
+// text, which APIs reject, is left out.
+func (b *MessageBuilder) Message() Message {
+	msg := Message{Role: RoleAssistant}
+	for _, block := range b.blocks {
+		if block.Type == ContentTypeText && strings.TrimSpace(block.Text) == "" {
+			continue
+		}
+		msg.Content = append(msg.Content, block)
+	}
+	return msg
+}
+
+// Text returns the message's text
+func (b *MessageBuilder) Text() string {
+	var sb strings.Builder
+	for _, block := range b.blocks {
+		if block.Type == ContentTypeText {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// ToolUses returns the message's tool uses in order
+func (b *MessageBuilder) ToolUses() []*ToolUse {
+	var toolUses []*ToolUse
+	for _, block := range b.blocks {
+		if block.Type == ContentTypeToolUse {
+			toolUses = append(toolUses, block.ToolUse)
+		}
+	}
+	return toolUses
+}
+
 // ToJSON converts the message to JSON
 func (m *Message) ToJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// IsImageFile reports whether a path has an image format models accept
+func IsImageFile(path string) bool {
+	return getMediaType(path) != ""
+}
+
 // getMediaType returns the MIME type for an image file
 func getMediaType(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// streamedTurn is an assistant turn as it arrives from a stream: reasoning,
+// text in pieces, then two tool calls
+func streamedTurn() []StreamEvent {
+	return []StreamEvent{
+		{Type: EventTypeThinking, Delta: "The user wants "},
+		{Type: EventTypeThinking, Delta: "the file read."},
+		{Type: EventTypeThinking, Block: &ContentBlock{Type: ContentTypeThinking, Thinking: "The user wants the file read.", Signature: "sig"}},
+		{Type: EventTypeText, Delta: "Let me look "},
+		{Type: EventTypeText, Delta: "at both files."},
+		{Type: EventTypeToolUse, ToolUse: &ToolUse{ID: "call_1", Name: "read", Input: map[string]interface{}{"path": "a.go"}}},
+		{Type: EventTypeToolUse, ToolUse: &ToolUse{ID: "call_2", Name: "read", Input: map[string]interface{}{"path": "b.go"}}},
+		{Type: EventTypeDone},
+	}
+}
+
+func buildTurn(t *testing.T) []Message {
+	t.Helper()
+	builder := NewMessageBuilder()
+	for _, event := range streamedTurn() {
+		builder.Add(event)
+	}
+
+	return []Message{
+		NewUserMessage("Compare a.go and b.go"),
+		builder.Message(),
+		{
+			Role: RoleUser,
+			Content: []ContentBlock{
+				{Type: ContentTypeToolResult, ToolResult: &ToolResult{ToolUseID: "call_1", Content: "package a"}},
+				{Type: ContentTypeToolResult, ToolResult: &ToolResult{ToolUseID: "call_2", Content: "package b"}},
+			},
+		},
+	}
+}
+
+// roundTrip marshals converted messages and decodes them generically, so
+// tests see exactly what goes over the wire
+func roundTrip(t *testing.T, v interface{}) []map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	return out
+}
+
+func TestMessageBuilder(t *testing.T) {
+	msg := buildTurn(t)[1]
+
+	var types []ContentType
+	for _, block := range msg.Content {
+		types = append(types, block.Type)
+	}
+	want := []ContentType{ContentTypeThinking, ContentTypeText, ContentTypeToolUse, ContentTypeToolUse}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("block types = %v, want %v", types, want)
+	}
+	if msg.Role != RoleAssistant {
+		t.Errorf("role = %q, want assistant", msg.Role)
+	}
+	if got := msg.Content[1].Text; got != "Let me look at both files." {
+		t.Errorf("text = %q, want deltas joined", got)
+	}
+	if got := msg.Content[0].Signature; got != "sig" {
+		t.Errorf("thinking signature = %q, want sig", got)
+	}
+}
+
+func TestMessageBuilderSkipsBlankText(t *testing.T) {
+	builder := NewMessageBuilder()
+	builder.Add(StreamEvent{Type: EventTypeText, Delta: "\n\n"})
+	builder.Add(StreamEvent{Type: EventTypeToolUse, ToolUse: &ToolUse{ID: "call_1", Name: "ls"}})
+
+	msg := builder.Message()
+	if len(msg.Content) != 1 || msg.Content[0].Type != ContentTypeToolUse {
+		t.Fatalf("content = %+v, want only the tool use", msg.Content)
+	}
+}
+
+func TestAnthropicConvertMessagesKeepsOrder(t *testing.T) {
+	p := NewAnthropicProvider("test", "")
+	out := roundTrip(t, p.convertMessages(buildTurn(t)))
+
+	if len(out) != 3 {
+		t.Fatalf("got %d messages, want 3", len(out))
+	}
+
+	assistant := out[1]
+	if assistant["role"] != "assistant" {
+		t.Fatalf("role = %v, want assistant", assistant["role"])
+	}
+	blocks := assistant["content"].([]interface{})
+	var types []string
+	for _, block := range blocks {
+		types = append(types, block.(map[string]interface{})["type"].(string))
+	}
+	want := []string{"thinking", "text", "tool_use", "tool_use"}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("block types = %v, want %v", types, want)
+	}
+
+	thinking := blocks[0].(map[string]interface{})
+	if thinking["signature"] != "sig" || thinking["thinking"] != "The user wants the file read." {
+		t.Errorf("thinking block = %v", thinking)
+	}
+	if text := blocks[1].(map[string]interface{})["text"]; text != "Let me look at both files." {
+		t.Errorf("text = %v", text)
+	}
+	for i, id := range []string{"call_1", "call_2"} {
+		if got := blocks[2+i].(map[string]interface{})["id"]; got != id {
+			t.Errorf("tool use %d id = %v, want %s", i, got, id)
+		}
+	}
+
+	results := out[2]["content"].([]interface{})
+	for i, id := range []string{"call_1", "call_2"} {
+		if got := results[i].(map[string]interface{})["tool_use_id"]; got != id {
+			t.Errorf("tool result %d id = %v, want %s", i, got, id)
+		}
+	}
+}
+
+func TestOpenAIConvertMessagesKeepsText(t *testing.T) {
+	p := NewOpenAIProvider("test", "")
+	out := roundTrip(t, p.convertMessages(buildTurn(t), "system"))
+
+	var roles []string
+	for _, msg := range out {
+		roles = append(roles, msg["role"].(string))
+	}
+	want := []string{"system", "user", "assistant", "tool", "tool"}
+	if !reflect.DeepEqual(roles, want) {
+		t.Fatalf("roles = %v, want %v", roles, want)
+	}
+
+	assistant := out[2]
+	if assistant["content"] != "Let me look at both files." {
+		t.Errorf("assistant content = %v, want the streamed text", assistant["content"])
+	}
+	calls := assistant["tool_calls"].([]interface{})
+	if len(calls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(calls))
+	}
+	for i, id := range []string{"call_1", "call_2"} {
+		call := calls[i].(map[string]interface{})
+		if call["id"] != id {
+			t.Errorf("tool call %d id = %v, want %s", i, call["id"], id)
+		}
+	}
+	args := calls[0].(map[string]interface{})["function"].(map[string]interface{})["arguments"]
+	if args != `{"path":"a.go"}` {
+		t.Errorf("tool call arguments = %v", args)
+	}
+
+	for i, id := range []string{"call_1", "call_2"} {
+		if got := out[3+i]["tool_call_id"]; got != id {
+			t.Errorf("tool result %d id = %v, want %s", i, got, id)
+		}
+	}
+}
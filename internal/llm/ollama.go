@@ -0,0 +1,493 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// DefaultOllamaURL is where a local Ollama listens
+const DefaultOllamaURL = "http://localhost:11434"
+
+// OllamaProvider implements the Provider interface for Ollama's native API.
+// Models are the ones pulled on the server, and their tool and image
+// support is read from the server.
+type OllamaProvider struct {
+	client  *http.Client
+	baseURL string
+	name    string
+
+	mu    sync.Mutex
+	infos map[string]config.ModelInfo
+}
+
+// NewOllamaProvider creates a provider for the Ollama server at baseURL.
+// OLLAMA_HOST-style addresses without a scheme are accepted.
+func NewOllamaProvider(name, baseURL string, providerConfig config.ProviderConfig) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &OllamaProvider{
+		client:  newHTTPClient(providerConfig.Headers),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		name:    name,
+		infos:   make(map[string]config.ModelInfo),
+	}
+}
+
+func (p *OllamaProvider) Name() string {
+	return p.name
+}
+
+// Models returns the models pulled on the server
+func (p *OllamaProvider) Models() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := p.get(ctx, "/api/tags", &tags); err != nil {
+		return nil
+	}
+
+	models := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (p *OllamaProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *OllamaProvider) SupportsVision() bool {
+	return true
+}
+
+func (p *OllamaProvider) SupportsStreaming() bool {
+	return true
+}
+
+// ModelInfo reads a model's capabilities from the server. Older servers
+// don't report capabilities, so tool support is read from the template.
+func (p *OllamaProvider) ModelInfo(model string) (config.ModelInfo, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if info, ok := p.infos[model]; ok {
+		return info, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	var show struct {
+		Template     string                 `json:"template"`
+		Capabilities []string               `json:"capabilities"`
+		ModelInfo    map[string]interface{} `json:"model_info"`
+		Projector    map[string]interface{} `json:"projector_info"`
+	}
+	if err := p.post(ctx, "/api/show", map[string]string{"model": model}, &show); err != nil {
+		return config.ModelInfo{}, false
+	}
+
+	info := config.ModelInfo{ID: model, Provider: p.name}
+	if len(show.Capabilities) > 0 {
+		for _, capability := range show.Capabilities {
+			switch capability {
+			case "tools":
+				info.Tools = true
+			case "vision":
+				info.Vision = true
+			case "thinking":
+				info.Reasoning = true
+			}
+		}
+	} else {
+		info.Tools = strings.Contains(show.Template, ".Tools")
+		info.Vision = len(show.Projector) > 0
+	}
+	for key, val := range show.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			if n, ok := val.(float64); ok {
+				info.ContextWindow = int(n)
+			}
+		}
+	}
+
+	p.infos[model] = info
+	return info, true
+}
+
+// ollamaMessage is a message in Ollama's chat API
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChunk is a line of a streamed chat response, or the whole response
+type ollamaChunk struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var chunk ollamaChunk
+	if err := p.post(ctx, "/api/chat", p.buildRequest(req, false), &chunk); err != nil {
+		return nil, fmt.Errorf("ollama API error: %w", err)
+	}
+	if chunk.Error != "" {
+		return nil, fmt.Errorf("ollama API error: %s", chunk.Error)
+	}
+
+	resp := &ChatResponse{
+		Model:      chunk.Model,
+		StopReason: chunk.DoneReason,
+		Usage:      ollamaUsage(chunk),
+	}
+	if chunk.Message.Thinking != "" {
+		resp.Content = append(resp.Content, ContentBlock{
+			Type:     ContentTypeThinking,
+			Thinking: chunk.Message.Thinking,
+		})
+	}
+	if chunk.Message.Content != "" {
+		resp.Content = append(resp.Content, ContentBlock{
+			Type: ContentTypeText,
+			Text: chunk.Message.Content,
+		})
+	}
+	for _, call := range chunk.Message.ToolCalls {
+		toolUse := ollamaToolUse(call)
+		resp.ToolUse = append(resp.ToolUse, *toolUse)
+		resp.Content = append(resp.Content, ContentBlock{
+			Type:    ContentTypeToolUse,
+			ToolUse: toolUse,
+		})
+	}
+	if len(resp.ToolUse) > 0 {
+		resp.StopReason = "tool_use"
+	}
+	return resp, nil
+}
+
+func (p *OllamaProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	body, err := json.Marshal(p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama API error: %w (is Ollama running at %s?)", err, p.baseURL)
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama API error: %w", err)
+	}
+
+	events := make(chan StreamEvent, 100)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		sawToolUse := false
+		var thinking thinkingBuffer
+		scanner := newLineScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			var chunk ollamaChunk
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("invalid ollama response: %w", err)}
+				return
+			}
+			if chunk.Error != "" {
+				events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("ollama API error: %s", chunk.Error)}
+				return
+			}
+
+			if chunk.Message.Thinking != "" {
+				thinking.WriteString(chunk.Message.Thinking)
+				events <- StreamEvent{
+					Type:  EventTypeThinking,
+					Delta: chunk.Message.Thinking,
+				}
+			}
+
+			if chunk.Message.Content != "" || len(chunk.Message.ToolCalls) > 0 {
+				thinking.flush(events)
+			}
+
+			if chunk.Message.Content != "" {
+				events <- StreamEvent{
+					Type:  EventTypeText,
+					Delta: chunk.Message.Content,
+				}
+			}
+
+			// Ollama sends each tool call whole
+			for _, call := range chunk.Message.ToolCalls {
+				sawToolUse = true
+				events <- StreamEvent{
+					Type:    EventTypeToolUse,
+					ToolUse: ollamaToolUse(call),
+				}
+			}
+
+			if chunk.Done {
+				stopReason := chunk.DoneReason
+				if sawToolUse {
+					stopReason = "tool_use"
+				}
+				thinking.flush(events)
+				events <- StreamEvent{
+					Type: EventTypeDone,
+					Response: &ChatResponse{
+						Model:      chunk.Model,
+						StopReason: stopReason,
+						Usage:      ollamaUsage(chunk),
+					},
+				}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			events <- StreamEvent{Type: EventTypeError, Error: err}
+			return
+		}
+
+		// Ollama always ends with a done chunk, so the response was cut off
+		events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("ollama stream ended before the response finished: %w", io.ErrUnexpectedEOF)}
+	}()
+
+	return events, nil
+}
+
+// buildRequest converts a chat request to Ollama's format
+func (p *OllamaProvider) buildRequest(req *ChatRequest, stream bool) map[string]interface{} {
+	options := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		options["top_p"] = req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		options["stop"] = req.StopSequences
+	}
+
+	body := map[string]interface{}{
+		"model":    req.Model,
+		"messages": p.convertMessages(req.Messages, req.SystemPrompt),
+		"stream":   stream,
+		"options":  options,
+	}
+	if req.ThinkingBudget > 0 {
+		body["think"] = true
+	}
+	if req.ResponseSchema != nil {
+		body["format"] = req.ResponseSchema.Schema
+	}
+
+	if requestTools := ollamaTools(req); len(requestTools) > 0 {
+		tools := make([]map[string]interface{}, len(requestTools))
+		for i, tool := range requestTools {
+			params := tool.InputSchema
+			if params == nil {
+				params = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+			}
+			tools[i] = map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        tool.Name,
+					"description": tool.Description,
+					"parameters":  params,
+				},
+			}
+		}
+		body["tools"] = tools
+	}
+
+	return body
+}
+
+// ollamaTools returns the tools to offer. Ollama has no tool choice, so a
+// forced tool is offered alone and "none" offers nothing.
+func ollamaTools(req *ChatRequest) []Tool {
+	choice := req.ToolChoice
+	switch {
+	case choice == nil:
+		return req.Tools
+	case choice.Mode == ToolChoiceNone:
+		return nil
+	case choice.Mode == ToolChoiceTool:
+		for _, tool := range req.Tools {
+			if tool.Name == choice.Name {
+				return []Tool{tool}
+			}
+		}
+	}
+	return req.Tools
+}
+
+func (p *OllamaProvider) convertMessages(messages []Message, systemPrompt string) []ollamaMessage {
+	result := make([]ollamaMessage, 0, len(messages)+1)
+	if systemPrompt != "" {
+		result = append(result, ollamaMessage{Role: "system", Content: systemPrompt})
+	}
+
+	// Tool results name their tool rather than the call
+	toolNames := make(map[string]string)
+
+	for _, msg := range messages {
+		out := ollamaMessage{Role: string(msg.Role)}
+		var texts []string
+
+		for _, content := range msg.Content {
+			switch content.Type {
+			case ContentTypeText:
+				texts = append(texts, content.Text)
+
+			case ContentTypeImage:
+				// Ollama only takes inline images
+				if content.Image != nil && content.Image.Type == "base64" {
+					out.Images = append(out.Images, content.Image.Data)
+				} else if content.Image != nil {
+					texts = append(texts, "[image: "+content.Image.URL+"]")
+				}
+
+			case ContentTypeToolUse:
+				if content.ToolUse != nil {
+					var call ollamaToolCall
+					call.Function.Name = content.ToolUse.Name
+					call.Function.Arguments = content.ToolUse.Input
+					out.ToolCalls = append(out.ToolCalls, call)
+					toolNames[content.ToolUse.ID] = content.ToolUse.Name
+				}
+
+			case ContentTypeToolResult:
+				if content.ToolResult != nil {
+					toolMsg := ollamaMessage{
+						Role:     "tool",
+						Content:  content.ToolResult.Content,
+						ToolName: toolNames[content.ToolResult.ToolUseID],
+					}
+					for _, image := range content.ToolResult.Images {
+						if image.Type == "base64" {
+							toolMsg.Images = append(toolMsg.Images, image.Data)
+						}
+					}
+					result = append(result, toolMsg)
+				}
+			}
+		}
+
+		out.Content = strings.Join(texts, "\n\n")
+		if out.Content != "" || len(out.Images) > 0 || len(out.ToolCalls) > 0 {
+			result = append(result, out)
+		}
+	}
+
+	return result
+}
+
+func ollamaToolUse(call ollamaToolCall) *ToolUse {
+	input := call.Function.Arguments
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	return &ToolUse{
+		ID:    newToolCallID(),
+		Name:  call.Function.Name,
+		Input: input,
+	}
+}
+
+func ollamaUsage(chunk ollamaChunk) Usage {
+	return Usage{
+		InputTokens:  chunk.PromptEvalCount,
+		OutputTokens: chunk.EvalCount,
+		TotalTokens:  chunk.PromptEvalCount + chunk.EvalCount,
+	}
+}
+
+func (p *OllamaProvider) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	return p.do(req, out)
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.do(req, out)
+}
+
+func (p *OllamaProvider) do(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w (is Ollama running at %s?)", err, p.baseURL)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
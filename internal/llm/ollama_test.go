@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// newOllamaServer serves a model without tool support, streaming the
+// given chat lines
+func newOllamaServer(t *testing.T, chatLines ...string) *OllamaProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			fmt.Fprint(w, `{"capabilities": ["completion"]}`)
+		case "/api/chat":
+			for _, line := range chatLines {
+				fmt.Fprintln(w, line)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewOllamaProvider("ollama", server.URL, config.ProviderConfig{})
+}
+
+func TestCheckRequestDropsUnsupportedTools(t *testing.T) {
+	provider := newOllamaServer(t)
+	req := &ChatRequest{
+		Model:    "gemma",
+		Messages: []Message{NewUserMessage("hi")},
+		Tools:    []Tool{{Name: "Read"}},
+	}
+
+	warnings, err := CheckRequest(provider, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Tools) != 0 {
+		t.Errorf("tools = %+v, want them dropped", req.Tools)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "doesn't support tool use") {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	// A request that must call a tool can't go ahead without them
+	req = &ChatRequest{
+		Model:      "gemma",
+		Tools:      []Tool{{Name: "Read"}},
+		ToolChoice: &ToolChoice{Mode: ToolChoiceTool, Name: "Read"},
+	}
+	if _, err := CheckRequest(provider, req); err == nil {
+		t.Error("forced tool choice accepted for a model without tool support")
+	}
+}
+
+func TestOllamaStreamCutOff(t *testing.T) {
+	provider := newOllamaServer(t,
+		`{"model": "gemma", "message": {"role": "assistant", "content": "Hel"}, "done": false}`,
+	)
+
+	events, err := provider.Stream(context.Background(), &ChatRequest{Model: "gemma", Messages: []Message{NewUserMessage("hi")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	var streamErr error
+	for event := range events {
+		switch event.Type {
+		case EventTypeText:
+			text += event.Delta
+		case EventTypeDone:
+			t.Error("stream reported done without a done chunk")
+		case EventTypeError:
+			streamErr = event.Error
+		}
+	}
+	if text != "Hel" {
+		t.Errorf("text = %q", text)
+	}
+	if !errors.Is(streamErr, io.ErrUnexpectedEOF) {
+		t.Errorf("error = %v, want unexpected EOF", streamErr)
+	}
+}
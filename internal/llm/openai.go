@@ -5,54 +5,94 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/heissanjay/oscode/internal/config"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-// OpenAIProvider implements the Provider interface for OpenAI
+// OpenAIProvider implements the Provider interface for OpenAI and servers
+// with an OpenAI-compatible API, such as vLLM and llama.cpp
 type OpenAIProvider struct {
 	client *openai.Client
 	apiKey string
+	name   string
+	quirks config.ProviderQuirks
+	models []string // Configured model list, for compatible servers
+
+	// Ask for usage on streams. Only OpenAI's own API is sure to accept it.
+	streamUsage bool
+
+	listOnce sync.Once
+	listed   []string
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
 func NewOpenAIProvider(apiKey string, baseURL string) *OpenAIProvider {
-	config := openai.DefaultConfig(apiKey)
+	return NewOpenAICompatibleProvider("openai", apiKey, baseURL, config.ProviderConfig{})
+}
+
+// NewOpenAICompatibleProvider creates a provider for an OpenAI-compatible
+// server configured under name. providerConfig supplies its headers, model
+// list and quirks.
+func NewOpenAICompatibleProvider(name, apiKey, baseURL string, providerConfig config.ProviderConfig) *OpenAIProvider {
+	clientConfig := openai.DefaultConfig(apiKey)
 	if baseURL != "" {
-		config.BaseURL = baseURL
+		clientConfig.BaseURL = baseURL
 	}
+	clientConfig.OrgID = providerConfig.OrgID
+	clientConfig.HTTPClient = newHTTPClient(providerConfig.Headers)
 
-	client := openai.NewClientWithConfig(config)
+	client := openai.NewClientWithConfig(clientConfig)
 
 	return &OpenAIProvider{
 		client: client,
 		apiKey: apiKey,
+		name:   name,
+		quirks: providerConfig.Quirks,
+		models: providerConfig.Models,
+
+		streamUsage: providerConfig.ProviderType(name) == config.ProviderOpenAI,
 	}
 }
 
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
 }
 
+// Models returns the catalog models for OpenAI, and for other servers the
+// configured models or, failing that, the ones the server lists
 func (p *OpenAIProvider) Models() []string {
-	return []string{
-		"gpt-4o",
-		"gpt-4o-mini",
-		"gpt-4-turbo-preview",
-		"gpt-4-turbo",
-		"gpt-4",
-		"gpt-3.5-turbo",
-		"o1-preview",
-		"o1-mini",
+	if ids := config.ModelIDs(p.name); len(ids) > 0 {
+		return ids
+	}
+	if len(p.models) > 0 {
+		return p.models
 	}
+
+	p.listOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+		defer cancel()
+		list, err := p.client.ListModels(ctx)
+		if err != nil {
+			return
+		}
+		for _, model := range list.Models {
+			p.listed = append(p.listed, model.ID)
+		}
+		sort.Strings(p.listed)
+	})
+	return p.listed
 }
 
 func (p *OpenAIProvider) SupportsTools() bool {
-	return true
+	return !p.quirks.NoTools
 }
 
 func (p *OpenAIProvider) SupportsVision() bool {
-	return true
+	return !p.quirks.NoVision
 }
 
 func (p *OpenAIProvider) SupportsStreaming() bool {
@@ -83,6 +123,10 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 		chatReq.Tools = p.convertTools(req.Tools)
 	}
 
+	applyToolChoice(&chatReq, req)
+	applyResponseSchema(&chatReq, req)
+	ctx = applyReasoning(ctx, &chatReq, req)
+
 	resp, err := p.client.CreateChatCompletion(ctx, chatReq)
 	if err != nil {
 		return nil, fmt.Errorf("openai API error: %w", err)
@@ -92,6 +136,14 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 }
 
 func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	if p.quirks.NoStreamTools && len(req.Tools) > 0 {
+		resp, err := p.Chat(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return streamResponse(resp), nil
+	}
+
 	events := make(chan StreamEvent, 100)
 
 	messages := p.convertMessages(req.Messages, req.SystemPrompt)
@@ -114,6 +166,14 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 		chatReq.Tools = p.convertTools(req.Tools)
 	}
 
+	if p.streamUsage {
+		chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	applyToolChoice(&chatReq, req)
+	applyResponseSchema(&chatReq, req)
+	ctx = applyReasoning(ctx, &chatReq, req)
+
 	go func() {
 		defer close(events)
 
@@ -128,7 +188,8 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 		defer stream.Close()
 
 		var toolCalls = make(map[int]*ToolUse)
-		var totalOutputTokens int
+		var response *ChatResponse
+		var usage Usage
 
 		for {
 			resp, err := stream.Recv()
@@ -143,6 +204,11 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 				return
 			}
 
+			// Usage arrives in a final chunk without choices
+			if resp.Usage != nil {
+				usage = openAIUsage(*resp.Usage)
+			}
+
 			if len(resp.Choices) == 0 {
 				continue
 			}
@@ -159,10 +225,12 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 			}
 
 			// Handle tool calls
-			for _, toolCall := range delta.ToolCalls {
+			for i, toolCall := range delta.ToolCalls {
 				idx := toolCall.Index
 				if idx == nil {
-					continue
+					// Servers without indexes send whole calls
+					position := len(toolCalls) + i
+					idx = &position
 				}
 
 				if toolCalls[*idx] == nil {
@@ -185,38 +253,53 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 				}
 			}
 
-			// Handle finish reason
-			if choice.FinishReason == openai.FinishReasonToolCalls {
-				for _, toolUse := range toolCalls {
+			// Handle finish reason. Some compatible servers finish tool
+			// calls with "stop", so any finish reason flushes them.
+			if choice.FinishReason != "" {
+				indexes := make([]int, 0, len(toolCalls))
+				for idx := range toolCalls {
+					indexes = append(indexes, idx)
+				}
+				sort.Ints(indexes)
+
+				for _, idx := range indexes {
+					toolUse := toolCalls[idx]
 					// Parse accumulated JSON arguments
 					if rawJSON, ok := toolUse.Input["_raw"].(string); ok {
-						var parsed map[string]interface{}
-						if err := json.Unmarshal([]byte(rawJSON), &parsed); err == nil {
+						parsed := make(map[string]interface{})
+						if rawJSON == "" || json.Unmarshal([]byte(rawJSON), &parsed) == nil {
 							toolUse.Input = parsed
 						}
 					}
+					if toolUse.ID == "" {
+						toolUse.ID = newToolCallID()
+					}
 
 					events <- StreamEvent{
 						Type:    EventTypeToolUse,
 						ToolUse: toolUse,
 					}
 				}
+				toolCalls = make(map[int]*ToolUse)
 			}
 
 			if choice.FinishReason != "" {
-				events <- StreamEvent{
-					Type: EventTypeDone,
-					Response: &ChatResponse{
-						ID:         resp.ID,
-						Model:      resp.Model,
-						StopReason: string(choice.FinishReason),
-						Usage: Usage{
-							OutputTokens: totalOutputTokens,
-						},
-					},
+				response = &ChatResponse{
+					ID:         resp.ID,
+					Model:      resp.Model,
+					StopReason: string(choice.FinishReason),
 				}
 			}
 		}
+
+		if response == nil {
+			response = &ChatResponse{}
+		}
+		response.Usage = usage
+		events <- StreamEvent{
+			Type:     EventTypeDone,
+			Response: response,
+		}
 	}()
 
 	return events, nil
@@ -225,10 +308,15 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string) []openai.ChatCompletionMessage {
 	result := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
 
+	systemRole := openai.ChatMessageRoleSystem
+	if p.quirks.SystemAsUser {
+		systemRole = openai.ChatMessageRoleUser
+	}
+
 	// Add system prompt as first message
 	if systemPrompt != "" {
 		result = append(result, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
+			Role:    systemRole,
 			Content: systemPrompt,
 		})
 	}
@@ -241,7 +329,7 @@ func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string
 		case RoleAssistant:
 			role = openai.ChatMessageRoleAssistant
 		case RoleSystem:
-			role = openai.ChatMessageRoleSystem
+			role = systemRole
 		default:
 			role = openai.ChatMessageRoleUser
 		}
@@ -259,18 +347,7 @@ func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string
 
 			case ContentTypeImage:
 				if content.Image != nil {
-					var imageURL string
-					if content.Image.Type == "base64" {
-						imageURL = fmt.Sprintf("data:%s;base64,%s", content.Image.MediaType, content.Image.Data)
-					} else {
-						imageURL = content.Image.URL
-					}
-					multiContent = append(multiContent, openai.ChatMessagePart{
-						Type: openai.ChatMessagePartTypeImageURL,
-						ImageURL: &openai.ChatMessageImageURL{
-							URL: imageURL,
-						},
-					})
+					multiContent = append(multiContent, imagePart(content.Image))
 				}
 
 			case ContentTypeToolResult:
@@ -280,6 +357,17 @@ func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string
 						Content:    content.ToolResult.Content,
 						ToolCallID: content.ToolResult.ToolUseID,
 					})
+
+					// Tool messages are text only, so images follow in a user message
+					if len(content.ToolResult.Images) > 0 {
+						multiContent = append(multiContent, openai.ChatMessagePart{
+							Type: openai.ChatMessagePartTypeText,
+							Text: fmt.Sprintf("Images returned by tool call %s:", content.ToolResult.ToolUseID),
+						})
+						for i := range content.ToolResult.Images {
+							multiContent = append(multiContent, imagePart(&content.ToolResult.Images[i]))
+						}
+					}
 					continue
 				}
 			}
@@ -301,7 +389,15 @@ func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string
 			}
 		}
 
-		if len(multiContent) > 0 {
+		// Assistant text goes as a plain string alongside its tool calls,
+		// which is the form every compatible server accepts
+		if len(multiContent) > 0 && (p.quirks.TextContent || role == openai.ChatMessageRoleAssistant) {
+			result = append(result, openai.ChatCompletionMessage{
+				Role:      role,
+				Content:   joinText(multiContent),
+				ToolCalls: toolCalls,
+			})
+		} else if len(multiContent) > 0 {
 			result = append(result, openai.ChatCompletionMessage{
 				Role:         role,
 				MultiContent: multiContent,
@@ -318,6 +414,180 @@ func (p *OpenAIProvider) convertMessages(messages []Message, systemPrompt string
 	return result
 }
 
+// applyToolChoice sets tool_choice and parallel_tool_calls, which the API
+// only accepts with tools
+func applyToolChoice(chatReq *openai.ChatCompletionRequest, req *ChatRequest) {
+	if len(chatReq.Tools) == 0 {
+		return
+	}
+
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Mode {
+		case ToolChoiceAuto:
+			chatReq.ToolChoice = "auto"
+		case ToolChoiceAny:
+			chatReq.ToolChoice = "required"
+		case ToolChoiceNone:
+			chatReq.ToolChoice = "none"
+		case ToolChoiceTool:
+			chatReq.ToolChoice = openai.ToolChoice{
+				Type:     openai.ToolTypeFunction,
+				Function: openai.ToolFunction{Name: choice.Name},
+			}
+		}
+	}
+	if req.DisableParallelToolUse {
+		chatReq.ParallelToolCalls = false
+	}
+}
+
+// applyResponseSchema asks for JSON matching the request's response schema.
+// The API only constrains objects; ChatJSON's instructions and validation
+// cover other schemas.
+func applyResponseSchema(chatReq *openai.ChatCompletionRequest, req *ChatRequest) {
+	schema := req.ResponseSchema
+	if schema == nil || !schema.IsObject() {
+		return
+	}
+	chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        schema.SchemaName(),
+			Description: schema.Description,
+			Schema:      json.RawMessage(compactJSON(schema.Schema)),
+			Strict:      strictCompatible(schema.Schema),
+		},
+	}
+}
+
+// strictUnsupported are keywords that OpenAI's strict mode rejects or
+// doesn't enforce everywhere
+var strictUnsupported = []string{
+	"oneOf", "allOf", "not", "if", "then", "else", "patternProperties",
+	"dependentRequired", "dependentSchemas", "minProperties", "maxProperties",
+	"minLength", "maxLength", "pattern", "format", "minimum", "maximum",
+	"exclusiveMinimum", "exclusiveMaximum", "multipleOf", "minItems",
+	"maxItems", "uniqueItems", "default",
+}
+
+// strictCompatible reports whether a schema can be sent in strict mode,
+// which needs every object closed with additionalProperties false and all
+// its properties required. Other schemas are sent unenforced and checked
+// by ChatJSON instead.
+func strictCompatible(schema map[string]interface{}) bool {
+	// Decode a copy so []string and other Go values have JSON shapes
+	var normalized map[string]interface{}
+	if err := json.Unmarshal([]byte(compactJSON(schema)), &normalized); err != nil {
+		return false
+	}
+	if _, ok := normalized["anyOf"]; ok {
+		return false // The root must be an object
+	}
+	return strictNode(normalized)
+}
+
+func strictNode(schema map[string]interface{}) bool {
+	for _, keyword := range strictUnsupported {
+		if _, ok := schema[keyword]; ok {
+			return false
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	isObject := properties != nil
+	for _, t := range schemaTypes(schema["type"]) {
+		isObject = isObject || t == "object"
+	}
+	if isObject {
+		if closed, ok := schema["additionalProperties"].(bool); !ok || closed {
+			return false
+		}
+		names, _ := schema["required"].([]interface{})
+		required := make(map[string]bool)
+		for _, name := range names {
+			key, _ := name.(string)
+			required[key] = true
+		}
+		for key, sub := range properties {
+			subSchema, ok := sub.(map[string]interface{})
+			if !required[key] || !ok || !strictNode(subSchema) {
+				return false
+			}
+		}
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok && !strictNode(items) {
+		return false
+	}
+	for _, sub := range schemaList(schema["anyOf"]) {
+		if !strictNode(sub) {
+			return false
+		}
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		defs, _ := schema[key].(map[string]interface{})
+		for _, def := range defs {
+			sub, ok := def.(map[string]interface{})
+			if !ok || !strictNode(sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isReasoningModel reports whether a model is one of OpenAI's o-series
+// reasoning models
+func isReasoningModel(model string) bool {
+	return len(model) > 1 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9'
+}
+
+// applyReasoning adapts a request for reasoning models, which take
+// max_completion_tokens and no sampling parameters. It returns ctx
+// carrying the reasoning effort, which the client library has no field for.
+func applyReasoning(ctx context.Context, chatReq *openai.ChatCompletionRequest, req *ChatRequest) context.Context {
+	if !isReasoningModel(req.Model) {
+		return ctx
+	}
+
+	chatReq.MaxCompletionTokens = chatReq.MaxTokens
+	chatReq.MaxTokens = 0
+	chatReq.Temperature = 0
+	chatReq.TopP = 0
+
+	if req.ReasoningEffort == "" {
+		return ctx
+	}
+	return withBodyFields(ctx, map[string]interface{}{"reasoning_effort": req.ReasoningEffort})
+}
+
+// joinText flattens message parts to a string for servers that only
+// accept string content, dropping images
+func joinText(parts []openai.ChatMessagePart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == openai.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// imagePart converts an image to a message part, inlining base64 data as a
+// data URL
+func imagePart(image *ImageBlock) openai.ChatMessagePart {
+	imageURL := image.URL
+	if image.Type == "base64" {
+		imageURL = fmt.Sprintf("data:%s;base64,%s", image.MediaType, image.Data)
+	}
+	return openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{
+			URL: imageURL,
+		},
+	}
+}
+
 func (p *OpenAIProvider) convertTools(tools []Tool) []openai.Tool {
 	result := make([]openai.Tool, len(tools))
 
@@ -348,11 +618,7 @@ func (p *OpenAIProvider) convertResponse(resp *openai.ChatCompletionResponse) *C
 	response := &ChatResponse{
 		ID:    resp.ID,
 		Model: resp.Model,
-		Usage: Usage{
-			InputTokens:  resp.Usage.PromptTokens,
-			OutputTokens: resp.Usage.CompletionTokens,
-			TotalTokens:  resp.Usage.TotalTokens,
-		},
+		Usage: openAIUsage(resp.Usage),
 	}
 
 	if len(resp.Choices) > 0 {
@@ -371,6 +637,9 @@ func (p *OpenAIProvider) convertResponse(resp *openai.ChatCompletionResponse) *C
 			var input map[string]interface{}
 			json.Unmarshal([]byte(toolCall.Function.Arguments), &input)
 
+			if toolCall.ID == "" {
+				toolCall.ID = newToolCallID()
+			}
 			toolUse := &ToolUse{
 				ID:    toolCall.ID,
 				Name:  toolCall.Function.Name,
@@ -386,3 +655,17 @@ func (p *OpenAIProvider) convertResponse(resp *openai.ChatCompletionResponse) *C
 
 	return response
 }
+
+// openAIUsage converts usage, separating cached prompt tokens
+func openAIUsage(usage openai.Usage) Usage {
+	result := Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+	if usage.PromptTokensDetails != nil {
+		result.CacheReadInputTokens = usage.PromptTokensDetails.CachedTokens
+		result.InputTokens -= usage.PromptTokensDetails.CachedTokens
+	}
+	return result
+}
@@ -3,6 +3,8 @@ package llm
 import (
 	"context"
 	"fmt"
+
+	"github.com/heissanjay/oscode/internal/config"
 )
 
 // Provider defines the interface for LLM providers
@@ -31,40 +33,109 @@ type Provider interface {
 
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
-	Model        string
-	Messages     []Message
-	Tools        []Tool
-	SystemPrompt string
-	MaxTokens    int
-	Temperature  float64
-	TopP         float64
+	Model         string
+	Messages      []Message
+	Tools         []Tool
+	SystemPrompt  string
+	MaxTokens     int
+	Temperature   float64
+	TopP          float64
 	StopSequences []string
+
+	// Extended thinking. Providers use whichever form they take; models
+	// that can't think ignore both.
+	ThinkingBudget  int    // Tokens the model may think with before answering (0 = off)
+	ReasoningEffort string // "low", "medium" or "high"
+
+	// Constrains the response to JSON matching a schema. Use ChatJSON to
+	// have it validated.
+	ResponseSchema *ResponseSchema
+
+	// Which tools the model may call (nil = its choice), and whether it
+	// may call more than one in a response
+	ToolChoice             *ToolChoice
+	DisableParallelToolUse bool
+}
+
+// ToolChoiceMode says whether the model must, may or can't call tools
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto ToolChoiceMode = "auto" // The model decides
+	ToolChoiceAny  ToolChoiceMode = "any"  // The model must call a tool
+	ToolChoiceNone ToolChoiceMode = "none" // The model must not call tools
+	ToolChoiceTool ToolChoiceMode = "tool" // The model must call the named tool
+)
+
+// ToolChoice controls how the model uses a request's tools
+type ToolChoice struct {
+	Mode ToolChoiceMode
+	Name string // Tool to call, for ToolChoiceTool
+}
+
+// ForceTool returns a tool choice that makes the model call a tool
+func ForceTool(name string) *ToolChoice {
+	return &ToolChoice{Mode: ToolChoiceTool, Name: name}
+}
+
+// forced reports whether the choice makes the model call a tool
+func (c *ToolChoice) forced() bool {
+	return c != nil && (c.Mode == ToolChoiceAny || c.Mode == ToolChoiceTool)
 }
 
 // ChatResponse represents a chat completion response
 type ChatResponse struct {
-	ID           string
-	Model        string
-	Content      []ContentBlock
-	StopReason   string
-	Usage        Usage
-	ToolUse      []ToolUse
+	ID         string         `json:"id,omitempty"`
+	Model      string         `json:"model,omitempty"`
+	Content    []ContentBlock `json:"content,omitempty"`
+	StopReason string         `json:"stop_reason,omitempty"`
+	Usage      Usage          `json:"usage"`
+	ToolUse    []ToolUse      `json:"tool_use,omitempty"`
 }
 
-// Usage contains token usage information
+// Usage contains token usage information. InputTokens excludes tokens
+// read from or written to the prompt cache.
 type Usage struct {
-	InputTokens  int
-	OutputTokens int
-	TotalTokens  int
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	TotalTokens              int `json:"total_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"` // Input tokens written to the prompt cache
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`     // Input tokens read from the prompt cache
+}
+
+// Add adds another request's usage
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Cost returns the price of the usage in USD at a model's rates
+func (u Usage) Cost(info config.ModelInfo) float64 {
+	cacheWrite, cacheRead := info.CacheWritePrice, info.CacheReadPrice
+	if cacheWrite == 0 {
+		cacheWrite = info.InputPrice
+	}
+	if cacheRead == 0 {
+		cacheRead = info.InputPrice
+	}
+	return (float64(u.InputTokens)*info.InputPrice +
+		float64(u.OutputTokens)*info.OutputPrice +
+		float64(u.CacheCreationInputTokens)*cacheWrite +
+		float64(u.CacheReadInputTokens)*cacheRead) / 1e6
 }
 
 // StreamEvent represents a streaming event
 type StreamEvent struct {
-	Type       StreamEventType
-	Delta      string
-	ToolUse    *ToolUse
-	Response   *ChatResponse
-	Error      error
+	Type         StreamEventType
+	Delta        string
+	ToolUse      *ToolUse
+	Response     *ChatResponse
+	Error        error
+	Block        *ContentBlock // Completed thinking block, to keep in the conversation
+	Retry        *RetryStatus  // Why and when a failed request is being retried
 	InputTokens  int
 	OutputTokens int
 }
@@ -73,13 +144,14 @@ type StreamEvent struct {
 type StreamEventType string
 
 const (
-	EventTypeText        StreamEventType = "text"
-	EventTypeToolUse     StreamEventType = "tool_use"
-	EventTypeToolResult  StreamEventType = "tool_result"
-	EventTypeThinking    StreamEventType = "thinking"
-	EventTypeDone        StreamEventType = "done"
-	EventTypeError       StreamEventType = "error"
-	EventTypeUsage       StreamEventType = "usage"
+	EventTypeText       StreamEventType = "text"
+	EventTypeToolUse    StreamEventType = "tool_use"
+	EventTypeToolResult StreamEventType = "tool_result"
+	EventTypeThinking   StreamEventType = "thinking"
+	EventTypeRetry      StreamEventType = "retry"
+	EventTypeDone       StreamEventType = "done"
+	EventTypeError      StreamEventType = "error"
+	EventTypeUsage      StreamEventType = "usage"
 )
 
 // Tool represents a tool definition for the LLM
@@ -98,9 +170,22 @@ type ToolUse struct {
 
 // ToolResult represents the result of a tool execution
 type ToolResult struct {
-	ToolUseID string `json:"tool_use_id"`
-	Content   string `json:"content"`
-	IsError   bool   `json:"is_error"`
+	ToolUseID string       `json:"tool_use_id"`
+	Content   string       `json:"content"`
+	IsError   bool         `json:"is_error"`
+	Images    []ImageBlock `json:"images,omitempty"` // Images returned with the result
+}
+
+// WithoutImages returns the result with its images replaced by a note, for
+// providers that can't see them
+func (r *ToolResult) WithoutImages() *ToolResult {
+	if len(r.Images) == 0 {
+		return r
+	}
+	stripped := *r
+	stripped.Images = nil
+	stripped.Content += fmt.Sprintf("\n[%d image(s) omitted: the current model does not support images]", len(r.Images))
+	return &stripped
 }
 
 // Registry holds all registered providers
@@ -150,3 +235,20 @@ func RegisterProvider(provider Provider) {
 func GetProvider(name string) (Provider, error) {
 	return DefaultRegistry.Get(name)
 }
+
+// streamResponse replays a complete response as stream events, for
+// providers that can't stream a request
+func streamResponse(resp *ChatResponse) <-chan StreamEvent {
+	events := make(chan StreamEvent, len(resp.Content)+1)
+	for _, block := range resp.Content {
+		switch {
+		case block.Type == ContentTypeText && block.Text != "":
+			events <- StreamEvent{Type: EventTypeText, Delta: block.Text}
+		case block.Type == ContentTypeToolUse && block.ToolUse != nil:
+			events <- StreamEvent{Type: EventTypeToolUse, ToolUse: block.ToolUse}
+		}
+	}
+	events <- StreamEvent{Type: EventTypeDone, Response: resp}
+	close(events)
+	return events
+}
@@ -0,0 +1,247 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// ProviderFactory creates a provider the first time it's needed
+type ProviderFactory func() (Provider, error)
+
+// ProviderRegistry holds the configured providers, creating each on first
+// use, and routes model references to them
+type ProviderRegistry struct {
+	factories map[string]ProviderFactory
+	providers map[string]Provider
+	mu        sync.Mutex
+}
+
+// NewProviderRegistry creates an empty provider registry
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		factories: make(map[string]ProviderFactory),
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register adds a provider under name
+func (r *ProviderRegistry) Register(name string, factory ProviderFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+	delete(r.providers, name)
+}
+
+// Has reports whether a provider is configured
+func (r *ProviderRegistry) Has(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Names returns the configured providers, sorted
+func (r *ProviderRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.namesLocked()
+}
+
+// Get returns a provider, creating it if this is its first use
+func (r *ProviderRegistry) Get(name string) (Provider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if provider, ok := r.providers[name]; ok {
+		return provider, nil
+	}
+
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s (configured: %s)", name, strings.Join(r.namesLocked(), ", "))
+	}
+
+	provider, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	r.providers[name] = provider
+	return provider, nil
+}
+
+func (r *ProviderRegistry) namesLocked() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve routes a model reference to a provider and full model name. The
+// reference is "provider/model", or a model name or alias whose provider
+// is looked up in the catalog, falling back to defaultProvider.
+func (r *ProviderRegistry) Resolve(ref, defaultProvider string) (string, string, error) {
+	provider, model, explicit := r.SplitRef(ref)
+	if !explicit {
+		provider = defaultProvider
+		if owner, ok := config.FindModelProvider(model, defaultProvider); ok {
+			provider = owner
+		}
+	}
+	if model == "" {
+		return "", "", fmt.Errorf("no model given in %q", ref)
+	}
+
+	if !r.Has(provider) {
+		if explicit {
+			return "", "", fmt.Errorf("unknown provider %q in %q (configured: %s)", provider, ref, strings.Join(r.Names(), ", "))
+		}
+		return "", "", fmt.Errorf("model %s needs the %s provider, which isn't configured. Add it under providers in settings", model, provider)
+	}
+
+	model = config.ResolveModel(provider, model)
+
+	// Catch models sent to a provider that doesn't serve them. Gateways and
+	// other providers outside the catalog may serve anything.
+	if owner, ok := config.FindModelProvider(model, ""); ok && owner != provider && len(config.ModelsFor(provider)) > 0 {
+		return "", "", fmt.Errorf("%s is a %s model and isn't available from %s. Use %s/%s", model, owner, provider, owner, model)
+	}
+
+	return provider, model, nil
+}
+
+// DefaultModel returns the model to use for a provider when none is given:
+// its catalog default, or else the first model it lists, such as a local
+// model pulled into Ollama
+func (r *ProviderRegistry) DefaultModel(name string) (string, error) {
+	if model := config.GetDefaultModel(name); model != "" {
+		return model, nil
+	}
+
+	provider, err := r.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if models := provider.Models(); len(models) > 0 {
+		return models[0], nil
+	}
+	return "", fmt.Errorf("provider %s has no models available. Use /model %s/<model>", name, name)
+}
+
+// SplitRef splits "provider/model" when the prefix names a configured
+// provider. Other slashes belong to the model name.
+func (r *ProviderRegistry) SplitRef(ref string) (string, string, bool) {
+	if i := strings.Index(ref, "/"); i > 0 && r.Has(ref[:i]) {
+		return ref[:i], ref[i+1:], true
+	}
+	return "", ref, false
+}
+
+// ModelInfoProvider is implemented by providers that can report the
+// capabilities of models outside the catalog, such as local models
+type ModelInfoProvider interface {
+	ModelInfo(model string) (config.ModelInfo, bool)
+}
+
+// LookupModel returns what's known about a provider's model, from the
+// catalog or the provider itself
+func LookupModel(provider Provider, model string) (config.ModelInfo, bool) {
+	if info, ok := config.LookupModel(provider.Name(), model); ok {
+		return info, true
+	}
+	if p, ok := provider.(ModelInfoProvider); ok {
+		return p.ModelInfo(model)
+	}
+	return config.ModelInfo{}, false
+}
+
+// CheckRequest validates a request against the provider and what's known
+// about the model, clamping MaxTokens to the model's limit. Unknown models
+// are assumed to support everything the provider does. Tools are dropped
+// for models that can't use them, with a warning to show the user.
+func CheckRequest(provider Provider, req *ChatRequest) (warnings []string, err error) {
+	info, ok := LookupModel(provider, req.Model)
+	if !ok {
+		info = config.ModelInfo{Tools: true, Vision: true, Reasoning: true}
+	}
+
+	if req.ToolChoice.forced() && !hasTool(req.Tools, req.ToolChoice) {
+		return nil, fmt.Errorf("tool choice %s names no tool in the request", describeToolChoice(req.ToolChoice))
+	}
+	if len(req.Tools) > 0 && (!info.Tools || !provider.SupportsTools()) {
+		if req.ToolChoice.forced() {
+			return nil, fmt.Errorf("model %s doesn't support tool use. Switch to another model with /model", req.Model)
+		}
+		req.Tools = nil
+		req.ToolChoice = nil
+		warnings = append(warnings, fmt.Sprintf("model %s doesn't support tool use, so it can only chat. Switch to another model with /model to use tools", req.Model))
+	}
+	if (!info.Vision || !provider.SupportsVision()) && hasImages(req.Messages) {
+		return nil, fmt.Errorf("model %s doesn't accept images. Switch to another model with /model", req.Model)
+	}
+	if info.MaxOutputTokens > 0 && req.MaxTokens > info.MaxOutputTokens {
+		req.MaxTokens = info.MaxOutputTokens
+	}
+
+	// Thinking is a preference, not a requirement, so it's dropped rather
+	// than failing the request
+	if !info.Reasoning {
+		req.ThinkingBudget = 0
+		req.ReasoningEffort = ""
+	}
+	if req.ThinkingBudget >= req.MaxTokens {
+		req.ThinkingBudget = req.MaxTokens / 2
+		if req.ThinkingBudget < MinThinkingBudget {
+			req.ThinkingBudget = 0
+		}
+	}
+	return warnings, nil
+}
+
+// hasTool reports whether a request's tools include the ones a forced
+// choice needs
+func hasTool(tools []Tool, choice *ToolChoice) bool {
+	if choice.Mode == ToolChoiceAny {
+		return len(tools) > 0
+	}
+	for _, tool := range tools {
+		if tool.Name == choice.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func describeToolChoice(choice *ToolChoice) string {
+	if choice.Mode == ToolChoiceTool {
+		return fmt.Sprintf("%q", choice.Name)
+	}
+	return string(choice.Mode)
+}
+
+// SupportsVision reports whether a provider's model accepts images
+func SupportsVision(provider Provider, model string) bool {
+	if !provider.SupportsVision() {
+		return false
+	}
+	if info, ok := LookupModel(provider, model); ok {
+		return info.Vision
+	}
+	return true
+}
+
+func hasImages(messages []Message) bool {
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			if block.Image != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
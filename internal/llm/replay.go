@@ -0,0 +1,413 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// Fixture is a recording of provider exchanges, for playing back without
+// a network or an API key
+type Fixture struct {
+	// How requests find their exchange: MatchSequence (default) or MatchHash
+	Match     MatchMode  `json:"match,omitempty"`
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// MatchMode says how a replayed request finds its recorded exchange
+type MatchMode string
+
+const (
+	// MatchSequence plays exchanges back in the order they were recorded
+	MatchSequence MatchMode = "sequence"
+	// MatchHash plays back the exchange recorded for an identical request
+	MatchHash MatchMode = "hash"
+)
+
+// Exchange is one recorded request and the events streamed back for it
+type Exchange struct {
+	Hash   string         `json:"hash,omitempty"` // RequestHash of the request
+	Model  string         `json:"model,omitempty"`
+	Events []FixtureEvent `json:"events"`
+}
+
+// FixtureEvent is a stream event in a form that can be saved
+type FixtureEvent struct {
+	Type     StreamEventType `json:"type"`
+	Delta    string          `json:"delta,omitempty"`
+	ToolUse  *ToolUse        `json:"tool_use,omitempty"`
+	Block    *ContentBlock   `json:"block,omitempty"`
+	Response *ChatResponse   `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// LoadFixture reads a fixture file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	switch fixture.Match {
+	case "", MatchSequence, MatchHash:
+	default:
+		return nil, fmt.Errorf("invalid fixture %s: unknown match mode %q", path, fixture.Match)
+	}
+	return &fixture, nil
+}
+
+// Save writes the fixture to a file
+func (f *Fixture) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// RequestHash identifies a request by its model, messages, tool names and
+// response constraints. The system prompt is left out, since it holds the
+// date and working directory.
+func RequestHash(req *ChatRequest) string {
+	// Tool order doesn't change what the model can do
+	toolNames := make([]string, len(req.Tools))
+	for i, tool := range req.Tools {
+		toolNames[i] = tool.Name
+	}
+	sort.Strings(toolNames)
+	key := struct {
+		Model          string          `json:"model"`
+		Messages       []Message       `json:"messages"`
+		Tools          []string        `json:"tools"`
+		ToolChoice     *ToolChoice     `json:"tool_choice,omitempty"`
+		ResponseSchema *ResponseSchema `json:"response_schema,omitempty"`
+	}{req.Model, req.Messages, toolNames, req.ToolChoice, req.ResponseSchema}
+
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTextExchange returns an exchange that answers with text, for
+// scripting fixtures
+func NewTextExchange(text string) Exchange {
+	return scriptedExchange(text, nil)
+}
+
+// NewToolUseExchange returns an exchange that says text, which may be
+// empty, and then calls tools, for scripting fixtures
+func NewToolUseExchange(text string, toolUses ...ToolUse) Exchange {
+	return scriptedExchange(text, toolUses)
+}
+
+func scriptedExchange(text string, toolUses []ToolUse) Exchange {
+	var exchange Exchange
+	resp := &ChatResponse{StopReason: "end_turn"}
+	if text != "" {
+		exchange.Events = append(exchange.Events, FixtureEvent{Type: EventTypeText, Delta: text})
+		resp.Content = append(resp.Content, ContentBlock{Type: ContentTypeText, Text: text})
+	}
+	for i := range toolUses {
+		toolUse := toolUses[i]
+		exchange.Events = append(exchange.Events, FixtureEvent{Type: EventTypeToolUse, ToolUse: &toolUse})
+		resp.Content = append(resp.Content, ContentBlock{Type: ContentTypeToolUse, ToolUse: &toolUse})
+		resp.ToolUse = append(resp.ToolUse, toolUse)
+		resp.StopReason = "tool_use"
+	}
+	exchange.Events = append(exchange.Events, FixtureEvent{Type: EventTypeDone, Response: resp})
+	return exchange
+}
+
+// ReplayProvider plays back a fixture's exchanges instead of calling an
+// API. One fixture can stand in for several providers; see Named.
+type ReplayProvider struct {
+	name  string
+	state *replayState
+}
+
+// replayState is shared by a replay provider's named views, so they play
+// from one recording
+type replayState struct {
+	mu      sync.Mutex
+	fixture *Fixture
+	used    []bool
+	next    int
+}
+
+// NewReplayProvider creates a provider that plays back a fixture
+func NewReplayProvider(fixture *Fixture) *ReplayProvider {
+	return &ReplayProvider{
+		name: "replay",
+		state: &replayState{
+			fixture: fixture,
+			used:    make([]bool, len(fixture.Exchanges)),
+		},
+	}
+}
+
+// Named returns a view of the provider under another provider's name,
+// sharing its recording. Routing and model lookups then work as they did
+// when the fixture was recorded.
+func (p *ReplayProvider) Named(name string) *ReplayProvider {
+	return &ReplayProvider{name: name, state: p.state}
+}
+
+// Remaining returns how many recorded exchanges haven't been played
+func (p *ReplayProvider) Remaining() int {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+	remaining := 0
+	for _, used := range p.state.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (p *ReplayProvider) Name() string {
+	return p.name
+}
+
+func (p *ReplayProvider) Models() []string {
+	var models []string
+	seen := make(map[string]bool)
+	for _, exchange := range p.state.fixture.Exchanges {
+		if exchange.Model != "" && !seen[exchange.Model] {
+			seen[exchange.Model] = true
+			models = append(models, exchange.Model)
+		}
+	}
+	return models
+}
+
+func (p *ReplayProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *ReplayProvider) SupportsVision() bool {
+	return true
+}
+
+func (p *ReplayProvider) SupportsStreaming() bool {
+	return true
+}
+
+// ModelInfo reports a recorded model's capabilities from the catalog,
+// whichever provider serves it
+func (p *ReplayProvider) ModelInfo(model string) (config.ModelInfo, bool) {
+	return config.LookupModel("", model)
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	events, err := p.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	message := NewMessageBuilder()
+	var resp *ChatResponse
+	for event := range events {
+		message.Add(event)
+		switch event.Type {
+		case EventTypeDone:
+			resp = event.Response
+		case EventTypeError:
+			return nil, event.Error
+		}
+	}
+
+	result := &ChatResponse{Model: req.Model, StopReason: "end_turn"}
+	if resp != nil {
+		*result = *resp
+	}
+	result.Content = message.Message().Content
+	result.ToolUse = nil
+	for _, toolUse := range message.ToolUses() {
+		result.ToolUse = append(result.ToolUse, *toolUse)
+	}
+	return result, nil
+}
+
+func (p *ReplayProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	exchange, err := p.state.take(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent, len(exchange.Events)+1)
+	for _, recorded := range exchange.Events {
+		event := StreamEvent{
+			Type:     recorded.Type,
+			Delta:    recorded.Delta,
+			ToolUse:  recorded.ToolUse,
+			Block:    recorded.Block,
+			Response: recorded.Response,
+		}
+		if recorded.Error != "" {
+			event.Error = errors.New(recorded.Error)
+		}
+		events <- event
+	}
+	close(events)
+	return events, nil
+}
+
+// take finds the exchange recorded for a request and marks it played
+func (s *replayState) take(req *ChatRequest) (*Exchange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fixture.Match == MatchHash {
+		hash := RequestHash(req)
+		for i, exchange := range s.fixture.Exchanges {
+			if !s.used[i] && exchange.Hash == hash {
+				s.used[i] = true
+				return &s.fixture.Exchanges[i], nil
+			}
+		}
+		return nil, fmt.Errorf("replay: no recorded exchange for request %s (model %s, %d messages)", hash[:12], req.Model, len(req.Messages))
+	}
+
+	for s.next < len(s.fixture.Exchanges) && s.used[s.next] {
+		s.next++
+	}
+	if s.next >= len(s.fixture.Exchanges) {
+		return nil, fmt.Errorf("replay: all %d recorded exchanges have been played", len(s.fixture.Exchanges))
+	}
+	s.used[s.next] = true
+	return &s.fixture.Exchanges[s.next], nil
+}
+
+// Recorder saves the exchanges of the providers it wraps to a fixture
+// file, rewriting it after each one so a crash keeps what was recorded
+type Recorder struct {
+	path    string
+	mu      sync.Mutex
+	fixture Fixture
+}
+
+// NewRecorder creates a recorder that writes to path
+func NewRecorder(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+// Wrap returns provider with its exchanges recorded
+func (r *Recorder) Wrap(provider Provider) *RecordingProvider {
+	return &RecordingProvider{Provider: provider, recorder: r}
+}
+
+// add appends an exchange and saves the fixture
+func (r *Recorder) add(exchange Exchange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixture.Exchanges = append(r.fixture.Exchanges, exchange)
+	return r.fixture.Save(r.path)
+}
+
+// RecordingProvider passes requests to a provider and records what comes
+// back. Retries aren't recorded, so a fixture plays back only the
+// outcome.
+type RecordingProvider struct {
+	Provider
+	recorder *Recorder
+}
+
+// Unwrap returns the wrapped provider
+func (p *RecordingProvider) Unwrap() Provider {
+	return p.Provider
+}
+
+// ModelInfo reports the wrapped provider's model capabilities, if it can
+func (p *RecordingProvider) ModelInfo(model string) (config.ModelInfo, bool) {
+	if inner, ok := p.Provider.(ModelInfoProvider); ok {
+		return inner.ModelInfo(model)
+	}
+	return config.ModelInfo{}, false
+}
+
+func (p *RecordingProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	exchange := Exchange{Hash: RequestHash(req), Model: req.Model}
+	resp, err := p.Provider.Chat(ctx, req)
+	if err != nil {
+		exchange.Events = append(exchange.Events, FixtureEvent{Type: EventTypeError, Error: err.Error()})
+	} else {
+		for event := range streamResponse(resp) {
+			exchange.Events = append(exchange.Events, fixtureEvent(event))
+		}
+	}
+	if saveErr := p.recorder.add(exchange); saveErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to record exchange: %w", saveErr))
+	}
+	return resp, err
+}
+
+func (p *RecordingProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	exchange := Exchange{Hash: RequestHash(req), Model: req.Model}
+	inner, err := p.Provider.Stream(ctx, req)
+	if err != nil {
+		exchange.Events = append(exchange.Events, FixtureEvent{Type: EventTypeError, Error: err.Error()})
+		if saveErr := p.recorder.add(exchange); saveErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to record exchange: %w", saveErr))
+		}
+		return nil, err
+	}
+
+	events := make(chan StreamEvent, 100)
+	go func() {
+		defer close(events)
+
+		// The done event is held back until the exchange is saved, so a
+		// failure to save ends the stream with an error instead
+		var done *StreamEvent
+		for event := range inner {
+			if event.Type != EventTypeRetry && event.Type != EventTypeUsage {
+				exchange.Events = append(exchange.Events, fixtureEvent(event))
+			}
+			if event.Type == EventTypeDone {
+				done = &event
+				continue
+			}
+			events <- event
+		}
+		if err := p.recorder.add(exchange); err != nil {
+			events <- StreamEvent{Type: EventTypeError, Error: fmt.Errorf("failed to record exchange: %w", err)}
+			return
+		}
+		if done != nil {
+			events <- *done
+		}
+	}()
+	return events, nil
+}
+
+func fixtureEvent(event StreamEvent) FixtureEvent {
+	recorded := FixtureEvent{
+		Type:     event.Type,
+		Delta:    event.Delta,
+		ToolUse:  event.ToolUse,
+		Block:    event.Block,
+		Response: event.Response,
+	}
+	if event.Error != nil {
+		recorded.Error = event.Error.Error()
+	}
+	return recorded
+}
@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// collect drains a stream into a message, failing on errors
+func collect(t *testing.T, events <-chan StreamEvent) Message {
+	t.Helper()
+	message := NewMessageBuilder()
+	for event := range events {
+		if event.Type == EventTypeError {
+			t.Fatalf("stream error: %v", event.Error)
+		}
+		message.Add(event)
+	}
+	return message.Message()
+}
+
+func TestReplaySequence(t *testing.T) {
+	provider := NewReplayProvider(&Fixture{Exchanges: []Exchange{
+		NewToolUseExchange("Reading it.", ToolUse{ID: "call_1", Name: "Read", Input: map[string]interface{}{"file_path": "a.go"}}),
+		NewTextExchange("It's a package clause."),
+	}})
+	req := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("What's in a.go?")}}
+
+	events, err := provider.Stream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := collect(t, events)
+	if got := first.GetText(); got != "Reading it." {
+		t.Errorf("first text = %q", got)
+	}
+	if toolUses := first.GetToolUses(); len(toolUses) != 1 || toolUses[0].Name != "Read" {
+		t.Errorf("first tool uses = %+v", toolUses)
+	}
+
+	resp, err := provider.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Text(); got != "It's a package clause." {
+		t.Errorf("second text = %q", got)
+	}
+
+	if provider.Remaining() != 0 {
+		t.Errorf("remaining = %d, want 0", provider.Remaining())
+	}
+	if _, err := provider.Stream(context.Background(), req); err == nil {
+		t.Error("expected an error once the fixture is played out")
+	}
+}
+
+func TestReplayHash(t *testing.T) {
+	first := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("one")}}
+	second := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("two")}}
+
+	one, two := NewTextExchange("first answer"), NewTextExchange("second answer")
+	one.Hash, two.Hash = RequestHash(first), RequestHash(second)
+
+	// Recorded in one order, requested in the other
+	provider := NewReplayProvider(&Fixture{Match: MatchHash, Exchanges: []Exchange{one, two}})
+	resp, err := provider.Chat(context.Background(), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Text(); got != "second answer" {
+		t.Errorf("text = %q, want second answer", got)
+	}
+
+	unknown := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("three")}}
+	if _, err := provider.Chat(context.Background(), unknown); err == nil || !strings.Contains(err.Error(), "no recorded exchange") {
+		t.Errorf("err = %v, want no recorded exchange", err)
+	}
+}
+
+func TestRequestHashIgnoresSystemPrompt(t *testing.T) {
+	req := &ChatRequest{Model: "m", SystemPrompt: "Today is Monday", Messages: []Message{NewUserMessage("hi")}}
+	other := *req
+	other.SystemPrompt = "Today is Tuesday"
+	if RequestHash(req) != RequestHash(&other) {
+		t.Error("hash changed with the system prompt")
+	}
+	other.Model = "n"
+	if RequestHash(req) == RequestHash(&other) {
+		t.Error("hash didn't change with the model")
+	}
+}
+
+func TestRequestHashIgnoresToolOrder(t *testing.T) {
+	req := &ChatRequest{Model: "m", Tools: []Tool{{Name: "Read"}, {Name: "Glob"}}}
+	other := *req
+	other.Tools = []Tool{{Name: "Glob"}, {Name: "Read"}}
+	if RequestHash(req) != RequestHash(&other) {
+		t.Error("hash changed with the tool order")
+	}
+}
+
+func TestRecordingReportsSaveFailure(t *testing.T) {
+	// A file where the fixture's directory should be makes saving fail
+	blocker := filepath.Join(t.TempDir(), "fixtures")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := NewReplayProvider(&Fixture{Exchanges: []Exchange{NewTextExchange("hi"), NewTextExchange("hi")}})
+	recording := NewRecorder(filepath.Join(blocker, "session.json")).Wrap(source)
+	req := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("hi")}}
+
+	events, err := recording.Stream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last StreamEvent
+	for event := range events {
+		last = event
+	}
+	if last.Type != EventTypeError || !strings.Contains(last.Error.Error(), "failed to record exchange") {
+		t.Errorf("stream ended with %+v, want the save error", last)
+	}
+
+	if _, err := recording.Chat(context.Background(), req); err == nil || !strings.Contains(err.Error(), "failed to record exchange") {
+		t.Errorf("Chat err = %v, want the save error", err)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures", "session.json")
+	source := NewReplayProvider(&Fixture{Exchanges: []Exchange{
+		NewToolUseExchange("", ToolUse{ID: "call_1", Name: "Glob", Input: map[string]interface{}{"pattern": "*.go"}}),
+		NewTextExchange("Found one file."),
+	}})
+	recorder := NewRecorder(path)
+	recording := recorder.Wrap(source)
+
+	req := &ChatRequest{Model: "test-model", Messages: []Message{NewUserMessage("List Go files")}}
+	events, err := recording.Stream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Message{collect(t, events)}
+	resp, err := recording.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, Message{Role: RoleAssistant, Content: resp.Content})
+
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixture.Exchanges) != 2 {
+		t.Fatalf("recorded %d exchanges, want 2", len(fixture.Exchanges))
+	}
+	if fixture.Exchanges[0].Hash != RequestHash(req) || fixture.Exchanges[0].Model != "test-model" {
+		t.Errorf("exchange = %+v", fixture.Exchanges[0])
+	}
+
+	replay := NewReplayProvider(fixture)
+	var got []Message
+	for range want {
+		events, err := replay.Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, collect(t, events))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,343 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/heissanjay/oscode/internal/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxRetries   int           // Retries after the first attempt
+	InitialDelay time.Duration // Wait before the first retry, doubled for each one after
+	MaxDelay     time.Duration // Longest backoff between retries
+
+	// Model to switch to after FallbackAfter failed attempts (empty = none)
+	FallbackModel string
+	FallbackAfter int
+}
+
+// DefaultRetryPolicy is used when settings don't configure retries
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:   5,
+	InitialDelay: time.Second,
+	MaxDelay:     30 * time.Second,
+}
+
+// NewRetryPolicy builds a provider's retry policy from settings
+func NewRetryPolicy(retry config.RetryConfig, fallbackModel string) RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries:    retry.MaxRetries,
+		InitialDelay:  time.Duration(retry.InitialDelay * float64(time.Second)),
+		MaxDelay:      time.Duration(retry.MaxDelay * float64(time.Second)),
+		FallbackModel: fallbackModel,
+		FallbackAfter: retry.FallbackAfter,
+	}
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = DefaultRetryPolicy.InitialDelay
+	}
+	if policy.MaxDelay < policy.InitialDelay {
+		policy.MaxDelay = max(DefaultRetryPolicy.MaxDelay, policy.InitialDelay)
+	}
+	return policy
+}
+
+// RetryStatus describes a retry, for showing in the UI
+type RetryStatus struct {
+	Attempt    int // Retry number, from 1
+	MaxRetries int
+	Delay      time.Duration
+	Model      string // Model the retry goes to, which changes on fallback
+	Fallback   bool   // This retry switched to the fallback model
+	Err        error  // What failed
+}
+
+func (s RetryStatus) String() string {
+	msg := fmt.Sprintf("%s — retrying in %s (attempt %d of %d)", describeError(s.Err), s.Delay.Round(100*time.Millisecond), s.Attempt, s.MaxRetries)
+	if s.Fallback {
+		msg += fmt.Sprintf(" with fallback model %s", s.Model)
+	}
+	return msg
+}
+
+// RetryProvider wraps a provider, retrying rate limits, overloads, server
+// errors and dropped connections with jittered exponential backoff. A
+// stream is only retried if it fails before any content arrives, so
+// nothing is shown twice.
+type RetryProvider struct {
+	Provider
+	policy RetryPolicy
+
+	// sleep waits between attempts; tests replace it to skip the wait
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryProvider wraps a provider with a retry policy
+func NewRetryProvider(provider Provider, policy RetryPolicy) *RetryProvider {
+	return &RetryProvider{
+		Provider: provider,
+		policy:   policy,
+		sleep:    sleepContext,
+	}
+}
+
+// Unwrap returns the wrapped provider
+func (p *RetryProvider) Unwrap() Provider {
+	return p.Provider
+}
+
+// ModelInfo reports the wrapped provider's model capabilities, if it can
+func (p *RetryProvider) ModelInfo(model string) (config.ModelInfo, bool) {
+	if inner, ok := p.Provider.(ModelInfoProvider); ok {
+		return inner.ModelInfo(model)
+	}
+	return config.ModelInfo{}, false
+}
+
+func (p *RetryProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	current := req
+	for attempt := 0; ; attempt++ {
+		resp, err := p.Provider.Chat(ctx, current)
+		if err == nil {
+			return resp, nil
+		}
+
+		status, ok := p.next(ctx, current, attempt, err)
+		if !ok {
+			return nil, err
+		}
+		current = p.retryRequest(req, status)
+		if err := p.sleep(ctx, status.Delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *RetryProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	events := make(chan StreamEvent, 100)
+
+	go func() {
+		defer close(events)
+
+		report := func(status RetryStatus) {
+			events <- StreamEvent{Type: EventTypeRetry, Retry: &status}
+		}
+
+		inner, current, attempt, err := p.start(ctx, req, req, 0, report)
+		for err == nil {
+			failed := p.forward(inner, events)
+			if failed == nil {
+				return
+			}
+
+			status, ok := p.next(ctx, current, attempt, failed.Error)
+			if !ok {
+				events <- *failed
+				return
+			}
+			report(status)
+			current = p.retryRequest(req, status)
+			if err = p.sleep(ctx, status.Delay); err != nil {
+				break
+			}
+			inner, current, attempt, err = p.start(ctx, req, current, attempt+1, report)
+		}
+		events <- StreamEvent{Type: EventTypeError, Error: err}
+	}()
+
+	return events, nil
+}
+
+// start opens a stream, retrying failures to connect. It returns the
+// stream with the request and attempt number that opened it.
+func (p *RetryProvider) start(ctx context.Context, req, current *ChatRequest, attempt int, report func(RetryStatus)) (<-chan StreamEvent, *ChatRequest, int, error) {
+	for ; ; attempt++ {
+		inner, err := p.Provider.Stream(ctx, current)
+		if err == nil {
+			return inner, current, attempt, nil
+		}
+
+		status, ok := p.next(ctx, current, attempt, err)
+		if !ok {
+			return nil, current, attempt, err
+		}
+		report(status)
+		current = p.retryRequest(req, status)
+		if err := p.sleep(ctx, status.Delay); err != nil {
+			return nil, current, attempt, err
+		}
+	}
+}
+
+// forward passes a stream's events on. It returns the error event of a
+// stream that failed before sending any content, which can be retried, and
+// nil once the stream is finished or has failed part way through.
+func (p *RetryProvider) forward(inner <-chan StreamEvent, events chan<- StreamEvent) *StreamEvent {
+	started := false
+	for event := range inner {
+		if event.Type == EventTypeError && !started {
+			// Drain the stream so its goroutine can exit
+			for range inner {
+			}
+			return &event
+		}
+		started = true
+		events <- event
+	}
+	return nil
+}
+
+// next decides whether to retry after a failed attempt, returning how
+// long to wait and which model to use
+func (p *RetryProvider) next(ctx context.Context, req *ChatRequest, attempt int, err error) (RetryStatus, bool) {
+	if ctx.Err() != nil || attempt >= p.policy.MaxRetries {
+		return RetryStatus{}, false
+	}
+	wait, ok := retryable(err)
+	if !ok {
+		return RetryStatus{}, false
+	}
+
+	// Jitter over the upper half of the backoff keeps clients that failed
+	// together from retrying together
+	backoff := p.policy.InitialDelay << attempt
+	if backoff <= 0 || backoff > p.policy.MaxDelay {
+		backoff = p.policy.MaxDelay
+	}
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if wait > delay {
+		delay = wait
+	}
+
+	status := RetryStatus{
+		Attempt:    attempt + 1,
+		MaxRetries: p.policy.MaxRetries,
+		Delay:      delay,
+		Model:      req.Model,
+		Err:        err,
+	}
+	if p.policy.FallbackModel != "" && p.policy.FallbackAfter > 0 && attempt+1 >= p.policy.FallbackAfter && req.Model != p.policy.FallbackModel {
+		status.Model = p.policy.FallbackModel
+		status.Fallback = true
+	}
+	return status, true
+}
+
+// retryRequest returns the request to retry with, switched to the
+// fallback model once it's in use
+func (p *RetryProvider) retryRequest(req *ChatRequest, status RetryStatus) *ChatRequest {
+	if status.Model == req.Model {
+		return req
+	}
+	retry := *req
+	retry.Model = status.Model
+	return &retry
+}
+
+// retryable reports whether an error is worth retrying, and how long the
+// server asked to wait if it did
+func retryable(err error) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		var wait time.Duration
+		if anthropicErr.Response != nil {
+			wait = retryAfter(anthropicErr.Response.Header)
+		}
+		return wait, retryableStatus(anthropicErr.StatusCode)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter, retryableStatus(statusErr.StatusCode)
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode != 0 {
+		return 0, retryableStatus(apiErr.HTTPStatusCode)
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) && requestErr.HTTPStatusCode != 0 {
+		return 0, retryableStatus(requestErr.HTTPStatusCode)
+	}
+
+	// Dropped connections, and errors sent in the middle of a stream
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range []string{"overloaded", "rate_limit", "rate limit", "connection reset", "unexpected eof", "stream error", "internal server error", "api_error"} {
+		if strings.Contains(msg, transient) {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// retryableStatus reports whether a response status is temporary: request
+// timeouts, conflicts, rate limits, server errors and Anthropic's 529
+// overloaded
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// describeError names a retryable error briefly
+func describeError(err error) string {
+	if err == nil {
+		return "Request failed"
+	}
+	var code int
+	var anthropicErr *anthropic.Error
+	var statusErr *StatusError
+	var apiErr *openai.APIError
+	var requestErr *openai.RequestError
+	switch {
+	case errors.As(err, &anthropicErr):
+		code = anthropicErr.StatusCode
+	case errors.As(err, &statusErr):
+		code = statusErr.StatusCode
+	case errors.As(err, &apiErr):
+		code = apiErr.HTTPStatusCode
+	case errors.As(err, &requestErr):
+		code = requestErr.HTTPStatusCode
+	}
+
+	switch {
+	case code == http.StatusTooManyRequests:
+		return "Rate limited"
+	case code == 529 || strings.Contains(strings.ToLower(err.Error()), "overloaded"):
+		return "API overloaded"
+	case code >= 500:
+		return fmt.Sprintf("Server error (%d)", code)
+	case code != 0:
+		return fmt.Sprintf("Request failed (%d)", code)
+	}
+	return "Connection lost"
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,254 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attempt is how a scripted provider answers one request: an error
+// opening the stream, or the events the stream sends
+type attempt struct {
+	err    error
+	events []StreamEvent
+}
+
+// scriptedProvider answers each request with the next scripted attempt,
+// recording the model each one asked for
+type scriptedProvider struct {
+	Provider
+	attempts []attempt
+	models   []string
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	p.models = append(p.models, req.Model)
+	next := p.attempts[0]
+	p.attempts = p.attempts[1:]
+	if next.err != nil {
+		return nil, next.err
+	}
+
+	events := make(chan StreamEvent, len(next.events))
+	for _, event := range next.events {
+		events <- event
+	}
+	close(events)
+	return events, nil
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	p.models = append(p.models, req.Model)
+	next := p.attempts[0]
+	p.attempts = p.attempts[1:]
+	if next.err != nil {
+		return nil, next.err
+	}
+	return &ChatResponse{Model: req.Model}, nil
+}
+
+// success is a stream that answers with text
+func success(text string) attempt {
+	return attempt{events: []StreamEvent{
+		{Type: EventTypeText, Delta: text},
+		{Type: EventTypeDone, Response: &ChatResponse{StopReason: "end_turn"}},
+	}}
+}
+
+// newScriptedRetry wraps the attempts in a retry provider that records its
+// backoff instead of waiting
+func newScriptedRetry(policy RetryPolicy, attempts ...attempt) (*RetryProvider, *scriptedProvider, *[]time.Duration) {
+	inner := &scriptedProvider{attempts: attempts}
+	provider := NewRetryProvider(inner, policy)
+	var sleeps []time.Duration
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return provider, inner, &sleeps
+}
+
+// drain collects a stream's text, retries and final error
+func drain(events <-chan StreamEvent) (text string, retries []RetryStatus, err error) {
+	for event := range events {
+		switch event.Type {
+		case EventTypeText:
+			text += event.Delta
+		case EventTypeRetry:
+			retries = append(retries, *event.Retry)
+		case EventTypeError:
+			err = event.Error
+		}
+	}
+	return text, retries, err
+}
+
+var testPolicy = RetryPolicy{MaxRetries: 3, InitialDelay: time.Second, MaxDelay: 30 * time.Second}
+
+func TestRetryRateLimitWaitsRetryAfter(t *testing.T) {
+	rateLimited := checkStatus(&http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Status:     "429 Too Many Requests",
+		Header:     http.Header{"Retry-After": {"45"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error": "rate limited"}`)),
+	})
+	provider, inner, sleeps := newScriptedRetry(testPolicy, attempt{err: rateLimited}, success("hi"))
+
+	events, err := provider.Stream(context.Background(), &ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, retries, err := drain(events)
+	if err != nil || text != "hi" {
+		t.Fatalf("text = %q, err = %v", text, err)
+	}
+	if len(inner.models) != 2 {
+		t.Errorf("%d attempts, want 2", len(inner.models))
+	}
+
+	// The server's wait is longer than the backoff, so it wins
+	if len(*sleeps) != 1 || (*sleeps)[0] != 45*time.Second {
+		t.Errorf("sleeps = %v, want [45s]", *sleeps)
+	}
+	if len(retries) != 1 || !strings.HasPrefix(retries[0].String(), "Rate limited") {
+		t.Errorf("retries = %v", retries)
+	}
+}
+
+func TestRetryOverloadedBeforeContent(t *testing.T) {
+	overloaded := &StatusError{StatusCode: 529, Status: "529 Overloaded", Body: "overloaded_error"}
+	provider, inner, sleeps := newScriptedRetry(testPolicy,
+		attempt{events: []StreamEvent{{Type: EventTypeError, Error: overloaded}}},
+		success("hi"),
+	)
+
+	events, err := provider.Stream(context.Background(), &ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, retries, err := drain(events)
+	if err != nil || text != "hi" {
+		t.Fatalf("text = %q, err = %v", text, err)
+	}
+	if len(inner.models) != 2 {
+		t.Errorf("%d attempts, want 2", len(inner.models))
+	}
+	if len(retries) != 1 || !strings.HasPrefix(retries[0].String(), "API overloaded") {
+		t.Errorf("retries = %v", retries)
+	}
+
+	// Backoff for the first retry is jittered over the upper half of the
+	// initial delay
+	if len(*sleeps) != 1 || (*sleeps)[0] < 500*time.Millisecond || (*sleeps)[0] > time.Second {
+		t.Errorf("sleeps = %v", *sleeps)
+	}
+}
+
+func TestRetryNotAfterContent(t *testing.T) {
+	dropped := io.ErrUnexpectedEOF
+	provider, inner, _ := newScriptedRetry(testPolicy,
+		attempt{events: []StreamEvent{
+			{Type: EventTypeText, Delta: "Hel"},
+			{Type: EventTypeError, Error: dropped},
+		}},
+		success("Hello"),
+	)
+
+	events, err := provider.Stream(context.Background(), &ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, retries, err := drain(events)
+	if !errors.Is(err, dropped) {
+		t.Errorf("err = %v, want the stream's error", err)
+	}
+	if text != "Hel" || len(retries) != 0 || len(inner.models) != 1 {
+		t.Errorf("text = %q, retries = %v, attempts = %d; want the partial answer, unretried", text, retries, len(inner.models))
+	}
+}
+
+func TestRetryGivesUpOnClientErrors(t *testing.T) {
+	badRequest := &StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}
+	provider, inner, _ := newScriptedRetry(testPolicy, attempt{err: badRequest})
+
+	_, err := provider.Chat(context.Background(), &ChatRequest{Model: "big"})
+	if !errors.Is(err, badRequest) {
+		t.Errorf("err = %v, want the 400", err)
+	}
+	if len(inner.models) != 1 {
+		t.Errorf("%d attempts, want 1", len(inner.models))
+	}
+}
+
+func TestRetrySwitchesToFallbackModel(t *testing.T) {
+	policy := testPolicy
+	policy.FallbackModel = "small"
+	policy.FallbackAfter = 2
+	overloaded := &StatusError{StatusCode: 529, Status: "529 Overloaded"}
+	provider, inner, _ := newScriptedRetry(policy,
+		attempt{err: overloaded},
+		attempt{err: overloaded},
+		attempt{events: []StreamEvent{{Type: EventTypeError, Error: overloaded}}},
+		success("hi"),
+	)
+
+	events, err := provider.Stream(context.Background(), &ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, retries, err := drain(events)
+	if err != nil || text != "hi" {
+		t.Fatalf("text = %q, err = %v", text, err)
+	}
+
+	want := []string{"big", "big", "small", "small"}
+	if strings.Join(inner.models, ",") != strings.Join(want, ",") {
+		t.Errorf("models = %v, want %v", inner.models, want)
+	}
+	if len(retries) != 3 || retries[0].Fallback || !retries[1].Fallback || retries[2].Fallback {
+		t.Errorf("retries = %+v, want the second to switch models", retries)
+	}
+}
+
+func TestRetryStopsWhenCancelledDuringBackoff(t *testing.T) {
+	overloaded := &StatusError{StatusCode: 529, Status: "529 Overloaded"}
+	provider, inner, _ := newScriptedRetry(testPolicy, attempt{err: overloaded}, success("hi"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, time.Hour)
+	}
+
+	events, err := provider.Stream(ctx, &ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = drain(events)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(inner.models) != 1 {
+		t.Errorf("%d attempts, want 1", len(inner.models))
+	}
+
+	// Chat stops the same way
+	provider, inner, _ = newScriptedRetry(testPolicy, attempt{err: overloaded}, attempt{})
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, time.Hour)
+	}
+	if _, err := provider.Chat(ctx, &ChatRequest{Model: "big"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Chat err = %v, want context.Canceled", err)
+	}
+	if len(inner.models) != 1 {
+		t.Errorf("Chat made %d attempts, want 1", len(inner.models))
+	}
+}
@@ -0,0 +1,409 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ResponseSchema asks for a response that is a JSON value matching a
+// schema. OpenAI, Gemini and Ollama constrain the output natively;
+// Anthropic is made to call a tool whose input is the response.
+type ResponseSchema struct {
+	Name        string // Identifies the schema to the model (default "response")
+	Description string
+	Schema      map[string]interface{}
+}
+
+// schemaRepairAttempts is how many times ChatJSON asks the model to fix a
+// response that doesn't match the schema
+const schemaRepairAttempts = 1
+
+var schemaNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// SchemaName returns the schema's name in the form APIs accept for tool
+// and format names
+func (s *ResponseSchema) SchemaName() string {
+	name := schemaNamePattern.ReplaceAllString(s.Name, "_")
+	if name == "" {
+		return "response"
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// IsObject reports whether the schema describes a JSON object. Tool
+// inputs must be objects, so other schemas are wrapped.
+func (s *ResponseSchema) IsObject() bool {
+	t, _ := s.Schema["type"].(string)
+	return t == "object" || (t == "" && s.Schema["properties"] != nil)
+}
+
+// wrappedProperty holds a non-object response in the object sent as a tool
+// input schema
+const wrappedProperty = "value"
+
+// objectSchema returns the schema as an object schema, wrapping any other
+// kind of value in a property
+func (s *ResponseSchema) objectSchema() map[string]interface{} {
+	if s.IsObject() {
+		schema := make(map[string]interface{}, len(s.Schema)+1)
+		for key, val := range s.Schema {
+			schema[key] = val
+		}
+		schema["type"] = "object"
+		return schema
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{wrappedProperty: s.Schema},
+		"required":   []string{wrappedProperty},
+	}
+}
+
+// responseJSON returns the JSON response held in an object made to match
+// objectSchema
+func (s *ResponseSchema) responseJSON(input map[string]interface{}) string {
+	if s.IsObject() {
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		return compactJSON(input)
+	}
+	return compactJSON(input[wrappedProperty])
+}
+
+// LoadResponseSchema reads a schema given inline as JSON or as the path of
+// a JSON file
+func LoadResponseSchema(value string) (*ResponseSchema, error) {
+	data := []byte(strings.TrimSpace(value))
+	name := "response"
+	if len(data) == 0 || data[0] != '{' {
+		fileData, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON schema: %w", err)
+		}
+		data = fileData
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if title, ok := schema["title"].(string); ok && title != "" {
+		name = title
+	}
+	description, _ := schema["description"].(string)
+	return &ResponseSchema{Name: name, Description: description, Schema: schema}, nil
+}
+
+// ChatJSON sends a request for a response matching req.ResponseSchema and
+// returns the decoded JSON. A response that doesn't parse or match the
+// schema is sent back with what's wrong for the model to fix.
+func ChatJSON(ctx context.Context, provider Provider, req *ChatRequest) (json.RawMessage, *ChatResponse, error) {
+	if req.ResponseSchema == nil {
+		return nil, nil, fmt.Errorf("request has no response schema")
+	}
+
+	// Providers that can't constrain the output natively rely on the
+	// instructions, and the rest are helped by them
+	current := *req
+	current.SystemPrompt = strings.TrimSpace(current.SystemPrompt + "\n\n" + schemaInstructions(req.ResponseSchema))
+	var usage Usage
+	for attempt := 0; ; attempt++ {
+		resp, err := provider.Chat(ctx, &current)
+		if err != nil {
+			return nil, nil, err
+		}
+		usage.Add(resp.Usage)
+		resp.Usage = usage
+
+		text := resp.Text()
+		data, err := parseJSONResponse(text, req.ResponseSchema.Schema)
+		if err == nil {
+			return data, resp, nil
+		}
+		if attempt >= schemaRepairAttempts {
+			return nil, resp, fmt.Errorf("response does not match the JSON schema: %w", err)
+		}
+
+		current.Messages = append(append([]Message{}, current.Messages...),
+			NewAssistantMessage(text),
+			NewUserMessage(fmt.Sprintf("That response is not valid: %v. Respond again with only a JSON value that matches the schema.", err)))
+	}
+}
+
+// schemaInstructions tells the model the format to respond in
+func schemaInstructions(schema *ResponseSchema) string {
+	data, _ := json.MarshalIndent(schema.Schema, "", "  ")
+	return fmt.Sprintf("Respond with only a JSON value that matches this JSON schema, with no other text and no code fences:\n%s", data)
+}
+
+// Text returns the response's text
+func (r *ChatResponse) Text() string {
+	var sb strings.Builder
+	for _, block := range r.Content {
+		if block.Type == ContentTypeText {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// parseJSONResponse decodes a response and validates it against a schema,
+// allowing for a code fence around the JSON
+func parseJSONResponse(text string, schema map[string]interface{}) (json.RawMessage, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+		text = strings.TrimSpace(text)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("empty response")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := ValidateJSON(schema, value); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(text), nil
+}
+
+// ValidateJSON checks a decoded JSON value against a schema. It covers the
+// keywords structured output uses: type, enum, const, properties, required,
+// additionalProperties, items, anyOf, oneOf, allOf, and length, size and
+// range limits.
+func ValidateJSON(schema map[string]interface{}, value interface{}) error {
+	// Schemas built in Go may hold []string and other typed values, so
+	// decode a copy to get the same shapes as the response
+	var normalized map[string]interface{}
+	if err := json.Unmarshal([]byte(compactJSON(schema)), &normalized); err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return validateValue(normalized, value, "$")
+}
+
+func validateValue(schema map[string]interface{}, value interface{}, path string) error {
+	if schema == nil {
+		return nil
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if jsonEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %s is not one of the allowed values", path, compactJSON(value))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		return fmt.Errorf("%s: must be %s", path, compactJSON(constant))
+	}
+
+	for _, sub := range schemaList(schema["allOf"]) {
+		if err := validateValue(sub, value, path); err != nil {
+			return err
+		}
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 {
+		if matchCount(anyOf, value, path) == 0 {
+			return fmt.Errorf("%s: does not match any allowed schema", path)
+		}
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 {
+		if matchCount(oneOf, value, path) != 1 {
+			return fmt.Errorf("%s: must match exactly one allowed schema", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	case []interface{}:
+		return validateArray(schema, v, path)
+	case string:
+		length := len([]rune(v))
+		if limit, ok := schemaNumber(schema["minLength"]); ok && float64(length) < limit {
+			return fmt.Errorf("%s: must be at least %v characters", path, limit)
+		}
+		if limit, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > limit {
+			return fmt.Errorf("%s: must be at most %v characters", path, limit)
+		}
+	case float64:
+		if limit, ok := schemaNumber(schema["minimum"]); ok && v < limit {
+			return fmt.Errorf("%s: must be at least %v", path, limit)
+		}
+		if limit, ok := schemaNumber(schema["maximum"]); ok && v > limit {
+			return fmt.Errorf("%s: must be at most %v", path, limit)
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, present := obj[key]; !present {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if sub, ok := properties[key].(map[string]interface{}); ok {
+			if err := validateValue(sub, obj[key], path+"."+key); err != nil {
+				return err
+			}
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return fmt.Errorf("%s: unexpected property %q", path, key)
+			}
+		case map[string]interface{}:
+			if err := validateValue(extra, obj[key], path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateArray(schema map[string]interface{}, arr []interface{}, path string) error {
+	if limit, ok := schemaNumber(schema["minItems"]); ok && float64(len(arr)) < limit {
+		return fmt.Errorf("%s: must have at least %v items", path, limit)
+	}
+	if limit, ok := schemaNumber(schema["maxItems"]); ok && float64(len(arr)) > limit {
+		return fmt.Errorf("%s: must have at most %v items", path, limit)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes reads a type keyword, which is a name or a list of names
+func schemaTypes(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var types []string
+		for _, t := range v {
+			if name, ok := t.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaList(value interface{}) []map[string]interface{} {
+	list, _ := value.([]interface{})
+	var schemas []map[string]interface{}
+	for _, item := range list {
+		if schema, ok := item.(map[string]interface{}); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+func schemaNumber(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func matchCount(schemas []map[string]interface{}, value interface{}, path string) int {
+	count := 0
+	for _, sub := range schemas {
+		if validateValue(sub, value, path) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == t
+	}
+}
+
+// jsonType names a decoded JSON value's type
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	person := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"age":  map[string]interface{}{"type": "integer", "minimum": 0},
+			"role": map[string]interface{}{"enum": []string{"admin", "user"}},
+		},
+		"required":             []string{"name"},
+		"additionalProperties": false,
+	}
+	idOrName := map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "integer"},
+			map[string]interface{}{"type": "string"},
+		},
+	}
+	numberOrInteger := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "number"},
+			map[string]interface{}{"type": "integer"},
+		},
+	}
+	tags := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}
+
+	tests := []struct {
+		name    string
+		schema  map[string]interface{}
+		value   string
+		wantErr string // Empty when the value is valid
+	}{
+		{"valid object", person, `{"name": "Ada", "age": 36, "role": "admin"}`, ""},
+		{"wrong type", person, `["Ada"]`, "$: expected object, got array"},
+		{"wrong property type", person, `{"name": 7}`, "$.name: expected string, got number"},
+		{"integer", person, `{"name": "Ada", "age": 36.5}`, "$.age: expected integer"},
+		{"range", person, `{"name": "Ada", "age": -1}`, "$.age: must be at least 0"},
+		{"enum", person, `{"name": "Ada", "role": "root"}`, `$.role: "root" is not one of the allowed values`},
+		{"required", person, `{"age": 36}`, `$: missing required property "name"`},
+		{"closed object", person, `{"name": "Ada", "email": "ada@example.com"}`, `$: unexpected property "email"`},
+		{"additional properties schema", tags, `{"env": "prod"}`, ""},
+		{"additional properties schema mismatch", tags, `{"env": 1}`, "$.env: expected string"},
+		{"anyOf first", idOrName, `42`, ""},
+		{"anyOf second", idOrName, `"forty-two"`, ""},
+		{"anyOf none", idOrName, `true`, "$: does not match any allowed schema"},
+		{"oneOf exactly one", numberOrInteger, `1.5`, ""},
+		{"oneOf both", numberOrInteger, `2`, "$: must match exactly one allowed schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateJSON(tt.schema, value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChatJSONRepairsResponse(t *testing.T) {
+	schema := &ResponseSchema{Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"count": map[string]interface{}{"type": "integer"}},
+		"required":   []string{"count"},
+	}}
+	replay := NewReplayProvider(&Fixture{Exchanges: []Exchange{
+		NewTextExchange(`{"count": "three"}`),
+		NewTextExchange("```json\n{\"count\": 3}\n```"),
+	}})
+	log := &chatLog{Provider: replay}
+
+	data, _, err := ChatJSON(context.Background(), log, &ChatRequest{
+		Model:          "test-model",
+		Messages:       []Message{NewUserMessage("How many files?")},
+		ResponseSchema: schema,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"count": 3}` {
+		t.Errorf("data = %s", data)
+	}
+
+	// The retry shows the model its response and what's wrong with it
+	if len(log.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(log.requests))
+	}
+	messages := log.requests[1].Messages
+	if len(messages) != 3 || messages[1].GetText() != `{"count": "three"}` {
+		t.Fatalf("repair messages = %+v", messages)
+	}
+	if repair := messages[2].GetText(); !strings.Contains(repair, "$.count: expected integer, got string") {
+		t.Errorf("repair prompt = %q", repair)
+	}
+	if !strings.Contains(log.requests[0].SystemPrompt, `"count"`) {
+		t.Errorf("system prompt doesn't carry the schema: %q", log.requests[0].SystemPrompt)
+	}
+}
+
+func TestChatJSONGivesUpAfterRepair(t *testing.T) {
+	replay := NewReplayProvider(&Fixture{Exchanges: []Exchange{
+		NewTextExchange("not JSON"),
+		NewTextExchange("still not JSON"),
+	}})
+
+	_, _, err := ChatJSON(context.Background(), replay, &ChatRequest{
+		Model:          "test-model",
+		Messages:       []Message{NewUserMessage("hi")},
+		ResponseSchema: &ResponseSchema{Schema: map[string]interface{}{"type": "object"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not match the JSON schema") {
+		t.Errorf("err = %v", err)
+	}
+	if replay.Remaining() != 0 {
+		t.Errorf("%d exchanges not played", replay.Remaining())
+	}
+}
+
+// chatLog records the requests sent to a provider's Chat
+type chatLog struct {
+	Provider
+	requests []*ChatRequest
+}
+
+func (l *chatLog) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	l.requests = append(l.requests, req)
+	return l.Provider.Chat(ctx, req)
+}
+
+func TestStrictCompatible(t *testing.T) {
+	closed := func(extra map[string]interface{}) map[string]interface{} {
+		schema := map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string"},
+				"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required":             []string{"name", "tags"},
+			"additionalProperties": false,
+		}
+		for key, val := range extra {
+			schema[key] = val
+		}
+		return schema
+	}
+
+	tests := []struct {
+		name   string
+		schema map[string]interface{}
+		want   bool
+	}{
+		{"closed and all required", closed(nil), true},
+		{"optional property", closed(map[string]interface{}{"required": []string{"name"}}), false},
+		{"open object", closed(map[string]interface{}{"additionalProperties": true}), false},
+		{"no additionalProperties", closed(map[string]interface{}{"additionalProperties": nil}), false},
+		{"unsupported keyword", closed(map[string]interface{}{"minProperties": 1}), false},
+		{"open nested object", closed(map[string]interface{}{
+			"properties": map[string]interface{}{"meta": map[string]interface{}{"type": "object"}},
+			"required":   []string{"meta"},
+		}), false},
+		{"nullable anyOf", closed(map[string]interface{}{
+			"properties": map[string]interface{}{"id": map[string]interface{}{
+				"anyOf": []interface{}{map[string]interface{}{"type": "string"}, map[string]interface{}{"type": "null"}},
+			}},
+			"required": []string{"id"},
+		}), true},
+	}
+	for _, tt := range tests {
+		if got := strictCompatible(tt.schema); got != tt.want {
+			t.Errorf("%s: strictCompatible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
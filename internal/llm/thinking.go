@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MinThinkingBudget is the smallest thinking budget providers accept
+const MinThinkingBudget = 1024
+
+// ThinkingBudgets maps reasoning effort levels to thinking budgets
+var ThinkingBudgets = map[string]int{
+	"low":    4096,
+	"medium": 10000,
+	"high":   32000,
+}
+
+// ParseThinking parses a thinking setting: "off", an effort level ("low",
+// "medium", "high") or a token budget. It returns the thinking budget and
+// the reasoning effort for providers that take one instead.
+func ParseThinking(setting string) (int, string, error) {
+	setting = strings.ToLower(strings.TrimSpace(setting))
+	switch setting {
+	case "", "off", "none", "false":
+		return 0, "", nil
+	case "on", "true":
+		setting = "medium"
+	}
+
+	if budget, ok := ThinkingBudgets[setting]; ok {
+		return budget, setting, nil
+	}
+
+	budget, err := strconv.Atoi(setting)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid thinking setting %q: use off, low, medium, high or a token budget", setting)
+	}
+	if budget <= 0 {
+		return 0, "", nil
+	}
+	if budget < MinThinkingBudget {
+		return 0, "", fmt.Errorf("thinking budget must be at least %d tokens", MinThinkingBudget)
+	}
+	return budget, effortForBudget(budget), nil
+}
+
+// effortForBudget returns the closest effort level at or below a budget
+func effortForBudget(budget int) string {
+	switch {
+	case budget >= ThinkingBudgets["high"]:
+		return "high"
+	case budget >= ThinkingBudgets["medium"]:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// thinkingBuffer collects streamed reasoning for providers that don't send
+// it as blocks. It's flushed when the model moves on, so the block keeps
+// its place in the message.
+type thinkingBuffer struct {
+	strings.Builder
+}
+
+// flush sends the collected reasoning as a block, if there is any
+func (t *thinkingBuffer) flush(events chan<- StreamEvent) {
+	if t.Len() == 0 {
+		return
+	}
+	events <- StreamEvent{
+		Type:  EventTypeThinking,
+		Block: &ContentBlock{Type: ContentTypeThinking, Thinking: t.String()},
+	}
+	t.Reset()
+}
+
+// IsThinking reports whether a content block holds model reasoning
+func (b ContentBlock) IsThinking() bool {
+	return b.Type == ContentTypeThinking || b.Type == ContentTypeRedactedThinking
+}
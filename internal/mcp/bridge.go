@@ -1,13 +1,20 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/heissanjay/oscode/internal/llm"
 	"github.com/heissanjay/oscode/internal/tools"
 )
 
+// maxResultLength caps the text of a tool result sent to the model, in bytes
+const maxResultLength = 100000
+
 // ToolBridge adapts an MCP tool to the internal tools.Tool interface
 type ToolBridge struct {
 	server *Server
@@ -59,32 +66,68 @@ func (b *ToolBridge) Execute(ctx context.Context, input json.RawMessage) (*tools
 		return tools.NewErrorResult(err), nil
 	}
 
-	// Format result
-	var content string
-	switch v := result.(type) {
-	case string:
-		content = v
-	case map[string]interface{}:
-		// Check for content array (MCP format)
-		if contentArr, ok := v["content"].([]interface{}); ok {
-			for _, item := range contentArr {
-				if itemMap, ok := item.(map[string]interface{}); ok {
-					if text, ok := itemMap["text"].(string); ok {
-						content += text
-					}
-				}
+	return convertToolResult(result), nil
+}
+
+// ReadOnly reports whether the server marked the tool as read-only
+func (b *ToolBridge) ReadOnly() bool {
+	return b.tool.Annotations != nil && b.tool.Annotations.ReadOnlyHint
+}
+
+// convertToolResult maps an MCP tool result to a tools.Result. Images are
+// passed through for the model to see; other content is rendered as text.
+func convertToolResult(result *CallToolResult) *tools.Result {
+	var parts []string
+	var images []llm.ImageBlock
+
+	for _, c := range result.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image":
+			images = append(images, llm.ImageBlock{
+				Type:      "base64",
+				MediaType: c.MimeType,
+				Data:      c.Data,
+			})
+		case "resource":
+			if c.Resource != nil {
+				parts = append(parts, fmt.Sprintf("[Resource: %s]\n%s", c.Resource.URI, FormatResourceContents([]ResourceContents{*c.Resource})))
+			}
+		case "resource_link":
+			link := c.URI
+			if c.Name != "" {
+				link = fmt.Sprintf("%s (%s)", c.Name, c.URI)
 			}
-		} else {
-			// Just marshal the whole thing
-			data, _ := json.MarshalIndent(v, "", "  ")
-			content = string(data)
+			parts = append(parts, "[Resource link: "+link+"]")
+		default:
+			parts = append(parts, fmt.Sprintf("[Unsupported %s content: %s]", c.Type, c.MimeType))
 		}
-	default:
-		data, _ := json.Marshal(v)
-		content = string(data)
 	}
 
-	return tools.NewResult(content), nil
+	// Servers should mirror structured content as text; show it if they didn't
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, result.StructuredContent, "", "  "); err == nil {
+			parts = append(parts, pretty.String())
+		}
+	}
+
+	content := strings.Join(parts, "\n")
+	if len(content) > maxResultLength {
+		// Cut on a rune boundary so the text stays valid UTF-8
+		cut := maxResultLength
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		content = fmt.Sprintf("%s\n\n... (output truncated: showing %d of %d bytes)", content[:cut], cut, len(content))
+	}
+
+	return &tools.Result{
+		Content: content,
+		IsError: result.IsError,
+		Images:  images,
+	}
 }
 
 // Ensure ToolBridge implements tools.Tool
@@ -0,0 +1,25 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestConvertToolResultTruncatesOnRuneBoundary(t *testing.T) {
+	// A 3-byte rune straddles the limit
+	text := strings.Repeat("a", maxResultLength-1) + "€" + strings.Repeat("b", 10)
+	result := convertToolResult(&CallToolResult{Content: []ToolContent{{Type: "text", Text: text}}})
+
+	if !utf8.ValidString(result.Content) {
+		t.Fatal("truncated content isn't valid UTF-8")
+	}
+	if !strings.HasPrefix(result.Content, strings.Repeat("a", maxResultLength-1)+"\n\n... (output truncated") {
+		t.Errorf("content ends with %q", result.Content[maxResultLength-10:])
+	}
+	notice := fmt.Sprintf("(output truncated: showing %d of %d bytes)", maxResultLength-1, len(text))
+	if !strings.HasSuffix(result.Content, notice) {
+		t.Errorf("content ends with %q, want %q", result.Content[maxResultLength:], notice)
+	}
+}
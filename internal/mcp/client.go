@@ -4,18 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/heissanjay/oscode/internal/config"
 	"github.com/heissanjay/oscode/internal/llm"
 	"github.com/heissanjay/oscode/internal/tools"
 )
 
+// initializeTimeout bounds the initialize handshake and tool discovery
+const initializeTimeout = 30 * time.Second
+
 // Tool represents an MCP tool definition
 type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
 }
 
 // Resource represents an MCP resource
@@ -26,34 +34,99 @@ type Resource struct {
 	MimeType    string `json:"mimeType,omitempty"`
 }
 
+// SamplingHandler answers sampling/createMessage requests from servers
+type SamplingHandler func(ctx context.Context, req *CreateMessageRequest) (*CreateMessageResult, error)
+
 // Server represents a connected MCP server
 type Server struct {
-	Name      string
-	Config    config.MCPServerConfig
-	Transport Transport
-	Tools     []Tool
-	Resources []Resource
-	mu        sync.RWMutex
+	Name         string
+	Config       config.MCPServerConfig
+	Transport    Transport
+	Info         Implementation
+	Capabilities ServerCapabilities
+	Instructions string
+	Tools        []Tool
+	Resources    []Resource
+	Prompts      []Prompt
+	mu           sync.RWMutex
+
+	conn          *Conn
+	client        *Client
+	progressToken int64
+	warnings      []string
 }
 
 // Client manages connections to MCP servers
 type Client struct {
 	servers map[string]*Server
 	mu      sync.RWMutex
+
+	// Handlers for server-initiated messages
+	roots            []Root
+	sampling         SamplingHandler
+	onToolsChanged   func(server string)
+	onPromptsChanged func(server string)
+	onProgress       func(server string, progress Progress)
+	onAuthorize      func(server, authURL string)
+
+	tokenStore *TokenStore
+	life       lifecycle
 }
 
 // NewClient creates a new MCP client
 func NewClient() *Client {
-	return &Client{
-		servers: make(map[string]*Server),
+	c := &Client{
+		servers:    make(map[string]*Server),
+		tokenStore: DefaultTokenStore(),
+		life: lifecycle{
+			entries:      make(map[string]*serverEntry),
+			sleep:        time.Sleep,
+			stableUptime: stableUptime,
+		},
 	}
+	c.life.dial = c.Connect
+	return c
+}
+
+// SetTokenStore sets where OAuth credentials for remote servers are kept
+func (c *Client) SetTokenStore(store *TokenStore) {
+	c.tokenStore = store
+}
+
+// SetRoots sets the directories exposed to servers via roots/list
+func (c *Client) SetRoots(roots []Root) {
+	c.roots = roots
+}
+
+// SetSamplingHandler lets servers sample from the client's LLM
+func (c *Client) SetSamplingHandler(handler SamplingHandler) {
+	c.sampling = handler
+}
+
+// SetToolsChangedHandler sets the callback for when a server's tools change
+func (c *Client) SetToolsChangedHandler(handler func(server string)) {
+	c.onToolsChanged = handler
+}
+
+// SetPromptsChangedHandler sets the callback for when a server's prompts change
+func (c *Client) SetPromptsChangedHandler(handler func(server string)) {
+	c.onPromptsChanged = handler
+}
+
+// SetProgressHandler sets the callback for progress on tool calls
+func (c *Client) SetProgressHandler(handler func(server string, progress Progress)) {
+	c.onProgress = handler
+}
+
+// SetAuthorizeHandler sets the callback that shows the user the URL to log
+// in to a remote server at. The browser is still opened. Without a handler
+// the URL is printed to stderr.
+func (c *Client) SetAuthorizeHandler(handler func(server, authURL string)) {
+	c.onAuthorize = handler
 }
 
 // Connect connects to an MCP server
 func (c *Client) Connect(name string, cfg config.MCPServerConfig) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	// Create transport based on type
 	var transport Transport
 	var err error
@@ -62,9 +135,9 @@ func (c *Client) Connect(name string, cfg config.MCPServerConfig) error {
 	case "stdio":
 		transport, err = NewStdioTransport(cfg.Command, cfg.Args, cfg.Env)
 	case "sse":
-		transport, err = NewSSETransport(cfg.URL, cfg.Headers)
+		transport, err = NewSSETransport(cfg.URL, cfg.Headers, c.oauthClient(name, cfg))
 	case "http":
-		transport, err = NewHTTPTransport(cfg.URL, cfg.Headers)
+		transport, err = NewHTTPTransport(cfg.URL, cfg.Headers, c.oauthClient(name, cfg))
 	default:
 		return fmt.Errorf("unsupported MCP transport: %s", cfg.Transport)
 	}
@@ -73,25 +146,69 @@ func (c *Client) Connect(name string, cfg config.MCPServerConfig) error {
 		return fmt.Errorf("failed to create transport: %w", err)
 	}
 
+	return c.ConnectTransport(name, cfg, transport)
+}
+
+// oauthClient returns the OAuth client for a remote server, or nil when the
+// config already supplies an Authorization header
+func (c *Client) oauthClient(name string, cfg config.MCPServerConfig) *OAuthClient {
+	for k := range cfg.Headers {
+		if strings.EqualFold(k, "Authorization") {
+			return nil
+		}
+	}
+
+	auth := NewOAuthClient(cfg.URL, cfg.OAuth, c.tokenStore)
+	if handler := c.onAuthorize; handler != nil {
+		auth.OpenBrowser = func(authURL string) error {
+			handler(name, authURL)
+			return launchBrowser(authURL)
+		}
+	}
+	return auth
+}
+
+// ConnectTransport starts an MCP session with a server over an existing
+// transport
+func (c *Client) ConnectTransport(name string, cfg config.MCPServerConfig, transport Transport) error {
 	server := &Server{
 		Name:      name,
 		Config:    cfg,
 		Transport: transport,
+		conn:      NewConn(transport),
+		client:    c,
 	}
+	server.registerHandlers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
 
 	// Initialize connection
-	if err := server.initialize(); err != nil {
-		transport.Close()
+	if err := server.initialize(ctx); err != nil {
+		server.conn.Close()
 		return fmt.Errorf("failed to initialize server %s: %w", name, err)
 	}
 
-	// Discover tools
-	if err := server.discoverTools(); err != nil {
-		// Not fatal, just log warning
-		fmt.Printf("Warning: failed to discover tools from %s: %v\n", name, err)
+	// Discover tools. Failures aren't fatal; they show up in the status.
+	if err := server.discoverTools(ctx); err != nil {
+		server.warn("failed to discover tools: %v", err)
+	}
+
+	// Resources and prompts are optional features
+	if server.Capabilities.Resources != nil {
+		if err := server.discoverResources(ctx); err != nil {
+			server.warn("failed to discover resources: %v", err)
+		}
+	}
+	if server.Capabilities.Prompts != nil {
+		if err := server.discoverPrompts(ctx); err != nil {
+			server.warn("failed to discover prompts: %v", err)
+		}
 	}
 
+	c.mu.Lock()
 	c.servers[name] = server
+	c.mu.Unlock()
 	return nil
 }
 
@@ -105,7 +222,7 @@ func (c *Client) Disconnect(name string) error {
 		return fmt.Errorf("server not found: %s", name)
 	}
 
-	if err := server.Transport.Close(); err != nil {
+	if err := server.conn.Close(); err != nil {
 		return err
 	}
 
@@ -121,6 +238,21 @@ func (c *Client) GetServer(name string) (*Server, bool) {
 	return server, ok
 }
 
+// Servers returns the connected servers sorted by name
+func (c *Client) Servers() []*Server {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]*Server, 0, len(c.servers))
+	for _, server := range c.servers {
+		result = append(result, server)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
 // AllTools returns all tools from all connected servers
 func (c *Client) AllTools() []tools.Tool {
 	c.mu.RLock()
@@ -128,10 +260,7 @@ func (c *Client) AllTools() []tools.Tool {
 
 	var result []tools.Tool
 	for _, server := range c.servers {
-		for _, tool := range server.Tools {
-			bridge := NewToolBridge(server, tool)
-			result = append(result, bridge)
-		}
+		result = append(result, server.BridgeTools()...)
 	}
 	return result
 }
@@ -143,7 +272,7 @@ func (c *Client) ToLLMTools() []llm.Tool {
 
 	var result []llm.Tool
 	for _, server := range c.servers {
-		for _, tool := range server.Tools {
+		for _, tool := range server.ListTools() {
 			result = append(result, llm.Tool{
 				Name:        fmt.Sprintf("%s:%s", server.Name, tool.Name),
 				Description: tool.Description,
@@ -156,112 +285,289 @@ func (c *Client) ToLLMTools() []llm.Tool {
 
 // Close closes all server connections
 func (c *Client) Close() {
+	c.life.mu.Lock()
+	c.life.closed = true
+	c.life.mu.Unlock()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	for name, server := range c.servers {
-		server.Transport.Close()
+		server.conn.Close()
 		delete(c.servers, name)
 	}
 }
 
 // Server methods
 
-func (s *Server) initialize() error {
-	// Send initialize request
-	request := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      1,
-		"method":  "initialize",
-		"params": map[string]interface{}{
-			"protocolVersion": "2024-11-05",
-			"capabilities":    map[string]interface{}{},
-			"clientInfo": map[string]interface{}{
-				"name":    "oscode",
-				"version": "1.0.0",
-			},
-		},
+// registerHandlers answers the requests and notifications servers may send
+func (s *Server) registerHandlers() {
+	s.conn.HandleRequest("roots/list", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		roots := s.client.roots
+		if roots == nil {
+			roots = []Root{}
+		}
+		return map[string]interface{}{"roots": roots}, nil
+	})
+
+	s.conn.HandleRequest("sampling/createMessage", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		if s.client.sampling == nil {
+			return nil, &RPCError{Code: ErrCodeMethodNotFound, Message: "sampling is not supported"}
+		}
+
+		var req CreateMessageRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &RPCError{Code: ErrCodeInvalidParams, Message: err.Error()}
+		}
+		return s.client.sampling(ctx, &req)
+	})
+
+	s.conn.HandleNotification("notifications/tools/list_changed", func(params json.RawMessage) {
+		// Refresh outside the read loop so the request can be answered
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+			defer cancel()
+
+			if err := s.discoverTools(ctx); err == nil && s.client.onToolsChanged != nil {
+				s.client.onToolsChanged(s.Name)
+			}
+		}()
+	})
+
+	s.conn.HandleNotification("notifications/resources/list_changed", func(params json.RawMessage) {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+			defer cancel()
+			s.discoverResources(ctx)
+		}()
+	})
+
+	s.conn.HandleNotification("notifications/prompts/list_changed", func(params json.RawMessage) {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+			defer cancel()
+
+			if err := s.discoverPrompts(ctx); err == nil && s.client.onPromptsChanged != nil {
+				s.client.onPromptsChanged(s.Name)
+			}
+		}()
+	})
+
+	s.conn.HandleNotification("notifications/progress", func(params json.RawMessage) {
+		if s.client.onProgress == nil {
+			return
+		}
+
+		var progress Progress
+		if err := json.Unmarshal(params, &progress); err == nil {
+			s.client.onProgress(s.Name, progress)
+		}
+	})
+}
+
+func (s *Server) initialize(ctx context.Context) error {
+	capabilities := map[string]interface{}{
+		"roots": map[string]interface{}{},
+	}
+	if s.client.sampling != nil {
+		capabilities["sampling"] = map[string]interface{}{}
 	}
 
-	response, err := s.Transport.Request(request)
+	var result InitializeResult
+	err := s.conn.Call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    capabilities,
+		ClientInfo: Implementation{
+			Name:    "oscode",
+			Version: "1.0.0",
+		},
+	}, &result)
 	if err != nil {
 		return err
 	}
 
-	// Check for error in response
-	if errObj, ok := response["error"]; ok {
-		return fmt.Errorf("initialization error: %v", errObj)
-	}
+	s.mu.Lock()
+	s.Info = result.ServerInfo
+	s.Capabilities = result.Capabilities
+	s.Instructions = result.Instructions
+	s.mu.Unlock()
 
 	// Send initialized notification
-	notification := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"method":  "notifications/initialized",
+	return s.conn.Notify(ctx, "notifications/initialized", nil)
+}
+
+func (s *Server) discoverTools(ctx context.Context) error {
+	var all []Tool
+	cursor := ""
+
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var page ListToolsResult
+		if err := s.conn.Call(ctx, "tools/list", params, &page); err != nil {
+			return err
+		}
+
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
 	}
-	return s.Transport.Notify(notification)
+
+	s.mu.Lock()
+	s.Tools = all
+	s.mu.Unlock()
+	return nil
 }
 
-func (s *Server) discoverTools() error {
+func (s *Server) discoverResources(ctx context.Context) error {
+	var all []Resource
+	cursor := ""
+
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var page ListResourcesResult
+		if err := s.conn.Call(ctx, "resources/list", params, &page); err != nil {
+			return err
+		}
+
+		all = append(all, page.Resources...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Request tools list
-	request := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      2,
-		"method":  "tools/list",
-		"params":  map[string]interface{}{},
+	s.Resources = all
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Server) discoverPrompts(ctx context.Context) error {
+	var all []Prompt
+	cursor := ""
+
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var page ListPromptsResult
+		if err := s.conn.Call(ctx, "prompts/list", params, &page); err != nil {
+			return err
+		}
+
+		all = append(all, page.Prompts...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
 	}
 
-	response, err := s.Transport.Request(request)
-	if err != nil {
-		return err
+	s.mu.Lock()
+	s.Prompts = all
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Server) warn(format string, args ...interface{}) {
+	s.mu.Lock()
+	s.warnings = append(s.warnings, fmt.Sprintf(format, args...))
+	s.mu.Unlock()
+}
+
+// Warnings returns non-fatal problems seen while talking to the server
+func (s *Server) Warnings() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.warnings...)
+}
+
+// ListTools returns the server's current tools
+func (s *Server) ListTools() []Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Tool(nil), s.Tools...)
+}
+
+// ListResources returns the server's current resources
+func (s *Server) ListResources() []Resource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Resource(nil), s.Resources...)
+}
+
+// ListPrompts returns the server's current prompts
+func (s *Server) ListPrompts() []Prompt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Prompt(nil), s.Prompts...)
+}
+
+// ReadResource reads a resource from this server
+func (s *Server) ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error) {
+	var result ReadResourceResult
+	if err := s.conn.Call(ctx, "resources/read", map[string]interface{}{"uri": uri}, &result); err != nil {
+		return nil, fmt.Errorf("failed to read resource %s: %w", uri, err)
 	}
+	return &result, nil
+}
 
-	// Parse tools from response
-	result, ok := response["result"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid response format")
+// GetPrompt renders a prompt with the given arguments
+func (s *Server) GetPrompt(ctx context.Context, name string, arguments map[string]string) (*GetPromptResult, error) {
+	params := map[string]interface{}{"name": name}
+	if len(arguments) > 0 {
+		params["arguments"] = arguments
 	}
 
-	toolsList, ok := result["tools"].([]interface{})
-	if !ok {
-		return nil // No tools available
+	var result GetPromptResult
+	if err := s.conn.Call(ctx, "prompts/get", params, &result); err != nil {
+		return nil, fmt.Errorf("failed to get prompt %s: %w", name, err)
 	}
+	return &result, nil
+}
 
-	s.Tools = make([]Tool, 0, len(toolsList))
-	for _, t := range toolsList {
-		toolData, _ := json.Marshal(t)
-		var tool Tool
-		if err := json.Unmarshal(toolData, &tool); err == nil {
-			s.Tools = append(s.Tools, tool)
-		}
+// BridgeTools returns the server's tools adapted to tools.Tool
+func (s *Server) BridgeTools() []tools.Tool {
+	var result []tools.Tool
+	for _, tool := range s.ListTools() {
+		result = append(result, NewToolBridge(s, tool))
 	}
+	return result
+}
 
-	return nil
+// Conn returns the server's JSON-RPC session
+func (s *Server) Conn() *Conn {
+	return s.conn
 }
 
 // CallTool calls a tool on this server
-func (s *Server) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (interface{}, error) {
-	request := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      3,
-		"method":  "tools/call",
-		"params": map[string]interface{}{
-			"name":      name,
-			"arguments": arguments,
+func (s *Server) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*CallToolResult, error) {
+	// Ask for progress updates on long-running calls
+	token := atomic.AddInt64(&s.progressToken, 1)
+
+	params := map[string]interface{}{
+		"name":      name,
+		"arguments": arguments,
+		"_meta": map[string]interface{}{
+			"progressToken": fmt.Sprintf("%s-%d", s.Name, token),
 		},
 	}
 
-	response, err := s.Transport.Request(request)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check for error
-	if errObj, ok := response["error"]; ok {
-		return nil, fmt.Errorf("tool call error: %v", errObj)
+	var result CallToolResult
+	if err := s.conn.Call(ctx, "tools/call", params, &result); err != nil {
+		return nil, fmt.Errorf("tool call error: %w", err)
 	}
 
-	return response["result"], nil
+	return &result, nil
 }
@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// fakeServer is an MCP server on the far end of a pipe whose tools can be
+// changed while connected
+type fakeServer struct {
+	conn *Conn
+
+	mu    sync.Mutex
+	tools []Tool
+}
+
+// connectFakeServer connects a client to a fake server offering tools
+func connectFakeServer(t *testing.T, client *Client, tools ...Tool) (*fakeServer, *Server) {
+	t.Helper()
+
+	a, b := net.Pipe()
+	fake := &fakeServer{conn: NewConn(NewStreamTransport(b, b)), tools: tools}
+	t.Cleanup(func() { fake.conn.Close() })
+
+	fake.conn.HandleRequest("initialize", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+			ServerInfo:      Implementation{Name: "fake", Version: "1.0.0"},
+		}, nil
+	})
+	fake.conn.HandleRequest("tools/list", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return &ListToolsResult{Tools: fake.tools}, nil
+	})
+
+	if err := client.ConnectTransport("fake", config.MCPServerConfig{}, NewStreamTransport(a, a)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	server, ok := client.GetServer("fake")
+	if !ok {
+		t.Fatal("server not registered")
+	}
+	return fake, server
+}
+
+func (f *fakeServer) setTools(tools ...Tool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tools = tools
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	client := NewClient()
+	client.SetTokenStore(NewTokenStore(filepath.Join(t.TempDir(), "auth.json")))
+	return client
+}
+
+func TestClientDiscoversTools(t *testing.T) {
+	client := newTestClient(t)
+	_, server := connectFakeServer(t, client, Tool{Name: "search"})
+
+	if server.Info.Name != "fake" {
+		t.Errorf("server name = %q, want fake", server.Info.Name)
+	}
+	if tools := server.ListTools(); len(tools) != 1 || tools[0].Name != "search" {
+		t.Errorf("tools = %+v, want search", tools)
+	}
+}
+
+func TestClientAnswersRootsList(t *testing.T) {
+	client := newTestClient(t)
+	roots := []Root{{URI: "file:///project", Name: "project"}}
+	client.SetRoots(roots)
+	fake, _ := connectFakeServer(t, client)
+
+	var result struct {
+		Roots []Root `json:"roots"`
+	}
+	if err := fake.conn.Call(context.Background(), "roots/list", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Roots, roots) {
+		t.Errorf("roots = %+v, want %+v", result.Roots, roots)
+	}
+
+	if err := fake.conn.Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
+
+func TestClientRefreshesToolsWhenListChanges(t *testing.T) {
+	client := newTestClient(t)
+	changed := make(chan string, 1)
+	client.SetToolsChangedHandler(func(server string) { changed <- server })
+	fake, server := connectFakeServer(t, client, Tool{Name: "search"})
+
+	fake.setTools(Tool{Name: "search"}, Tool{Name: "fetch"})
+	if err := fake.conn.Notify(context.Background(), "notifications/tools/list_changed", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case name := <-changed:
+		if name != "fake" {
+			t.Errorf("changed server = %q, want fake", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tools weren't refreshed")
+	}
+	if tools := server.ListTools(); len(tools) != 2 || tools[1].Name != "fetch" {
+		t.Errorf("tools after refresh = %+v, want search and fetch", tools)
+	}
+}
@@ -0,0 +1,485 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streamable HTTP headers
+const (
+	headerSessionID       = "Mcp-Session-Id"
+	headerProtocolVersion = "Mcp-Protocol-Version"
+	headerLastEventID     = "Last-Event-ID"
+)
+
+// errSessionExpired is returned when the server no longer knows the session
+var errSessionExpired = errors.New("MCP session expired")
+
+// streamReconnectDelay is the wait before reopening a dropped event stream
+const streamReconnectDelay = 2 * time.Second
+
+// HTTPTransport speaks the Streamable HTTP transport. Every client message
+// is POSTed to a single endpoint; the server answers with JSON or an SSE
+// stream, and may push messages on an optional GET stream. Sessions are
+// tracked with the Mcp-Session-Id header and dropped streams resume from
+// the last event id.
+type HTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	auth    *OAuthClient
+
+	sessionID       string
+	protocolVersion string
+	initializeID    string
+	initialize      []byte // Replayed when the session expires
+	lastEventID     string
+	stateMu         sync.Mutex
+
+	messages chan *Message
+	closed   bool
+	mu       sync.Mutex
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	streamOnce sync.Once
+}
+
+// NewHTTPTransport creates a new Streamable HTTP transport
+func NewHTTPTransport(serverURL string, headers map[string]string, auth *OAuthClient) (*HTTPTransport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPTransport{
+		url:      serverURL,
+		headers:  headers,
+		client:   &http.Client{},
+		auth:     auth,
+		messages: make(chan *Message, 16),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// SessionID returns the session id assigned by the server, if any
+func (t *HTTPTransport) SessionID() string {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	return t.sessionID
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, msg *Message) error {
+	err := t.send(ctx, msg)
+	if errors.Is(err, errSessionExpired) && msg.Method != "initialize" {
+		// The server dropped the session; start a new one and try again
+		if err := t.reinitialize(ctx); err != nil {
+			return fmt.Errorf("MCP session expired and couldn't be renewed: %w", err)
+		}
+		err = t.send(ctx, msg)
+	}
+	return err
+}
+
+func (t *HTTPTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if msg.Method == "initialize" {
+		t.stateMu.Lock()
+		t.initializeID = string(msg.ID)
+		t.initialize = data
+		t.stateMu.Unlock()
+	}
+
+	// Response streams outlive Send, so tie them to the transport as well
+	reqCtx, cancel := mergeContext(ctx, t.ctx)
+
+	resp, err := t.post(reqCtx, data)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && msg.Method != "initialize" && t.hadSession(resp):
+		resp.Body.Close()
+		cancel()
+		return errSessionExpired
+
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("MCP server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		// Responses (and any requests the server makes meanwhile) arrive on
+		// the stream, which may stay open long after Send returns
+		go func() {
+			defer cancel()
+			t.readEventStream(reqCtx, resp.Body, true)
+		}()
+
+	default:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		// 202 Accepted carries no body
+		if len(bytes.TrimSpace(body)) > 0 {
+			msgs, err := decodeMessages(body)
+			if err != nil {
+				return fmt.Errorf("invalid response from MCP server: %w", err)
+			}
+			for _, m := range msgs {
+				t.push(m)
+			}
+		}
+	}
+
+	// Once the session is established, listen for server-initiated messages
+	if msg.Method == "notifications/initialized" {
+		t.streamOnce.Do(func() {
+			go t.listen()
+		})
+	}
+
+	return nil
+}
+
+// post sends a message body to the endpoint, remembering the session id
+// the server assigns
+func (t *HTTPTransport) post(ctx context.Context, data []byte) (*http.Response, error) {
+	resp, err := doWithAuth(ctx, t.client, t.auth, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		t.setSessionHeaders(req)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if id := resp.Header.Get(headerSessionID); id != "" {
+		t.stateMu.Lock()
+		t.sessionID = id
+		t.stateMu.Unlock()
+	}
+	return resp, nil
+}
+
+// hadSession reports whether a request was sent with a session id, so a 404
+// means the server forgot it
+func (t *HTTPTransport) hadSession(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Header.Get(headerSessionID) != ""
+}
+
+// reinitialize replays the initialize handshake without a session id after
+// the server expired the session. The response is consumed here, as the call
+// that started the first session has long returned.
+func (t *HTTPTransport) reinitialize(ctx context.Context) error {
+	t.stateMu.Lock()
+	t.sessionID = ""
+	t.protocolVersion = ""
+	t.lastEventID = ""
+	initialize := t.initialize
+	t.stateMu.Unlock()
+
+	if initialize == nil {
+		return errSessionExpired
+	}
+	var request Message
+	if err := json.Unmarshal(initialize, &request); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := mergeContext(ctx, t.ctx)
+	defer cancel()
+
+	resp, err := t.post(reqCtx, initialize)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("MCP server returned %s", resp.Status)
+	}
+
+	var msgs []*Message
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		err = readSSE(resp.Body, func(event sseEvent) bool {
+			decoded, err := decodeMessages([]byte(event.Data))
+			if err != nil {
+				return true
+			}
+			msgs = append(msgs, decoded...)
+			for _, m := range decoded {
+				if m.IsResponse() && string(m.ID) == string(request.ID) {
+					return false
+				}
+			}
+			return true
+		})
+	} else {
+		var body []byte
+		if body, err = io.ReadAll(resp.Body); err == nil {
+			msgs, err = decodeMessages(body)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid response from MCP server: %w", err)
+	}
+
+	initialized := false
+	for _, m := range msgs {
+		if !m.IsResponse() || string(m.ID) != string(request.ID) {
+			t.push(m)
+			continue
+		}
+		if m.Error != nil {
+			return m.Error
+		}
+		var result InitializeResult
+		if err := json.Unmarshal(m.Result, &result); err != nil {
+			return fmt.Errorf("invalid initialize result: %w", err)
+		}
+		t.stateMu.Lock()
+		t.protocolVersion = result.ProtocolVersion
+		t.stateMu.Unlock()
+		initialized = true
+	}
+	if !initialized {
+		return fmt.Errorf("no initialize response")
+	}
+
+	return t.send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (t *HTTPTransport) setSessionHeaders(req *http.Request) {
+	setHeaders(req, t.headers)
+
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set(headerSessionID, t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(headerProtocolVersion, t.protocolVersion)
+	}
+}
+
+// readEventStream pushes messages from an SSE body. If resume is set and the
+// stream drops while ctx is live, it continues on a GET from the last event id.
+func (t *HTTPTransport) readEventStream(ctx context.Context, body io.ReadCloser, resume bool) {
+	defer body.Close()
+
+	err := readSSE(body, func(event sseEvent) bool {
+		if event.ID != "" {
+			t.stateMu.Lock()
+			t.lastEventID = event.ID
+			t.stateMu.Unlock()
+		}
+		if event.Event != "" && event.Event != "message" {
+			return true
+		}
+
+		msgs, err := decodeMessages([]byte(event.Data))
+		if err != nil {
+			return true
+		}
+		for _, m := range msgs {
+			t.push(m)
+		}
+		return true
+	})
+
+	if err != nil && resume && ctx.Err() == nil {
+		t.stateMu.Lock()
+		lastEventID := t.lastEventID
+		t.stateMu.Unlock()
+
+		if lastEventID != "" {
+			go t.openStream(lastEventID)
+		}
+	}
+}
+
+// listen keeps a GET stream open for server-initiated messages
+func (t *HTTPTransport) listen() {
+	for t.ctx.Err() == nil {
+		t.stateMu.Lock()
+		lastEventID := t.lastEventID
+		t.stateMu.Unlock()
+
+		supported := t.openStream(lastEventID)
+		if !supported {
+			return
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(streamReconnectDelay):
+		}
+	}
+}
+
+// openStream opens a GET event stream, resuming after lastEventID when set.
+// It returns false if the server doesn't offer a stream.
+func (t *HTTPTransport) openStream(lastEventID string) bool {
+	resp, err := doWithAuth(t.ctx, t.client, t.auth, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(t.ctx, "GET", t.url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set(headerLastEventID, lastEventID)
+		}
+		t.setSessionHeaders(req)
+		return req, nil
+	})
+	if err != nil {
+		// Transient failure; the caller retries
+		return true
+	}
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return false
+	}
+
+	// The listen loop reconnects itself
+	t.readEventStream(t.ctx, resp.Body, false)
+	return true
+}
+
+func (t *HTTPTransport) push(msg *Message) {
+	t.captureProtocolVersion(msg)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.messages <- msg
+	}
+}
+
+// captureProtocolVersion remembers the version negotiated by initialize,
+// which must be sent on every later request
+func (t *HTTPTransport) captureProtocolVersion(msg *Message) {
+	if !msg.IsResponse() || len(msg.Result) == 0 {
+		return
+	}
+
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	if t.initializeID == "" || string(msg.ID) != t.initializeID {
+		return
+	}
+
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(msg.Result, &result); err == nil {
+		t.protocolVersion = result.ProtocolVersion
+	}
+	t.initializeID = ""
+}
+
+func (t *HTTPTransport) Messages() <-chan *Message {
+	return t.messages
+}
+
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.messages)
+	t.mu.Unlock()
+
+	t.cancel()
+
+	// Let the server know the session is over
+	if sessionID := t.SessionID(); sessionID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "DELETE", t.url, nil)
+		if err == nil {
+			setHeaders(req, t.headers)
+			req.Header.Set(headerSessionID, sessionID)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	return nil
+}
+
+// doWithAuth sends a request built by build, attaching the OAuth bearer
+// token when there is one. A 401 starts authorization and retries once.
+func doWithAuth(ctx context.Context, client *http.Client, auth *OAuthClient, build func() (*http.Request, error)) (*http.Response, error) {
+	req, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	token := ""
+	if auth != nil {
+		token = auth.AccessToken(ctx)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized || auth == nil {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if err := auth.Authorize(ctx, challenge, token); err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+
+	req, err = build()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+auth.AccessToken(ctx))
+	return client.Do(req)
+}
+
+// mergeContext returns a context that ends when either parent does
+func mergeContext(a, b context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(a)
+	stop := context.AfterFunc(b, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// fakeHTTPServer is a Streamable HTTP MCP server. tools/list is answered on
+// an event stream and everything else with JSON.
+type fakeHTTPServer struct {
+	mu          sync.Mutex
+	sessions    map[string]bool
+	initialized int
+	versions    []string // Mcp-Protocol-Version of requests after initialize
+}
+
+func (f *fakeHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if msg.Method == "initialize" {
+		f.initialized++
+		id := fmt.Sprintf("session-%d", f.initialized)
+		f.sessions[id] = true
+		w.Header().Set(headerSessionID, id)
+		writeJSONResponse(w, msg.ID, InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+			ServerInfo:      Implementation{Name: "fake-http", Version: "1.0.0"},
+		})
+		return
+	}
+
+	if !f.sessions[r.Header.Get(headerSessionID)] {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	f.versions = append(f.versions, r.Header.Get(headerProtocolVersion))
+
+	switch {
+	case msg.IsNotification():
+		w.WriteHeader(http.StatusAccepted)
+	case msg.Method == "tools/list":
+		data, _ := json.Marshal(&Message{JSONRPC: "2.0", ID: msg.ID, Result: mustMarshal(ListToolsResult{Tools: []Tool{{Name: "search"}}})})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: 1\nevent: message\ndata: %s\n\n", data)
+	default:
+		writeJSONResponse(w, msg.ID, struct{}{})
+	}
+}
+
+// expire forgets every session, as a restarted server would
+func (f *fakeHTTPServer) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = make(map[string]bool)
+}
+
+func writeJSONResponse(w http.ResponseWriter, id json.RawMessage, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&Message{JSONRPC: "2.0", ID: id, Result: mustMarshal(result)})
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// connectHTTPServer connects a client to a fake Streamable HTTP server
+func connectHTTPServer(t *testing.T) (*fakeHTTPServer, *HTTPTransport, *Server) {
+	t.Helper()
+
+	fake := &fakeHTTPServer{sessions: make(map[string]bool)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	transport, err := NewHTTPTransport(srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t)
+	if err := client.ConnectTransport("remote", config.MCPServerConfig{}, transport); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	server, _ := client.GetServer("remote")
+	return fake, transport, server
+}
+
+func TestHTTPTransportKeepsSession(t *testing.T) {
+	fake, transport, server := connectHTTPServer(t)
+
+	if server.Info.Name != "fake-http" {
+		t.Errorf("server name = %q, want fake-http", server.Info.Name)
+	}
+	// tools/list was answered on an event stream
+	if tools := server.ListTools(); len(tools) != 1 || tools[0].Name != "search" {
+		t.Errorf("tools = %+v, want search", tools)
+	}
+	if id := transport.SessionID(); id != "session-1" {
+		t.Errorf("session id = %q, want session-1", id)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, version := range fake.versions {
+		if version != ProtocolVersion {
+			t.Errorf("request sent protocol version %q, want %q", version, ProtocolVersion)
+		}
+	}
+}
+
+func TestHTTPTransportRenewsExpiredSession(t *testing.T) {
+	fake, transport, server := connectHTTPServer(t)
+
+	fake.expire()
+	if err := server.Conn().Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Fatalf("call after the session expired: %v", err)
+	}
+
+	if id := transport.SessionID(); id != "session-2" {
+		t.Errorf("session id = %q, want session-2", id)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.initialized != 2 {
+		t.Errorf("initialized %d times, want 2", fake.initialized)
+	}
+}
@@ -0,0 +1,353 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// JSON-RPC error codes
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternal       = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// IsRequest reports whether the message is a request expecting a response
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether the message is a notification
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether the message is a response to a request
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// RPCError is a JSON-RPC error object
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// RequestHandler answers a request sent by the other side
+type RequestHandler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// NotificationHandler handles a notification sent by the other side
+type NotificationHandler func(params json.RawMessage)
+
+// Conn is a JSON-RPC session over a Transport. It assigns request ids,
+// matches responses to pending calls and dispatches incoming requests and
+// notifications to registered handlers.
+type Conn struct {
+	transport Transport
+	nextID    int64
+
+	pending map[int64]chan *Message
+	mu      sync.Mutex
+
+	requestHandlers      map[string]RequestHandler
+	notificationHandlers map[string]NotificationHandler
+	handlersMu           sync.RWMutex
+
+	// Cancels handlers for incoming requests, keyed by raw id
+	inflight   map[string]context.CancelFunc
+	inflightMu sync.Mutex
+
+	done      chan struct{}
+	closeErr  error
+	closeOnce sync.Once
+}
+
+// NewConn starts a JSON-RPC session on the transport
+func NewConn(transport Transport) *Conn {
+	c := &Conn{
+		transport:            transport,
+		pending:              make(map[int64]chan *Message),
+		requestHandlers:      make(map[string]RequestHandler),
+		notificationHandlers: make(map[string]NotificationHandler),
+		inflight:             make(map[string]context.CancelFunc),
+		done:                 make(chan struct{}),
+	}
+
+	// Both sides must answer pings
+	c.HandleRequest("ping", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return struct{}{}, nil
+	})
+	c.HandleNotification("notifications/cancelled", c.handleCancelled)
+
+	go c.readLoop()
+	return c
+}
+
+// HandleRequest registers a handler for requests with the given method
+func (c *Conn) HandleRequest(method string, handler RequestHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.requestHandlers[method] = handler
+}
+
+// HandleNotification registers a handler for notifications with the given method
+func (c *Conn) HandleNotification(method string, handler NotificationHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.notificationHandlers[method] = handler
+}
+
+// Call sends a request and waits for its response. The result is decoded
+// into result when it is non-nil. If ctx ends first, the request is
+// cancelled on the other side.
+func (c *Conn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := atomic.AddInt64(&c.nextID, 1)
+
+	msg, err := newMessage(method, params)
+	if err != nil {
+		return err
+	}
+	msg.ID = json.RawMessage(strconv.FormatInt(id, 10))
+
+	respCh := make(chan *Message, 1)
+	c.mu.Lock()
+	c.pending[id] = respCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.transport.Send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-respCh:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("invalid %s result: %w", method, err)
+			}
+		}
+		return nil
+
+	case <-ctx.Done():
+		// Tell the other side to stop working on it
+		c.Notify(context.Background(), "notifications/cancelled", map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+
+	case <-c.done:
+		return c.Err()
+	}
+}
+
+// Notify sends a notification
+func (c *Conn) Notify(ctx context.Context, method string, params interface{}) error {
+	msg, err := newMessage(method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.Send(ctx, msg)
+}
+
+// Done is closed when the connection ends
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it is open
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.closeErr
+	default:
+		return nil
+	}
+}
+
+// Close ends the session and closes the transport
+func (c *Conn) Close() error {
+	err := c.transport.Close()
+	c.shutdown(fmt.Errorf("connection closed"))
+	return err
+}
+
+func (c *Conn) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.closeErr = err
+		close(c.done)
+
+		c.inflightMu.Lock()
+		for _, cancel := range c.inflight {
+			cancel()
+		}
+		c.inflightMu.Unlock()
+	})
+}
+
+func (c *Conn) readLoop() {
+	for msg := range c.transport.Messages() {
+		switch {
+		case msg.IsResponse():
+			c.deliver(msg)
+		case msg.IsRequest():
+			go c.handleRequest(msg)
+		case msg.IsNotification():
+			c.handleNotification(msg)
+		}
+	}
+	c.shutdown(fmt.Errorf("connection closed by server"))
+}
+
+func (c *Conn) deliver(msg *Message) {
+	id, err := parseID(msg.ID)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+
+	// A duplicate or late response must not stall the read loop
+	if ok {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func (c *Conn) handleRequest(msg *Message) {
+	c.handlersMu.RLock()
+	handler, ok := c.requestHandlers[msg.Method]
+	c.handlersMu.RUnlock()
+
+	resp := &Message{JSONRPC: "2.0", ID: msg.ID}
+
+	if !ok {
+		resp.Error = &RPCError{Code: ErrCodeMethodNotFound, Message: "method not found: " + msg.Method}
+		c.transport.Send(context.Background(), resp)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	key := string(msg.ID)
+	c.inflightMu.Lock()
+	c.inflight[key] = cancel
+	c.inflightMu.Unlock()
+
+	defer func() {
+		c.inflightMu.Lock()
+		delete(c.inflight, key)
+		c.inflightMu.Unlock()
+		cancel()
+	}()
+
+	result, err := handler(ctx, msg.Params)
+	if ctx.Err() != nil {
+		// Cancelled requests get no response
+		return
+	}
+
+	if err != nil {
+		rpcErr, ok := err.(*RPCError)
+		if !ok {
+			rpcErr = &RPCError{Code: ErrCodeInternal, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &RPCError{Code: ErrCodeInternal, Message: err.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+
+	c.transport.Send(context.Background(), resp)
+}
+
+func (c *Conn) handleNotification(msg *Message) {
+	c.handlersMu.RLock()
+	handler, ok := c.notificationHandlers[msg.Method]
+	c.handlersMu.RUnlock()
+
+	if ok {
+		handler(msg.Params)
+	}
+}
+
+// handleCancelled stops a request handler the other side gave up on
+func (c *Conn) handleCancelled(params json.RawMessage) {
+	var p struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+
+	c.inflightMu.Lock()
+	cancel, ok := c.inflight[string(p.RequestID)]
+	c.inflightMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+func newMessage(method string, params interface{}) (*Message, error) {
+	msg := &Message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s params: %w", method, err)
+		}
+		msg.Params = data
+	}
+	return msg, nil
+}
+
+// parseID reads a numeric id, accepting ids that were echoed back as strings
+func parseID(raw json.RawMessage) (int64, error) {
+	var id int64
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,180 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newConnPair connects two JSON-RPC sessions over an in-memory pipe
+func newConnPair(t *testing.T) (client, server *Conn) {
+	t.Helper()
+
+	a, b := net.Pipe()
+	client = NewConn(NewStreamTransport(a, a))
+	server = NewConn(NewStreamTransport(b, b))
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestConnMatchesConcurrentResponses(t *testing.T) {
+	client, server := newConnPair(t)
+
+	// Later requests are answered first
+	server.HandleRequest("echo", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p struct{ N int }
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Duration(10-p.N) * 5 * time.Millisecond)
+		return p, nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var result struct{ N int }
+			if err := client.Call(context.Background(), "echo", map[string]int{"N": n}, &result); err != nil {
+				errs <- err
+			} else if result.N != n {
+				errs <- errors.New("response matched to the wrong request")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConnCancelsRequestWhenContextEnds(t *testing.T) {
+	client, server := newConnPair(t)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	server.HandleRequest("slow", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	if err := client.Call(ctx, "slow", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Call error = %v, want context.Canceled", err)
+	}
+
+	// notifications/cancelled stops the handler on the other side
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server handler wasn't cancelled")
+	}
+}
+
+func TestConnAnswersPing(t *testing.T) {
+	client, server := newConnPair(t)
+
+	// Both sides answer pings without any setup
+	if err := server.Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Errorf("server ping: %v", err)
+	}
+	if err := client.Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Errorf("client ping: %v", err)
+	}
+
+	var rpcErr *RPCError
+	err := client.Call(context.Background(), "no/such/method", nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != ErrCodeMethodNotFound {
+		t.Errorf("unknown method error = %v, want method not found", err)
+	}
+}
+
+func TestConnEndsWhenTransportCloses(t *testing.T) {
+	client, server := newConnPair(t)
+
+	server.HandleRequest("hang", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		server.Close()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if err := client.Call(context.Background(), "hang", nil, nil); err == nil {
+		t.Fatal("expected an error when the connection closes mid-call")
+	}
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client connection didn't end")
+	}
+}
+
+func TestConnIgnoresDuplicateResponses(t *testing.T) {
+	a, b := net.Pipe()
+	client := NewConn(NewStreamTransport(a, a))
+	server := NewStreamTransport(b, b)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	// A misbehaving server that answers every request three times
+	go func() {
+		for msg := range server.Messages() {
+			resp := &Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(`"pong"`)}
+			for i := 0; i < 3; i++ {
+				server.Send(context.Background(), resp)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var result string
+		err := client.Call(ctx, "ping", nil, &result)
+		cancel()
+		if err != nil || result != "pong" {
+			t.Fatalf("call %d: result = %q, err = %v", i, result, err)
+		}
+	}
+
+	// A response whose caller gave up, delivered twice
+	late := &Message{JSONRPC: "2.0", ID: json.RawMessage("1000"), Result: json.RawMessage(`"late"`)}
+	client.mu.Lock()
+	client.pending[1000] = make(chan *Message, 1)
+	client.mu.Unlock()
+	delivered := make(chan struct{})
+	go func() {
+		client.deliver(late)
+		client.deliver(late)
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivering a duplicate response blocked")
+	}
+
+	client.mu.Lock()
+	pending := len(client.pending)
+	client.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d responses still pending", pending)
+	}
+}
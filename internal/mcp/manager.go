@@ -0,0 +1,333 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// Restart policy for crashed stdio servers. A server that stays up for
+// stableUptime starts over with a full set of restarts.
+const (
+	maxRestarts         = 5
+	initialRestartDelay = time.Second
+	maxRestartDelay     = 30 * time.Second
+	stableUptime        = 10 * time.Minute
+)
+
+// ServerState is the lifecycle state of a configured server
+type ServerState string
+
+const (
+	StateConnecting ServerState = "connecting"
+	StateConnected  ServerState = "connected"
+	StateRestarting ServerState = "restarting"
+	StateFailed     ServerState = "failed"
+	StateDisabled   ServerState = "disabled"
+)
+
+// ServerStatus reports the health of a configured server
+type ServerStatus struct {
+	Name      string
+	Transport string
+	State     ServerState
+	Error     string
+	Restarts  int
+	Tools     int
+	Resources int
+	Prompts   int
+	Warnings  []string // Non-fatal problems, such as failed discovery
+}
+
+// serverEntry tracks a configured server across reconnects
+type serverEntry struct {
+	cfg      config.MCPServerConfig
+	state    ServerState
+	err      error
+	restarts int
+	attempt  int // Incremented on every (re)connect to cancel stale restarts
+
+	connectedAt time.Time
+}
+
+// lifecycle holds the managed state of configured servers
+type lifecycle struct {
+	entries  map[string]*serverEntry
+	pending  sync.WaitGroup
+	closed   bool
+	onStatus func(server string)
+	mu       sync.Mutex
+
+	// How servers are connected and restart delays waited out, replaced
+	// in tests
+	dial         func(name string, cfg config.MCPServerConfig) error
+	sleep        func(d time.Duration)
+	stableUptime time.Duration
+}
+
+// SetStatusHandler sets the callback for when a server connects,
+// disconnects or fails
+func (c *Client) SetStatusHandler(handler func(server string)) {
+	c.life.mu.Lock()
+	c.life.onStatus = handler
+	c.life.mu.Unlock()
+}
+
+// Start connects to the given servers in the background. Each server
+// connects in parallel; use Wait to block until the attempts finish.
+func (c *Client) Start(servers map[string]config.MCPServerConfig) {
+	for name, cfg := range servers {
+		c.life.mu.Lock()
+		entry := &serverEntry{cfg: cfg, state: StateConnecting}
+		c.life.entries[name] = entry
+		c.life.pending.Add(1)
+		c.life.mu.Unlock()
+
+		go func(name string) {
+			defer c.life.pending.Done()
+			c.connectManaged(name, false)
+		}(name)
+	}
+}
+
+// Wait blocks until the connections started by Start have succeeded or
+// failed, or the timeout passes
+func (c *Client) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		c.life.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// Reconnect drops the current connection to a server, if any, and connects
+// again. It also re-enables a disabled server.
+func (c *Client) Reconnect(name string) error {
+	c.life.mu.Lock()
+	entry, ok := c.life.entries[name]
+	if !ok {
+		c.life.mu.Unlock()
+		return fmt.Errorf("server not found: %s", name)
+	}
+	entry.state = StateConnecting
+	entry.err = nil
+	entry.restarts = 0
+	c.life.mu.Unlock()
+
+	c.Disconnect(name)
+	c.notifyStatus(name)
+
+	return c.connectManaged(name, false)
+}
+
+// Disable disconnects a server for the rest of the session
+func (c *Client) Disable(name string) error {
+	c.life.mu.Lock()
+	entry, ok := c.life.entries[name]
+	if !ok {
+		c.life.mu.Unlock()
+		return fmt.Errorf("server not found: %s", name)
+	}
+	entry.state = StateDisabled
+	entry.err = nil
+	entry.attempt++
+	c.life.mu.Unlock()
+
+	c.Disconnect(name)
+	c.notifyStatus(name)
+	return nil
+}
+
+// Status returns the status of one configured server
+func (c *Client) Status(name string) (ServerStatus, bool) {
+	c.life.mu.Lock()
+	entry, ok := c.life.entries[name]
+	if !ok {
+		c.life.mu.Unlock()
+		return ServerStatus{}, false
+	}
+	status := ServerStatus{
+		Name:      name,
+		Transport: entry.cfg.Transport,
+		State:     entry.state,
+		Restarts:  entry.restarts,
+	}
+	if entry.err != nil {
+		status.Error = entry.err.Error()
+	}
+	c.life.mu.Unlock()
+
+	if server, ok := c.GetServer(name); ok {
+		status.Tools = len(server.ListTools())
+		status.Resources = len(server.ListResources())
+		status.Prompts = len(server.ListPrompts())
+		status.Warnings = server.Warnings()
+	}
+	return status, true
+}
+
+// Statuses returns the status of every configured server, sorted by name
+func (c *Client) Statuses() []ServerStatus {
+	c.life.mu.Lock()
+	names := make([]string, 0, len(c.life.entries))
+	for name := range c.life.entries {
+		names = append(names, name)
+	}
+	c.life.mu.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]ServerStatus, 0, len(names))
+	for _, name := range names {
+		if status, ok := c.Status(name); ok {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// connectManaged connects a configured server and watches the connection.
+// Failed restarts stay in the restarting state so the caller can retry.
+func (c *Client) connectManaged(name string, restarting bool) error {
+	c.life.mu.Lock()
+	entry := c.life.entries[name]
+	if c.life.closed || entry.state == StateDisabled {
+		c.life.mu.Unlock()
+		return nil
+	}
+	entry.attempt++
+	attempt := entry.attempt
+	cfg := entry.cfg
+	c.life.mu.Unlock()
+
+	err := c.life.dial(name, cfg)
+
+	c.life.mu.Lock()
+	if entry.attempt != attempt || c.life.closed {
+		// Superseded by a reconnect, disable or shutdown
+		c.life.mu.Unlock()
+		if err == nil {
+			c.Disconnect(name)
+		}
+		return err
+	}
+	if err != nil {
+		entry.err = err
+		if restarting {
+			c.life.mu.Unlock()
+			return err
+		}
+		entry.state = StateFailed
+	} else {
+		entry.state = StateConnected
+		entry.err = nil
+		entry.connectedAt = time.Now()
+	}
+	c.life.mu.Unlock()
+
+	if err == nil {
+		if server, ok := c.GetServer(name); ok {
+			go c.watch(name, server, attempt)
+		}
+	}
+	c.notifyStatus(name)
+	return err
+}
+
+// watch waits for a connection to end. Crashed stdio servers are restarted
+// with exponential backoff; other transports are marked failed.
+func (c *Client) watch(name string, server *Server, attempt int) {
+	<-server.conn.Done()
+
+	// Connections closed on purpose are removed from the client first
+	if current, ok := c.GetServer(name); !ok || current != server {
+		return
+	}
+	c.mu.Lock()
+	delete(c.servers, name)
+	c.mu.Unlock()
+
+	c.life.mu.Lock()
+	entry := c.life.entries[name]
+	if c.life.closed || entry.attempt != attempt {
+		c.life.mu.Unlock()
+		return
+	}
+	entry.err = fmt.Errorf("server exited: %v", server.conn.Err())
+	if entry.cfg.Transport != "stdio" {
+		entry.state = StateFailed
+		c.life.mu.Unlock()
+		c.notifyStatus(name)
+		return
+	}
+	entry.state = StateRestarting
+	if time.Since(entry.connectedAt) >= c.life.stableUptime {
+		// Only crashes in quick succession count towards giving up
+		entry.restarts = 0
+	}
+	c.life.mu.Unlock()
+	c.notifyStatus(name)
+
+	delay := initialRestartDelay
+	for {
+		c.life.mu.Lock()
+		if c.life.closed || entry.attempt != attempt {
+			c.life.mu.Unlock()
+			return
+		}
+		if entry.restarts >= maxRestarts {
+			entry.state = StateFailed
+			entry.err = fmt.Errorf("server crashed %d times, giving up: %v", entry.restarts, entry.err)
+			c.life.mu.Unlock()
+			c.notifyStatus(name)
+			return
+		}
+		entry.restarts++
+		c.life.mu.Unlock()
+
+		c.life.sleep(delay)
+
+		// Reconnect or Disable may have taken over while we slept
+		c.life.mu.Lock()
+		superseded := c.life.closed || entry.attempt != attempt
+		c.life.mu.Unlock()
+		if superseded {
+			return
+		}
+
+		if err := c.connectManaged(name, true); err == nil {
+			return
+		}
+
+		// connectManaged took the next attempt; anything newer is someone else's
+		c.life.mu.Lock()
+		if entry.attempt != attempt+1 {
+			c.life.mu.Unlock()
+			return
+		}
+		attempt = entry.attempt
+		c.life.mu.Unlock()
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+func (c *Client) notifyStatus(name string) {
+	c.life.mu.Lock()
+	handler := c.life.onStatus
+	c.life.mu.Unlock()
+
+	if handler != nil {
+		handler(name)
+	}
+}
@@ -0,0 +1,229 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// fakeDialer connects managed servers to fake servers over pipes. crash
+// ends the latest connection, as if the server process exited.
+type fakeDialer struct {
+	client *Client
+
+	mu      sync.Mutex
+	servers []*Conn
+	dials   int
+	fail    bool
+	sleeps  []time.Duration
+}
+
+// newManagedClient returns a client whose servers are dialed by a fake
+// dialer and whose restart delays are recorded instead of waited out
+func newManagedClient(t *testing.T) (*Client, *fakeDialer) {
+	t.Helper()
+	client := newTestClient(t)
+	dialer := &fakeDialer{client: client}
+	client.life.dial = dialer.dial
+	client.life.sleep = dialer.sleep
+	t.Cleanup(client.Close)
+	return client, dialer
+}
+
+func (d *fakeDialer) dial(name string, cfg config.MCPServerConfig) error {
+	d.mu.Lock()
+	d.dials++
+	fail := d.fail
+	d.mu.Unlock()
+	if fail {
+		return errors.New("failed to start server")
+	}
+
+	a, b := net.Pipe()
+	server := NewConn(NewStreamTransport(b, b))
+	server.HandleRequest("initialize", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+			ServerInfo:      Implementation{Name: "fake", Version: "1.0.0"},
+		}, nil
+	})
+	server.HandleRequest("tools/list", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return &ListToolsResult{Tools: []Tool{{Name: "search"}}}, nil
+	})
+
+	if err := d.client.ConnectTransport(name, cfg, NewStreamTransport(a, a)); err != nil {
+		server.Close()
+		return err
+	}
+	d.mu.Lock()
+	d.servers = append(d.servers, server)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *fakeDialer) sleep(delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sleeps = append(d.sleeps, delay)
+}
+
+// crash ends the latest connection from the server's side
+func (d *fakeDialer) crash() {
+	d.mu.Lock()
+	server := d.servers[len(d.servers)-1]
+	d.mu.Unlock()
+	server.Close()
+}
+
+func (d *fakeDialer) setFail(fail bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fail = fail
+}
+
+// waitForDials waits until the server has been dialed n times
+func (d *fakeDialer) waitForDials(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if dials, _ := d.stats(); dials >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server not dialed %d times", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (d *fakeDialer) stats() (dials int, sleeps []time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials, append([]time.Duration(nil), d.sleeps...)
+}
+
+// startManaged starts a stdio server named "fake" and waits for it to connect
+func startManaged(t *testing.T, client *Client) {
+	t.Helper()
+	client.Start(map[string]config.MCPServerConfig{"fake": {Transport: "stdio", Command: "fake-server"}})
+	client.Wait(5 * time.Second)
+	waitForState(t, client, StateConnected, 0)
+}
+
+// waitForState waits until the server is in state with the given restarts
+func waitForState(t *testing.T, client *Client, state ServerState, restarts int) ServerStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := client.Status("fake")
+		if status.State == state && status.Restarts == restarts {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s with %d restarts (%s), want %s with %d", status.State, status.Restarts, status.Error, state, restarts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagedServerRestartsAfterCrash(t *testing.T) {
+	client, dialer := newManagedClient(t)
+	startManaged(t, client)
+
+	dialer.crash()
+	dialer.waitForDials(t, 2)
+	status := waitForState(t, client, StateConnected, 1)
+
+	if status.Tools != 1 {
+		t.Errorf("tools = %d after restart, want the server's tools again", status.Tools)
+	}
+	dials, sleeps := dialer.stats()
+	if dials != 2 || !reflect.DeepEqual(sleeps, []time.Duration{initialRestartDelay}) {
+		t.Errorf("dials = %d, sleeps = %v, want one restart after %v", dials, sleeps, initialRestartDelay)
+	}
+}
+
+func TestManagedServerBacksOffAndGivesUp(t *testing.T) {
+	client, dialer := newManagedClient(t)
+	startManaged(t, client)
+
+	dialer.setFail(true)
+	dialer.crash()
+	status := waitForState(t, client, StateFailed, maxRestarts)
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
+	if _, sleeps := dialer.stats(); !reflect.DeepEqual(sleeps, want) {
+		t.Errorf("sleeps = %v, want %v", sleeps, want)
+	}
+	if status.Error == "" {
+		t.Error("no error reported for the failed server")
+	}
+	if _, ok := client.GetServer("fake"); ok {
+		t.Error("failed server still registered")
+	}
+
+	// Reconnect starts over
+	dialer.setFail(false)
+	if err := client.Reconnect("fake"); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, client, StateConnected, 0)
+}
+
+func TestManagedServerRestartsResetAfterStableUptime(t *testing.T) {
+	client, dialer := newManagedClient(t)
+	client.life.stableUptime = 50 * time.Millisecond
+	startManaged(t, client)
+
+	dialer.crash()
+	dialer.waitForDials(t, 2)
+	waitForState(t, client, StateConnected, 1)
+
+	// A crash after staying up a while starts the count over
+	time.Sleep(100 * time.Millisecond)
+	dialer.crash()
+	dialer.waitForDials(t, 3)
+	waitForState(t, client, StateConnected, 1)
+
+	if _, sleeps := dialer.stats(); !reflect.DeepEqual(sleeps, []time.Duration{initialRestartDelay, initialRestartDelay}) {
+		t.Errorf("sleeps = %v, want both restarts after the initial delay", sleeps)
+	}
+}
+
+func TestDisabledServerStaysDown(t *testing.T) {
+	client, dialer := newManagedClient(t)
+	startManaged(t, client)
+
+	if err := client.Disable("fake"); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, client, StateDisabled, 0)
+	if _, ok := client.GetServer("fake"); ok {
+		t.Error("disabled server still registered")
+	}
+
+	// Closing the disabled server's connection doesn't restart it
+	dialer.crash()
+	time.Sleep(50 * time.Millisecond)
+	if dials, _ := dialer.stats(); dials != 1 {
+		t.Errorf("dials = %d, want the disabled server left alone", dials)
+	}
+	waitForState(t, client, StateDisabled, 0)
+
+	// Reconnect enables it again
+	if err := client.Reconnect("fake"); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, client, StateConnected, 0)
+	if err := client.Disable("missing"); err == nil {
+		t.Error("disabling an unknown server succeeded")
+	}
+}
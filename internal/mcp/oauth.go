@@ -0,0 +1,606 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// authorizeTimeout bounds how long we wait for the user to finish logging in
+const authorizeTimeout = 5 * time.Minute
+
+// Credentials are the stored OAuth client and tokens for one server
+type Credentials struct {
+	ClientID      string    `json:"clientId,omitempty"`
+	ClientSecret  string    `json:"clientSecret,omitempty"`
+	TokenEndpoint string    `json:"tokenEndpoint,omitempty"`
+	AccessToken   string    `json:"accessToken,omitempty"`
+	RefreshToken  string    `json:"refreshToken,omitempty"`
+	ExpiresAt     time.Time `json:"expiresAt,omitempty"`
+	Resource      string    `json:"resource,omitempty"` // The URI tokens are bound to
+}
+
+// expired reports whether the access token is missing or about to expire
+func (c *Credentials) expired() bool {
+	if c.AccessToken == "" {
+		return true
+	}
+	return !c.ExpiresAt.IsZero() && time.Now().Add(30*time.Second).After(c.ExpiresAt)
+}
+
+// TokenStore persists OAuth credentials keyed by server URL
+type TokenStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewTokenStore creates a token store backed by the given file
+func NewTokenStore(path string) *TokenStore {
+	return &TokenStore{path: path}
+}
+
+// DefaultTokenStore returns the token store in the user config directory
+func DefaultTokenStore() *TokenStore {
+	return NewTokenStore(config.GetMCPAuthPath())
+}
+
+// Load returns the credentials for a server, or nil if there are none
+func (s *TokenStore) Load(serverURL string) *Credentials {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.readAll()
+	if creds, ok := all[serverURL]; ok {
+		return &creds
+	}
+	return nil
+}
+
+// Save stores the credentials for a server
+func (s *TokenStore) Save(serverURL string, creds *Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.readAll()
+	all[serverURL] = *creds
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	// Tokens are secrets
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// Delete removes the credentials for a server
+func (s *TokenStore) Delete(serverURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.readAll()
+	if _, ok := all[serverURL]; !ok {
+		return nil
+	}
+	delete(all, serverURL)
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *TokenStore) readAll() map[string]Credentials {
+	all := make(map[string]Credentials)
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		json.Unmarshal(data, &all)
+	}
+	return all
+}
+
+// OAuthClient runs the OAuth 2.1 authorization code flow with PKCE for a
+// remote MCP server, using a loopback redirect, and keeps its tokens fresh
+type OAuthClient struct {
+	serverURL  string
+	cfg        config.MCPOAuthConfig
+	store      *TokenStore
+	httpClient *http.Client
+
+	// OpenBrowser shows the authorization URL to the user
+	OpenBrowser func(authURL string) error
+
+	creds *Credentials
+	mu    sync.Mutex
+}
+
+// NewOAuthClient creates an OAuth client for a server. cfg may be nil.
+func NewOAuthClient(serverURL string, cfg *config.MCPOAuthConfig, store *TokenStore) *OAuthClient {
+	o := &OAuthClient{
+		serverURL:   serverURL,
+		store:       store,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		OpenBrowser: openBrowser,
+	}
+	if cfg != nil {
+		o.cfg = *cfg
+	}
+	if store != nil {
+		o.creds = store.Load(serverURL)
+	}
+	return o
+}
+
+// AccessToken returns a valid access token, refreshing it if needed. It
+// returns "" when the user hasn't authorized yet.
+func (o *OAuthClient) AccessToken(ctx context.Context) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.creds == nil {
+		return ""
+	}
+	if o.creds.expired() && o.creds.RefreshToken != "" {
+		if err := o.refresh(ctx); err != nil {
+			return ""
+		}
+	}
+	return o.creds.AccessToken
+}
+
+// Authorize runs the interactive flow after the server rejected failedToken.
+// If another caller already replaced that token, it returns immediately.
+func (o *OAuthClient) Authorize(ctx context.Context, challenge, failedToken string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.creds != nil && o.creds.AccessToken != "" && o.creds.AccessToken != failedToken && !o.creds.expired() {
+		return nil
+	}
+
+	// A refresh token may still work
+	if o.creds != nil && o.creds.RefreshToken != "" && o.creds.AccessToken == failedToken {
+		if err := o.refresh(ctx); err == nil {
+			return nil
+		}
+	}
+
+	return o.authorize(ctx, challenge)
+}
+
+// authServerMetadata is the subset of RFC 8414 metadata we use
+type authServerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	RegistrationEndpoint  string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+}
+
+// resourceMetadata is the subset of RFC 9728 metadata we use
+type resourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported,omitempty"`
+}
+
+// tokenResponse is an OAuth token endpoint response
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Description  string `json:"error_description,omitempty"`
+}
+
+func (o *OAuthClient) authorize(ctx context.Context, challenge string) error {
+	resource, err := o.discoverResource(ctx, challenge)
+	if err != nil {
+		return err
+	}
+
+	issuer := originOf(o.serverURL)
+	if len(resource.AuthorizationServers) > 0 {
+		issuer = resource.AuthorizationServers[0]
+	}
+
+	meta, err := o.discoverAuthServer(ctx, issuer)
+	if err != nil {
+		return err
+	}
+
+	// The loopback listener must exist before registering its redirect URI
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", o.cfg.CallbackPort))
+	if err != nil {
+		return fmt.Errorf("failed to start callback listener: %w", err)
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	creds := &Credentials{TokenEndpoint: meta.TokenEndpoint, Resource: o.resourceURI(resource)}
+	switch {
+	case o.cfg.ClientID != "":
+		creds.ClientID = o.cfg.ClientID
+		creds.ClientSecret = o.cfg.ClientSecret
+	case o.creds != nil && o.creds.ClientID != "":
+		creds.ClientID = o.creds.ClientID
+		creds.ClientSecret = o.creds.ClientSecret
+	case meta.RegistrationEndpoint != "":
+		if err := o.register(ctx, meta.RegistrationEndpoint, redirectURI, creds); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("server requires a client ID; set oauth.clientId in the server config")
+	}
+
+	verifier := randomString(32)
+	state := randomString(16)
+
+	scopes := o.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = resource.ScopesSupported
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {creds.ClientID},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		"resource":              {o.resourceURI(resource)},
+	}
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+
+	authURL := meta.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+
+	code, err := o.waitForCode(ctx, listener, authURL, state)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {creds.ClientID},
+		"code_verifier": {verifier},
+		"resource":      {o.resourceURI(resource)},
+	}
+	if err := o.requestToken(ctx, creds, form); err != nil {
+		return err
+	}
+
+	o.creds = creds
+	return o.save()
+}
+
+// waitForCode sends the user to the authorization URL and waits for the
+// redirect back to the loopback listener
+func (o *OAuthClient) waitForCode(ctx context.Context, listener net.Listener, authURL, state string) (string, error) {
+	type callback struct {
+		code string
+		err  error
+	}
+	results := make(chan callback, 1)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		var result callback
+		switch {
+		case q.Get("error") != "":
+			result.err = fmt.Errorf("authorization denied: %s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("state") != state:
+			result.err = fmt.Errorf("authorization state mismatch")
+		case q.Get("code") == "":
+			result.err = fmt.Errorf("authorization response has no code")
+		default:
+			result.code = q.Get("code")
+		}
+
+		if result.err != nil {
+			fmt.Fprintf(w, "Authorization failed: %v. You can close this window.", result.err)
+		} else {
+			fmt.Fprint(w, "Authorization complete. You can close this window and return to oscode.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})}
+
+	go server.Serve(listener)
+	defer server.Close()
+
+	if err := o.OpenBrowser(authURL); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authorizeTimeout)
+	defer cancel()
+
+	select {
+	case result := <-results:
+		return result.code, result.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("timed out waiting for authorization")
+	}
+}
+
+// refresh exchanges the refresh token for a new access token
+func (o *OAuthClient) refresh(ctx context.Context) error {
+	creds := *o.creds
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {creds.RefreshToken},
+		"client_id":     {creds.ClientID},
+		"resource":      {o.resourceURI(&resourceMetadata{Resource: creds.Resource})},
+	}
+	if err := o.requestToken(ctx, &creds, form); err != nil {
+		return err
+	}
+
+	o.creds = &creds
+	return o.save()
+}
+
+func (o *OAuthClient) requestToken(ctx context.Context, creds *Credentials, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", creds.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if creds.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(creds.ClientID), url.QueryEscape(creds.ClientSecret))
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.Error != "" {
+		return fmt.Errorf("token request failed: %s %s", token.Error, token.Description)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return fmt.Errorf("token request failed: %s", resp.Status)
+	}
+
+	creds.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		creds.RefreshToken = token.RefreshToken
+	}
+	creds.ExpiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		creds.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return nil
+}
+
+// register performs RFC 7591 dynamic client registration
+func (o *OAuthClient) register(ctx context.Context, endpoint, redirectURI string, creds *Credentials) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"client_name":                "oscode",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("client registration failed: %s %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var reg struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+		return fmt.Errorf("invalid registration response: %w", err)
+	}
+
+	creds.ClientID = reg.ClientID
+	creds.ClientSecret = reg.ClientSecret
+	return nil
+}
+
+// discoverResource fetches the server's protected resource metadata. Older
+// servers don't publish it, in which case the server is its own issuer.
+func (o *OAuthClient) discoverResource(ctx context.Context, challenge string) (*resourceMetadata, error) {
+	var candidates []string
+	if metaURL := challengeParam(challenge, "resource_metadata"); metaURL != "" {
+		candidates = append(candidates, metaURL)
+	}
+
+	u, err := url.Parse(o.serverURL)
+	if err != nil {
+		return nil, err
+	}
+	origin := originOf(o.serverURL)
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		candidates = append(candidates, origin+"/.well-known/oauth-protected-resource"+path)
+	}
+	candidates = append(candidates, origin+"/.well-known/oauth-protected-resource")
+
+	for _, candidate := range candidates {
+		var meta resourceMetadata
+		if err := o.getJSON(ctx, candidate, &meta); err == nil && len(meta.AuthorizationServers) > 0 {
+			return &meta, nil
+		}
+	}
+
+	return &resourceMetadata{}, nil
+}
+
+// discoverAuthServer fetches authorization server metadata, falling back to
+// the default endpoint paths when none is published
+func (o *OAuthClient) discoverAuthServer(ctx context.Context, issuer string) (*authServerMetadata, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+	origin := originOf(issuer)
+	path := strings.TrimSuffix(u.Path, "/")
+
+	candidates := []string{
+		origin + "/.well-known/oauth-authorization-server" + path,
+		origin + "/.well-known/openid-configuration" + path,
+	}
+	if path != "" {
+		candidates = append(candidates, origin+path+"/.well-known/openid-configuration")
+	}
+
+	for _, candidate := range candidates {
+		var meta authServerMetadata
+		if err := o.getJSON(ctx, candidate, &meta); err == nil && meta.AuthorizationEndpoint != "" && meta.TokenEndpoint != "" {
+			return &meta, nil
+		}
+	}
+
+	return &authServerMetadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: origin + "/authorize",
+		TokenEndpoint:         origin + "/token",
+		RegistrationEndpoint:  origin + "/register",
+	}, nil
+}
+
+func (o *OAuthClient) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// resourceURI is the canonical URI tokens are bound to
+func (o *OAuthClient) resourceURI(meta *resourceMetadata) string {
+	if meta.Resource != "" {
+		return meta.Resource
+	}
+	return o.serverURL
+}
+
+func (o *OAuthClient) save() error {
+	if o.store == nil {
+		return nil
+	}
+	return o.store.Save(o.serverURL, o.creds)
+}
+
+// challengeParam extracts a parameter from a WWW-Authenticate header
+func challengeParam(challenge, name string) string {
+	for _, part := range strings.Split(challenge, ",") {
+		part = strings.TrimSpace(part)
+		part = strings.TrimPrefix(part, "Bearer ")
+		key, value, ok := strings.Cut(part, "=")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// openBrowser prints the URL and tries to open it in the default browser
+func openBrowser(authURL string) error {
+	fmt.Fprintf(os.Stderr, "Opening browser to authorize the MCP server. If it doesn't open, visit:\n%s\n", authURL)
+	return launchBrowser(authURL)
+}
+
+// launchBrowser opens a URL in the default browser
+func launchBrowser(authURL string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", authURL)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", authURL)
+	default:
+		cmd = exec.Command("xdg-open", authURL)
+	}
+	// The URL is shown as well, so a missing opener isn't fatal
+	cmd.Start()
+	return nil
+}
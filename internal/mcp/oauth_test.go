@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// fakeAuthServer is an MCP endpoint protected by an OAuth authorization
+// server on the same origin
+type fakeAuthServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	forms []url.Values // Token requests
+}
+
+func newFakeAuthServer(t *testing.T) *fakeAuthServer {
+	t.Helper()
+
+	f := &fakeAuthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resource":              f.URL + "/mcp",
+			"authorization_servers": []string{f.URL},
+		})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(authServerMetadata{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		f.forms = append(f.forms, r.PostForm)
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(tokenResponse{
+			AccessToken:  "token-" + r.PostForm.Get("grant_type"),
+			RefreshToken: "refresh",
+			ExpiresIn:    3600,
+		})
+	})
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-authorization_code" {
+			w.Header().Set("WWW-Authenticate", `Bearer resource_metadata="`+f.URL+`/.well-known/oauth-protected-resource/mcp"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAuthServer) tokenForms() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.forms...)
+}
+
+func TestOAuthAuthorizesAfterUnauthorized(t *testing.T) {
+	srv := newFakeAuthServer(t)
+	store := NewTokenStore(filepath.Join(t.TempDir(), "auth.json"))
+	auth := NewOAuthClient(srv.URL+"/mcp", &config.MCPOAuthConfig{ClientID: "oscode-test"}, store)
+
+	// Stand in for the user approving in the browser
+	auth.OpenBrowser = func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		if q.Get("resource") != srv.URL+"/mcp" || q.Get("code_challenge_method") != "S256" {
+			t.Errorf("unexpected authorization URL %s", authURL)
+		}
+		go func() {
+			resp, err := http.Get(q.Get("redirect_uri") + "?code=abc&state=" + url.QueryEscape(q.Get("state")))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+
+	ctx := context.Background()
+	resp, err := doWithAuth(ctx, http.DefaultClient, auth, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "POST", srv.URL+"/mcp", nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after authorizing = %s, want 200", resp.Status)
+	}
+
+	forms := srv.tokenForms()
+	if len(forms) != 1 || forms[0].Get("code") != "abc" || forms[0].Get("code_verifier") == "" {
+		t.Fatalf("token requests = %v, want one code exchange", forms)
+	}
+
+	// Tokens are saved for the next session
+	if creds := store.Load(srv.URL + "/mcp"); creds == nil || creds.AccessToken != "token-authorization_code" {
+		t.Errorf("stored credentials = %+v", creds)
+	}
+}
+
+func TestOAuthRefreshSendsResource(t *testing.T) {
+	srv := newFakeAuthServer(t)
+	store := NewTokenStore(filepath.Join(t.TempDir(), "auth.json"))
+	serverURL := srv.URL + "/mcp/"
+	store.Save(serverURL, &Credentials{
+		ClientID:      "oscode-test",
+		TokenEndpoint: srv.URL + "/token",
+		AccessToken:   "stale",
+		RefreshToken:  "refresh",
+		ExpiresAt:     time.Now().Add(-time.Minute),
+		Resource:      srv.URL + "/mcp",
+	})
+
+	auth := NewOAuthClient(serverURL, nil, store)
+	if token := auth.AccessToken(context.Background()); token != "token-refresh_token" {
+		t.Fatalf("access token = %q, want a refreshed one", token)
+	}
+
+	forms := srv.tokenForms()
+	if len(forms) != 1 {
+		t.Fatalf("got %d token requests, want 1", len(forms))
+	}
+	// The token stays bound to the resource it was issued for
+	if resource := forms[0].Get("resource"); resource != srv.URL+"/mcp" {
+		t.Errorf("refresh resource = %q, want %q", resource, srv.URL+"/mcp")
+	}
+}
@@ -0,0 +1,187 @@
+package mcp
+
+import "encoding/json"
+
+// ProtocolVersion is the MCP protocol revision this client speaks
+const ProtocolVersion = "2025-06-18"
+
+// Implementation identifies a client or server
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams is sent by the client to start a session
+type InitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+// InitializeResult is the server's answer to initialize
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ServerCapabilities lists the features a server supports
+type ServerCapabilities struct {
+	Tools     *ListChangedCapability `json:"tools,omitempty"`
+	Resources *ListChangedCapability `json:"resources,omitempty"`
+	Prompts   *ListChangedCapability `json:"prompts,omitempty"`
+	Logging   map[string]interface{} `json:"logging,omitempty"`
+}
+
+// ListChangedCapability marks a feature that can notify about list changes
+type ListChangedCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+	Subscribe   bool `json:"subscribe,omitempty"`
+}
+
+// ListToolsResult is a page of tools/list
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Progress is a notifications/progress update for a running request
+type Progress struct {
+	ProgressToken interface{} `json:"progressToken"`
+	Progress      float64     `json:"progress"`
+	Total         float64     `json:"total,omitempty"`
+	Message       string      `json:"message,omitempty"`
+}
+
+// Root is a directory the client exposes to servers via roots/list
+type Root struct {
+	URI  string `json:"uri"`
+	Name string `json:"name,omitempty"`
+}
+
+// SamplingContent is a content block in a sampling message
+type SamplingContent struct {
+	Type     string `json:"type"` // "text" or "image"
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// SamplingMessage is a message in a sampling/createMessage request
+type SamplingMessage struct {
+	Role    string          `json:"role"`
+	Content SamplingContent `json:"content"`
+}
+
+// CreateMessageRequest asks the client to sample from its LLM
+type CreateMessageRequest struct {
+	Messages      []SamplingMessage `json:"messages"`
+	SystemPrompt  string            `json:"systemPrompt,omitempty"`
+	MaxTokens     int               `json:"maxTokens"`
+	Temperature   float64           `json:"temperature,omitempty"`
+	StopSequences []string          `json:"stopSequences,omitempty"`
+}
+
+// CreateMessageResult is the client's sampled response
+type CreateMessageResult struct {
+	Role       string          `json:"role"`
+	Content    SamplingContent `json:"content"`
+	Model      string          `json:"model"`
+	StopReason string          `json:"stopReason,omitempty"`
+}
+
+// ListResourcesResult is a page of resources/list
+type ListResourcesResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ResourceContents is the content of a resource. Text resources set Text;
+// binary resources set Blob to base64 data.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// ReadResourceResult is the server's answer to resources/read
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// Prompt is a prompt template offered by a server
+type Prompt struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument describes an argument a prompt accepts
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// ListPromptsResult is a page of prompts/list
+type ListPromptsResult struct {
+	Prompts    []Prompt `json:"prompts"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// PromptContent is a content block in a prompt message
+type PromptContent struct {
+	Type     string            `json:"type"` // "text", "image", "audio" or "resource"
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// PromptMessage is a message produced by prompts/get
+type PromptMessage struct {
+	Role    string        `json:"role"`
+	Content PromptContent `json:"content"`
+}
+
+// GetPromptResult is the server's answer to prompts/get
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// ToolAnnotations are hints about a tool's behavior
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  bool   `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+// CallToolParams is sent by the client to run a tool
+type CallToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// ToolContent is a content block in a tool result
+type ToolContent struct {
+	Type     string            `json:"type"` // "text", "image", "audio", "resource" or "resource_link"
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+	URI      string            `json:"uri,omitempty"`  // For resource links
+	Name     string            `json:"name,omitempty"` // For resource links
+}
+
+// CallToolResult is the server's answer to tools/call
+type CallToolResult struct {
+	Content           []ToolContent   `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
@@ -0,0 +1,187 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// ListResourcesTool lets the model discover resources on connected servers
+type ListResourcesTool struct {
+	tools.BaseTool
+	client *Client
+}
+
+// NewListResourcesTool creates the ListMcpResources tool
+func NewListResourcesTool(client *Client) *ListResourcesTool {
+	return &ListResourcesTool{
+		BaseTool: tools.NewBaseTool(
+			"ListMcpResources",
+			"Lists resources (documents, files, records) exposed by connected MCP servers. Read one with ReadMcpResource.",
+			tools.BuildSchema(map[string]interface{}{
+				"server": tools.StringProperty("Only list resources from this server", false),
+			}, nil),
+			false,
+			tools.CategorySearch,
+		),
+		client: client,
+	}
+}
+
+func (t *ListResourcesTool) Execute(ctx context.Context, input json.RawMessage) (*tools.Result, error) {
+	var params struct {
+		Server string `json:"server"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return tools.NewErrorResult(fmt.Errorf("invalid input: %w", err)), nil
+	}
+
+	var sb strings.Builder
+	for _, server := range t.client.Servers() {
+		if params.Server != "" && server.Name != params.Server {
+			continue
+		}
+		for _, r := range server.ListResources() {
+			sb.WriteString(fmt.Sprintf("%s:%s", server.Name, r.URI))
+			if r.Name != "" {
+				sb.WriteString(" - " + r.Name)
+			}
+			if r.Description != "" {
+				sb.WriteString(": " + r.Description)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if sb.Len() == 0 {
+		if params.Server != "" {
+			return tools.NewResult(fmt.Sprintf("No resources found on server %s.", params.Server)), nil
+		}
+		return tools.NewResult("No resources found."), nil
+	}
+	return tools.NewResult(sb.String()), nil
+}
+
+// ReadResourceTool lets the model read a resource from a connected server
+type ReadResourceTool struct {
+	tools.BaseTool
+	client *Client
+}
+
+// NewReadResourceTool creates the ReadMcpResource tool
+func NewReadResourceTool(client *Client) *ReadResourceTool {
+	return &ReadResourceTool{
+		BaseTool: tools.NewBaseTool(
+			"ReadMcpResource",
+			"Reads a resource from a connected MCP server by its URI. Use ListMcpResources to find available resources.",
+			tools.BuildSchema(map[string]interface{}{
+				"server": tools.StringProperty("The MCP server name", true),
+				"uri":    tools.StringProperty("The resource URI", true),
+			}, []string{"server", "uri"}),
+			false,
+			tools.CategorySearch,
+		),
+		client: client,
+	}
+}
+
+func (t *ReadResourceTool) Execute(ctx context.Context, input json.RawMessage) (*tools.Result, error) {
+	var params struct {
+		Server string `json:"server"`
+		URI    string `json:"uri"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return tools.NewErrorResult(fmt.Errorf("invalid input: %w", err)), nil
+	}
+
+	if params.Server == "" || params.URI == "" {
+		return tools.NewErrorResultString("server and uri are required"), nil
+	}
+
+	server, ok := t.client.GetServer(params.Server)
+	if !ok {
+		return tools.NewErrorResultString(fmt.Sprintf("MCP server not found: %s", params.Server)), nil
+	}
+
+	result, err := server.ReadResource(ctx, params.URI)
+	if err != nil {
+		return tools.NewErrorResult(err), nil
+	}
+
+	return tools.NewResult(FormatResourceContents(result.Contents)), nil
+}
+
+// FormatResourceContents renders resource contents as text. Binary content
+// is summarized rather than inlined.
+func FormatResourceContents(contents []ResourceContents) string {
+	var parts []string
+	for _, c := range contents {
+		if c.Text != "" || c.Blob == "" {
+			parts = append(parts, c.Text)
+			continue
+		}
+
+		size := base64.StdEncoding.DecodedLen(len(c.Blob))
+		mimeType := c.MimeType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		parts = append(parts, fmt.Sprintf("[binary resource %s: %s, ~%d bytes]", c.URI, mimeType, size))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// PromptMessages converts a rendered prompt into conversation messages,
+// merging consecutive messages from the same role
+func PromptMessages(result *GetPromptResult) []llm.Message {
+	var messages []llm.Message
+	for _, pm := range result.Messages {
+		role := llm.RoleUser
+		if pm.Role == "assistant" {
+			role = llm.RoleAssistant
+		}
+
+		var block llm.ContentBlock
+		switch pm.Content.Type {
+		case "image":
+			block = llm.ContentBlock{
+				Type: llm.ContentTypeImage,
+				Image: &llm.ImageBlock{
+					Type:      "base64",
+					MediaType: pm.Content.MimeType,
+					Data:      pm.Content.Data,
+				},
+			}
+		case "resource":
+			if pm.Content.Resource == nil {
+				continue
+			}
+			block = llm.ContentBlock{
+				Type: llm.ContentTypeText,
+				Text: fmt.Sprintf("<resource uri=%q>\n%s\n</resource>", pm.Content.Resource.URI, FormatResourceContents([]ResourceContents{*pm.Content.Resource})),
+			}
+		case "text":
+			block = llm.ContentBlock{Type: llm.ContentTypeText, Text: pm.Content.Text}
+		default:
+			continue
+		}
+
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, block)
+			continue
+		}
+		messages = append(messages, llm.Message{Role: role, Content: []llm.ContentBlock{block}})
+	}
+	return messages
+}
+
+// Ensure resource tools implement tools.Tool
+var (
+	_ tools.Tool = (*ListResourcesTool)(nil)
+	_ tools.Tool = (*ReadResourceTool)(nil)
+)
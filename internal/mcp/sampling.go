@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/heissanjay/oscode/internal/llm"
+)
+
+// NewProviderSamplingHandler answers sampling requests with an LLM provider
+func NewProviderSamplingHandler(provider llm.Provider, model string) SamplingHandler {
+	return func(ctx context.Context, req *CreateMessageRequest) (*CreateMessageResult, error) {
+		messages := make([]llm.Message, 0, len(req.Messages))
+		for _, m := range req.Messages {
+			msg := llm.Message{Role: llm.RoleUser}
+			if m.Role == "assistant" {
+				msg.Role = llm.RoleAssistant
+			}
+
+			switch m.Content.Type {
+			case "text":
+				msg.AddText(m.Content.Text)
+			case "image":
+				msg.Content = append(msg.Content, llm.ContentBlock{
+					Type: llm.ContentTypeImage,
+					Image: &llm.ImageBlock{
+						Type:      "base64",
+						MediaType: m.Content.MimeType,
+						Data:      m.Content.Data,
+					},
+				})
+			default:
+				return nil, fmt.Errorf("unsupported sampling content type: %s", m.Content.Type)
+			}
+			messages = append(messages, msg)
+		}
+
+		maxTokens := req.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = 1024
+		}
+
+		resp, err := provider.Chat(ctx, &llm.ChatRequest{
+			Model:         model,
+			Messages:      messages,
+			SystemPrompt:  req.SystemPrompt,
+			MaxTokens:     maxTokens,
+			Temperature:   req.Temperature,
+			StopSequences: req.StopSequences,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var text strings.Builder
+		for _, block := range resp.Content {
+			if block.Type == llm.ContentTypeText {
+				text.WriteString(block.Text)
+			}
+		}
+
+		return &CreateMessageResult{
+			Role:       "assistant",
+			Content:    SamplingContent{Type: "text", Text: text.String()},
+			Model:      resp.Model,
+			StopReason: resp.StopReason,
+		}, nil
+	}
+}
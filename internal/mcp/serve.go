@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heissanjay/oscode/internal/permissions"
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// ToolServer exposes a tool registry to MCP clients
+type ToolServer struct {
+	registry *tools.Registry
+	info     Implementation
+}
+
+// NewToolServer creates a server for the tools in registry
+func NewToolServer(registry *tools.Registry, info Implementation) *ToolServer {
+	return &ToolServer{
+		registry: registry,
+		info:     info,
+	}
+}
+
+// Serve answers requests on the transport until the client disconnects.
+// It returns the error that ended the connection, if it didn't end cleanly.
+func (s *ToolServer) Serve(transport Transport) error {
+	conn := NewConn(transport)
+	conn.HandleRequest("initialize", s.handleInitialize)
+	conn.HandleRequest("tools/list", s.handleListTools)
+	conn.HandleRequest("tools/call", s.handleCallTool)
+
+	<-conn.Done()
+	if stream, ok := transport.(*StreamTransport); ok && stream.Err() != nil {
+		return fmt.Errorf("failed to read from client: %w", stream.Err())
+	}
+	return nil
+}
+
+func (s *ToolServer) handleInitialize(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req InitializeParams
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, &RPCError{Code: ErrCodeInvalidParams, Message: err.Error()}
+	}
+
+	// Tools work the same in every revision, so agree to the client's
+	version := req.ProtocolVersion
+	if version == "" {
+		version = ProtocolVersion
+	}
+
+	return &InitializeResult{
+		ProtocolVersion: version,
+		Capabilities: ServerCapabilities{
+			Tools: &ListChangedCapability{},
+		},
+		ServerInfo: s.info,
+	}, nil
+}
+
+func (s *ToolServer) handleListTools(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	registered := s.registry.List()
+	result := &ListToolsResult{Tools: make([]Tool, 0, len(registered))}
+	for _, tool := range registered {
+		result.Tools = append(result.Tools, Tool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.InputSchema(),
+			Annotations: &ToolAnnotations{
+				ReadOnlyHint: !permissions.IsMutatingOperation(tool.Name(), nil),
+			},
+		})
+	}
+	return result, nil
+}
+
+func (s *ToolServer) handleCallTool(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req CallToolParams
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, &RPCError{Code: ErrCodeInvalidParams, Message: err.Error()}
+	}
+	if _, ok := s.registry.Get(req.Name); !ok {
+		return nil, &RPCError{Code: ErrCodeInvalidParams, Message: "unknown tool: " + req.Name}
+	}
+
+	arguments := req.Arguments
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+
+	// Permission checks and hooks run as they do for the model's own calls;
+	// failures come back as error results the client can show
+	result, err := s.registry.Execute(ctx, req.Name, arguments)
+	if err != nil {
+		result = tools.NewErrorResult(err)
+	}
+
+	content := []ToolContent{}
+	if result.Content != "" {
+		content = append(content, ToolContent{Type: "text", Text: result.Content})
+	}
+	return &CallToolResult{Content: content, IsError: result.IsError}, nil
+}
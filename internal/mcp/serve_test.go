@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/tools"
+)
+
+// discardCloser is an output stream nobody reads
+type discardCloser struct{ io.Writer }
+
+func (discardCloser) Close() error { return nil }
+
+func TestToolServer(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("remember the milk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := tools.NewRegistry()
+	registry.Register(tools.NewWriteTool(dir))
+	registry.Register(tools.NewReadTool(dir))
+
+	serverSide, clientSide := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		server := NewToolServer(registry, Implementation{Name: "oscode", Version: "test"})
+		served <- server.Serve(NewStreamTransport(serverSide, serverSide))
+	}()
+	client := NewConn(NewStreamTransport(clientSide, clientSide))
+	ctx := context.Background()
+
+	var initialized InitializeResult
+	if err := client.Call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: "2025-03-26",
+		ClientInfo:      Implementation{Name: "test-client", Version: "1.0.0"},
+	}, &initialized); err != nil {
+		t.Fatal(err)
+	}
+	if initialized.ServerInfo.Name != "oscode" || initialized.ProtocolVersion != "2025-03-26" || initialized.Capabilities.Tools == nil {
+		t.Errorf("initialize = %+v, want oscode offering tools in the client's version", initialized)
+	}
+
+	var list ListToolsResult
+	if err := client.Call(ctx, "tools/list", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	readOnly := map[string]bool{}
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		readOnly[tool.Name] = tool.Annotations != nil && tool.Annotations.ReadOnlyHint
+		if tool.InputSchema == nil {
+			t.Errorf("%s has no input schema", tool.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"Read", "Write"}) {
+		t.Errorf("tools = %v, want Read and Write in order", names)
+	}
+	if !readOnly["Read"] || readOnly["Write"] {
+		t.Errorf("read-only hints = %v, want only Read", readOnly)
+	}
+
+	var result CallToolResult
+	if err := client.Call(ctx, "tools/call", CallToolParams{
+		Name:      "Read",
+		Arguments: json.RawMessage(`{"file_path": "` + notes + `"}`),
+	}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, "remember the milk") {
+		t.Errorf("tools/call = %+v, want the file's content", result)
+	}
+
+	err := client.Call(ctx, "tools/call", CallToolParams{Name: "Delete"}, &result)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != ErrCodeInvalidParams {
+		t.Errorf("calling an unknown tool: err = %v, want invalid params", err)
+	}
+
+	// The client hanging up is a clean end
+	client.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() = %v, want nil when the client disconnects", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return after the client disconnected")
+	}
+}
+
+func TestToolServerReturnsReadError(t *testing.T) {
+	r, w := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		server := NewToolServer(tools.NewRegistry(), Implementation{Name: "oscode"})
+		served <- server.Serve(NewStreamTransport(r, discardCloser{io.Discard}))
+	}()
+
+	w.CloseWithError(errors.New("stdin is broken"))
+	select {
+	case err := <-served:
+		if err == nil || !strings.Contains(err.Error(), "stdin is broken") {
+			t.Errorf("Serve() = %v, want the read error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return after the read failed")
+	}
+}
@@ -0,0 +1,258 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sseEvent is a single Server-Sent Event
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSE parses an event stream, calling fn for each event until the
+// stream ends or fn returns false
+func readSSE(r io.Reader, fn func(sseEvent) bool) error {
+	reader := bufio.NewReader(r)
+	var event sseEvent
+	var data []string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// A blank line dispatches the event
+		if line == "" {
+			if len(data) > 0 || event.Event != "" {
+				event.Data = strings.Join(data, "\n")
+				if !fn(event) {
+					return nil
+				}
+			}
+			event = sseEvent{}
+			data = nil
+			continue
+		}
+
+		// Comments keep the connection alive
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+// decodeMessages parses a JSON-RPC message or batch
+func decodeMessages(data []byte) ([]*Message, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var batch []*Message
+		if err := json.Unmarshal([]byte(trimmed), &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+
+	var msg Message
+	if err := json.Unmarshal([]byte(trimmed), &msg); err != nil {
+		return nil, err
+	}
+	return []*Message{&msg}, nil
+}
+
+// SSETransport speaks the legacy HTTP+SSE transport (protocol 2024-11-05):
+// server messages arrive on a long-lived GET stream, and client messages
+// are POSTed to an endpoint announced on that stream.
+type SSETransport struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	auth     *OAuthClient
+	endpoint string
+
+	messages chan *Message
+	closed   bool
+	mu       sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// sseConnectTimeout bounds waiting for the server's endpoint event
+const sseConnectTimeout = 30 * time.Second
+
+// NewSSETransport opens the event stream and waits for the POST endpoint
+func NewSSETransport(serverURL string, headers map[string]string, auth *OAuthClient) (*SSETransport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &SSETransport{
+		url:      serverURL,
+		headers:  headers,
+		client:   &http.Client{},
+		auth:     auth,
+		messages: make(chan *Message, 16),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	resp, err := doWithAuth(ctx, t.client, t.auth, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", serverURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		setHeaders(req, headers)
+		return req, nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("MCP server returned %s", resp.Status)
+	}
+
+	endpoint := make(chan string, 1)
+	go t.readStream(resp.Body, endpoint)
+
+	select {
+	case ep, ok := <-endpoint:
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("event stream closed before endpoint was announced")
+		}
+		t.endpoint = ep
+	case <-time.After(sseConnectTimeout):
+		cancel()
+		return nil, fmt.Errorf("timed out waiting for endpoint event")
+	}
+
+	return t, nil
+}
+
+func (t *SSETransport) readStream(body io.ReadCloser, endpoint chan<- string) {
+	defer body.Close()
+	defer t.Close()
+
+	announced := false
+	readSSE(body, func(event sseEvent) bool {
+		switch event.Event {
+		case "endpoint":
+			if !announced {
+				announced = true
+				endpoint <- resolveURL(t.url, event.Data)
+			}
+		case "", "message":
+			msgs, err := decodeMessages([]byte(event.Data))
+			if err != nil {
+				return true
+			}
+			for _, msg := range msgs {
+				t.push(msg)
+			}
+		}
+		return true
+	})
+
+	if !announced {
+		close(endpoint)
+	}
+}
+
+func (t *SSETransport) push(msg *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.messages <- msg
+	}
+}
+
+func (t *SSETransport) Send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doWithAuth(ctx, t.client, t.auth, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, strings.NewReader(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		setHeaders(req, t.headers)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("MCP server returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *SSETransport) Messages() <-chan *Message {
+	return t.messages
+}
+
+func (t *SSETransport) Close() error {
+	t.cancel()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.messages)
+	}
+	return nil
+}
+
+// resolveURL resolves ref against base, as used for the endpoint event
+func resolveURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+func setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
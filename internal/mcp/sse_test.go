@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// fakeSSEServer is a legacy HTTP+SSE MCP server. Responses to POSTed
+// requests are written to the open event stream.
+type fakeSSEServer struct {
+	events chan string
+}
+
+func (f *fakeSSEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/sse":
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-f.events:
+				fmt.Fprint(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+	case r.Method == "POST" && r.URL.Path == "/messages" && r.URL.Query().Get("session") == "1":
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if !msg.IsRequest() {
+			return
+		}
+
+		var result interface{} = struct{}{}
+		switch msg.Method {
+		case "initialize":
+			result = InitializeResult{
+				ProtocolVersion: "2024-11-05",
+				ServerInfo:      Implementation{Name: "fake-sse", Version: "1.0.0"},
+			}
+		case "tools/list":
+			result = ListToolsResult{Tools: []Tool{{Name: "lookup"}}}
+		}
+		data, _ := json.Marshal(&Message{JSONRPC: "2.0", ID: msg.ID, Result: mustMarshal(result)})
+		f.events <- fmt.Sprintf("event: message\ndata: %s\n\n", data)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSSETransportPostsToAnnouncedEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&fakeSSEServer{events: make(chan string, 16)})
+	t.Cleanup(srv.Close)
+
+	transport, err := NewSSETransport(srv.URL+"/sse", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/messages?session=1"; transport.endpoint != want {
+		t.Errorf("endpoint = %q, want %q", transport.endpoint, want)
+	}
+
+	client := newTestClient(t)
+	if err := client.ConnectTransport("legacy", config.MCPServerConfig{}, transport); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	server, _ := client.GetServer("legacy")
+	if server.Info.Name != "fake-sse" {
+		t.Errorf("server name = %q, want fake-sse", server.Info.Name)
+	}
+	if tools := server.ListTools(); len(tools) != 1 || tools[0].Name != "lookup" {
+		t.Errorf("tools = %+v, want lookup", tools)
+	}
+	if err := server.Conn().Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := "id: 7\nevent: message\ndata: {\"a\":\ndata: 1}\n\n: comment\n\ndata: second\n\n"
+
+	var events []sseEvent
+	if err := readSSE(strings.NewReader(stream), func(event sseEvent) bool {
+		events = append(events, event)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].ID != "7" || events[0].Event != "message" || events[0].Data != "{\"a\":\n1}" {
+		t.Errorf("first event = %+v", events[0])
+	}
+	if events[1].Data != "second" {
+		t.Errorf("second event = %+v", events[1])
+	}
+}
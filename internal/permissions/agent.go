@@ -0,0 +1,49 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+)
+
+// AgentContext checks a sub-agent's tool calls. It applies the parent's
+// rules and session approvals with the agent's own mode, keeps read-only
+// agents from changing anything, and attributes prompts to the agent.
+type AgentContext struct {
+	parent   *Manager
+	agent    string
+	mode     Mode // Empty = the parent's
+	readOnly bool
+}
+
+// ForAgent returns the permission context for a sub-agent. agent is shown
+// in permission prompts; an empty mode follows the parent's.
+func (m *Manager) ForAgent(agent string, mode Mode, readOnly bool) *AgentContext {
+	return &AgentContext{
+		parent:   m,
+		agent:    agent,
+		mode:     mode,
+		readOnly: readOnly,
+	}
+}
+
+// Check checks if the agent may run a tool without asking
+func (c *AgentContext) Check(tool string, input map[string]interface{}) (bool, error) {
+	c.parent.mu.RLock()
+	defer c.parent.mu.RUnlock()
+
+	if c.readOnly && IsMutatingOperation(tool, input) {
+		return false, fmt.Errorf("%s is read-only and can't make changes with %s", c.agent, tool)
+	}
+
+	// Agents can't leave plan mode while the parent is in it
+	mode := c.mode
+	if mode == "" || c.parent.mode == ModePlan {
+		mode = c.parent.mode
+	}
+	return c.parent.check(mode, tool, input)
+}
+
+// RequestPermission asks the user on the agent's behalf
+func (c *AgentContext) RequestPermission(ctx context.Context, tool string, input map[string]interface{}) (bool, error) {
+	return c.parent.request(ctx, c.agent, tool, input)
+}
@@ -1,7 +1,9 @@
 package permissions
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/heissanjay/oscode/internal/config"
@@ -11,13 +13,44 @@ import (
 type Mode string
 
 const (
-	ModeAuto Mode = "auto" // Auto-accept allowed tools
-	ModeAsk  Mode = "ask"  // Ask for all tools
-	ModePlan Mode = "plan" // Read-only mode
+	ModeAuto        Mode = "auto"        // Auto-accept allowed tools
+	ModeAcceptEdits Mode = "acceptEdits" // Auto-accept file edits as well
+	ModeAsk         Mode = "ask"         // Ask for all tools but reads
+	ModePlan        Mode = "plan"        // Read-only mode
 )
 
-// PermissionCallback is called to request user permission
-type PermissionCallback func(tool string, input map[string]interface{}, description string) (bool, error)
+// CycleModes is the order modes are cycled through from the UI
+var CycleModes = []Mode{ModeAuto, ModeAcceptEdits, ModePlan, ModeAsk}
+
+// ParseMode parses a permission mode string
+func ParseMode(s string) (Mode, bool) {
+	switch s {
+	case "auto", "default":
+		return ModeAuto, true
+	case "acceptEdits":
+		return ModeAcceptEdits, true
+	case "ask":
+		return ModeAsk, true
+	case "plan":
+		return ModePlan, true
+	}
+	return "", false
+}
+
+// NextMode returns the mode that follows the given one in CycleModes
+func NextMode(mode Mode) Mode {
+	for i, m := range CycleModes {
+		if m == mode {
+			return CycleModes[(i+1)%len(CycleModes)]
+		}
+	}
+	return CycleModes[0]
+}
+
+// PermissionCallback is called to request user permission. agent names the
+// sub-agent asking, and is empty for the main conversation. It should give
+// up with a denial when ctx is done.
+type PermissionCallback func(ctx context.Context, tool string, input map[string]interface{}, description, agent string) (bool, error)
 
 // Manager handles permission checking and enforcement
 type Manager struct {
@@ -26,6 +59,7 @@ type Manager struct {
 	sessionAllowed  map[string]bool // Tools allowed for this session
 	callback        PermissionCallback
 	skipPermissions bool
+	isReadOnly      func(tool string) bool // Tools that declare they don't modify state
 	mu              sync.RWMutex
 }
 
@@ -43,13 +77,8 @@ func NewManager(cfg *config.Config) *Manager {
 		modeStr = cfg.Permissions.DefaultMode // Fall back to config default
 	}
 
-	switch modeStr {
-	case "auto", "acceptEdits":
-		m.mode = ModeAuto
-	case "ask":
-		m.mode = ModeAsk
-	case "plan":
-		m.mode = ModePlan
+	if mode, ok := ParseMode(modeStr); ok {
+		m.mode = mode
 	}
 
 	// Parse permission rules from config
@@ -86,6 +115,16 @@ func (m *Manager) SetSkipPermissions(skip bool) {
 	m.skipPermissions = skip
 }
 
+// SetReadOnlyCheck sets the function reporting which tools declare
+// themselves read-only. Such tools run without asking unless a rule says
+// otherwise. The declaration is only a hint, so it doesn't get them past plan
+// mode.
+func (m *Manager) SetReadOnlyCheck(isReadOnly func(tool string) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isReadOnly = isReadOnly
+}
+
 // AddRule adds a permission rule
 func (m *Manager) AddRule(ruleStr string, action Action) {
 	m.mu.Lock()
@@ -105,17 +144,36 @@ func (m *Manager) AllowForSession(tool string) {
 func (m *Manager) Check(tool string, input map[string]interface{}) (bool, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.check(m.mode, tool, input)
+}
+
+// check decides a tool call in the given mode. Callers hold m.mu.
+func (m *Manager) check(mode Mode, tool string, input map[string]interface{}) (bool, error) {
+	// Plan mode denies all mutating operations, even with skipped permissions
+	if mode == ModePlan && IsMutatingOperation(tool, input) {
+		return false, fmt.Errorf("%s is not allowed in plan mode. Present your plan with ExitPlanMode and wait for approval before making changes", tool)
+	}
 
 	// Skip permissions if flag is set
 	if m.skipPermissions {
 		return true, nil
 	}
 
-	// Plan mode denies all write operations
-	if m.mode == ModePlan {
-		if isWriteOperation(tool) {
-			return false, fmt.Errorf("write operations not allowed in plan mode")
+	// Check rule-based permissions
+	readOnly := isReadOperation(tool) || m.readOnlyTool(tool)
+	action, matched := m.ruleSet.Find(tool, input)
+	if !matched {
+		action = ActionAsk
+		if readOnly {
+			action = ActionAllow
 		}
+	}
+	if action == ActionDeny {
+		return false, fmt.Errorf("operation denied by permission rules")
+	}
+
+	// Anything left in plan mode is read-only
+	if mode == ModePlan {
 		return true, nil
 	}
 
@@ -124,14 +182,19 @@ func (m *Manager) Check(tool string, input map[string]interface{}) (bool, error)
 		return true, nil
 	}
 
-	// Check rule-based permissions
-	action := m.ruleSet.Check(tool, input)
+	switch mode {
+	case ModeAcceptEdits:
+		if isEditOperation(tool) {
+			return true, nil
+		}
+	case ModeAsk:
+		// Reads go ahead unless a rule says to ask
+		return readOnly && action == ActionAllow, nil
+	}
 
 	switch action {
 	case ActionAllow:
 		return true, nil
-	case ActionDeny:
-		return false, fmt.Errorf("operation denied by permission rules")
 	case ActionAsk:
 		// Need to ask user
 		return false, nil
@@ -141,7 +204,11 @@ func (m *Manager) Check(tool string, input map[string]interface{}) (bool, error)
 }
 
 // RequestPermission requests permission from the user
-func (m *Manager) RequestPermission(tool string, input map[string]interface{}) (bool, error) {
+func (m *Manager) RequestPermission(ctx context.Context, tool string, input map[string]interface{}) (bool, error) {
+	return m.request(ctx, "", tool, input)
+}
+
+func (m *Manager) request(ctx context.Context, agent, tool string, input map[string]interface{}) (bool, error) {
 	if m.callback == nil {
 		return false, fmt.Errorf("no permission callback configured")
 	}
@@ -149,11 +216,11 @@ func (m *Manager) RequestPermission(tool string, input map[string]interface{}) (
 	// Generate description
 	description := generateDescription(tool, input)
 
-	return m.callback(tool, input, description)
+	return m.callback(ctx, tool, input, description, agent)
 }
 
 // CheckAndRequest checks permission and requests if needed
-func (m *Manager) CheckAndRequest(tool string, input map[string]interface{}) (bool, error) {
+func (m *Manager) CheckAndRequest(ctx context.Context, tool string, input map[string]interface{}) (bool, error) {
 	allowed, err := m.Check(tool, input)
 	if err != nil {
 		return false, err
@@ -163,12 +230,38 @@ func (m *Manager) CheckAndRequest(tool string, input map[string]interface{}) (bo
 	}
 
 	// Need to request permission
-	return m.RequestPermission(tool, input)
+	return m.RequestPermission(ctx, tool, input)
+}
+
+// IsMutatingOperation reports whether a tool invocation may change state
+// outside the conversation. Bash is judged by its command, and MCP tools
+// (named "server:tool") are assumed to mutate.
+func IsMutatingOperation(tool string, input map[string]interface{}) bool {
+	switch tool {
+	case "Write", "Edit", "NotebookEdit", "KillShell":
+		return true
+	case "Bash":
+		return !IsReadOnlyCommand(GetCommandFromInput(input))
+	}
+	return strings.Contains(tool, ":")
+}
+
+func (m *Manager) readOnlyTool(tool string) bool {
+	return m.isReadOnly != nil && m.isReadOnly(tool)
+}
+
+func isReadOperation(tool string) bool {
+	switch tool {
+	case "Read", "Glob", "Grep", "CodeSearch", "LSP":
+		return true
+	default:
+		return false
+	}
 }
 
-func isWriteOperation(tool string) bool {
+func isEditOperation(tool string) bool {
 	switch tool {
-	case "Write", "Edit", "Bash", "NotebookEdit":
+	case "Write", "Edit", "NotebookEdit":
 		return true
 	default:
 		return false
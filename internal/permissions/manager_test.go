@@ -0,0 +1,54 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+func TestCheckReadOnlyHint(t *testing.T) {
+	m := NewManager(&config.Config{})
+	m.SetReadOnlyCheck(func(tool string) bool { return tool == "docs:search" })
+
+	// The hint skips the prompt by default
+	if allowed, err := m.Check("docs:search", nil); !allowed || err != nil {
+		t.Errorf("read-only MCP tool = %v, %v, want allowed", allowed, err)
+	}
+	if allowed, _ := m.Check("docs:write", nil); allowed {
+		t.Error("other MCP tool allowed without asking")
+	}
+
+	// but comes from the server, so it can't get past plan mode
+	m.SetMode(ModePlan)
+	if allowed, err := m.Check("docs:search", nil); allowed || err == nil {
+		t.Errorf("read-only MCP tool in plan mode = %v, %v, want denied", allowed, err)
+	}
+	if allowed, err := m.Check("Read", map[string]interface{}{"file_path": "main.go"}); !allowed || err != nil {
+		t.Errorf("Read in plan mode = %v, %v, want allowed", allowed, err)
+	}
+}
+
+func TestCheckAskMode(t *testing.T) {
+	m := NewManager(&config.Config{PermissionMode: "ask"})
+	m.SetReadOnlyCheck(func(tool string) bool { return tool == "docs:search" })
+	m.AddRule("Glob", ActionAsk)
+
+	tests := []struct {
+		tool  string
+		input map[string]interface{}
+		want  bool
+	}{
+		{"Read", map[string]interface{}{"file_path": "main.go"}, true},
+		{"Grep", map[string]interface{}{"pattern": "TODO"}, true},
+		{"docs:search", nil, true},
+		{"Glob", map[string]interface{}{"pattern": "*.go"}, false},
+		{"Bash", map[string]interface{}{"command": "ls"}, false},
+		{"Write", map[string]interface{}{"file_path": "main.go"}, false},
+		{"docs:write", nil, false},
+	}
+	for _, tt := range tests {
+		if allowed, err := m.Check(tt.tool, tt.input); allowed != tt.want || err != nil {
+			t.Errorf("Check(%s) = %v, %v, want %v", tt.tool, allowed, err, tt.want)
+		}
+	}
+}
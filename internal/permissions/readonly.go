@@ -0,0 +1,369 @@
+package permissions
+
+import (
+	"strings"
+)
+
+// readOnlyCommands are shell commands that never modify state on their own
+var readOnlyCommands = map[string]bool{
+	"cat": true, "head": true, "tail": true, "less": true, "more": true,
+	"ls": true, "tree": true, "pwd": true, "echo": true, "printf": true,
+	"grep": true, "egrep": true, "fgrep": true, "rg": true, "ag": true,
+	"wc": true, "sort": true, "uniq": true, "cut": true, "tr": true,
+	"diff": true, "cmp": true, "file": true, "stat": true, "du": true,
+	"df": true, "which": true, "whereis": true, "type": true, "whoami": true,
+	"uname": true, "date": true, "printenv": true, "id": true,
+	"basename": true, "dirname": true, "realpath": true, "readlink": true,
+	"md5sum": true, "sha1sum": true, "sha256sum": true, "jq": true,
+	"true": true, "false": true, "test": true, "[": true,
+}
+
+// readOnlySubcommands lists read-only subcommands of multi-purpose tools
+var readOnlySubcommands = map[string]map[string]bool{
+	"git": {
+		"status": true, "log": true, "diff": true, "show": true, "blame": true,
+		"ls-files": true, "ls-tree": true, "rev-parse": true, "describe": true,
+		"shortlog": true, "grep": true, "cat-file": true, "reflog": true,
+	},
+	"go": {
+		"list": true, "version": true, "env": true, "doc": true,
+	},
+	"npm": {
+		"ls": true, "list": true, "view": true, "outdated": true,
+	},
+	"cargo": {
+		"tree": true, "metadata": true,
+	},
+}
+
+// writingFlags are options that make an otherwise read-only command write
+// files or run other programs. Short flags also match with a value attached.
+var writingFlags = map[string][]string{
+	"sort": {"-o", "--output", "--compress-program"},
+	"tree": {"-o"},
+	"date": {"-s", "--set"},
+	"rg":   {"--pre"},
+	"less": {"-o", "-O", "--log-file", "--LOG-FILE"},
+	"file": {"-C", "--compile"},
+	"find": {"-delete", "-exec", "-execdir", "-ok", "-okdir", "-fprint", "-fprint0", "-fprintf", "-fls"},
+	"git":  {"--config-env", "--exec-path"},
+}
+
+// writingSubcommandArgs are arguments that make a read-only subcommand
+// write or run other programs, keyed by tool and subcommand
+var writingSubcommandArgs = map[string][]string{
+	"git diff":   {"--output", "--ext-diff", "--textconv"},
+	"git log":    {"--output", "--ext-diff", "--textconv"},
+	"git show":   {"--output", "--ext-diff", "--textconv"},
+	"git grep":   {"-O", "--open-files-in-pager", "--textconv"},
+	"git reflog": {"expire", "delete"},
+	"go env":     {"-w", "-u"},
+}
+
+// IsReadOnlyCommand reports whether a shell command is known not to modify
+// files or other state. Unknown commands are treated as mutating.
+func IsReadOnlyCommand(command string) bool {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return false
+	}
+
+	// Redirections and command or process substitutions can write or run
+	// arbitrary commands
+	cleaned := strings.ReplaceAll(command, "2>&1", "")
+	cleaned = strings.ReplaceAll(cleaned, "2>/dev/null", "")
+	if strings.ContainsAny(cleaned, ">`") || strings.Contains(cleaned, "$(") || strings.Contains(cleaned, "<(") {
+		return false
+	}
+
+	for _, segment := range splitCommandSegments(cleaned) {
+		if !isReadOnlySegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitCommandSegments splits a command line on pipes and command separators
+func splitCommandSegments(command string) []string {
+	replacer := strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n", "&", "\n")
+	var segments []string
+	for _, seg := range strings.Split(replacer.Replace(command), "\n") {
+		if seg = strings.TrimSpace(seg); seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+func isReadOnlySegment(segment string) bool {
+	fields := shellFields(segment)
+	if len(fields) == 0 {
+		return true
+	}
+
+	name := fields[0]
+	args := fields[1:]
+
+	for _, arg := range args {
+		if hasFlag(arg, writingFlags[name], name != "find") {
+			return false
+		}
+	}
+
+	switch name {
+	case "find":
+		return true
+	case "sed":
+		return isReadOnlySed(args)
+	case "sort":
+		// Bundled short options, as in -ro file
+		for _, arg := range args {
+			if hasShortFlag(arg, 'o') {
+				return false
+			}
+		}
+	case "uniq":
+		// A second file argument is the output
+		return len(positionalArgs(args, "-f", "-s", "-w")) <= 1
+	case "date":
+		// An argument other than +FORMAT sets the clock
+		for _, arg := range positionalArgs(args, "-d", "-f", "-r") {
+			if !strings.HasPrefix(arg, "+") {
+				return false
+			}
+		}
+	}
+
+	if readOnlyCommands[name] {
+		return true
+	}
+
+	if subcommands, ok := readOnlySubcommands[name]; ok {
+		for i, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if !subcommands[arg] {
+				return false
+			}
+			for _, rest := range args[i+1:] {
+				if hasFlag(rest, writingSubcommandArgs[name+" "+arg], true) {
+					return false
+				}
+				// -O runs a pager even when bundled, as in -nO
+				if name == "git" && arg == "grep" && hasShortFlag(rest, 'O') {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasFlag reports whether arg is one of flags, a long flag with =value, or
+// with attached set a short flag with its value attached
+func hasFlag(arg string, flags []string, attached bool) bool {
+	for _, flag := range flags {
+		switch {
+		case arg == flag:
+			return true
+		case strings.HasPrefix(flag, "--") && strings.HasPrefix(arg, flag+"="):
+			return true
+		case attached && len(flag) == 2 && flag[0] == '-' && strings.HasPrefix(arg, flag) && !strings.HasPrefix(arg, "--"):
+			return true
+		}
+	}
+	return false
+}
+
+// hasShortFlag reports whether arg is a bundle of short options that
+// includes flag
+func hasShortFlag(arg string, flag byte) bool {
+	return strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.IndexByte(arg, flag) >= 0
+}
+
+// positionalArgs returns the arguments that aren't flags, skipping the
+// values of valueFlags
+func positionalArgs(args []string, valueFlags ...string) []string {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(positional, args[i+1:]...)
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		for _, flag := range valueFlags {
+			if arg == flag {
+				i++
+				break
+			}
+		}
+	}
+	return positional
+}
+
+// isReadOnlySed reports whether sed's arguments only read: no in-place
+// editing, no script files and no script commands that write or execute
+func isReadOnlySed(args []string) bool {
+	var scripts []string
+	explicit := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--in-place" || strings.HasPrefix(arg, "--in-place="),
+			arg == "--file" || strings.HasPrefix(arg, "--file="):
+			return false
+		case arg == "--expression" && i+1 < len(args):
+			scripts = append(scripts, args[i+1])
+			explicit = true
+			i++
+		case strings.HasPrefix(arg, "--expression="):
+			scripts = append(scripts, strings.TrimPrefix(arg, "--expression="))
+			explicit = true
+		case strings.HasPrefix(arg, "--"):
+			continue
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// Bundled short options, as in -ne 'p'
+			for j := 1; j < len(arg); j++ {
+				switch arg[j] {
+				case 'i', 'f':
+					return false
+				case 'e', 'l':
+					value := arg[j+1:]
+					if value == "" && i+1 < len(args) {
+						i++
+						value = args[i]
+					}
+					if arg[j] == 'e' {
+						scripts = append(scripts, value)
+						explicit = true
+					}
+					j = len(arg)
+				}
+			}
+		case !explicit && len(scripts) == 0:
+			scripts = append(scripts, arg)
+		}
+	}
+
+	for _, script := range scripts {
+		if sedScriptWrites(script) {
+			return false
+		}
+	}
+	return true
+}
+
+// sedScriptWrites reports whether a sed script can write files or run
+// commands: the w, W and e commands, the w and e flags of s, or anything
+// it doesn't recognize
+func sedScriptWrites(script string) bool {
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case strings.IndexByte(" \t\n;{}!,$~+0123456789", c) >= 0:
+			i++
+		case c == '/' || c == '\\':
+			// Address regex, /re/ or \cREc, with optional I and M flags
+			delim := byte('/')
+			if c == '\\' {
+				if i+1 >= len(script) {
+					return true
+				}
+				i++
+				delim = script[i]
+			}
+			i = skipDelimited(script, i+1, delim)
+			for i < len(script) && (script[i] == 'I' || script[i] == 'M') {
+				i++
+			}
+		case c == 's' || c == 'y':
+			if i+1 >= len(script) {
+				return true
+			}
+			delim := script[i+1]
+			i = skipDelimited(script, i+2, delim)
+			i = skipDelimited(script, i, delim)
+			for c == 's' && i < len(script) && strings.IndexByte("gpiImM0123456789we", script[i]) >= 0 {
+				if script[i] == 'w' || script[i] == 'e' {
+					return true
+				}
+				i++
+			}
+		case c == 'w' || c == 'W' || c == 'e':
+			return true
+		case strings.IndexByte("aicrR#", c) >= 0:
+			// Text, a file to read or a comment, to the end of the line
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("btT:", c) >= 0:
+			// A label, to the end of the command
+			for i < len(script) && script[i] != '\n' && script[i] != ';' {
+				i++
+			}
+		case strings.IndexByte("pPdDnNqQ=lLhHgGxzFv", c) >= 0:
+			i++
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// skipDelimited returns the index just past the next unescaped delim
+func skipDelimited(s string, i int, delim byte) int {
+	for ; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == delim {
+			return i + 1
+		}
+	}
+	return i
+}
+
+// shellFields splits a command into words, removing quotes
+func shellFields(command string) []string {
+	var fields []string
+	var b strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				fields = append(fields, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		fields = append(fields, b.String())
+	}
+	return fields
+}
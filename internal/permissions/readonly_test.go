@@ -0,0 +1,107 @@
+package permissions
+
+import "testing"
+
+func TestIsReadOnlyCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"ls -la", true},
+		{"cat README.md | grep -n foo | head -5", true},
+		{"git status && git diff HEAD~1", true},
+		{"git log --oneline -10", true},
+		{"go list ./...", true},
+		{"go env GOPATH", true},
+		{"", false},
+		{"rm -rf .", false},
+		{"echo hi > out.txt", false},
+		{"cat $(which foo)", false},
+		{"cat <(touch /tmp/pwned)", false},
+		{"diff <(ls a) <(ls b)", false},
+		{"tee >(cat)", false},
+		{"echo `touch x`", false},
+
+		// Wrappers run other commands
+		{"env rm -rf .", false},
+		{"env", false},
+
+		// Flags and arguments that write files or run programs
+		{"sort file.txt", true},
+		{"sort -rn file.txt", true},
+		{"sort -o out.txt file.txt", false},
+		{"sort -oout.txt file.txt", false},
+		{"sort -ro out.txt file.txt", false},
+		{"sort --output=out.txt file.txt", false},
+		{"sort --compress-program=sh file.txt", false},
+		{"uniq in.txt", true},
+		{"uniq -c -f 1 in.txt", true},
+		{"uniq in.txt out.txt", false},
+		{"tree -L 2", true},
+		{"tree -o out.txt", false},
+		{"date +%Y-%m-%d", true},
+		{"date -d yesterday +%s", true},
+		{"date -s 2020-01-01", false},
+		{"date --set=2020-01-01", false},
+		{"date 010112002020", false},
+		{"rg --pre ./script.sh foo", false},
+		{"file -C -m magic", false},
+
+		// find
+		{"find . -name '*.go'", true},
+		{"find . -delete", false},
+		{"find . -exec rm {} +", false},
+		{"find . -fprint0 out", false},
+		{"find . -fprintf out %p", false},
+
+		// sed
+		{"sed -n '1,20p' main.go", true},
+		{"sed 's/foo/bar/g' main.go", true},
+		{"sed -e 's/wall/west/' main.go", true},
+		{"sed -i 's/foo/bar/' main.go", false},
+		{"sed -ni 's/foo/bar/' main.go", false},
+		{"sed --in-place=.bak 's/foo/bar/' main.go", false},
+		{"sed -f script.sed main.go", false},
+		{"sed 's/foo/bar/w out.txt' main.go", false},
+		{"sed 's/foo/bar/e' main.go", false},
+		{"sed -n 'w out.txt' main.go", false},
+		{"sed '1e rm -rf .' main.go", false},
+		{"sed -e 'p' -e 'W out.txt' main.go", false},
+		{"sed '/x/w out.txt' main.go", false},
+
+		// Subcommands
+		{"git reflog", true},
+		{"git reflog show", true},
+		{"git reflog expire --all", false},
+		{"git reflog delete HEAD@{1}", false},
+		{"git diff --output=patch.diff", false},
+		{"git diff --output patch.diff", false},
+		{"git push", false},
+		{"git grep -n foo", true},
+		{"git grep -Otouch foo", false},
+		{"git grep -O touch foo", false},
+		{"git grep -nO foo", false},
+		{"git grep --open-files-in-pager=touch foo", false},
+		{"git grep --textconv foo", false},
+		{"git diff --stat", true},
+		{"git diff --ext-diff", false},
+		{"git diff --textconv HEAD", false},
+		{"git log -p --ext-diff", false},
+		{"git show --textconv HEAD:README.md", false},
+		{"git -c diff.external=touch diff", false},
+		{"git --config-env=diff.external=CMD diff", false},
+		{"git --exec-path=/tmp status", false},
+		{"go env -w GOFLAGS=-mod=mod", false},
+		{"go env -u GOFLAGS", false},
+		{"go vet ./...", false},
+		{"cargo check", false},
+		{"cargo tree", true},
+		{"npm install", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReadOnlyCommand(tt.command); got != tt.want {
+			t.Errorf("IsReadOnlyCommand(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
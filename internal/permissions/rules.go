@@ -181,27 +181,37 @@ func (rs *RuleSet) ParseRules(allow, ask, deny []string) {
 // Check returns the action for a tool invocation
 // Priority: Deny > Ask > Allow > Default
 func (rs *RuleSet) Check(tool string, input map[string]interface{}) Action {
+	if action, ok := rs.Find(tool, input); ok {
+		return action
+	}
+
+	// Default to ask
+	return ActionAsk
+}
+
+// Find returns the action of the highest priority rule matching a tool
+// invocation, and false if no rule matches
+func (rs *RuleSet) Find(tool string, input map[string]interface{}) (Action, bool) {
 	// Check deny rules first
 	for _, rule := range rs.denyRules {
 		if rule.Match(tool, input) {
-			return ActionDeny
+			return ActionDeny, true
 		}
 	}
 
 	// Check ask rules
 	for _, rule := range rs.askRules {
 		if rule.Match(tool, input) {
-			return ActionAsk
+			return ActionAsk, true
 		}
 	}
 
 	// Check allow rules
 	for _, rule := range rs.allowRules {
 		if rule.Match(tool, input) {
-			return ActionAllow
+			return ActionAllow, true
 		}
 	}
 
-	// Default to ask
-	return ActionAsk
+	return ActionAsk, false
 }
@@ -0,0 +1,243 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+// maxHistoryEntries is how many prompts a project's history keeps
+const maxHistoryEntries = 1000
+
+// redacted replaces secrets in saved prompts
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials that shouldn't be written to history.
+// Text matched by a group named keep, such as a key's name, stays.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{20,}`),                               // OpenAI, Anthropic and Stripe keys
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`),                                    // GitHub tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{30,}`),                                  // GitHub fine-grained tokens
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),                                   // AWS access keys
+	regexp.MustCompile(`\bAIza[A-Za-z0-9_-]{35}\b`),                                       // Google API keys
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),                                 // Slack tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), // JWTs
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`),
+	regexp.MustCompile(`(?i)(?P<keep>\b(?:api[_-]?key|secret|token|password|passwd)\b\s*[:=]\s*["']?)[^\s"']{8,}`),
+}
+
+// HistoryEntry is a prompt in a project's history
+type HistoryEntry struct {
+	Prompt    string    `json:"prompt"`
+	Timestamp time.Time `json:"timestamp"`
+	SessionID string    `json:"session_id,omitempty"`
+}
+
+// History is a project's prompt history, shared by its sessions and kept
+// in a JSONL file. Secrets are redacted before prompts are saved, and a
+// repeated prompt, such as the same pasted log, is kept once.
+type History struct {
+	path     string
+	patterns []*regexp.Regexp
+	entries  []HistoryEntry
+	lines    int // Lines in the file, compacted when it outgrows the entries
+	mu       sync.Mutex
+}
+
+// LoadHistory loads a project's prompt history. extraPatterns match more
+// secrets to redact.
+func LoadHistory(projectDir string, extraPatterns []string) (*History, error) {
+	h := &History{
+		path:     config.GetProjectHistoryPath(projectDir),
+		patterns: append([]*regexp.Regexp{}, secretPatterns...),
+	}
+	for _, pattern := range extraPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history redaction pattern %q: %w", pattern, err)
+		}
+		h.patterns = append(h.patterns, re)
+	}
+
+	// Histories were once kept under a name that projects could share
+	if _, err := os.Stat(h.path); os.IsNotExist(err) {
+		os.Rename(config.GetLegacyProjectHistoryPath(projectDir), h.path)
+	}
+
+	if err := h.read(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return h, nil
+}
+
+// read adds the entries in the history file, counting its lines
+func (h *History) read() error {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		h.lines++
+		var entry HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Prompt == "" {
+			continue // Skip lines cut short by a crash
+		}
+		h.add(entry)
+	}
+	return scanner.Err()
+}
+
+// Prompts returns the prompts oldest first
+func (h *History) Prompts() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prompts := make([]string, len(h.entries))
+	for i, entry := range h.entries {
+		prompts[i] = entry.Prompt
+	}
+	return prompts
+}
+
+// Add saves a prompt to the history, redacting secrets first
+func (h *History) Add(prompt, sessionID string) error {
+	prompt = strings.TrimSpace(h.Redact(prompt))
+	if prompt == "" {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := HistoryEntry{Prompt: prompt, Timestamp: time.Now(), SessionID: sessionID}
+	h.add(entry)
+
+	// Other sessions in the project write to the same file
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(h.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if h.lines >= 2*maxHistoryEntries {
+		return h.compact(entry)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.lines++
+	return nil
+}
+
+// Redact replaces the secrets in text
+func (h *History) Redact(text string) string {
+	for _, re := range h.patterns {
+		text = re.ReplaceAllString(text, "${keep}"+redacted)
+	}
+	return text
+}
+
+// add appends an entry, dropping an earlier copy of its prompt and the
+// oldest entries past the limit
+func (h *History) add(entry HistoryEntry) {
+	for i, existing := range h.entries {
+		if existing.Prompt == entry.Prompt {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+	}
+}
+
+// compact rewrites the file with just the entries kept, after adding entry.
+// Other sessions may have added prompts since the file was read, so it's
+// read again first. The caller holds the file lock.
+func (h *History) compact(entry HistoryEntry) error {
+	merged := &History{path: h.path}
+	if err := merged.read(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	merged.add(entry)
+	h.entries = merged.entries
+
+	var b strings.Builder
+	for _, entry := range h.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	h.lines = len(h.entries)
+	return nil
+}
+
+const (
+	lockRetryInterval = 10 * time.Millisecond
+	lockTimeout       = 5 * time.Second
+	staleLockAge      = 30 * time.Second // A lock this old was left by a crash
+)
+
+// lockFile takes an exclusive lock by creating path, waiting while another
+// process holds it. It returns a function that releases the lock.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heissanjay/oscode/internal/config"
+)
+
+func TestHistoryPersistsAcrossLoads(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+
+	history, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prompt := range []string{"fix the build", "paste:\nlong log", "add tests", "paste:\nlong log", "  "} {
+		if err := history.Add(prompt, "session-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A repeated prompt moves to the end instead of being kept twice
+	want := []string{"fix the build", "add tests", "paste:\nlong log"}
+	if got := history.Prompts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("prompts = %q, want %q", got, want)
+	}
+
+	reloaded, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Prompts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded prompts = %q, want %q", got, want)
+	}
+
+	other, err := LoadHistory(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.Prompts(); len(got) != 0 {
+		t.Errorf("another project's history = %q, want none", got)
+	}
+}
+
+func TestHistoryRedactsSecrets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+
+	history, err := LoadHistory(project, []string{`internal-[0-9]{6}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := "call the API with sk-ant-REDACTED and password=hunter2hunter2 for ticket internal-123456"
+	if err := history.Add(prompt, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(config.GetProjectHistoryPath(project))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"sk-ant-api03", "hunter2", "internal-123456"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("history file contains %q:\n%s", secret, data)
+		}
+	}
+	want := "call the API with [REDACTED] and password=[REDACTED] for ticket [REDACTED]"
+	if got := history.Prompts(); len(got) != 1 || got[0] != want {
+		t.Errorf("prompts = %q, want %q", got, want)
+	}
+
+	if _, err := LoadHistory(project, []string{"("}); err == nil {
+		t.Error("expected an invalid pattern to fail")
+	}
+	if filepath.Dir(config.GetProjectHistoryPath(project)) == project {
+		t.Error("history is kept inside the project")
+	}
+}
+
+func TestHistoryCompactionKeepsOtherSessionsPrompts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+
+	first, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Add("from the first session", "session-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Add("from the second session", "session-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first session compacts without having seen the second's prompt
+	first.lines = 2 * maxHistoryEntries
+	if err := first.Add("compacting", "session-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"from the first session", "from the second session", "compacting"}
+	if got := reloaded.Prompts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("prompts after compaction = %q, want %q", got, want)
+	}
+	if reloaded.lines != len(want) {
+		t.Errorf("file has %d lines, want %d", reloaded.lines, len(want))
+	}
+}
+
+func TestHistoryBreaksStaleLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+
+	history, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := config.GetProjectHistoryPath(project) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lock, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := history.Add("after a crash", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("lock not released: %v", err)
+	}
+}
+
+func TestProjectHistoryPaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// These once mapped to the same file
+	dashed := config.GetProjectHistoryPath("/work/b-c")
+	nested := config.GetProjectHistoryPath("/work/b/c")
+	if dashed == nested {
+		t.Errorf("/work/b-c and /work/b/c share %s", dashed)
+	}
+	if !strings.HasPrefix(filepath.Base(nested), "c-") {
+		t.Errorf("history file %s isn't named for the project", nested)
+	}
+	if config.GetProjectHistoryPath("/work/b/c/") != nested {
+		t.Error("path isn't cleaned")
+	}
+	if filepath.Dir(config.GetProjectHistoryPath("/")) != filepath.Dir(nested) {
+		t.Error("root history is outside the history directory")
+	}
+
+	// History saved under the old name is moved to the new one
+	project := t.TempDir()
+	legacy := config.GetLegacyProjectHistoryPath(project)
+	if err := os.MkdirAll(filepath.Dir(legacy), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte(`{"prompt":"old prompt"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	history, err := LoadHistory(project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := history.Prompts(); len(got) != 1 || got[0] != "old prompt" {
+		t.Errorf("prompts = %q, want the legacy history", got)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy file still there: %v", err)
+	}
+}
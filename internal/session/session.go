@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,6 +27,9 @@ type Session struct {
 	UpdatedAt         time.Time     `json:"updated_at"`
 	TotalInputTokens  int           `json:"total_input_tokens"`
 	TotalOutputTokens int           `json:"total_output_tokens"`
+	TotalCacheWrite   int           `json:"total_cache_write_tokens,omitempty"`
+	TotalCacheRead    int           `json:"total_cache_read_tokens,omitempty"`
+	TotalCost         float64       `json:"total_cost_usd,omitempty"`
 	Checkpoints       []Checkpoint  `json:"checkpoints,omitempty"`
 }
 
@@ -64,13 +69,27 @@ func (s *Session) AddMessage(msg llm.Message) {
 	s.UpdatedAt = time.Now()
 }
 
-// UpdateTokens updates the token counts
-func (s *Session) UpdateTokens(input, output int) {
-	s.TotalInputTokens += input
-	s.TotalOutputTokens += output
+// AddUsage adds a request's token usage and its cost in USD
+func (s *Session) AddUsage(usage llm.Usage, cost float64) {
+	s.TotalInputTokens += usage.InputTokens
+	s.TotalOutputTokens += usage.OutputTokens
+	s.TotalCacheWrite += usage.CacheCreationInputTokens
+	s.TotalCacheRead += usage.CacheReadInputTokens
+	s.TotalCost += cost
 	s.UpdatedAt = time.Now()
 }
 
+// Usage returns the session's total token usage
+func (s *Session) Usage() llm.Usage {
+	return llm.Usage{
+		InputTokens:              s.TotalInputTokens,
+		OutputTokens:             s.TotalOutputTokens,
+		TotalTokens:              s.TotalInputTokens + s.TotalCacheWrite + s.TotalCacheRead + s.TotalOutputTokens,
+		CacheCreationInputTokens: s.TotalCacheWrite,
+		CacheReadInputTokens:     s.TotalCacheRead,
+	}
+}
+
 // CreateCheckpoint creates a new checkpoint
 func (s *Session) CreateCheckpoint(description string, files []string) *Checkpoint {
 	cp := Checkpoint{
@@ -144,6 +163,18 @@ func (s *Session) RewindTo(checkpointID string) error {
 	return nil
 }
 
+// Sidechain is a sub-agent's conversation, saved with its parent session
+type Sidechain struct {
+	AgentID     string        `json:"agent_id"`
+	SessionID   string        `json:"session_id"` // Parent session
+	AgentType   string        `json:"agent_type"`
+	Description string        `json:"description,omitempty"`
+	Model       string        `json:"model"`
+	Messages    []llm.Message `json:"messages"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
 // Manager handles session persistence
 type Manager struct {
 	sessionsDir string
@@ -277,12 +308,93 @@ func (m *Manager) List() ([]*Session, error) {
 	return sessions, nil
 }
 
-// Delete deletes a session by ID
+// Delete deletes a session by ID, with its sidechains
 func (m *Manager) Delete(id string) error {
 	path := filepath.Join(m.sessionsDir, id+".json")
+	os.RemoveAll(m.sidechainsDir(id))
 	return os.Remove(path)
 }
 
+// sidechainsDir returns the directory holding a session's sidechains
+func (m *Manager) sidechainsDir(sessionID string) string {
+	return filepath.Join(m.sessionsDir, sessionID, "agents")
+}
+
+// agentIDPattern matches agent IDs, which name sidechain files
+var agentIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// validateAgentID rejects agent IDs that would escape the sidechains dir
+func validateAgentID(agentID string) error {
+	if !agentIDPattern.MatchString(agentID) {
+		return fmt.Errorf("invalid agent ID: %q", agentID)
+	}
+	return nil
+}
+
+// SaveSidechain saves a sub-agent's conversation under its parent session
+func (m *Manager) SaveSidechain(sc *Sidechain) error {
+	if sc.SessionID == "" {
+		return fmt.Errorf("sidechain has no parent session")
+	}
+	if err := validateAgentID(sc.AgentID); err != nil {
+		return err
+	}
+
+	dir := m.sidechainsDir(sc.SessionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, sc.AgentID+".json"), data, 0644)
+}
+
+// LoadSidechain loads a sub-agent's conversation by agent ID
+func (m *Manager) LoadSidechain(sessionID, agentID string) (*Sidechain, error) {
+	if err := validateAgentID(agentID); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.sidechainsDir(sessionID), agentID+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sc Sidechain
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// ListSidechains returns a session's sidechains, oldest first
+func (m *Manager) ListSidechains(sessionID string) ([]*Sidechain, error) {
+	paths, err := filepath.Glob(filepath.Join(m.sidechainsDir(sessionID), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sidechains := make([]*Sidechain, 0, len(paths))
+	for _, path := range paths {
+		sc, err := m.LoadSidechain(sessionID, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		sidechains = append(sidechains, sc)
+	}
+
+	sort.Slice(sidechains, func(i, j int) bool {
+		return sidechains[i].CreatedAt.Before(sidechains[j].CreatedAt)
+	})
+
+	return sidechains, nil
+}
+
 // Cleanup removes old sessions
 func (m *Manager) Cleanup(maxAge time.Duration) error {
 	sessions, err := m.List()
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSidechainsRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := NewManager()
+
+	created := time.Now()
+	for i, id := range []string{"b2", "a1"} {
+		err := m.SaveSidechain(&Sidechain{
+			AgentID:   id,
+			SessionID: "session-1",
+			AgentType: "Explore",
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc, err := m.LoadSidechain("session-1", "a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.AgentType != "Explore" {
+		t.Errorf("agent type = %q, want Explore", sc.AgentType)
+	}
+
+	sidechains, err := m.ListSidechains("session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sidechains) != 2 || sidechains[0].AgentID != "b2" || sidechains[1].AgentID != "a1" {
+		t.Errorf("sidechains not listed oldest first: %+v", sidechains)
+	}
+}
+
+func TestSidechainsRejectInvalidAgentIDs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := NewManager()
+
+	for _, id := range []string{"", "../session-2", "a/b", ".hidden", "a b"} {
+		if _, err := m.LoadSidechain("session-1", id); err == nil {
+			t.Errorf("LoadSidechain(%q) succeeded", id)
+		}
+		if err := m.SaveSidechain(&Sidechain{AgentID: id, SessionID: "session-1"}); err == nil {
+			t.Errorf("SaveSidechain(%q) succeeded", id)
+		}
+	}
+}
@@ -336,6 +336,11 @@ func (m Model) GetResult() Result {
 
 // NeedsSetup checks if setup is needed
 func NeedsSetup(cfg *config.Config) bool {
+	// Local servers such as Ollama don't need a key
+	if provider, ok := cfg.Providers[cfg.DefaultProvider]; ok && !provider.NeedsAPIKey(cfg.DefaultProvider) {
+		return false
+	}
+
 	// Check if any provider has a valid API key
 	for _, provider := range cfg.Providers {
 		apiKey := provider.APIKey
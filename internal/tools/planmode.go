@@ -3,11 +3,38 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 )
 
 // PlanModeCallback is called when entering or exiting plan mode
 type PlanModeCallback func(entering bool)
 
+// PlanDecision is the user's decision on a proposed plan
+type PlanDecision int
+
+const (
+	// PlanApprovedAcceptEdits approves the plan and auto-accepts file edits
+	PlanApprovedAcceptEdits PlanDecision = iota
+	// PlanApprovedAskEdits approves the plan but asks before each edit
+	PlanApprovedAskEdits
+	// PlanKeepPlanning rejects the plan and stays in plan mode
+	PlanKeepPlanning
+)
+
+// PlanApproval is the outcome of presenting a plan to the user
+type PlanApproval struct {
+	Decision PlanDecision
+	Feedback string // Optional guidance when the user keeps planning
+}
+
+// PlanApprovalCallback presents a plan to the user and waits for a decision
+type PlanApprovalCallback func(ctx context.Context, plan string) (PlanApproval, error)
+
+// ExitPlanModeInput defines the input for the ExitPlanMode tool
+type ExitPlanModeInput struct {
+	Plan string `json:"plan"`
+}
+
 // EnterPlanModeTool allows the AI to switch into planning/read-only mode
 type EnterPlanModeTool struct {
 	BaseTool
@@ -54,7 +81,7 @@ In plan mode:
 - Use AskUserQuestion to clarify requirements
 - Call ExitPlanMode when ready to implement
 
-Write your plan and then call ExitPlanMode to get user approval.`)
+Pass your finished plan to ExitPlanMode to get user approval.`)
 
 	result.WithMetadata("mode", "plan")
 	return result, nil
@@ -63,11 +90,11 @@ Write your plan and then call ExitPlanMode to get user approval.`)
 // ExitPlanModeTool allows the AI to exit planning mode and proceed with implementation
 type ExitPlanModeTool struct {
 	BaseTool
-	callback PlanModeCallback
+	callback PlanApprovalCallback
 }
 
 // NewExitPlanModeTool creates a new ExitPlanMode tool
-func NewExitPlanModeTool(callback PlanModeCallback) *ExitPlanModeTool {
+func NewExitPlanModeTool(callback PlanApprovalCallback) *ExitPlanModeTool {
 	return &ExitPlanModeTool{
 		BaseTool: NewBaseTool(
 			"ExitPlanMode",
@@ -80,7 +107,9 @@ Only use this tool when:
 - The task requires writing code (not just research)
 
 The user will review your plan before you can proceed with implementation.`,
-			BuildSchema(map[string]interface{}{}, []string{}),
+			BuildSchema(map[string]interface{}{
+				"plan": StringProperty("The implementation plan to present for approval, in markdown", true),
+			}, []string{"plan"}),
 			false, // Doesn't require permission
 			CategoryAgent,
 		),
@@ -89,14 +118,40 @@ The user will review your plan before you can proceed with implementation.`,
 }
 
 func (t *ExitPlanModeTool) Execute(ctx context.Context, input json.RawMessage) (*Result, error) {
-	if t.callback != nil {
-		t.callback(false) // exiting plan mode
+	var params ExitPlanModeInput
+	if err := json.Unmarshal(input, &params); err != nil {
+		return NewErrorResult(fmt.Errorf("invalid input: %w", err)), nil
+	}
+
+	if params.Plan == "" {
+		return NewErrorResultString("plan is required"), nil
 	}
 
-	result := NewResult(`Plan mode deactivated. Awaiting user approval.
+	if t.callback == nil {
+		return NewErrorResultString("Plan approval not configured"), nil
+	}
+
+	approval, err := t.callback(ctx, params.Plan)
+	if err != nil {
+		return NewErrorResult(err), nil
+	}
 
-The user will review your plan. Once approved, you can proceed with implementation.`)
+	var result *Result
+	switch approval.Decision {
+	case PlanApprovedAcceptEdits:
+		result = NewResult(`The user approved your plan and enabled auto-accept for file edits. Plan mode is off; proceed with the implementation.`)
+		result.WithMetadata("mode", "acceptEdits")
+	case PlanApprovedAskEdits:
+		result = NewResult(`The user approved your plan. Plan mode is off; proceed with the implementation. The user will review each file edit.`)
+		result.WithMetadata("mode", "ask")
+	default:
+		msg := "The user did not approve your plan. You are still in plan mode: keep exploring and refine the plan, then call ExitPlanMode again."
+		if approval.Feedback != "" {
+			msg += "\n\nUser feedback: " + approval.Feedback
+		}
+		result = NewResult(msg)
+		result.WithMetadata("mode", "plan")
+	}
 
-	result.WithMetadata("mode", "normal")
 	return result, nil
 }
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/heissanjay/oscode/internal/hooks"
 	"github.com/heissanjay/oscode/internal/llm"
 )
 
@@ -20,6 +23,7 @@ type Registry struct {
 type Executor struct {
 	registry          *Registry
 	permissionChecker PermissionChecker
+	hooks             *hooks.Executor
 	onToolStart       func(name, description string)
 	onToolEnd         func(name, result string, isError bool)
 }
@@ -27,7 +31,7 @@ type Executor struct {
 // PermissionChecker checks if a tool execution is allowed
 type PermissionChecker interface {
 	Check(tool string, input map[string]interface{}) (allowed bool, err error)
-	RequestPermission(tool string, input map[string]interface{}) (bool, error)
+	RequestPermission(ctx context.Context, tool string, input map[string]interface{}) (bool, error)
 }
 
 // NewRegistry creates a new tool registry
@@ -48,6 +52,13 @@ func (r *Registry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool from the registry
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 // Get returns a tool by name
 func (r *Registry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
@@ -56,18 +67,28 @@ func (r *Registry) Get(name string) (Tool, bool) {
 	return tool, ok
 }
 
-// List returns all registered tools
+// List returns all registered tools, sorted by name
 func (r *Registry) List() []Tool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.sorted()
+}
+
+// sorted returns the tools sorted by name. Tool definitions are sent in
+// this order, which must not change between requests so that the prompt
+// cache still matches. The caller holds r.mu.
+func (r *Registry) sorted() []Tool {
 	tools := make([]Tool, 0, len(r.tools))
 	for _, tool := range r.tools {
 		tools = append(tools, tool)
 	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name() < tools[j].Name()
+	})
 	return tools
 }
 
-// ListNames returns all registered tool names
+// ListNames returns all registered tool names, sorted
 func (r *Registry) ListNames() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -75,6 +96,7 @@ func (r *Registry) ListNames() []string {
 	for name := range r.tools {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -83,7 +105,7 @@ func (r *Registry) ToLLMTools() []llm.Tool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	tools := make([]llm.Tool, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		tools = append(tools, llm.Tool{
 			Name:        tool.Name(),
 			Description: tool.Description(),
@@ -104,7 +126,7 @@ func (r *Registry) FilteredTools(names []string) []llm.Tool {
 	}
 
 	tools := make([]llm.Tool, 0)
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		if nameSet[tool.Name()] {
 			tools = append(tools, llm.Tool{
 				Name:        tool.Name(),
@@ -127,7 +149,7 @@ func (r *Registry) ExcludedTools(excludeNames []string) []llm.Tool {
 	}
 
 	tools := make([]llm.Tool, 0)
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		if !excludeSet[tool.Name()] {
 			tools = append(tools, llm.Tool{
 				Name:        tool.Name(),
@@ -139,11 +161,40 @@ func (r *Registry) ExcludedTools(excludeNames []string) []llm.Tool {
 	return tools
 }
 
+// Scoped returns a registry with only the named tools (nil = all) that
+// checks permissions with checker. Hooks and callbacks are shared with
+// this registry.
+func (r *Registry) Scoped(names []string, checker PermissionChecker) *Registry {
+	scoped := NewRegistry()
+	if names == nil {
+		for _, tool := range r.List() {
+			scoped.Register(tool)
+		}
+	} else {
+		for _, name := range names {
+			if tool, ok := r.Get(name); ok {
+				scoped.Register(tool)
+			}
+		}
+	}
+
+	scoped.executor.permissionChecker = checker
+	scoped.executor.hooks = r.executor.hooks
+	scoped.executor.onToolStart = r.executor.onToolStart
+	scoped.executor.onToolEnd = r.executor.onToolEnd
+	return scoped
+}
+
 // SetPermissionChecker sets the permission checker
 func (r *Registry) SetPermissionChecker(checker PermissionChecker) {
 	r.executor.permissionChecker = checker
 }
 
+// SetHooks sets the hook executor run around each tool call
+func (r *Registry) SetHooks(executor *hooks.Executor) {
+	r.executor.hooks = executor
+}
+
 // SetCallbacks sets the tool execution callbacks
 func (r *Registry) SetCallbacks(onStart func(name, description string), onEnd func(name, result string, isError bool)) {
 	r.executor.onToolStart = onStart
@@ -191,16 +242,54 @@ func (e *Executor) Execute(ctx context.Context, name string, input json.RawMessa
 		inputMap = make(map[string]interface{})
 	}
 
+	// Run PreToolUse hooks, which may block, rewrite the input or override
+	// the permission decision
+	var hookContext []string
+	decision := hooks.DecisionNone
+	if e.hooks != nil {
+		hookResult, err := e.hooks.Execute(ctx, hooks.Context{
+			Event:    hooks.EventPreToolUse,
+			ToolName: name,
+			Input:    inputMap,
+		})
+		if err != nil {
+			return NewErrorResult(err), nil
+		}
+		if !hookResult.Continue {
+			return NewErrorResultString(hookBlockedMessage(hooks.EventPreToolUse, hookResult.Message)), nil
+		}
+		if hookResult.Modified != nil {
+			inputMap = hookResult.Modified
+			if modified, err := json.Marshal(inputMap); err == nil {
+				input = modified
+			}
+		}
+		if hookResult.AdditionalContext != "" {
+			hookContext = append(hookContext, hookResult.AdditionalContext)
+		}
+		decision = hookResult.Decision
+	}
+
 	// Check permission if required
-	if tool.RequiresPermission() && e.permissionChecker != nil {
+	if (tool.RequiresPermission() || decision == hooks.DecisionAsk) && e.permissionChecker != nil {
 		allowed, err := e.permissionChecker.Check(name, inputMap)
+
+		switch decision {
+		case hooks.DecisionApprove:
+			allowed = true
+		case hooks.DecisionAsk:
+			allowed = false
+		}
+
+		// Hooks only choose between running and asking; denials such as
+		// plan mode's still win
 		if err != nil {
 			return NewErrorResult(err), nil
 		}
 
 		if !allowed {
 			// Request permission from user
-			granted, err := e.permissionChecker.RequestPermission(name, inputMap)
+			granted, err := e.permissionChecker.RequestPermission(ctx, name, inputMap)
 			if err != nil {
 				return NewErrorResult(err), nil
 			}
@@ -222,6 +311,29 @@ func (e *Executor) Execute(ctx context.Context, name string, input json.RawMessa
 		result = NewErrorResult(err)
 	}
 
+	// Run PostToolUse hooks; their feedback goes to the model with the result
+	if e.hooks != nil {
+		hookResult, err := e.hooks.Execute(ctx, hooks.Context{
+			Event:    hooks.EventPostToolUse,
+			ToolName: name,
+			Input:    inputMap,
+			Result:   result.Content,
+			IsError:  result.IsError,
+		})
+		if err == nil {
+			if !hookResult.Continue {
+				hookContext = append(hookContext, hookBlockedMessage(hooks.EventPostToolUse, hookResult.Message))
+			}
+			if hookResult.AdditionalContext != "" {
+				hookContext = append(hookContext, hookResult.AdditionalContext)
+			}
+		}
+	}
+
+	if len(hookContext) > 0 {
+		result.Content += "\n\n" + strings.Join(hookContext, "\n")
+	}
+
 	// Notify end
 	if e.onToolEnd != nil {
 		e.onToolEnd(name, result.Content, result.IsError)
@@ -230,6 +342,14 @@ func (e *Executor) Execute(ctx context.Context, name string, input json.RawMessa
 	return result, nil
 }
 
+// hookBlockedMessage formats a blocking hook's reason for the model
+func hookBlockedMessage(event hooks.Event, reason string) string {
+	if reason == "" {
+		return fmt.Sprintf("Blocked by %s hook", event)
+	}
+	return fmt.Sprintf("Blocked by %s hook: %s", event, reason)
+}
+
 // getToolDescription extracts a meaningful description from tool input
 func getToolDescription(toolName string, input map[string]interface{}) string {
 	switch toolName {
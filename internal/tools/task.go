@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // TaskInput defines the input for the Task tool
@@ -13,6 +15,7 @@ type TaskInput struct {
 	SubagentType string `json:"subagent_type"`
 	Model        string `json:"model,omitempty"`
 	Background   bool   `json:"run_in_background,omitempty"`
+	Resume       string `json:"resume,omitempty"` // Agent ID to continue
 }
 
 // TaskResult represents the result of a task execution
@@ -25,36 +28,67 @@ type TaskResult struct {
 // TaskExecutor is called to execute a subagent task
 type TaskExecutor func(ctx context.Context, input TaskInput) (*TaskResult, error)
 
+// TaskAgentType describes a kind of subagent the Task tool can launch
+type TaskAgentType struct {
+	Name        string
+	Description string
+}
+
 // TaskTool spawns subagent tasks
 type TaskTool struct {
 	BaseTool
-	executor TaskExecutor
+	executor   TaskExecutor
+	agentTypes func() []TaskAgentType
 }
 
-// NewTaskTool creates a new Task tool
-func NewTaskTool(executor TaskExecutor) *TaskTool {
+// NewTaskTool creates a new Task tool. agentTypes is called whenever the
+// schema is built, so agents added at runtime are offered to the model.
+func NewTaskTool(executor TaskExecutor, agentTypes func() []TaskAgentType) *TaskTool {
 	return &TaskTool{
 		BaseTool: NewBaseTool(
 			"Task",
 			"Launch a new agent to handle complex, multi-step tasks autonomously. Use for research, exploration, and specialized tasks.",
-			BuildSchema(map[string]interface{}{
-				"description": StringProperty("Short (3-5 word) description of the task", true),
-				"prompt":      StringProperty("Detailed task description with all necessary context", true),
-				"subagent_type": map[string]interface{}{
-					"type":        "string",
-					"description": "Type of agent to use: 'general-purpose', 'Explore', 'Plan'",
-					"enum":        []string{"general-purpose", "Explore", "Plan"},
-				},
-				"model":             StringProperty("Optional model override (sonnet, opus, haiku)", false),
-				"run_in_background": BoolProperty("Run agent in background"),
-			}, []string{"description", "prompt", "subagent_type"}),
+			nil,
 			false, // Task doesn't require permission
 			CategoryAgent,
 		),
-		executor: executor,
+		executor:   executor,
+		agentTypes: agentTypes,
 	}
 }
 
+// Description lists the available agent types after the tool description
+func (t *TaskTool) Description() string {
+	var sb strings.Builder
+	sb.WriteString(t.BaseTool.Description())
+	sb.WriteString("\n\nAvailable agent types:")
+	for _, agentType := range t.agentTypes() {
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", agentType.Name, agentType.Description))
+	}
+	return sb.String()
+}
+
+// InputSchema enumerates the available agent types
+func (t *TaskTool) InputSchema() map[string]interface{} {
+	names := make([]string, 0)
+	for _, agentType := range t.agentTypes() {
+		names = append(names, agentType.Name)
+	}
+
+	return BuildSchema(map[string]interface{}{
+		"description": StringProperty("Short (3-5 word) description of the task", true),
+		"prompt":      StringProperty("Detailed task description with all necessary context", true),
+		"subagent_type": map[string]interface{}{
+			"type":        "string",
+			"description": "Type of agent to use",
+			"enum":        names,
+		},
+		"model":             StringProperty("Optional model override: an alias like sonnet, a model name, or provider/model", false),
+		"run_in_background": BoolProperty("Run agent in background. Check on it or get its result with AgentOutput."),
+		"resume":            StringProperty("ID of a previous agent to continue, with prompt as the follow-up", false),
+	}, []string{"description", "prompt", "subagent_type"})
+}
+
 func (t *TaskTool) Execute(ctx context.Context, input json.RawMessage) (*Result, error) {
 	var params TaskInput
 	if err := json.Unmarshal(input, &params); err != nil {
@@ -64,7 +98,7 @@ func (t *TaskTool) Execute(ctx context.Context, input json.RawMessage) (*Result,
 	if params.Prompt == "" {
 		return NewErrorResultString("prompt is required"), nil
 	}
-	if params.SubagentType == "" {
+	if params.SubagentType == "" && params.Resume == "" {
 		params.SubagentType = "general-purpose"
 	}
 
@@ -80,10 +114,141 @@ func (t *TaskTool) Execute(ctx context.Context, input json.RawMessage) (*Result,
 	output := NewResult(result.Result)
 	output.WithMetadata("agent_id", result.AgentID)
 	output.WithMetadata("status", result.Status)
+	if result.Status == "error" {
+		output.IsError = true
+	}
+
+	return output, nil
+}
+
+// AgentStatus describes a background agent's progress
+type AgentStatus struct {
+	AgentID     string
+	AgentType   string
+	Description string
+	State       string // running, completed, failed or cancelled
+	ToolCalls   int
+	Result      string
+	Error       string
+	Elapsed     time.Duration
+}
+
+// AgentStatusFunc returns a background agent's status, first waiting up to
+// timeout for it to finish if wait is set
+type AgentStatusFunc func(ctx context.Context, agentID string, wait bool, timeout time.Duration) (*AgentStatus, error)
+
+// AgentOutputTool checks on and retrieves results from background agents
+type AgentOutputTool struct {
+	BaseTool
+	status AgentStatusFunc
+}
+
+// NewAgentOutputTool creates a new AgentOutput tool
+func NewAgentOutputTool(status AgentStatusFunc) *AgentOutputTool {
+	return &AgentOutputTool{
+		BaseTool: NewBaseTool(
+			"AgentOutput",
+			"Retrieves the status and result of an agent started with run_in_background. Set wait to false to check progress without blocking.",
+			BuildSchema(map[string]interface{}{
+				"agent_id": StringProperty("The ID of the background agent", true),
+				"wait":     BoolProperty("Wait for the agent to finish (default: true)"),
+				"timeout":  IntProperty("Maximum seconds to wait (default: 300)"),
+			}, []string{"agent_id"}),
+			false, // Doesn't require permission
+			CategoryAgent,
+		),
+		status: status,
+	}
+}
+
+func (t *AgentOutputTool) Execute(ctx context.Context, input json.RawMessage) (*Result, error) {
+	var params struct {
+		AgentID string `json:"agent_id"`
+		Wait    *bool  `json:"wait,omitempty"`
+		Timeout int    `json:"timeout,omitempty"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return NewErrorResult(fmt.Errorf("invalid input: %w", err)), nil
+	}
 
+	if params.AgentID == "" {
+		return NewErrorResultString("agent_id is required"), nil
+	}
+
+	wait := true
+	if params.Wait != nil {
+		wait = *params.Wait
+	}
+	timeout := 300 * time.Second
+	if params.Timeout > 0 {
+		timeout = time.Duration(params.Timeout) * time.Second
+	}
+
+	status, err := t.status(ctx, params.AgentID, wait, timeout)
+	if err != nil {
+		return NewErrorResult(err), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Agent %s (%s): %s after %s, %d tool calls\n",
+		status.AgentID, status.AgentType, status.State, status.Elapsed.Round(time.Second), status.ToolCalls))
+	switch status.State {
+	case "running":
+		sb.WriteString("Still running. Call AgentOutput again to wait for the result.")
+	case "completed":
+		sb.WriteString("\n" + status.Result)
+	default:
+		sb.WriteString("Error: " + status.Error)
+	}
+
+	output := NewResult(sb.String())
+	output.WithMetadata("agent_id", status.AgentID)
+	output.WithMetadata("status", status.State)
+	output.IsError = status.State == "failed"
 	return output, nil
 }
 
+// KillAgentTool cancels a running background agent
+type KillAgentTool struct {
+	BaseTool
+	cancel func(agentID string) error
+}
+
+// NewKillAgentTool creates a new KillAgent tool
+func NewKillAgentTool(cancel func(agentID string) error) *KillAgentTool {
+	return &KillAgentTool{
+		BaseTool: NewBaseTool(
+			"KillAgent",
+			"Cancels a running background agent by its ID. Its work so far is discarded.",
+			BuildSchema(map[string]interface{}{
+				"agent_id": StringProperty("The ID of the background agent to cancel", true),
+			}, []string{"agent_id"}),
+			false, // Only stops work the model started
+			CategoryAgent,
+		),
+		cancel: cancel,
+	}
+}
+
+func (t *KillAgentTool) Execute(ctx context.Context, input json.RawMessage) (*Result, error) {
+	var params struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return NewErrorResult(fmt.Errorf("invalid input: %w", err)), nil
+	}
+
+	if params.AgentID == "" {
+		return NewErrorResultString("agent_id is required"), nil
+	}
+
+	if err := t.cancel(params.AgentID); err != nil {
+		return NewErrorResult(err), nil
+	}
+
+	return NewResult(fmt.Sprintf("Successfully cancelled agent: %s", params.AgentID)), nil
+}
+
 // TodoInput defines the input for the TodoWrite tool
 type TodoInput struct {
 	Todos []TodoItem `json:"todos"`
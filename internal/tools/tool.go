@@ -50,6 +50,9 @@ type Result struct {
 
 	// Metadata contains additional metadata about the execution
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// Images are returned to the model alongside the content
+	Images []llm.ImageBlock `json:"images,omitempty"`
 }
 
 // NewResult creates a new successful result
@@ -91,6 +94,7 @@ func (r *Result) ToToolResult(toolUseID string) *llm.ToolResult {
 		ToolUseID: toolUseID,
 		Content:   r.Content,
 		IsError:   r.IsError,
+		Images:    r.Images,
 	}
 }
 
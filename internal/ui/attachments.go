@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/heissanjay/oscode/internal/llm"
+	"github.com/heissanjay/oscode/internal/utils"
+)
+
+// clipboardImageMsg carries an image pasted from the clipboard
+type clipboardImageMsg struct {
+	Path  string
+	Error error
+}
+
+// pasteClipboardImage saves an image on the clipboard to a temp file. It
+// sends nothing when the clipboard holds no image.
+func pasteClipboardImage() tea.Msg {
+	path, err := utils.ClipboardImage(utils.ClipboardImageDir())
+	if path == "" && err == nil {
+		return nil
+	}
+	return clipboardImageMsg{Path: path, Error: err}
+}
+
+// attach adds an image to the next message, once
+func (m *Model) attach(paths ...string) {
+	for _, path := range paths {
+		duplicate := false
+		for _, existing := range m.attachments {
+			duplicate = duplicate || existing == path
+		}
+		if !duplicate {
+			m.attachments = append(m.attachments, path)
+		}
+	}
+}
+
+// detach removes the last attached image, or all of them, deleting
+// images saved from the clipboard
+func (m *Model) detach(all bool) {
+	removed := m.attachments
+	if !all {
+		removed = m.attachments[len(m.attachments)-1:]
+	}
+	for _, path := range removed {
+		utils.RemoveClipboardImage(path)
+	}
+	m.attachments = m.attachments[:len(m.attachments)-len(removed)]
+}
+
+// withAttachments adds the attached images to a message as @path mentions,
+// which the app turns into image blocks
+func (m *Model) withAttachments(input string) string {
+	mentions := []string{input}
+	for _, path := range m.attachments {
+		if strings.ContainsAny(path, " \t") {
+			mentions = append(mentions, `@"`+path+`"`)
+		} else {
+			mentions = append(mentions, "@"+path)
+		}
+	}
+	return strings.TrimSpace(strings.Join(mentions, " "))
+}
+
+// attachmentLabels names the attached images for display
+func (m *Model) attachmentLabels() []string {
+	labels := make([]string, len(m.attachments))
+	for i, path := range m.attachments {
+		labels[i] = "📎 " + filepath.Base(path)
+	}
+	return labels
+}
+
+// renderAttachments shows a chip for each attached image above the input
+func (m Model) renderAttachments() string {
+	if len(m.attachments) == 0 {
+		return ""
+	}
+	var chips []string
+	for _, label := range m.attachmentLabels() {
+		chips = append(chips, AttachmentChipStyle.Render(label))
+	}
+	hint := TextMutedStyle.Render("backspace to remove")
+	return lipgloss.JoinHorizontal(lipgloss.Top, strings.Join(chips, " "), " ", hint) + "\n"
+}
+
+// pastedImagePaths returns the image files named by pasted text, such as
+// files dropped onto the terminal. It returns nil unless every path in the
+// text is an existing image.
+func pastedImagePaths(text string) []string {
+	var paths []string
+	for _, field := range splitPastedPaths(strings.TrimSpace(text)) {
+		path := field
+		if strings.HasPrefix(path, "file://") {
+			unescaped, err := url.PathUnescape(strings.TrimPrefix(path, "file://"))
+			if err != nil {
+				return nil
+			}
+			path = unescaped
+		}
+		if !llm.IsImageFile(path) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// splitPastedPaths splits pasted text into paths the way a shell would,
+// honoring the quotes and escaped spaces terminals use for dropped files
+func splitPastedPaths(text string) []string {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+	escaped, inField := false, false
+
+	for _, r := range text {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'' && runtime.GOOS != "windows":
+			escaped, inField = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
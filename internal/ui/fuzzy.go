@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxMentionSuggestions caps the @mention completions offered
+const maxMentionSuggestions = 20
+
+// fuzzyScore scores how well a pattern matches a candidate, with the
+// pattern's characters appearing in order. Matches at the start of a path
+// segment or word, runs of characters and matches in the last segment
+// score higher, and shorter candidates win ties. ok is false when the
+// pattern doesn't match.
+func fuzzyScore(candidate, pattern string) (score int, ok bool) {
+	candidate, pattern = strings.ToLower(candidate), strings.ToLower(pattern)
+	if pattern == "" {
+		return 0, true
+	}
+
+	base := strings.LastIndex(strings.TrimSuffix(candidate, "/"), "/") + 1
+	p, last := 0, -2
+	for i := 0; i < len(candidate) && p < len(pattern); i++ {
+		if candidate[i] != pattern[p] {
+			continue
+		}
+		score++
+		if i == 0 || strings.ContainsRune("/_-. ", rune(candidate[i-1])) {
+			score += 5
+		}
+		if i == last+1 {
+			score += 3
+		}
+		if i >= base {
+			score += 2
+		}
+		last = i
+		p++
+	}
+	if p < len(pattern) {
+		return 0, false
+	}
+	return score*100 - len(candidate), true
+}
+
+// fuzzyFilter returns the items matching a pattern by ID, or failing that
+// by description, best first
+func fuzzyFilter(items []SelectionItem, pattern string) []SelectionItem {
+	type scored struct {
+		item  SelectionItem
+		score int
+	}
+	var matches []scored
+	for _, item := range items {
+		if score, ok := fuzzyScore(item.ID, pattern); ok {
+			matches = append(matches, scored{item, score})
+		} else if pattern != "" && strings.Contains(strings.ToLower(item.Description), strings.ToLower(pattern)) {
+			matches = append(matches, scored{item, -len(item.ID)})
+		}
+	}
+
+	// With no pattern, the source's order stands
+	if pattern != "" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].score > matches[j].score
+		})
+	}
+
+	var result []SelectionItem
+	for i := 0; i < len(matches) && i < maxMentionSuggestions; i++ {
+		result = append(result, matches[i].item)
+	}
+	return result
+}
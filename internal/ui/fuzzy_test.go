@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	// Patterns match when their characters appear in order
+	for _, tt := range []struct {
+		candidate, pattern string
+		ok                 bool
+	}{
+		{"internal/app/app.go", "", true},
+		{"internal/app/app.go", "app", true},
+		{"internal/app/app.go", "iaa", true},
+		{"internal/app/app.go", "APP", true},
+		{"internal/app/app.go", "gop", false},
+		{"main.go", "main.go.bak", false},
+	} {
+		if _, ok := fuzzyScore(tt.candidate, tt.pattern); ok != tt.ok {
+			t.Errorf("fuzzyScore(%q, %q) ok = %v, want %v", tt.candidate, tt.pattern, ok, tt.ok)
+		}
+	}
+
+	// Each pair is better match first
+	for _, tt := range []struct {
+		pattern, better, worse, why string
+	}{
+		{"mod", "go.mod", "cmd/oscode/main.go", "a run of characters"},
+		{"ui", "internal/ui/", "build/output.txt", "matches at segment starts"},
+		{"app", "internal/app/app.go", "internal/app/mentions.go", "matches in the last segment"},
+		{"main", "main.go", "cmd/main.go", "shorter candidate on a tie"},
+	} {
+		better, _ := fuzzyScore(tt.better, tt.pattern)
+		worse, _ := fuzzyScore(tt.worse, tt.pattern)
+		if better <= worse {
+			t.Errorf("%q: %q scored %d, %q scored %d; want the first higher for %s", tt.pattern, tt.better, better, tt.worse, worse, tt.why)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	items := []SelectionItem{
+		{ID: "cmd/oscode/main.go"},
+		{ID: "main.go"},
+		{ID: "README.md"},
+		{ID: "docs:guide", Description: "Main guide"},
+	}
+	ids := func(items []SelectionItem) []string {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	// Description matches come after ID matches
+	want := []string{"main.go", "cmd/oscode/main.go", "docs:guide"}
+	if got := ids(fuzzyFilter(items, "main")); !reflect.DeepEqual(got, want) {
+		t.Errorf("filter main = %v, want %v", got, want)
+	}
+
+	// With no pattern the source's order stands
+	if got := ids(fuzzyFilter(items, "")); !reflect.DeepEqual(got, ids(items)) {
+		t.Errorf("filter empty = %v", got)
+	}
+
+	many := make([]SelectionItem, maxMentionSuggestions+5)
+	for i := range many {
+		many[i] = SelectionItem{ID: "file.go"}
+	}
+	if got := len(fuzzyFilter(many, "f")); got != maxMentionSuggestions {
+		t.Errorf("got %d suggestions, want %d", got, maxMentionSuggestions)
+	}
+}
@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// historyPreviewLines caps the lines of a match shown while searching
+const historyPreviewLines = 5
+
+// SetHistory seeds the prompt history, oldest first. onAdd is called with
+// each prompt submitted, to save it.
+func (m *Model) SetHistory(prompts []string, onAdd func(string)) {
+	m.history = append([]string{}, prompts...)
+	m.historyIndex = len(m.history)
+	m.onHistory = onAdd
+}
+
+// addHistory records a submitted prompt, moving an earlier copy of it to
+// the end
+func (m *Model) addHistory(prompt string) {
+	for i, existing := range m.history {
+		if existing == prompt {
+			m.history = append(m.history[:i], m.history[i+1:]...)
+			break
+		}
+	}
+	m.history = append(m.history, prompt)
+	m.historyIndex = len(m.history)
+	if m.onHistory != nil {
+		m.onHistory(prompt)
+	}
+}
+
+// startHistorySearch begins a reverse incremental search of the history
+func (m *Model) startHistorySearch() {
+	m.searchingHistory = true
+	m.historyQuery = ""
+	m.historyMatch = len(m.history) - 1
+	m.searchOriginal = m.textarea.Value()
+	m.showingSuggestions = false
+}
+
+// findHistory returns the newest entry at or before from containing the
+// query, or -1
+func (m *Model) findHistory(query string, from int) int {
+	query = strings.ToLower(query)
+	for i := from; i >= 0 && i < len(m.history); i-- {
+		if strings.Contains(strings.ToLower(m.history[i]), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleHistorySearchKeys handles keys while searching the history: typing
+// narrows the search, Ctrl+R finds an older match, Enter puts the match in
+// the input and Esc puts back what was there
+func (m Model) handleHistorySearchKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+r":
+		if m.historyMatch > 0 {
+			if i := m.findHistory(m.historyQuery, m.historyMatch-1); i >= 0 {
+				m.historyMatch = i
+			}
+		}
+		return m, nil
+
+	case "enter", "tab", "right", "end":
+		m.searchingHistory = false
+		if m.historyMatch >= 0 {
+			m.textarea.SetValue(m.history[m.historyMatch])
+			m.historyIndex = m.historyMatch
+		}
+		m.textarea.CursorEnd()
+		return m, nil
+
+	case "esc", "ctrl+c", "ctrl+g":
+		m.searchingHistory = false
+		m.textarea.SetValue(m.searchOriginal)
+		m.textarea.CursorEnd()
+		return m, nil
+
+	case "backspace":
+		if query := []rune(m.historyQuery); len(query) > 0 {
+			m.historyQuery = string(query[:len(query)-1])
+		}
+		m.historyMatch = m.findHistory(m.historyQuery, len(m.history)-1)
+		return m, nil
+	}
+
+	if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+		m.historyQuery += string(msg.Runes)
+		from := m.historyMatch
+		if from < 0 {
+			from = len(m.history) - 1
+		}
+		m.historyMatch = m.findHistory(m.historyQuery, from)
+	}
+	return m, nil
+}
+
+// renderHistorySearch shows the search query and a preview of the match
+func (m Model) renderHistorySearch() string {
+	label := "(reverse-i-search)"
+	if m.historyMatch < 0 {
+		label = "(failing reverse-i-search)"
+	}
+	var b strings.Builder
+	b.WriteString(TextMutedStyle.Render(label+"`") + InputTextStyle.Render(m.historyQuery) + TextMutedStyle.Render("`: "))
+
+	if m.historyMatch >= 0 {
+		width := m.width - 6
+		if width < 20 {
+			width = 20
+		}
+		lines := strings.Split(m.history[m.historyMatch], "\n")
+		for i, line := range lines {
+			if i == historyPreviewLines {
+				b.WriteString("\n" + TextMutedStyle.Render(fmt.Sprintf("  ... %d more lines", len(lines)-i)))
+				break
+			}
+			if len([]rune(line)) > width {
+				line = string([]rune(line)[:width-1]) + "…"
+			}
+			if i > 0 {
+				b.WriteString("\n  ")
+			}
+			b.WriteString(highlightMatch(line, m.historyQuery))
+		}
+	}
+
+	b.WriteString("\n" + TextMutedStyle.Render("ctrl+r older · enter use · esc cancel"))
+	return b.String()
+}
+
+// highlightMatch styles the first occurrence of query in line
+func highlightMatch(line, query string) string {
+	i := strings.Index(strings.ToLower(line), strings.ToLower(query))
+	if query == "" || i < 0 || i+len(query) > len(line) {
+		return TextPrimaryStyle.Render(line)
+	}
+	end := i + len(query)
+	return TextPrimaryStyle.Render(line[:i]) + SelectionSelectedStyle.Render(line[i:end]) + TextPrimaryStyle.Render(line[end:])
+}
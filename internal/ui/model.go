@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ const (
 	StateInput State = iota
 	StateProcessing
 	StatePermissionPrompt
+	StatePlanApproval
 	StateError
 	StateQuitting
 )
@@ -31,6 +33,8 @@ const (
 	MessageTypeSystem
 	MessageTypeTool
 	MessageTypeError
+	MessageTypeThinking
+	MessageTypeWarning
 )
 
 // DisplayMessage represents a message to display
@@ -47,6 +51,7 @@ type DisplayMessage struct {
 type PermissionRequest struct {
 	Tool        string
 	Description string
+	Agent       string // Sub-agent asking, empty for the main conversation
 	Command     string
 	FilePath    string          // For file operations
 	OldContent  string          // For Edit: content being replaced
@@ -62,6 +67,26 @@ type PermissionResponse struct {
 	Feedback     string // If rejected, user can explain why
 }
 
+// PlanChoice represents the user's decision on a proposed plan
+type PlanChoice int
+
+const (
+	PlanChoiceAcceptEdits  PlanChoice = iota // Approve and auto-accept edits
+	PlanChoiceAskEdits                       // Approve but ask before each edit
+	PlanChoiceKeepPlanning                   // Keep planning, with optional feedback
+)
+
+// PlanApprovalRequest represents a plan awaiting the user's approval
+type PlanApprovalRequest struct {
+	Plan string
+}
+
+// PlanApprovalResponse represents the user's response to a plan
+type PlanApprovalResponse struct {
+	Choice   PlanChoice
+	Feedback string
+}
+
 // Model represents the main UI model
 type Model struct {
 	// UI state
@@ -97,14 +122,24 @@ type Model struct {
 	permissionChoice   int  // 0=yes, 1=yes always, 2=no with feedback
 	rejectingWithInput bool // User is typing rejection feedback
 
+	// Plan approval handling
+	planRequest       *PlanApprovalRequest
+	planChoice        PlanChoice
+	planFeedbackInput bool // User is typing feedback for the plan
+	permissionMode    string
+
 	// Streaming state
-	streamingContent string
-	isStreaming      bool
-	currentVerb      string // Dynamic verb for spinner (Thinking, Reading, etc.)
+	streamingContent  string
+	streamingThinking string // Reasoning streamed before the answer
+	isStreaming       bool
+	currentVerb       string // Dynamic verb for spinner (Thinking, Reading, etc.)
 
 	// Verbose mode
 	verbose bool
 
+	// Expand thinking sections
+	showThinking bool
+
 	// Vim mode
 	vimMode   bool
 	vimNormal bool
@@ -112,17 +147,39 @@ type Model struct {
 	// Error message
 	errorMsg string
 
+	// Background agents still running
+	backgroundAgents []BackgroundAgentInfo
+
+	// Images attached to the next message
+	attachments []string
+
+	// Reverse history search (Ctrl+R)
+	searchingHistory bool
+	historyQuery     string
+	historyMatch     int    // Index of the matching entry, -1 for none
+	searchOriginal   string // Input before the search, restored on cancel
+
 	// Command suggestions
 	showingSuggestions bool
 	suggestions        []SelectionItem
 	suggestionCursor   int
+	mentionPrefix      string // Input before the @mention being completed
+	completingMention  bool
+
+	// Dynamic suggestion sources (set by app)
+	commandSource   func() []SelectionItem
+	mentionSource   func() []SelectionItem
+	refreshMentions tea.Cmd // Brings the mention source up to date
 
 	// Event handlers (set by app)
 	onSubmit         func(string) tea.Cmd
+	onHistory        func(string)
 	onPermission     func(PermissionResponse)
 	onQuit           func()
 	onModelChange    func(string)
 	onProviderChange func(string)
+	onPlanApproval   func(PlanApprovalResponse)
+	onModeCycle      func() string
 }
 
 // allCommands is the list of all available commands for suggestions
@@ -132,6 +189,9 @@ var allCommands = []SelectionItem{
 	{ID: "provider", Label: "/provider", Description: "Switch provider"},
 	{ID: "clear", Label: "/clear", Description: "Clear conversation"},
 	{ID: "compact", Label: "/compact", Description: "Compact conversation"},
+	{ID: "hooks", Label: "/hooks", Description: "List configured hooks"},
+	{ID: "mcp", Label: "/mcp", Description: "Manage MCP servers"},
+	{ID: "agents", Label: "/agents", Description: "Manage sub-agents"},
 	{ID: "cost", Label: "/cost", Description: "Show token usage"},
 	{ID: "vim", Label: "/vim", Description: "Toggle vim mode"},
 	{ID: "verbose", Label: "/verbose", Description: "Toggle verbose"},
@@ -144,7 +204,14 @@ func (m *Model) updateSuggestions(filter string) {
 	m.suggestions = nil
 	m.suggestionCursor = 0
 
-	for _, cmd := range allCommands {
+	m.completingMention = false
+
+	candidates := allCommands
+	if m.commandSource != nil {
+		candidates = append(append([]SelectionItem{}, allCommands...), m.commandSource()...)
+	}
+
+	for _, cmd := range candidates {
 		if strings.HasPrefix(strings.ToLower(cmd.ID), filter) ||
 			strings.Contains(strings.ToLower(cmd.Label), filter) {
 			m.suggestions = append(m.suggestions, cmd)
@@ -152,6 +219,33 @@ func (m *Model) updateSuggestions(filter string) {
 	}
 }
 
+// updateMentionSuggestions suggests @mentions fuzzy-matching the word
+// being typed. prefix is the input before the mention.
+func (m *Model) updateMentionSuggestions(prefix, filter string) {
+	filter = strings.ToLower(filter)
+	m.suggestions = nil
+	m.suggestionCursor = 0
+	m.mentionPrefix = prefix
+	m.completingMention = true
+
+	if m.mentionSource == nil {
+		return
+	}
+	m.suggestions = fuzzyFilter(m.mentionSource(), filter)
+}
+
+// completeMention replaces the @mention being typed with the selected one
+func (m *Model) completeMention(item SelectionItem) {
+	mention := "@" + item.ID
+	if strings.ContainsAny(item.ID, " \t") {
+		mention = `@"` + item.ID + `"`
+	}
+	m.textarea.SetValue(m.mentionPrefix + mention + " ")
+	m.textarea.CursorEnd()
+	m.showingSuggestions = false
+	m.completingMention = false
+}
+
 // NewModel creates a new UI model
 func NewModel() Model {
 	// Create textarea for input - single line, minimal style
@@ -203,11 +297,13 @@ func NewModel() Model {
 			{ID: "o1-mini", Label: "o1-mini", Description: "Fast reasoning"},
 			{ID: "claude-sonnet-4-20250514", Label: "claude-sonnet-4", Description: "Best for coding"},
 			{ID: "claude-opus-4-20250514", Label: "claude-opus-4", Description: "Most capable"},
-			{ID: "claude-haiku-3-5-20241022", Label: "claude-haiku-3.5", Description: "Fast Claude"},
+			{ID: "claude-3-5-haiku-20241022", Label: "claude-3.5-haiku", Description: "Fast Claude"},
 		},
 		availableProviders: []SelectionItem{
 			{ID: "openai", Label: "OpenAI", Description: "GPT models", Selected: true},
 			{ID: "anthropic", Label: "Anthropic", Description: "Claude models"},
+			{ID: "gemini", Label: "Gemini", Description: "Google Gemini models"},
+			{ID: "ollama", Label: "Ollama", Description: "Local models"},
 		},
 	}
 }
@@ -225,6 +321,29 @@ func (m *Model) SetChangeHandlers(onModelChange func(string), onProviderChange f
 	m.onProviderChange = onProviderChange
 }
 
+// SetPlanHandlers sets the plan approval and permission mode handlers.
+// onModeCycle switches to the next permission mode and returns its name.
+func (m *Model) SetPlanHandlers(onPlanApproval func(PlanApprovalResponse), onModeCycle func() string) {
+	m.onPlanApproval = onPlanApproval
+	m.onModeCycle = onModeCycle
+}
+
+// SetSuggestionSources sets providers for extra slash commands and
+// @mention completions, which may change while the program runs. The
+// mention source must return quickly; refreshMentions runs while a mention
+// is typed, off the update loop, and returns MentionsUpdatedMsg when there
+// are new completions.
+func (m *Model) SetSuggestionSources(commands, mentions func() []SelectionItem, refreshMentions tea.Cmd) {
+	m.commandSource = commands
+	m.mentionSource = mentions
+	m.refreshMentions = refreshMentions
+}
+
+// SetPermissionMode sets the permission mode shown in the status bar
+func (m *Model) SetPermissionMode(mode string) {
+	m.permissionMode = mode
+}
+
 // ShowModelSelection shows the model selection menu
 func (m *Model) ShowModelSelection() {
 	// Update selected state based on current model
@@ -274,6 +393,9 @@ func (m *Model) ShowCommandPalette(filter string) {
 		{ID: "provider", Label: "/provider", Description: "Switch provider"},
 		{ID: "clear", Label: "/clear", Description: "Clear conversation"},
 		{ID: "compact", Label: "/compact", Description: "Compact conversation"},
+		{ID: "hooks", Label: "/hooks", Description: "List configured hooks"},
+		{ID: "mcp", Label: "/mcp", Description: "Manage MCP servers"},
+		{ID: "agents", Label: "/agents", Description: "Manage sub-agents"},
 		{ID: "cost", Label: "/cost", Description: "Show token usage"},
 		{ID: "vim", Label: "/vim", Description: "Toggle vim mode"},
 		{ID: "verbose", Label: "/verbose", Description: "Toggle verbose"},
@@ -348,6 +470,15 @@ func (m *Model) AddSystemMessage(content string) {
 	})
 }
 
+// AddWarningMessage adds a warning, such as a request being retried
+func (m *Model) AddWarningMessage(content string) {
+	m.AddMessage(DisplayMessage{
+		Type:      MessageTypeWarning,
+		Content:   content,
+		Timestamp: time.Now(),
+	})
+}
+
 // AddErrorMessage adds an error message
 func (m *Model) AddErrorMessage(content string) {
 	m.AddMessage(DisplayMessage{
@@ -358,12 +489,57 @@ func (m *Model) AddErrorMessage(content string) {
 	})
 }
 
+// AppendThinking appends streamed reasoning
+func (m *Model) AppendThinking(content string) {
+	m.streamingThinking += content
+	m.updateViewport()
+}
+
+// flushThinking moves streamed reasoning into the conversation once the
+// model moves on to its answer or a tool call
+func (m *Model) flushThinking() {
+	if strings.TrimSpace(m.streamingThinking) == "" {
+		m.streamingThinking = ""
+		return
+	}
+	thinking := strings.TrimSpace(m.streamingThinking)
+	m.streamingThinking = ""
+	m.AddMessage(DisplayMessage{
+		Type:      MessageTypeThinking,
+		Content:   thinking,
+		Timestamp: time.Now(),
+	})
+}
+
+// ToggleThinking expands or collapses thinking sections
+func (m *Model) ToggleThinking() {
+	m.showThinking = !m.showThinking
+	m.updateViewport()
+}
+
+// renderThinking renders reasoning, collapsed to a summary line unless
+// thinking sections are expanded
+func (m *Model) renderThinking(content string, streaming bool) string {
+	label := "Thinking"
+	if streaming {
+		label = "Thinking…"
+	}
+	if !m.showThinking {
+		lines := strings.Count(content, "\n") + 1
+		return ThinkingStyle.Render(fmt.Sprintf("%s %s (%d lines) · ctrl+t to expand", IconThinking, label, lines))
+	}
+	header := ThinkingStyle.Render(fmt.Sprintf("%s %s · ctrl+t to collapse", IconThinking, label))
+	body := ThinkingStyle.Width(m.viewport.Width - 4).Render(content)
+	return header + "\n" + lipgloss.NewStyle().PaddingLeft(2).Render(body)
+}
+
 // SetStreaming starts or stops streaming mode
 func (m *Model) SetStreaming(streaming bool) {
 	m.isStreaming = streaming
 	if streaming {
 		m.state = StateProcessing
 		m.streamingContent = ""
+		m.streamingThinking = ""
 		m.currentVerb = GetSpinnerVerb("default") // Reset to "Thinking"
 	} else {
 		m.state = StateInput
@@ -405,6 +581,7 @@ func (m *Model) ShowPermissionPrompt(req *PermissionRequest) {
 func (m *Model) ClearMessages() {
 	m.messages = make([]DisplayMessage, 0)
 	m.streamingContent = ""
+	m.streamingThinking = ""
 	m.updateViewport()
 }
 
@@ -523,12 +700,27 @@ func (m *Model) renderMessages() string {
 			flushTools()
 			sb.WriteString(RenderError(msg.Content))
 			sb.WriteString("\n\n")
+
+		case MessageTypeWarning:
+			flushTools()
+			sb.WriteString(RenderWarning(msg.Content))
+			sb.WriteString("\n\n")
+
+		case MessageTypeThinking:
+			flushTools()
+			sb.WriteString(m.renderThinking(msg.Content, false))
+			sb.WriteString("\n\n")
 		}
 	}
 
 	// Flush any remaining tools
 	flushTools()
 
+	if m.isStreaming && m.streamingThinking != "" {
+		sb.WriteString(m.renderThinking(strings.TrimSpace(m.streamingThinking), true))
+		sb.WriteString("\n\n")
+	}
+
 	// Add streaming content with cursor (no label - like Claude Code)
 	if m.isStreaming && m.streamingContent != "" {
 		rendered := RenderMarkdownStreaming(m.streamingContent, m.viewport.Width)
@@ -564,6 +756,26 @@ type PermissionRequestMsg struct {
 	Request *PermissionRequest
 }
 
+// PlanApprovalRequestMsg is sent to present a plan for approval
+type PlanApprovalRequestMsg struct {
+	Request *PlanApprovalRequest
+}
+
+// PermissionModeMsg is sent when the permission mode changes outside the UI
+type PermissionModeMsg struct {
+	Mode string
+}
+
+// BackgroundAgentInfo describes a running background agent for the panel
+type BackgroundAgentInfo struct {
+	ID          string
+	Type        string
+	Description string
+	ToolCalls   int
+	LastTool    string
+	StartTime   time.Time
+}
+
 // Tick returns a command that ticks continuously for smooth updates
 func Tick() tea.Cmd {
 	return tea.Tick(time.Millisecond*16, func(t time.Time) tea.Msg {
@@ -15,6 +15,7 @@ const (
 	SelectionProviderMenu
 	SelectionHelpMenu
 	SelectionPermissionsMenu
+	SelectionCommandMenu // Items are slash commands to run
 )
 
 // SelectionItem represents an item in a selection list
@@ -120,6 +120,11 @@ var (
 	InputPlaceholderStyle = lipgloss.NewStyle().
 				Foreground(ColorTextMuted).
 				Italic(true)
+
+	AttachmentChipStyle = lipgloss.NewStyle().
+				Foreground(ColorCode).
+				Background(lipgloss.Color("#2D2D2D")).
+				Padding(0, 1)
 )
 
 // Message Styles
@@ -137,6 +142,11 @@ var (
 	SystemMessageStyle = lipgloss.NewStyle().
 				Foreground(ColorCloudy).
 				Italic(true)
+
+	// Model reasoning, shown dimmer than the answer
+	ThinkingStyle = lipgloss.NewStyle().
+			Foreground(ColorTextMuted).
+			Italic(true)
 )
 
 // Tool Execution Styles
@@ -176,6 +186,12 @@ var (
 
 	StatusIndicatorStyle = lipgloss.NewStyle().
 				Foreground(ColorCrail)
+
+	StatusPlanModeStyle = lipgloss.NewStyle().
+				Foreground(ColorCode)
+
+	StatusEditModeStyle = lipgloss.NewStyle().
+				Foreground(ColorSuccess)
 )
 
 // Permission Prompt Styles
@@ -322,20 +338,21 @@ var (
 
 // === ICONS ===
 const (
-	IconSuccess   = "✓"
-	IconError     = "✖"
-	IconWarning   = "⚠"
-	IconInfo      = "ℹ"
-	IconArrow     = "→"
-	IconBullet    = "•"
-	IconChevron   = "›"
-	IconCheck     = "✔"
-	IconCross     = "✘"
-	IconSpinner   = "◌"
-	IconSelected  = "▶"
+	IconSuccess    = "✓"
+	IconError      = "✖"
+	IconWarning    = "⚠"
+	IconInfo       = "ℹ"
+	IconArrow      = "→"
+	IconBullet     = "•"
+	IconChevron    = "›"
+	IconCheck      = "✔"
+	IconCross      = "✘"
+	IconSpinner    = "◌"
+	IconSelected   = "▶"
 	IconUnselected = " "
-	IconTokens    = "↓"
-	IconCost      = "$"
+	IconTokens     = "↓"
+	IconCost       = "$"
+	IconThinking   = "✻"
 )
 
 // === HELPER FUNCTIONS ===
@@ -381,13 +398,35 @@ func RenderToolStatus(icon, toolName string, isRunning bool) string {
 	return "  " + iconStyle.Render(icon) + " " + ToolNameStyle.Render(toolName)
 }
 
+// RenderModeIndicator renders the permission mode badge for the status line.
+// The default mode renders nothing.
+func RenderModeIndicator(mode string) string {
+	hint := TextMutedStyle.Render(" (shift+tab to cycle)")
+	switch mode {
+	case "plan":
+		return StatusPlanModeStyle.Render("⏸ plan mode on") + hint
+	case "acceptEdits":
+		return StatusEditModeStyle.Render("⏵⏵ accept edits on") + hint
+	case "ask":
+		return StatusTokenStyle.Render("? ask mode on") + hint
+	default:
+		return ""
+	}
+}
+
 // RenderStatusLine renders the bottom status line
-func RenderStatusLine(model string, tokens int, width int) string {
-	// Left side: model name
+func RenderStatusLine(model string, mode string, tokens int, cost float64, width int) string {
+	// Left side: model name and permission mode
 	modelPart := StatusModelStyle.Render(model)
+	if indicator := RenderModeIndicator(mode); indicator != "" {
+		modelPart += StatusSeparatorStyle.Render(" · ") + indicator
+	}
 
 	// Right side: token count
 	tokenPart := StatusTokenStyle.Render(fmt.Sprintf("%s %s", IconTokens, FormatTokenCount(tokens)))
+	if cost > 0 {
+		tokenPart += StatusSeparatorStyle.Render(" · ") + StatusTokenStyle.Render(fmt.Sprintf("%s%.2f", IconCost, cost))
+	}
 
 	// Calculate padding
 	leftWidth := lipgloss.Width(modelPart)
@@ -484,6 +523,7 @@ func RenderHelp() string {
 		{"Ctrl+J", "Insert newline"},
 		{"Ctrl+C", "Cancel/Quit"},
 		{"Ctrl+L", "Clear screen"},
+		{"Shift+Tab", "Cycle permission mode"},
 		{"Up/Down", "History / Scroll"},
 		{"PgUp/PgDn", "Scroll page"},
 	}
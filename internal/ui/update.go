@@ -14,10 +14,29 @@ type (
 		Content string
 	}
 
+	// StreamThinkingMsg contains streamed model reasoning
+	StreamThinkingMsg struct {
+		Content string
+	}
+
+	// RetryMsg reports that a failed request is being retried
+	RetryMsg struct {
+		Status string
+	}
+
+	// WarningMsg reports a problem that doesn't stop the turn
+	WarningMsg struct {
+		Content string
+	}
+
+	// MentionsUpdatedMsg signals that the @mention completions changed
+	MentionsUpdatedMsg struct{}
+
 	// StreamDoneMsg signals streaming is complete
 	StreamDoneMsg struct {
-		InputTokens  int
+		InputTokens  int // Session totals, including cached input
 		OutputTokens int
+		Cost         float64 // Session cost in USD
 	}
 
 	// StreamErrorMsg signals a streaming error
@@ -43,6 +62,22 @@ type (
 		Error error
 	}
 
+	// SystemMsg contains a notice to display, such as hook output
+	SystemMsg struct {
+		Content string
+	}
+
+	// CommandMenuMsg shows a menu whose item IDs are commands to run
+	CommandMenuMsg struct {
+		Title string
+		Items []SelectionItem
+	}
+
+	// BackgroundAgentsMsg lists the background agents still running
+	BackgroundAgentsMsg struct {
+		Agents []BackgroundAgentInfo
+	}
+
 	// ClearMsg signals to clear the screen
 	ClearMsg struct{}
 
@@ -111,7 +146,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, tea.Batch(cmds...)
 
+	case StreamThinkingMsg:
+		if !m.isStreaming {
+			m.SetStreaming(true)
+			cmds = append(cmds, Tick())
+		}
+		m.AppendThinking(msg.Content)
+		return m, tea.Batch(cmds...)
+
 	case StreamTextMsg:
+		if msg.Content != "" {
+			m.flushThinking()
+		}
 		m.AppendStreamContent(msg.Content)
 		// Keep ticking during streaming for smooth updates
 		if !m.isStreaming {
@@ -128,8 +174,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.state = StatePermissionPrompt
 		return m, nil
 
+	case PlanApprovalRequestMsg:
+		// Show plan approval prompt
+		m.planRequest = msg.Request
+		m.planChoice = PlanChoiceAcceptEdits
+		m.planFeedbackInput = false
+		m.state = StatePlanApproval
+		return m, nil
+
+	case PermissionModeMsg:
+		m.permissionMode = msg.Mode
+		return m, nil
+
 	case StreamDoneMsg:
 		// IMPORTANT: First stop streaming, THEN add message to avoid double rendering
+		m.flushThinking()
 		content := m.streamingContent
 		m.streamingContent = ""
 		m.SetStreaming(false)
@@ -139,9 +198,31 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.AddAssistantMessage(content)
 		}
 		m.UpdateTokens(msg.InputTokens, msg.OutputTokens)
+		m.cost = msg.Cost
+		return m, nil
+
+	case RetryMsg:
+		m.flushThinking()
+		m.AddWarningMessage(msg.Status)
+		return m, nil
+
+	case WarningMsg:
+		m.flushThinking()
+		m.AddWarningMessage(msg.Content)
+		return m, nil
+
+	case MentionsUpdatedMsg:
+		// Refilter the mention still being typed
+		if m.state == StateInput && m.completingMention {
+			if prefix, word, ok := currentMention(m.textarea.Value()); ok && !strings.Contains(word, "#") {
+				m.updateMentionSuggestions(prefix, word)
+				m.showingSuggestions = len(m.suggestions) > 0
+			}
+		}
 		return m, nil
 
 	case StreamErrorMsg:
+		m.flushThinking()
 		m.streamingContent = ""
 		m.SetStreaming(false)
 		m.AddErrorMessage(msg.Error.Error())
@@ -149,6 +230,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case ToolStartMsg:
 		// Show tool start with description (file path, command, etc.)
+		m.flushThinking()
 		m.AddToolMessage(msg.ToolName, msg.Description, false)
 		return m, m.spinner.Tick
 
@@ -173,6 +255,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.AddErrorMessage(msg.Error.Error())
 		return m, nil
 
+	case SystemMsg:
+		m.AddSystemMessage(msg.Content)
+		return m, nil
+
+	case CommandMenuMsg:
+		m.selection.Show(SelectionCommandMenu, msg.Title, msg.Items)
+		return m, nil
+
+	case BackgroundAgentsMsg:
+		m.backgroundAgents = msg.Agents
+		return m, nil
+
+	case clipboardImageMsg:
+		if msg.Error != nil {
+			m.AddErrorMessage("Couldn't paste image: " + msg.Error.Error())
+			return m, nil
+		}
+		m.attach(msg.Path)
+		return m, nil
+
 	case ClearMsg:
 		m.ClearMessages()
 		return m, nil
@@ -216,6 +318,11 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handlePermissionKeys(msg)
 	}
 
+	// Handle plan approval state
+	if m.state == StatePlanApproval {
+		return m.handlePlanApprovalKeys(msg)
+	}
+
 	// Handle error state
 	if m.state == StateError {
 		m.ClearError()
@@ -226,10 +333,17 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if m.state == StateProcessing || m.isStreaming {
 		switch msg.String() {
 		case "ctrl+c", "esc":
+			m.flushThinking()
 			m.streamingContent = ""
 			m.SetStreaming(false)
 			m.AddSystemMessage("Cancelled")
 			return m, nil
+		case "ctrl+t":
+			m.ToggleThinking()
+			return m, nil
+		case "shift+tab":
+			m.cyclePermissionMode()
+			return m, nil
 		case "up", "k":
 			m.viewport.LineUp(1)
 			return m, nil
@@ -246,16 +360,30 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if m.searchingHistory {
+		return m.handleHistorySearchKeys(msg)
+	}
+
 	// Handle vim mode
 	if m.vimMode && m.vimNormal {
 		return m.handleVimKeys(msg)
 	}
 
+	// Image files dropped or pasted into the terminal are attached rather
+	// than typed out
+	if msg.Type == tea.KeyRunes && (msg.Paste || len(msg.Runes) > 1) {
+		if paths := pastedImagePaths(string(msg.Runes)); len(paths) > 0 {
+			m.attach(paths...)
+			return m, nil
+		}
+	}
+
 	// Normal input mode
 	switch msg.String() {
 	case "ctrl+c":
-		if m.textarea.Value() != "" {
+		if m.textarea.Value() != "" || len(m.attachments) > 0 {
 			m.textarea.Reset()
+			m.detach(true)
 			m.showingSuggestions = false
 			return m, nil
 		}
@@ -276,6 +404,10 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.ClearMessages()
 		return m, nil
 
+	case "ctrl+t":
+		m.ToggleThinking()
+		return m, nil
+
 	case "ctrl+o":
 		m.verbose = !m.verbose
 		status := "off"
@@ -285,9 +417,27 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.AddSystemMessage("Verbose mode: " + status)
 		return m, nil
 
+	case "ctrl+v":
+		// The textarea pastes text; an image on the clipboard is attached
+		var cmd tea.Cmd
+		m.textarea, cmd = m.textarea.Update(msg)
+		return m, tea.Batch(cmd, pasteClipboardImage)
+
+	case "backspace":
+		if m.textarea.Value() == "" && len(m.attachments) > 0 {
+			m.detach(false)
+			return m, nil
+		}
+
 	case "enter":
 		input := strings.TrimSpace(m.textarea.Value())
-		if input == "" {
+		if input == "" && len(m.attachments) == 0 {
+			return m, nil
+		}
+
+		// Enter completes a mention instead of sending a partial one
+		if m.showingSuggestions && m.completingMention && len(m.suggestions) > 0 {
+			m.completeMention(m.suggestions[m.suggestionCursor])
 			return m, nil
 		}
 
@@ -346,29 +496,30 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 
-			case "cost":
-				m.AddSystemMessage("Token usage: " + FormatTokenCount(m.tokens) + " tokens")
-				return m, nil
-
-			case "compact":
-				m.AddSystemMessage("Conversation compacting not yet implemented")
-				return m, nil
-
 			default:
+				// Everything else goes to the app's command registry
+				if m.onSubmit != nil {
+					m.SetStreaming(true)
+					return m, tea.Batch(m.spinner.Tick, Tick(), m.onSubmit(input))
+				}
 				m.AddSystemMessage("Unknown command: /" + cmdName + " (use /help)")
 				return m, nil
 			}
 		}
 
+		// Attached images are shown under the text and sent as mentions
+		display := strings.Join(append([]string{input}, m.attachmentLabels()...), "\n")
+		input = m.withAttachments(input)
+		m.attachments = nil
+
 		// Add to history
-		m.history = append(m.history, input)
-		m.historyIndex = len(m.history)
+		m.addHistory(input)
 
 		// Clear input
 		m.textarea.Reset()
 
 		// Add user message to display
-		m.AddUserMessage(input)
+		m.AddUserMessage(strings.TrimSpace(display))
 
 		// Set processing state
 		m.SetStreaming(true)
@@ -384,14 +535,26 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 		return m, tea.Batch(cmds...)
 
+	case "ctrl+r":
+		m.startHistorySearch()
+		return m, nil
+
 	case "ctrl+j": // Insert newline
 		m.textarea.InsertString("\n")
 		return m, nil
 
+	case "shift+tab":
+		m.cyclePermissionMode()
+		return m, nil
+
 	case "tab":
 		// If showing inline suggestions, select the current one
 		if m.showingSuggestions && len(m.suggestions) > 0 {
 			selected := m.suggestions[m.suggestionCursor]
+			if m.completingMention {
+				m.completeMention(selected)
+				return m, nil
+			}
 			m.textarea.SetValue(selected.Label)
 			m.textarea.CursorEnd()
 			m.showingSuggestions = false
@@ -448,6 +611,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "esc":
 		if m.showingSuggestions {
 			m.showingSuggestions = false
+			m.completingMention = false
 			return m, nil
 		}
 		if m.vimMode {
@@ -469,11 +633,18 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	m.textarea, cmd = m.textarea.Update(msg)
 	cmds = append(cmds, cmd)
 
-	// Check if we should show suggestions (when typing slash commands)
+	// Check if we should show suggestions (when typing slash commands or
+	// an @mention)
 	input := m.textarea.Value()
 	if strings.HasPrefix(input, "/") && len(input) > 1 {
 		m.showingSuggestions = true
 		m.updateSuggestions(strings.TrimPrefix(input, "/"))
+	} else if prefix, word, ok := currentMention(input); ok && !strings.Contains(word, "#") {
+		m.updateMentionSuggestions(prefix, word)
+		m.showingSuggestions = len(m.suggestions) > 0
+		if m.refreshMentions != nil {
+			cmds = append(cmds, m.refreshMentions)
+		}
 	} else {
 		m.showingSuggestions = false
 	}
@@ -622,6 +793,102 @@ func (m Model) handlePermissionKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m Model) handlePlanApprovalKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Guard against nil plan request
+	if m.planRequest == nil {
+		m.state = StateInput
+		return m, nil
+	}
+
+	// If typing feedback to keep planning
+	if m.planFeedbackInput {
+		switch msg.String() {
+		case "enter":
+			feedback := m.textarea.Value()
+			m.textarea.Reset()
+			m.AddSystemMessage("Plan not approved - continuing to plan")
+			return m.respondToPlan(PlanApprovalResponse{Choice: PlanChoiceKeepPlanning, Feedback: feedback})
+		case "esc":
+			// Cancel feedback, go back to selection
+			m.planFeedbackInput = false
+			m.textarea.Reset()
+			return m, nil
+		default:
+			var cmd tea.Cmd
+			m.textarea, cmd = m.textarea.Update(msg)
+			return m, cmd
+		}
+	}
+
+	switch strings.ToLower(msg.String()) {
+	case "1", "y":
+		m.AddSystemMessage("Plan approved - auto-accepting edits")
+		return m.respondToPlan(PlanApprovalResponse{Choice: PlanChoiceAcceptEdits})
+
+	case "2":
+		m.AddSystemMessage("Plan approved - edits will ask for permission")
+		return m.respondToPlan(PlanApprovalResponse{Choice: PlanChoiceAskEdits})
+
+	case "3", "n":
+		m.planChoice = PlanChoiceKeepPlanning
+		m.planFeedbackInput = true
+		m.textarea.Focus()
+		m.textarea.SetValue("")
+		return m, nil
+
+	case "up", "k":
+		if m.planChoice > PlanChoiceAcceptEdits {
+			m.planChoice--
+		}
+		return m, nil
+
+	case "down", "j":
+		if m.planChoice < PlanChoiceKeepPlanning {
+			m.planChoice++
+		}
+		return m, nil
+
+	case "enter":
+		switch m.planChoice {
+		case PlanChoiceAcceptEdits:
+			m.AddSystemMessage("Plan approved - auto-accepting edits")
+		case PlanChoiceAskEdits:
+			m.AddSystemMessage("Plan approved - edits will ask for permission")
+		case PlanChoiceKeepPlanning:
+			m.planFeedbackInput = true
+			m.textarea.Focus()
+			m.textarea.SetValue("")
+			return m, nil
+		}
+		return m.respondToPlan(PlanApprovalResponse{Choice: m.planChoice})
+
+	case "ctrl+c", "esc":
+		m.AddSystemMessage("Plan not approved - continuing to plan")
+		return m.respondToPlan(PlanApprovalResponse{Choice: PlanChoiceKeepPlanning})
+	}
+
+	return m, nil
+}
+
+// respondToPlan sends the plan decision and returns to processing
+func (m Model) respondToPlan(resp PlanApprovalResponse) (tea.Model, tea.Cmd) {
+	if m.onPlanApproval != nil {
+		m.onPlanApproval(resp)
+	}
+	m.planRequest = nil
+	m.planChoice = PlanChoiceAcceptEdits
+	m.planFeedbackInput = false
+	m.state = StateProcessing
+	return m, nil
+}
+
+// cyclePermissionMode switches to the next permission mode
+func (m *Model) cyclePermissionMode() {
+	if m.onModeCycle != nil {
+		m.permissionMode = m.onModeCycle()
+	}
+}
+
 func (m Model) handleSelectionKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "up", "k":
@@ -653,6 +920,12 @@ func (m Model) handleSelectionKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				}
 				m.AddSystemMessage("Provider set to: " + item.Label)
 
+			case SelectionCommandMenu:
+				if m.onSubmit != nil {
+					m.SetStreaming(true)
+					return m, tea.Batch(m.spinner.Tick, Tick(), m.onSubmit(item.ID))
+				}
+
 			case SelectionHelpMenu:
 				// Clear the textarea first
 				m.textarea.Reset()
@@ -682,16 +955,17 @@ func (m Model) handleSelectionKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					} else {
 						m.AddSystemMessage("Verbose mode disabled")
 					}
-				case "cost":
-					m.AddSystemMessage("Token usage: " + FormatTokenCount(m.tokens) + " tokens")
-				case "compact":
-					m.AddSystemMessage("Conversation compacting not yet implemented")
 				case "exit":
 					if m.onQuit != nil {
 						m.onQuit()
 					}
 					return m, tea.Quit
 				default:
+					// Everything else goes to the app's command registry
+					if m.onSubmit != nil {
+						m.SetStreaming(true)
+						return m, tea.Batch(m.spinner.Tick, Tick(), m.onSubmit("/"+item.ID))
+					}
 					m.AddSystemMessage("Command not yet implemented: " + item.ID)
 				}
 			}
@@ -853,3 +1127,13 @@ func SendQuit() tea.Cmd {
 		return QuitMsg{}
 	}
 }
+
+// currentMention returns the @mention at the end of the input, without the
+// @, and the text before it
+func currentMention(input string) (prefix, word string, ok bool) {
+	start := strings.LastIndexAny(input, " \t\n") + 1
+	if !strings.HasPrefix(input[start:], "@") {
+		return "", "", false
+	}
+	return input[:start], input[start+1:], true
+}
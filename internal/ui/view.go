@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -16,6 +17,12 @@ func (m Model) View() string {
 	// Calculate fixed element heights
 	headerHeight := 2
 	inputHeight := 3
+	if len(m.attachments) > 0 {
+		inputHeight++
+	}
+	if m.searchingHistory {
+		inputHeight += lipgloss.Height(m.renderHistorySearch()) - 1
+	}
 	statusHeight := 1
 
 	// For welcome screen - compact layout, input follows content naturally
@@ -40,8 +47,10 @@ func (m Model) View() string {
 		var prompt string
 		if m.state == StateProcessing || m.isStreaming {
 			prompt = RenderSpinnerWithVerb(m.spinner.View(), m.GetCurrentVerb())
+		} else if m.searchingHistory {
+			prompt = m.renderHistorySearch()
 		} else {
-			prompt = InputPromptStyle.Render("> ") + m.textarea.View()
+			prompt = m.renderAttachments() + InputPromptStyle.Render("> ") + m.textarea.View()
 		}
 		inputBlock := lipgloss.JoinVertical(lipgloss.Left,
 			borderLine,
@@ -71,6 +80,14 @@ func (m Model) View() string {
 	if m.state == StatePermissionPrompt && m.permissionRequest != nil {
 		overlayHeight = 12
 	}
+	if m.state == StatePlanApproval && m.planRequest != nil {
+		overlayHeight = lipgloss.Height(m.renderPlanApproval())
+	}
+
+	agentsPanel := m.renderAgentsPanel()
+	if agentsPanel != "" {
+		overlayHeight += lipgloss.Height(agentsPanel)
+	}
 
 	availableHeight := m.height - headerHeight - inputHeight - statusHeight - overlayHeight
 	if availableHeight < 5 {
@@ -98,6 +115,10 @@ func (m Model) View() string {
 		sections = append(sections, m.renderPermissionPrompt())
 	}
 
+	if m.state == StatePlanApproval && m.planRequest != nil {
+		sections = append(sections, m.renderPlanApproval())
+	}
+
 	if m.state == StateError && m.errorMsg != "" {
 		sections = append(sections, m.renderError())
 	}
@@ -110,6 +131,10 @@ func (m Model) View() string {
 		sections = append(sections, m.selection.View(m.width))
 	}
 
+	if agentsPanel != "" {
+		sections = append(sections, agentsPanel)
+	}
+
 	// 4. Input Area
 	sections = append(sections, m.renderInput())
 
@@ -153,11 +178,15 @@ func (m Model) renderSuggestions() string {
 		return ""
 	}
 
+	// Show five at a time, keeping the cursor in view
+	first := 0
+	if m.suggestionCursor >= 5 {
+		first = m.suggestionCursor - 4
+	}
+
 	var parts []string
-	for i, s := range m.suggestions {
-		if i >= 5 {
-			break
-		}
+	for i := first; i < len(m.suggestions) && i < first+5; i++ {
+		s := m.suggestions[i]
 		if i == m.suggestionCursor {
 			parts = append(parts, SelectionSelectedStyle.Render(s.Label))
 		} else {
@@ -183,7 +212,13 @@ func (m Model) renderPermissionPrompt() string {
 	content.WriteString("\n\n")
 
 	// Tool & Target
-	content.WriteString(TextPrimaryStyle.Render("OSCode wants to run "))
+	if req.Agent != "" {
+		content.WriteString(TextPrimaryStyle.Render("OSCode's "))
+		content.WriteString(ToolNameStyle.Render(req.Agent))
+		content.WriteString(TextPrimaryStyle.Render(" agent wants to run "))
+	} else {
+		content.WriteString(TextPrimaryStyle.Render("OSCode wants to run "))
+	}
 	content.WriteString(PermissionToolStyle.Render(req.Tool))
 
 	if req.FilePath != "" {
@@ -231,6 +266,58 @@ func (m Model) renderPermissionPrompt() string {
 	return boxStyle.Render(content.String())
 }
 
+func (m Model) renderPlanApproval() string {
+	req := m.planRequest
+	if req == nil {
+		return ""
+	}
+
+	var content strings.Builder
+
+	content.WriteString(PermissionTitleStyle.Render("📋 Ready to code?"))
+	content.WriteString("\n\n")
+	content.WriteString(TextPrimaryStyle.Render("Here is OSCode's plan:"))
+	content.WriteString("\n\n")
+
+	// Keep the plan to at most half the screen so the options stay visible
+	plan := strings.TrimRight(RenderMarkdown(req.Plan, m.width-8), "\n")
+	lines := strings.Split(plan, "\n")
+	maxLines := m.height / 2
+	if maxLines < 5 {
+		maxLines = 5
+	}
+	if len(lines) > maxLines {
+		remaining := len(lines) - maxLines
+		lines = append(lines[:maxLines], TextMutedStyle.Render(fmt.Sprintf("  ... %d more lines", remaining)))
+	}
+	content.WriteString(strings.Join(lines, "\n"))
+	content.WriteString("\n\n")
+
+	options := []struct {
+		key   string
+		label string
+		desc  string
+	}{
+		{"1", "Yes", "Approve and auto-accept edits"},
+		{"2", "Yes", "Approve, but ask before each edit"},
+		{"3", "No", "Keep planning"},
+	}
+
+	for i, opt := range options {
+		content.WriteString(RenderPermissionOption(opt.key, opt.label, opt.desc, PlanChoice(i) == m.planChoice))
+		content.WriteString("\n")
+	}
+
+	if m.planFeedbackInput {
+		content.WriteString("\n")
+		content.WriteString(TextMutedStyle.Render("Tell OSCode what to change: "))
+		content.WriteString(m.textarea.View())
+	}
+
+	boxStyle := PermissionBoxStyle.Width(m.width - 4)
+	return boxStyle.Render(content.String())
+}
+
 func (m Model) renderUnifiedDiff(oldContent, newContent string) string {
 	var result strings.Builder
 
@@ -294,6 +381,28 @@ func (m Model) renderNewContent(content string) string {
 	return result.String()
 }
 
+// renderAgentsPanel lists running background agents, or returns "" when
+// there are none
+func (m Model) renderAgentsPanel() string {
+	if len(m.backgroundAgents) == 0 {
+		return ""
+	}
+
+	lines := []string{TextMutedStyle.Render(fmt.Sprintf("  Background agents (%d running)", len(m.backgroundAgents)))}
+	for _, agent := range m.backgroundAgents {
+		progress := fmt.Sprintf("%d tool calls · %s", agent.ToolCalls, time.Since(agent.StartTime).Round(time.Second))
+		if agent.LastTool != "" {
+			progress = agent.LastTool + " · " + progress
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s %s %s",
+			ToolSpinnerStyle.Render("◐"),
+			ToolNameStyle.Render(agent.ID),
+			TextSecondaryStyle.Render(agent.Type+": "+agent.Description),
+			TextCloudyStyle.Render("("+progress+")")))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (m Model) renderError() string {
 	errorBox := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
@@ -321,12 +430,15 @@ func (m Model) renderInput() string {
 		// Sparkle spinner with dynamic verb
 		verb := m.GetCurrentVerb()
 		prompt = RenderSpinnerWithVerb(m.spinner.View(), verb)
-	} else if m.state == StatePermissionPrompt && m.rejectingWithInput {
+	} else if (m.state == StatePermissionPrompt && m.rejectingWithInput) ||
+		(m.state == StatePlanApproval && m.planFeedbackInput) {
 		// In feedback mode, show the textarea
 		prompt = InputPromptStyle.Render("> ") + m.textarea.View()
+	} else if m.searchingHistory {
+		prompt = m.renderHistorySearch()
 	} else {
 		// Normal input mode with Crail-colored prompt
-		prompt = InputPromptStyle.Render("> ") + m.textarea.View()
+		prompt = m.renderAttachments() + InputPromptStyle.Render("> ") + m.textarea.View()
 	}
 
 	inputContent := inputStyle.Render(prompt)
@@ -359,7 +471,7 @@ func (m Model) renderStatusBar() string {
 		modelDisplay = strings.ToUpper(modelDisplay)
 	}
 
-	return RenderStatusLine(modelDisplay, m.tokens, m.width)
+	return RenderStatusLine(modelDisplay, m.permissionMode, m.tokens, m.cost, m.width)
 }
 
 // formatTokenCount formats tokens for display - re-export for usage
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ClipboardImageDir is where images pasted from the clipboard are saved
+func ClipboardImageDir() string {
+	return filepath.Join(os.TempDir(), "oscode")
+}
+
+// IsClipboardImage reports whether path is an image saved by ClipboardImage
+// in ClipboardImageDir
+func IsClipboardImage(path string) bool {
+	return filepath.Dir(path) == ClipboardImageDir() &&
+		strings.HasPrefix(filepath.Base(path), "clipboard-") && filepath.Ext(path) == ".png"
+}
+
+// RemoveClipboardImage deletes a pasted image once it's no longer needed.
+// Other files are left alone.
+func RemoveClipboardImage(path string) {
+	if IsClipboardImage(path) {
+		os.Remove(path)
+	}
+}
+
+// RemoveStaleClipboardImages deletes pasted images older than maxAge, left
+// by sessions that exited before sending them
+func RemoveStaleClipboardImages(maxAge time.Duration) {
+	paths, _ := filepath.Glob(filepath.Join(ClipboardImageDir(), "clipboard-*.png"))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(path)
+		}
+	}
+}
+
+// ClipboardImage saves the image on the system clipboard as a PNG file in
+// dir and returns its path. The path is empty when the clipboard holds no
+// image or there's no tool to read it with.
+func ClipboardImage(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("clipboard-%d.png", time.Now().UnixNano()))
+
+	var data []byte
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("pngpaste"); err == nil {
+			if exec.Command("pngpaste", path).Run() != nil {
+				return "", nil
+			}
+			return path, nil
+		}
+		script := []string{
+			"-e", "set png to (the clipboard as «class PNGf»)",
+			"-e", fmt.Sprintf("set f to open for access POSIX file %q with write permission", path),
+			"-e", "write png to f",
+			"-e", "close access f",
+		}
+		if exec.Command("osascript", script...).Run() != nil {
+			os.Remove(path)
+			return "", nil
+		}
+		return path, nil
+
+	case "windows":
+		script := fmt.Sprintf("Add-Type -AssemblyName System.Windows.Forms; "+
+			"$img = [System.Windows.Forms.Clipboard]::GetImage(); "+
+			"if ($img) { $img.Save('%s', [System.Drawing.Imaging.ImageFormat]::Png) }", path)
+		exec.Command("powershell", "-NoProfile", "-Command", script).Run()
+		if _, err := os.Stat(path); err != nil {
+			return "", nil
+		}
+		return path, nil
+
+	default:
+		// Wayland first, then X11
+		if _, err := exec.LookPath("wl-paste"); err == nil && os.Getenv("WAYLAND_DISPLAY") != "" {
+			types, err := exec.Command("wl-paste", "--list-types").Output()
+			if err != nil || !strings.Contains(string(types), "image/png") {
+				return "", nil
+			}
+			data, err = exec.Command("wl-paste", "--type", "image/png").Output()
+			if err != nil {
+				return "", nil
+			}
+		} else if _, err := exec.LookPath("xclip"); err == nil {
+			targets, err := exec.Command("xclip", "-selection", "clipboard", "-t", "TARGETS", "-o").Output()
+			if err != nil || !strings.Contains(string(targets), "image/png") {
+				return "", nil
+			}
+			data, err = exec.Command("xclip", "-selection", "clipboard", "-t", "image/png", "-o").Output()
+			if err != nil {
+				return "", nil
+			}
+		}
+	}
+
+	if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return "", nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}